@@ -0,0 +1,118 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AIChatBackendSpec defines the desired state of AIChatBackend.
+type AIChatBackendSpec struct {
+	// OllamaImageTag overrides the ollamaImageTag of the operator config map for the pool.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[\w][\w.-]{0,127}$`
+	OllamaImageTag string `json:"ollamaImageTag,omitempty"`
+
+	// StorageSize is the size of the volume holding the models of every workspace using the
+	// backend. Defaults to 50Gi.
+	// +optional
+	StorageSize *resource.Quantity `json:"storageSize,omitempty"`
+
+	// Resources of the Ollama container, e.g. the GPUs of the pool.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NumParallel is the number of requests each loaded model serves at the same time
+	// (OLLAMA_NUM_PARALLEL). Defaults to the Ollama default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	NumParallel *int32 `json:"numParallel,omitempty"`
+
+	// MaxLoadedModels is the number of models loaded at the same time
+	// (OLLAMA_MAX_LOADED_MODELS). Defaults to the Ollama default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxLoadedModels *int32 `json:"maxLoadedModels,omitempty"`
+
+	// AllowedNamespaces lists the namespaces, other than the one of the AIChatBackend, whose
+	// AIChatWorkspaces can use the backend.
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+// AIChatBackendStatus defines the observed state of AIChatBackend.
+type AIChatBackendStatus struct {
+	// URL is the in-cluster URL of the Ollama API of the pool.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Workspaces is the number of AIChatWorkspaces using the backend.
+	// +optional
+	Workspaces int32 `json:"workspaces,omitempty"`
+
+	// Models lists the models installed for the workspaces, with the workspaces referencing
+	// them. A model is deleted from the pool once no workspace references it.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Models []BackendModelStatus `json:"models,omitempty"`
+
+	// Represents the observations of a AIChatBackend's current state.
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+// BackendModelStatus is a model of the pool and the workspaces referencing it.
+type BackendModelStatus struct {
+	// Name is the model name as served by Ollama, with its tag.
+	Name string `json:"name"`
+
+	// Workspaces are the <namespace>/<name> of the AIChatWorkspaces listing the model, or an
+	// alias of it, in spec.models.
+	// +optional
+	Workspaces []string `json:"workspaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Workspaces",type=integer,JSONPath=`.status.workspaces`
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// AIChatBackend is the Schema for the aichatbackends API. It runs an Ollama instance shared by
+// the AIChatWorkspaces in shared backend mode.
+type AIChatBackend struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AIChatBackendSpec   `json:"spec,omitempty"`
+	Status AIChatBackendStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AIChatBackendList contains a list of AIChatBackend.
+type AIChatBackendList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AIChatBackend `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AIChatBackend{}, &AIChatBackendList{})
+}
@@ -21,6 +21,10 @@ import (
 )
 
 // AIChatWorkspaceSpec defines the desired state of AIChatWorkspace.
+// +kubebuilder:validation:XValidation:rule="!has(self.patternDelivery) || self.patternDelivery == 'Modelfile' || has(self.bootstrap)",message="the Prompts and ModelPresets pattern deliveries require bootstrap, they are published with the Open WebUI admin"
+// +kubebuilder:validation:XValidation:rule="!has(self.members) || has(self.bootstrap)",message="members require bootstrap, they are managed with the Open WebUI admin"
+// +kubebuilder:validation:XValidation:rule="!has(self.bootstrap) || !has(self.bootstrap.signup) || self.bootstrap.signup != 'Enabled' || !has(self.auth) || !has(self.auth.oidc) || !has(self.auth.oidc.disableLocalSignup) || !self.auth.oidc.disableLocalSignup",message="bootstrap.signup can't be Enabled with auth.oidc.disableLocalSignup"
+// +kubebuilder:validation:XValidation:rule="!has(self.backend) || self.backend.mode != 'shared' || !has(self.api)",message="api is not supported with a shared backend, the workspace has no Ollama API of its own"
 type AIChatWorkspaceSpec struct {
 	// The name of the workspace.
 	// +kubebuilder:validation:Required
@@ -31,11 +35,274 @@ type AIChatWorkspaceSpec struct {
 	WorkspaceEnv string `json:"workspaceENV"`
 
 	// List of default models for this workspace.
-	Models []string `json:"models"`
+	// Each model is either a name, optionally pinned to a manifest digest with
+	// <name>@sha256:<digest>, or an object setting its source, digest, alias and defaults.
+	Models []ModelSpec `json:"models"`
+
+	// ModelUpdatePolicy controls whether models are pulled again when their tag moves upstream.
+	// When omitted models are never updated once pulled.
+	// +optional
+	ModelUpdatePolicy *ModelUpdatePolicy `json:"modelUpdatePolicy,omitempty"`
 
 	// List of patterns
 	// https://github.com/danielmiessler/fabric/tree/main/patterns
 	Patterns []string `json:"patterns,omitempty"`
+
+	// PatternDelivery selects how the patterns are offered in Open WebUI. Modelfile creates an
+	// Ollama model <model>-<pattern> for every model and pattern. Prompts publishes a /<pattern>
+	// prompt, and ModelPresets an Open WebUI model preset fabric-<pattern> on the first model of
+	// spec.models. Prompts and ModelPresets require bootstrap, they are published by the admin.
+	// +kubebuilder:default:=Modelfile
+	// +optional
+	PatternDelivery PatternDelivery `json:"patternDelivery,omitempty"`
+
+	// Backend selects the Ollama instance serving the workspace.
+	// When omitted the workspace runs a dedicated Ollama StatefulSet.
+	// +optional
+	Backend *BackendSpec `json:"backend,omitempty"`
+
+	// Providers lists external OpenAI-compatible APIs offered in Open WebUI next to the models
+	// of the workspace.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=16
+	Providers []ProviderSpec `json:"providers,omitempty"`
+
+	// Auth configures how users sign in to Open WebUI.
+	// When omitted users sign up with a local account.
+	// +optional
+	Auth *AuthSpec `json:"auth,omitempty"`
+
+	// Bootstrap creates the Open WebUI admin and applies the default settings, with the models
+	// of spec.models selected by default.
+	// When omitted the first user signing up becomes the admin.
+	// +optional
+	Bootstrap *BootstrapSpec `json:"bootstrap,omitempty"`
+
+	// Members are the Open WebUI accounts of the workspace, with their role and group. The
+	// accounts of the removed members are deactivated. Requires bootstrap, the members are
+	// managed with the admin account.
+	// +optional
+	// +listType=map
+	// +listMapKey=email
+	// +kubebuilder:validation:MaxItems=500
+	Members []MemberSpec `json:"members,omitempty"`
+
+	// Owners are the Kubernetes users and groups owning the workspace. They can read and debug
+	// the workloads of the workspace namespace, and edit this AIChatWorkspace. Once set, only
+	// the owners can change or delete the AIChatWorkspace.
+	// +optional
+	Owners *OwnersSpec `json:"owners,omitempty"`
+
+	// Routing selects how the Open WebUI and Ollama hosts are exposed outside the cluster.
+	// When omitted the operator-wide routingMode from the config map is used.
+	// +optional
+	Routing *RoutingSpec `json:"routing,omitempty"`
+
+	// API configures how the Ollama API of the workspace is exposed.
+	// When omitted the API is only reachable from inside the cluster.
+	// +optional
+	API *APISpec `json:"api,omitempty"`
+
+	// Profile selects a named set of configuration keys from the profiles key of the
+	// operator config map, applied on top of the operator-wide configuration.
+	// +optional
+	Profile string `json:"profile,omitempty"`
+
+	// Overrides sets individual configuration keys for this workspace, on top of the
+	// operator-wide configuration and the selected profile.
+	// +optional
+	// +kubebuilder:validation:MaxProperties=13
+	// +kubebuilder:validation:XValidation:rule="self.all(k, k in ['defaultDomain', 'openwebUIImageTag', 'ollamaImageTag', 'llamaCppImageTag', 'routingMode', 'gatewayName', 'gatewayNamespace', 'gatewaySectionName', 'ingressClassName', 'ingressAnnotations', 'httpsProxy', 'noProxy', 'caBundle'])",message="only defaultDomain, openwebUIImageTag, ollamaImageTag, llamaCppImageTag, routingMode, gatewayName, gatewayNamespace, gatewaySectionName, ingressClassName, ingressAnnotations, httpsProxy, noProxy and caBundle can be overridden"
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// ModelUpdatePolicyType selects when pulled models are updated.
+// +kubebuilder:validation:Enum=Never;OnTagChange
+type ModelUpdatePolicyType string
+
+const (
+	// ModelUpdatePolicyNever keeps the pulled models until they are removed from spec.models.
+	ModelUpdatePolicyNever ModelUpdatePolicyType = "Never"
+
+	// ModelUpdatePolicyOnTagChange pulls a model again when the manifest digest of its tag
+	// changes in the registry. Models pinned to a digest are never updated.
+	ModelUpdatePolicyOnTagChange ModelUpdatePolicyType = "OnTagChange"
+)
+
+// ModelUpdatePolicy defines how the pulled models are kept up to date.
+type ModelUpdatePolicy struct {
+	// Type is either Never or OnTagChange.
+	// +kubebuilder:default:=Never
+	// +optional
+	Type ModelUpdatePolicyType `json:"type,omitempty"`
+
+	// CheckInterval is how often the registry is asked for the digest of the model tags
+	// when Type is OnTagChange. Defaults to 24h, intervals under 10m are raised to 10m.
+	// +optional
+	CheckInterval *metav1.Duration `json:"checkInterval,omitempty"`
+}
+
+// BackendMode selects whether a workspace runs its own Ollama or uses a shared one.
+// +kubebuilder:validation:Enum=dedicated;shared
+type BackendMode string
+
+const (
+	// BackendModeDedicated runs an Ollama StatefulSet in the workspace namespace.
+	BackendModeDedicated BackendMode = "dedicated"
+
+	// BackendModeShared points Open WebUI at the Ollama pool of an AIChatBackend. Only
+	// Open WebUI and its volume are created in the workspace namespace.
+	BackendModeShared BackendMode = "shared"
+)
+
+// BackendEngine selects the inference server of a workspace.
+// +kubebuilder:validation:Enum=ollama;llamacpp
+type BackendEngine string
+
+const (
+	// BackendEngineOllama runs Ollama, which installs the models of spec.models at runtime.
+	BackendEngineOllama BackendEngine = "ollama"
+
+	// BackendEngineLlamaCpp runs the CPU llama.cpp server. It serves the single model of
+	// spec.models, from a Hugging Face, URL or PVC source, through its OpenAI-compatible API.
+	BackendEngineLlamaCpp BackendEngine = "llamacpp"
+)
+
+// BackendSpec defines the inference server serving the workspace.
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'shared' || has(self.backendRef)",message="shared mode requires backendRef"
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'shared' || !has(self.engine) || self.engine == 'ollama'",message="shared mode requires the ollama engine"
+type BackendSpec struct {
+	// Mode is either dedicated or shared.
+	// +kubebuilder:default:=dedicated
+	// +optional
+	Mode BackendMode `json:"mode,omitempty"`
+
+	// Engine is the inference server of a dedicated backend, ollama or llamacpp.
+	// +kubebuilder:default:=ollama
+	// +optional
+	Engine BackendEngine `json:"engine,omitempty"`
+
+	// BackendRef is the AIChatBackend serving the workspace in shared mode.
+	// +optional
+	BackendRef *BackendReference `json:"backendRef,omitempty"`
+}
+
+// BackendReference identifies an AIChatBackend.
+type BackendReference struct {
+	// Name of the AIChatBackend.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the AIChatBackend. Defaults to the namespace of the AIChatWorkspace.
+	// Other namespaces must list the namespace of the workspace in spec.allowedNamespaces.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RoutingMode is the kind of object used to expose the workspace hosts.
+// +kubebuilder:validation:Enum=Ingress;GatewayAPI
+type RoutingMode string
+
+const (
+	// RoutingModeIngress exposes the workspace with networking.k8s.io/v1 Ingresses.
+	RoutingModeIngress RoutingMode = "Ingress"
+
+	// RoutingModeGatewayAPI exposes the workspace with gateway.networking.k8s.io/v1 HTTPRoutes.
+	RoutingModeGatewayAPI RoutingMode = "GatewayAPI"
+)
+
+// RoutingSpec defines how the workspace hosts are exposed.
+type RoutingSpec struct {
+	// Mode is either Ingress or GatewayAPI.
+	// +optional
+	Mode RoutingMode `json:"mode,omitempty"`
+
+	// ParentRef is the Gateway the HTTPRoutes attach to when Mode is GatewayAPI.
+	// When omitted the gateway configured for the operator is used.
+	// +optional
+	ParentRef *GatewayParentRef `json:"parentRef,omitempty"`
+}
+
+// GatewayParentRef identifies the Gateway (and optionally the listener) an HTTPRoute attaches to.
+type GatewayParentRef struct {
+	// Name of the Gateway.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the Gateway.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName is the listener name on the Gateway.
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// APIExposure controls who can reach the Ollama API of a workspace.
+// +kubebuilder:validation:Enum=none;internal;public
+type APIExposure string
+
+const (
+	// APIExposureNone only allows pods in the workspace namespace to reach the Ollama API.
+	APIExposureNone APIExposure = "none"
+
+	// APIExposureInternal allows any pod in the cluster to reach the Ollama API through its Service.
+	APIExposureInternal APIExposure = "internal"
+
+	// APIExposurePublic publishes the Ollama API on <workspaceName>-api.<defaultDomain> behind authentication.
+	APIExposurePublic APIExposure = "public"
+)
+
+// APISpec defines how the Ollama API is exposed.
+// +kubebuilder:validation:XValidation:rule="!has(self.exposure) || self.exposure != 'public' || has(self.auth)",message="public exposure requires auth"
+type APISpec struct {
+	// Exposure is one of none, internal or public.
+	// +kubebuilder:default:=internal
+	// +optional
+	Exposure APIExposure `json:"exposure,omitempty"`
+
+	// Auth protects the published API. Required when Exposure is public.
+	// +optional
+	Auth *APIAuthSpec `json:"auth,omitempty"`
+}
+
+// APIAuthMode is the authentication applied in front of a public Ollama API.
+// +kubebuilder:validation:Enum=BasicAuth;APIKey
+type APIAuthMode string
+
+const (
+	// APIAuthModeBasicAuth protects the API with ingress-nginx basic authentication.
+	APIAuthModeBasicAuth APIAuthMode = "BasicAuth"
+
+	// APIAuthModeAPIKey puts the operator API gateway in front of Ollama. It validates
+	// bearer API keys and only forwards the inference endpoints.
+	APIAuthModeAPIKey APIAuthMode = "APIKey"
+)
+
+// APIAuthSpec defines the authentication for a public Ollama API.
+// +kubebuilder:validation:XValidation:rule="self.mode != 'BasicAuth' || has(self.secretName)",message="BasicAuth requires secretName"
+type APIAuthSpec struct {
+	// Mode selects the authentication mechanism.
+	// +kubebuilder:validation:Required
+	Mode APIAuthMode `json:"mode"`
+
+	// SecretName is a Secret in the namespace of the AIChatWorkspace holding the credentials.
+	// For BasicAuth it must contain an htpasswd formatted "auth" key.
+	// For APIKey it is the Secret the generated key is written to, <workspaceName>-api-key by default.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// AllowedPaths overrides the Ollama API paths the APIKey gateway forwards.
+	// Defaults to the chat, generate, embeddings and model listing endpoints.
+	// +optional
+	AllowedPaths []string `json:"allowedPaths,omitempty"`
+
+	// AllowedKeyNamespaces lists the namespaces, other than the one of the AIChatWorkspace,
+	// where AIChatWorkspaceAPIKeys for this workspace can be created.
+	// +optional
+	AllowedKeyNamespaces []string `json:"allowedKeyNamespaces,omitempty"`
 }
 
 // AIChatWorkspaceStatus defines the observed state of AIChatWorkspace.
@@ -52,6 +319,119 @@ type AIChatWorkspaceStatus struct {
 	// For further information see: https://github.com/kubernetes/community/blob/master/contributors/devel/sig-architecture/api-conventions.md#typical-status-properties
 
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// Usage summarises the token usage of the workspace API over the last 24 hours.
+	// Only reported when the APIKey gateway is enabled.
+	// +optional
+	Usage *UsageStatus `json:"usage,omitempty"`
+
+	// Models reports the models of spec.models installed in the workspace.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Models []ModelStatus `json:"models,omitempty"`
+
+	// Providers reports the connectivity check of spec.providers.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Providers []ProviderStatus `json:"providers,omitempty"`
+
+	// Members reports the sync state of spec.members and of the deactivated members.
+	// +optional
+	// +listType=map
+	// +listMapKey=email
+	Members []MemberStatus `json:"members,omitempty"`
+}
+
+// PatternDelivery selects how the fabric patterns of a workspace are offered in Open WebUI.
+// +kubebuilder:validation:Enum=Modelfile;Prompts;ModelPresets
+type PatternDelivery string
+
+const (
+	// PatternDeliveryModelfile creates an Ollama model with the pattern as SYSTEM prompt for
+	// every model and pattern.
+	PatternDeliveryModelfile PatternDelivery = "Modelfile"
+
+	// PatternDeliveryPrompts publishes every pattern as an Open WebUI prompt, used with /<pattern>.
+	PatternDeliveryPrompts PatternDelivery = "Prompts"
+
+	// PatternDeliveryModelPresets publishes every pattern as an Open WebUI model preset with the
+	// pattern as system prompt.
+	PatternDeliveryModelPresets PatternDelivery = "ModelPresets"
+)
+
+// ModelState is the state of a model of the workspace.
+type ModelState string
+
+const (
+	// ModelStateInstalled means the model is installed and matches its pinned digest, if any.
+	ModelStateInstalled ModelState = "Installed"
+
+	// ModelStateMissing means the model is not installed, e.g. its pull failed.
+	ModelStateMissing ModelState = "Missing"
+
+	// ModelStateDigestMismatch means the installed model does not match its pinned digest.
+	ModelStateDigestMismatch ModelState = "DigestMismatch"
+
+	// ModelStateImporting means the model is being imported from a PersistentVolumeClaim.
+	ModelStateImporting ModelState = "Importing"
+)
+
+// ModelStatus is the installed version of a model of the workspace.
+type ModelStatus struct {
+	// Name is the model name, without the pinned digest.
+	Name string `json:"name"`
+
+	// Digest is the manifest digest of the installed model, as listed by Ollama.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// PinnedDigest is the digest the model is pinned to in spec.models.
+	// +optional
+	PinnedDigest string `json:"pinnedDigest,omitempty"`
+
+	// State is one of Installed, Missing, DigestMismatch or Importing.
+	State ModelState `json:"state"`
+
+	// AliasHash identifies the model digest and parameters the alias of the model was created
+	// from. The alias is created again when they change.
+	// +optional
+	AliasHash string `json:"aliasHash,omitempty"`
+
+	// LastUpdateCheck is the last time the registry was asked for the digest of the model tag.
+	// +optional
+	LastUpdateCheck *metav1.Time `json:"lastUpdateCheck,omitempty"`
+}
+
+// UsageStatus is the token usage of the workspace API metered by the API gateway.
+type UsageStatus struct {
+	// Window is the period the usage covers.
+	Window string `json:"window"`
+
+	// Requests is the number of metered requests.
+	Requests int64 `json:"requests"`
+
+	// PromptTokens is the number of prompt tokens evaluated.
+	PromptTokens int64 `json:"promptTokens"`
+
+	// CompletionTokens is the number of tokens generated.
+	CompletionTokens int64 `json:"completionTokens"`
+
+	// Models breaks the usage down by model.
+	// +optional
+	Models []ModelUsageStatus `json:"models,omitempty"`
+
+	// LastUpdated is the last time the usage changed.
+	LastUpdated metav1.Time `json:"lastUpdated"`
+}
+
+// ModelUsageStatus is the token usage of one model.
+type ModelUsageStatus struct {
+	Model            string `json:"model"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"promptTokens"`
+	CompletionTokens int64  `json:"completionTokens"`
 }
 
 // +kubebuilder:object:root=true
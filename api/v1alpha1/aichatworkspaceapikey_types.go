@@ -0,0 +1,114 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AIChatWorkspaceAPIKeySpec defines the desired state of AIChatWorkspaceAPIKey.
+type AIChatWorkspaceAPIKeySpec struct {
+	// WorkspaceRef is the AIChatWorkspace the key grants access to. The workspace must use
+	// the APIKey auth mode.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="workspaceRef is immutable"
+	WorkspaceRef WorkspaceReference `json:"workspaceRef"`
+
+	// ExpiresAt is the time the key is revoked. When omitted the key never expires.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Scopes limits the endpoints the key can call. When omitted the key can call every
+	// endpoint allowed by the workspace gateway.
+	// +optional
+	Scopes []APIKeyScope `json:"scopes,omitempty"`
+
+	// SecretName is the Secret, in the namespace of the AIChatWorkspaceAPIKey, the key is
+	// written to. Defaults to the name of the AIChatWorkspaceAPIKey.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// WorkspaceReference identifies an AIChatWorkspace.
+type WorkspaceReference struct {
+	// Name of the AIChatWorkspace.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the AIChatWorkspace. Defaults to the namespace of the referencing object.
+	// Other namespaces must be listed in the workspace spec.api.auth.allowedKeyNamespaces.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// APIKeyScope is a group of API endpoints a key can be restricted to.
+// +kubebuilder:validation:Enum=chat;embeddings;models
+type APIKeyScope string
+
+const (
+	// APIKeyScopeChat grants the chat and completion endpoints.
+	APIKeyScopeChat APIKeyScope = "chat"
+
+	// APIKeyScopeEmbeddings grants the embedding endpoints.
+	APIKeyScopeEmbeddings APIKeyScope = "embeddings"
+
+	// APIKeyScopeModels grants the endpoints listing and describing models.
+	APIKeyScopeModels APIKeyScope = "models"
+)
+
+// AIChatWorkspaceAPIKeyStatus defines the observed state of AIChatWorkspaceAPIKey.
+type AIChatWorkspaceAPIKeyStatus struct {
+	// SecretName is the Secret holding the key.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// KeyID is the name the key is registered under with the workspace API gateway.
+	// +optional
+	KeyID string `json:"keyID,omitempty"`
+
+	// Represents the observations of a AIChatWorkspaceAPIKey's current state.
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Workspace",type=string,JSONPath=`.spec.workspaceRef.name`
+// +kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.status.secretName`
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.spec.expiresAt`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// AIChatWorkspaceAPIKey is the Schema for the aichatworkspaceapikeys API.
+type AIChatWorkspaceAPIKey struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AIChatWorkspaceAPIKeySpec   `json:"spec,omitempty"`
+	Status AIChatWorkspaceAPIKeyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AIChatWorkspaceAPIKeyList contains a list of AIChatWorkspaceAPIKey.
+type AIChatWorkspaceAPIKeyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AIChatWorkspaceAPIKey `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AIChatWorkspaceAPIKey{}, &AIChatWorkspaceAPIKeyList{})
+}
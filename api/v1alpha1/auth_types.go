@@ -0,0 +1,75 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// AuthSpec configures how users sign in to Open WebUI.
+type AuthSpec struct {
+	// OIDC signs the users in with an OpenID Connect provider.
+	// +optional
+	OIDC *OIDCSpec `json:"oidc,omitempty"`
+}
+
+// OIDCSpec is the OpenID Connect provider Open WebUI signs the users in with. The provider must
+// accept https://<workspace host>/oauth/oidc/callback as a redirect URL.
+type OIDCSpec struct {
+	// Issuer is the issuer URL of the provider, its discovery document is read from
+	// <issuer>/.well-known/openid-configuration.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	Issuer string `json:"issuer"`
+
+	// ProviderName is the name of the provider on the Open WebUI login button.
+	// +kubebuilder:default:=SSO
+	// +optional
+	ProviderName string `json:"providerName,omitempty"`
+
+	// ClientID is the client of Open WebUI registered with the provider.
+	// +kubebuilder:validation:MinLength=1
+	ClientID string `json:"clientID"`
+
+	// ClientSecretName is a Secret in the namespace of the AIChatWorkspace holding the client secret.
+	// +kubebuilder:validation:MinLength=1
+	ClientSecretName string `json:"clientSecretName"`
+
+	// ClientSecretKey is the key of the Secret holding the client secret.
+	// +kubebuilder:default:=clientSecret
+	// +optional
+	ClientSecretKey string `json:"clientSecretKey,omitempty"`
+
+	// Scopes are the scopes requested from the provider. Defaults to openid, email and profile.
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+
+	// GroupsClaim is the claim of the ID token listing the groups of the user.
+	// +kubebuilder:default:=groups
+	// +optional
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+
+	// AllowedGroups are the groups whose members sign in as users. When AllowedGroups or
+	// AdminGroup is set, the users of no listed group sign in as pending users, which can't chat
+	// until an admin approves them.
+	// +optional
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+
+	// AdminGroup is the group whose members sign in as admins.
+	// +optional
+	AdminGroup string `json:"adminGroup,omitempty"`
+
+	// DisableLocalSignup removes the Open WebUI signup form, the accounts are only created
+	// through the provider.
+	// +optional
+	DisableLocalSignup bool `json:"disableLocalSignup,omitempty"`
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// SignupMode selects whether users can sign up with a local account.
+// +kubebuilder:validation:Enum=Enabled;Disabled
+type SignupMode string
+
+const (
+	SignupModeEnabled  SignupMode = "Enabled"
+	SignupModeDisabled SignupMode = "Disabled"
+)
+
+// UserRole is the role of an Open WebUI account.
+// +kubebuilder:validation:Enum=pending;user;admin
+type UserRole string
+
+const (
+	UserRolePending UserRole = "pending"
+	UserRoleUser    UserRole = "user"
+	UserRoleAdmin   UserRole = "admin"
+)
+
+// BootstrapSpec creates the admin of Open WebUI once it runs and applies its default settings.
+// The settings left empty are not changed.
+type BootstrapSpec struct {
+	// AdminSecretName is a Secret in the namespace of the AIChatWorkspace holding the email and
+	// password keys of the admin account, and optionally its name. The account is signed up as
+	// the first account of Open WebUI, which makes it the admin.
+	// +kubebuilder:validation:MinLength=1
+	AdminSecretName string `json:"adminSecretName"`
+
+	// Signup enables or disables the signup of local accounts once the admin exists. It can't be
+	// Enabled with auth.oidc.disableLocalSignup.
+	// +optional
+	Signup SignupMode `json:"signup,omitempty"`
+
+	// DefaultUserRole is the role of the accounts signing up.
+	// +optional
+	DefaultUserRole UserRole `json:"defaultUserRole,omitempty"`
+
+	// Banner is a message shown above the chats of every user.
+	// +optional
+	Banner string `json:"banner,omitempty"`
+}
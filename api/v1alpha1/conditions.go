@@ -21,10 +21,26 @@ const (
 	// the resource has succeeded.
 	ConditionTypeReady string = "Ready"
 
-	// ConditionTypeConfigMapReady represents the fact that the reconciliation of
-	// the ConfigMap has succeeded.
+	// ConditionTypeConfigMapReady represents the fact that the operator configuration,
+	// with the profile and overrides of the workspace applied, is valid.
 	ConditionTypeConfigMapReady string = "ConfigMapReady"
 
+	// ConditionTypeIngressReady represents the fact that the Ingresses or
+	// HTTPRoutes exposing the workspace have been admitted.
+	ConditionTypeIngressReady string = "IngressReady"
+
+	// ConditionTypeOpenWebUIBootstrapped represents the fact that the Open WebUI admin exists
+	// and the default settings of spec.bootstrap were applied.
+	ConditionTypeOpenWebUIBootstrapped string = "OpenWebUIBootstrapped"
+
+	// ConditionTypePatternsPublished represents the fact that the patterns are published as Open
+	// WebUI prompts or model presets, see spec.patternDelivery.
+	ConditionTypePatternsPublished string = "PatternsPublished"
+
+	// ConditionTypeTerminating represents the fact that the workspace is being
+	// deleted and its namespace is being cleaned up.
+	ConditionTypeTerminating string = "Terminating"
+
 	// ReconciliationSucceededReason represents the fact that reconciliation has succeeded.
 	ReconciliationSucceededReason string = "ReconciliationSucceeded"
 
@@ -34,4 +50,74 @@ const (
 	// ProgressingReason represents the fact that the reconciliation of the
 	// resource is underway.
 	ProgressingReason string = "Progressing"
+
+	// IngressAdmittedReason represents the fact that every route to the workspace
+	// has been admitted by the ingress controller or gateway.
+	IngressAdmittedReason string = "Admitted"
+
+	// IngressPendingReason represents the fact that at least one route to the
+	// workspace has not been admitted yet.
+	IngressPendingReason string = "Pending"
+
+	// APIKeyIssuedReason represents the fact that the API key was written to its
+	// Secret and registered with the workspace API gateway.
+	APIKeyIssuedReason string = "Issued"
+
+	// APIKeyExpiredReason represents the fact that the API key expired and was revoked.
+	APIKeyExpiredReason string = "Expired"
+
+	// WorkspaceNotFoundReason represents the fact that the referenced AIChatWorkspace does not exist.
+	WorkspaceNotFoundReason string = "WorkspaceNotFound"
+
+	// APIKeyAuthDisabledReason represents the fact that the referenced AIChatWorkspace
+	// does not use the APIKey auth mode.
+	APIKeyAuthDisabledReason string = "APIKeyAuthDisabled"
+
+	// NamespaceNotAllowedReason represents the fact that the referenced AIChatWorkspace
+	// does not accept API keys from the namespace of the AIChatWorkspaceAPIKey.
+	NamespaceNotAllowedReason string = "NamespaceNotAllowed"
+
+	// NamespaceTerminatingReason represents the fact that the workspace namespace
+	// has been deleted and the finalizer waits for it to be gone.
+	NamespaceTerminatingReason string = "NamespaceTerminating"
+
+	// CleanupForcedReason represents the fact that the finalizer was removed before
+	// the cleanup completed because of the force-delete annotation.
+	CleanupForcedReason string = "CleanupForced"
+
+	// BackendReadyReason represents the fact that the Ollama pool of the AIChatBackend is running.
+	BackendReadyReason string = "BackendReady"
+
+	// BackendNotReadyReason represents the fact that the Ollama pool of the AIChatBackend is
+	// not running yet, or that the referenced AIChatBackend does not exist.
+	BackendNotReadyReason string = "BackendNotReady"
+
+	// BootstrappedReason represents the fact that the Open WebUI admin exists and the default
+	// settings were applied.
+	BootstrappedReason string = "Bootstrapped"
+
+	// WaitingForOpenWebUIReason represents the fact that Open WebUI is not running, or not bootstrapped yet.
+	WaitingForOpenWebUIReason string = "WaitingForOpenWebUI"
+
+	// BootstrapFailedReason represents the fact that the admin could not be signed in or up, or
+	// that a setting could not be applied.
+	BootstrapFailedReason string = "BootstrapFailed"
+
+	// PatternsPublishedReason represents the fact that the prompts or model presets of the
+	// patterns are published.
+	PatternsPublishedReason string = "Published"
+
+	// PatternsPublishFailedReason represents the fact that a prompt or model preset could not be
+	// published or removed.
+	PatternsPublishFailedReason string = "PublishFailed"
+
+	// ConfigValidReason represents the fact that the configuration of the workspace is valid.
+	ConfigValidReason string = "Valid"
+
+	// InvalidConfigReason represents the fact that the operator ConfigMap, the selected
+	// profile or the overrides of the workspace are invalid.
+	InvalidConfigReason string = "InvalidConfig"
+
+	// ConfigUnavailableReason represents the fact that the operator ConfigMap could not be read.
+	ConfigUnavailableReason string = "ConfigUnavailable"
 )
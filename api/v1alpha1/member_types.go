@@ -0,0 +1,84 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// MemberRole is the Open WebUI role of a member.
+// +kubebuilder:validation:Enum=user;admin
+type MemberRole string
+
+const (
+	MemberRoleUser  MemberRole = "user"
+	MemberRoleAdmin MemberRole = "admin"
+)
+
+// MemberSpec is a user of Open WebUI provisioned by the operator.
+type MemberSpec struct {
+	// Email identifies the account of the member. Members signing in with OIDC are matched by
+	// the email claim.
+	// +kubebuilder:validation:Pattern=`^[^@\s]+@[^@\s]+$`
+	// +kubebuilder:validation:MaxLength=254
+	Email string `json:"email"`
+
+	// Name is the display name of the account, the email when omitted.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Role is the role of the member.
+	// +kubebuilder:default:=user
+	// +optional
+	Role MemberRole `json:"role,omitempty"`
+
+	// Group is an Open WebUI group the member belongs to, created when missing.
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	Group string `json:"group,omitempty"`
+}
+
+// MemberState is the sync state of a member.
+type MemberState string
+
+const (
+	// MemberStateSynced means the account exists with the role and group of the member.
+	MemberStateSynced MemberState = "Synced"
+
+	// MemberStatePending means Open WebUI is not bootstrapped yet.
+	MemberStatePending MemberState = "Pending"
+
+	// MemberStateFailed means the account could not be created or updated.
+	MemberStateFailed MemberState = "Failed"
+
+	// MemberStateDeactivated means the member was removed from spec.members and its account
+	// moved back to the pending role, which can't use Open WebUI.
+	MemberStateDeactivated MemberState = "Deactivated"
+)
+
+// MemberStatus is the sync state of a member of spec.members, or of a removed member.
+type MemberStatus struct {
+	// Email is the email of the member.
+	Email string `json:"email"`
+
+	// State is Synced, Pending, Failed or Deactivated.
+	State MemberState `json:"state"`
+
+	// UserID is the id of the Open WebUI account.
+	// +optional
+	UserID string `json:"userID,omitempty"`
+
+	// Message explains a Pending or Failed state.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ModelSpec is a model of the workspace.
+//
+// It is written either as a string, <name>[@sha256:<digest>], or as an object. The CRD schema
+// can't describe a value that is a string or an object, the entries are validated by
+// ValidateModels instead.
+// +kubebuilder:validation:Type=""
+// +kubebuilder:pruning:PreserveUnknownFields
+type ModelSpec struct {
+	// Name is the name the model is installed under, e.g. llama3.2:1b. Models without a source
+	// are pulled from the Ollama library under this name.
+	Name string `json:"name"`
+
+	// Source imports the model from somewhere else than the Ollama library.
+	// +optional
+	Source *ModelSource `json:"source,omitempty"`
+
+	// Digest pins the model to a manifest digest, sha256:<hex>. The installed model is verified
+	// and a mismatch is reported in status.models.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// Alias is an additional name the model is served under. It is required to set Parameters,
+	// the alias is created from a Modelfile setting them.
+	// +optional
+	Alias string `json:"alias,omitempty"`
+
+	// KeepAlive is how long the model stays loaded in memory after it is preloaded, -1s keeps it
+	// loaded. Defaults to the Ollama default of 5m.
+	// +optional
+	KeepAlive *metav1.Duration `json:"keepAlive,omitempty"`
+
+	// Preload loads the model in memory once it is installed, so the first chat doesn't wait for it.
+	// The model is loaded again by the reconciles that find it isn't running.
+	// +optional
+	Preload bool `json:"preload,omitempty"`
+
+	// Parameters are the default Modelfile parameters of the alias, e.g. temperature or num_ctx.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// invalid is the reason the entry could not be decoded, reported by ValidateModels. Entries are
+	// decoded leniently: a decoding error would fail the list of every AIChatWorkspace.
+	invalid string `json:"-"`
+}
+
+// ModelSource is where a model is imported from. At most one source can be set.
+type ModelSource struct {
+	// HuggingFace is a GGUF repository on Hugging Face, <org>/<repo>[:<quantization>].
+	// +optional
+	HuggingFace string `json:"huggingFace,omitempty"`
+
+	// URL downloads a GGUF file over HTTPS.
+	// +optional
+	URL *URLModelSource `json:"url,omitempty"`
+
+	// PVC reads a GGUF file from a PersistentVolumeClaim of the workspace namespace.
+	// +optional
+	PVC *PVCModelSource `json:"pvc,omitempty"`
+}
+
+// URLModelSource is a GGUF file downloaded over HTTPS.
+type URLModelSource struct {
+	// URL of the GGUF file.
+	URL string `json:"url"`
+
+	// SHA256 is the checksum of the file, sha256:<hex>. The download is rejected when it doesn't match.
+	SHA256 string `json:"sha256"`
+}
+
+// PVCModelSource is a GGUF file on a PersistentVolumeClaim.
+type PVCModelSource struct {
+	// ClaimName is the name of the PersistentVolumeClaim in the workspace namespace.
+	ClaimName string `json:"claimName"`
+
+	// Path of the GGUF file, relative to the root of the volume.
+	Path string `json:"path"`
+}
+
+var (
+	digestPattern    = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	parameterPattern = regexp.MustCompile(`^[a-z_]+$`)
+)
+
+// UnmarshalJSON decodes a model written as a string or as an object.
+func (m *ModelSpec) UnmarshalJSON(data []byte) error {
+	*m = ModelSpec{}
+
+	var ref string
+	if err := json.Unmarshal(data, &ref); err == nil {
+		m.Name, m.Digest, _ = strings.Cut(ref, "@")
+		return nil
+	}
+
+	type model ModelSpec
+	var obj model
+	if err := json.Unmarshal(data, &obj); err != nil {
+		m.invalid = fmt.Sprintf("must be a model name or an object: %v", err)
+		return nil
+	}
+	*m = ModelSpec(obj)
+	return nil
+}
+
+// ServedName returns the name the model is served under, its alias when it has one.
+func (m ModelSpec) ServedName() string {
+	if m.Alias != "" {
+		return m.Alias
+	}
+	return m.Name
+}
+
+// ValidateModels returns the problems of the spec.models entries, or nil when they are valid.
+func ValidateModels(models []ModelSpec) error {
+	var errs []error
+	names := map[string]bool{}
+	for i, model := range models {
+		field := fmt.Sprintf("spec.models[%d]", i)
+		if model.invalid != "" {
+			errs = append(errs, fmt.Errorf("%s %s", field, model.invalid))
+			continue
+		}
+		if model.Name == "" || strings.ContainsAny(model.Name, " @") {
+			errs = append(errs, fmt.Errorf("%s.name %q is not a valid model name", field, model.Name))
+		}
+		for _, name := range []string{model.Name, model.Alias} {
+			if name != "" && names[name] {
+				errs = append(errs, fmt.Errorf("%s: %s is used by more than one model", field, name))
+			}
+			names[name] = name != ""
+		}
+		if model.Digest != "" && !digestPattern.MatchString(model.Digest) {
+			errs = append(errs, fmt.Errorf("%s.digest %q must be sha256:<64 hex characters>", field, model.Digest))
+		}
+		if len(model.Parameters) > 0 && model.Alias == "" {
+			errs = append(errs, fmt.Errorf("%s.parameters require an alias", field))
+		}
+		for name := range model.Parameters {
+			if !parameterPattern.MatchString(name) {
+				errs = append(errs, fmt.Errorf("%s.parameters: %q is not a Modelfile parameter", field, name))
+			}
+		}
+		if source := model.Source; source != nil {
+			set := 0
+			if source.HuggingFace != "" {
+				set++
+			}
+			if source.URL != nil {
+				set++
+				if !strings.HasPrefix(source.URL.URL, "https://") {
+					errs = append(errs, fmt.Errorf("%s.source.url.url must be an https URL", field))
+				}
+				if !digestPattern.MatchString(source.URL.SHA256) {
+					errs = append(errs, fmt.Errorf("%s.source.url.sha256 must be sha256:<64 hex characters>", field))
+				}
+			}
+			if source.PVC != nil {
+				set++
+				if source.PVC.ClaimName == "" || source.PVC.Path == "" {
+					errs = append(errs, fmt.Errorf("%s.source.pvc requires claimName and path", field))
+				} else if path.IsAbs(source.PVC.Path) || slices.Contains(strings.Split(source.PVC.Path, "/"), "..") {
+					errs = append(errs, fmt.Errorf("%s.source.pvc.path must be relative to the volume", field))
+				}
+			}
+			if set != 1 {
+				errs = append(errs, fmt.Errorf("%s.source must set exactly one of huggingFace, url or pvc", field))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestModelSpecUnmarshalJSON(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	var models []ModelSpec
+	err := json.Unmarshal([]byte(`[
+		"llama3.2:1b",
+		"gemma2:2b@`+digest+`",
+		{"name": "qwen2.5:0.5b", "alias": "qwen", "parameters": {"temperature": "0.2"}, "preload": true, "keepAlive": "30m"},
+		{"name": 1}
+	]`), &models)
+	if err != nil {
+		t.Fatalf("a bad entry should not fail the decoding: %v", err)
+	}
+
+	if models[0].Name != "llama3.2:1b" || models[0].Digest != "" {
+		t.Errorf("models[0] = %+v", models[0])
+	}
+	if models[1].Name != "gemma2:2b" || models[1].Digest != digest {
+		t.Errorf("models[1] = %+v", models[1])
+	}
+	if m := models[2]; m.ServedName() != "qwen" || !m.Preload || m.KeepAlive.Minutes() != 30 || m.Parameters["temperature"] != "0.2" {
+		t.Errorf("models[2] = %+v", m)
+	}
+	if models[3].invalid == "" {
+		t.Error("models[3] should be reported as invalid")
+	}
+
+	err = ValidateModels(models)
+	if err == nil || !strings.Contains(err.Error(), "spec.models[3]") {
+		t.Errorf("ValidateModels() = %v, want the invalid entry reported", err)
+	}
+	if err := ValidateModels(models[:3]); err != nil {
+		t.Errorf("ValidateModels() = %v, want nil", err)
+	}
+}
+
+func TestValidateModels(t *testing.T) {
+	for name, model := range map[string]ModelSpec{
+		"empty name":             {},
+		"bad digest":             {Name: "llama3.2", Digest: "sha256:abc"},
+		"parameters w/o alias":   {Name: "llama3.2", Parameters: map[string]string{"temperature": "0.2"}},
+		"bad parameter":          {Name: "llama3.2", Alias: "x", Parameters: map[string]string{"Temp": "1"}},
+		"two sources":            {Name: "x", Source: &ModelSource{HuggingFace: "org/repo", PVC: &PVCModelSource{ClaimName: "c", Path: "m.gguf"}}},
+		"http url":               {Name: "x", Source: &ModelSource{URL: &URLModelSource{URL: "http://x/m.gguf", SHA256: "sha256:" + strings.Repeat("a", 64)}}},
+		"alias used as a name":   {Name: "x", Alias: "llama3.2"},
+		"pvc without claim name": {Name: "x", Source: &ModelSource{PVC: &PVCModelSource{Path: "m.gguf"}}},
+	} {
+		if err := ValidateModels([]ModelSpec{{Name: "llama3.2"}, model}); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "slices"
+
+// OwnersSpec lists the Kubernetes users and groups owning a workspace.
+// +kubebuilder:validation:XValidation:rule="(has(self.users) && size(self.users) > 0) || (has(self.groups) && size(self.groups) > 0)",message="owners need at least one user or group"
+type OwnersSpec struct {
+	// Users are Kubernetes user names, as authenticated by the API server.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=32
+	Users []string `json:"users,omitempty"`
+
+	// Groups are Kubernetes group names, as authenticated by the API server.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=32
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Includes returns whether a Kubernetes user, or one of its groups, is an owner.
+func (o *OwnersSpec) Includes(username string, groups []string) bool {
+	if o == nil {
+		return false
+	}
+	if slices.Contains(o.Users, username) {
+		return true
+	}
+	return slices.ContainsFunc(groups, func(group string) bool {
+		return slices.Contains(o.Groups, group)
+	})
+}
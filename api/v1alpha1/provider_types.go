@@ -0,0 +1,89 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProviderSpec is an external OpenAI-compatible API offered in Open WebUI next to the models of
+// the workspace.
+type ProviderSpec struct {
+	// Name identifies the provider in status.providers.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// BaseURL is the base URL of the API, including its version, e.g. https://api.openai.com/v1.
+	// +kubebuilder:validation:Pattern=`^https?://[^;]+$`
+	BaseURL string `json:"baseURL"`
+
+	// SecretName is a Secret in the namespace of the AIChatWorkspace holding the API key. The
+	// Secret must be labelled aichatworkspaces.io/provider-key=<workspaceName>.
+	// When omitted the API is called without a key.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// SecretKey is the key of the Secret holding the API key.
+	// +kubebuilder:default:=apiKey
+	// +optional
+	SecretKey string `json:"secretKey,omitempty"`
+
+	// Models is the allow-list of the provider models the workspace uses. With spec.bootstrap, Open
+	// WebUI only offers these models of the provider, without it the list only feeds the connectivity
+	// check, which reports the listed models the provider doesn't serve. Empty offers every model.
+	// +optional
+	Models []string `json:"models,omitempty"`
+}
+
+// ProviderState is the result of the connectivity check of a provider.
+type ProviderState string
+
+const (
+	// ProviderStateConnected means the provider answered the model listing with the key of the
+	// workspace and serves the models of its allow-list.
+	ProviderStateConnected ProviderState = "Connected"
+
+	// ProviderStateFailed means the API key could not be read, the provider could not be reached
+	// or rejected the key, or it doesn't serve a model of the allow-list.
+	ProviderStateFailed ProviderState = "Failed"
+)
+
+// ProviderStatus is the result of the last connectivity check of a provider.
+type ProviderStatus struct {
+	// Name is the name of the provider in spec.providers.
+	Name string `json:"name"`
+
+	// State is either Connected or Failed.
+	State ProviderState `json:"state"`
+
+	// Message explains a Failed state.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// ServedModels is the number of models listed by the provider.
+	// +optional
+	ServedModels int32 `json:"servedModels,omitempty"`
+
+	// MissingModels are the models of the allow-list the provider doesn't serve.
+	// +optional
+	MissingModels []string `json:"missingModels,omitempty"`
+
+	// LastCheck is the last time the provider models were listed.
+	// +optional
+	LastCheck *metav1.Time `json:"lastCheck,omitempty"`
+}
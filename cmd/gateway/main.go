@@ -0,0 +1,129 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The gateway binary runs as a sidecar of the workspace Ollama StatefulSet and
+// guards the Ollama API with the API keys managed by the operator.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/chaunceyt/aichat-workspace-operator/internal/gateway"
+)
+
+var setupLog = ctrl.Log.WithName("gateway")
+
+func main() {
+	var listenAddr string
+	var upstream string
+	var keysDir string
+	var allowedPaths string
+	var reloadInterval time.Duration
+	var metricsAddr string
+	var workspace string
+	flag.StringVar(&listenAddr, "listen-address", ":8000", "The address the gateway listens on.")
+	flag.StringVar(&metricsAddr, "metrics-address", ":9090",
+		"The address serving the Prometheus metrics and the usage summary. Not routed by the workspace Service.")
+	flag.StringVar(&workspace, "workspace", "", "The workspace name used to label the metrics.")
+	flag.StringVar(&upstream, "upstream", "http://127.0.0.1:11434", "The Ollama API requests are forwarded to.")
+	flag.StringVar(&keysDir, "keys-dir", "/etc/aichat-gateway/keys", "Directory holding the API key hashes, one file per key.")
+	flag.StringVar(&allowedPaths, "allowed-paths", strings.Join(gateway.DefaultAllowedPaths, ","),
+		"Comma separated list of Ollama API paths that are forwarded.")
+	flag.DurationVar(&reloadInterval, "reload-interval", 10*time.Second, "How often the API keys are re-read.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	upstreamURL, err := url.Parse(upstream)
+	if err != nil {
+		setupLog.Error(err, "invalid upstream", "upstream", upstream)
+		os.Exit(1)
+	}
+
+	keys := gateway.NewKeyStore(keysDir, setupLog)
+	if err := keys.Load(); err != nil {
+		setupLog.Error(err, "unable to load api keys", "dir", keysDir)
+		os.Exit(1)
+	}
+	setupLog.Info("loaded api keys", "count", keys.Len())
+
+	ctx := ctrl.SetupSignalHandler()
+	go keys.ReloadEvery(ctx, reloadInterval, func(err error) {
+		setupLog.Error(err, "unable to reload api keys", "dir", keysDir)
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	meter := gateway.NewMeter(workspace, registry)
+
+	server := &http.Server{
+		Addr: listenAddr,
+		Handler: gateway.New(gateway.Options{
+			Upstream:     upstreamURL,
+			Keys:         keys,
+			AllowedPaths: strings.Split(allowedPaths, ","),
+			Meter:        meter,
+			Logger:       setupLog,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	metricsMux.HandleFunc(gateway.UsagePath, meter.ServeUsage)
+	metricsServer := &http.Server{
+		Addr:              metricsAddr,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+		_ = metricsServer.Shutdown(shutdownCtx)
+	}()
+
+	go func() {
+		setupLog.Info("starting metrics server", "address", metricsAddr)
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			setupLog.Error(err, "problem running metrics server")
+			os.Exit(1)
+		}
+	}()
+
+	setupLog.Info("starting gateway", "address", listenAddr, "upstream", upstream)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		setupLog.Error(err, "problem running gateway")
+		os.Exit(1)
+	}
+}
@@ -20,7 +20,10 @@ import (
 	"crypto/tls"
 	"expvar"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/arl/statsviz"
 
@@ -31,20 +34,31 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	kedahttpv1alpha1 "github.com/kedacore/http-add-on/operator/apis/http/v1alpha1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
 	"github.com/chaunceyt/aichat-workspace-operator/internal/controller"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/events"
+	opmetrics "github.com/chaunceyt/aichat-workspace-operator/internal/metrics"
+	webhookappsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -59,6 +73,9 @@ func init() {
 	// KEDA
 	utilruntime.Must(kedahttpv1alpha1.AddToScheme(scheme))
 
+	// Gateway API
+	utilruntime.Must(gatewayv1.AddToScheme(scheme))
+
 	utilruntime.Must(appsv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
@@ -69,6 +86,12 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var orphanSweepInterval time.Duration
+	var orphanGracePeriod time.Duration
+	var deleteOrphanedNamespaces bool
+	var configMapName string
+	var configMapNamespace string
+	var managerServiceAccount string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -80,6 +103,20 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.DurationVar(&orphanSweepInterval, "orphan-sweep-interval", controller.DefaultOrphanSweepInterval,
+		"How often to look for workspace namespaces whose AIChatWorkspace no longer exists.")
+	flag.DurationVar(&orphanGracePeriod, "orphan-grace-period", controller.DefaultOrphanGracePeriod,
+		"How long a workspace namespace stays orphaned before --delete-orphaned-namespaces deletes it.")
+	flag.BoolVar(&deleteOrphanedNamespaces, "delete-orphaned-namespaces", false,
+		"If set, orphaned workspace namespaces are deleted after --orphan-grace-period. Otherwise they are only "+
+			"annotated with "+constants.OrphanedSinceAnnotation+".")
+	flag.StringVar(&configMapName, "config-map-name", constants.AIChatWorspaceConfigMapName,
+		"The name of the ConfigMap holding the operator configuration.")
+	flag.StringVar(&configMapNamespace, "config-map-namespace", constants.AIChatWorkspaceNamespace,
+		"The namespace of the operator ConfigMap. The manager must be allowed to get, list and watch ConfigMaps in it.")
+	flag.StringVar(&managerServiceAccount, "manager-service-account", "",
+		"The service account the manager runs as, <namespace>:<name>. The AIChatWorkspace webhook always allows "+
+			"its requests, e.g. removing the finalizer of a workspace with owners. Required with the webhooks.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -149,13 +186,33 @@ func main() {
 		// this setup is not recommended for production.
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig := ctrl.GetConfigOrDie()
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to create the HTTP client")
+		os.Exit(1)
+	}
+	mapper, err := apiutil.NewDynamicRESTMapper(restConfig, httpClient)
+	if err != nil {
+		setupLog.Error(err, "unable to create the REST mapper")
+		os.Exit(1)
+	}
+	cacheByObject, err := controller.CacheByObject(mapper, configMapNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to build the cache settings")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "ebac4b4e.aichatworkspaces.io",
+		// Only the objects of the operator are watched, don't cache the objects of the whole cluster.
+		Cache:            cache.Options{ByObject: cacheByObject},
+		MapperProvider:   func(*rest.Config, *http.Client) (meta.RESTMapper, error) { return mapper, nil },
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: "ebac4b4e.aichatworkspaces.io",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -173,16 +230,67 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctx := ctrl.SetupSignalHandler()
+
+	if err = controller.SetupFieldIndexes(ctx, mgr); err != nil {
+		setupLog.Error(err, "unable to set up field indexes")
+		os.Exit(1)
+	}
 	if err = (&controller.AIChatWorkspaceReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("aichatworkspace-controller"),
+		Recorder: events.NewRateLimitedRecorder(mgr.GetEventRecorderFor("aichatworkspace-controller"), events.DefaultInterval),
+		Config:   config.NewLoader(mgr.GetClient(), configMapName, configMapNamespace),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AIChatWorkspace")
 		os.Exit(1)
 	}
+	if err = (&controller.AIChatWorkspaceAPIKeyReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: events.NewRateLimitedRecorder(mgr.GetEventRecorderFor("aichatworkspaceapikey-controller"), events.DefaultInterval),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AIChatWorkspaceAPIKey")
+		os.Exit(1)
+	}
+	if err = (&controller.AIChatBackendReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: events.NewRateLimitedRecorder(mgr.GetEventRecorderFor("aichatbackend-controller"), events.DefaultInterval),
+		Config:   config.NewLoader(mgr.GetClient(), configMapName, configMapNamespace),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AIChatBackend")
+		os.Exit(1)
+	}
+	if err = mgr.Add(&controller.OrphanSweeper{
+		Client:      mgr.GetClient(),
+		Interval:    orphanSweepInterval,
+		GracePeriod: orphanGracePeriod,
+		Delete:      deleteOrphanedNamespaces,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up the orphan sweeper")
+		os.Exit(1)
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		// the service account of the operator is always allowed, the other ones of its namespace aren't.
+		namespace, name, ok := strings.Cut(managerServiceAccount, ":")
+		if !ok || namespace == "" || name == "" || strings.Contains(name, ":") {
+			setupLog.Error(fmt.Errorf("invalid --manager-service-account %q", managerServiceAccount), "the webhooks need the service account of the manager, <namespace>:<name>")
+			os.Exit(1)
+		}
+		if err = webhookappsv1alpha1.SetupAIChatWorkspaceWebhookWithManager(mgr, "system:serviceaccount:"+managerServiceAccount); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AIChatWorkspace")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	// Workspaces by state, computed from the manager cache at scrape time.
+	ctrlmetrics.Registry.MustRegister(opmetrics.NewWorkspacesCollector(mgr.GetClient()))
+	// Hit ratio and bytes saved of the shared model cache, when modelCacheURL is set.
+	ctrlmetrics.Registry.MustRegister(opmetrics.NewModelCacheCollector(config.NewLoader(mgr.GetClient(), configMapName, configMapNamespace)))
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -193,7 +301,7 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The modelcache binary is a pull-through cache of the Ollama model registry shared by
+// the workspaces of the cluster, see config/modelcache.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/api/resource"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/chaunceyt/aichat-workspace-operator/internal/modelcache"
+)
+
+var setupLog = ctrl.Log.WithName("modelcache")
+
+func main() {
+	var listenAddr string
+	var upstream string
+	var cacheDir string
+	var maxSize string
+	flag.StringVar(&listenAddr, "listen-address", ":5000", "The address the cache listens on.")
+	flag.StringVar(&upstream, "upstream", "https://registry.ollama.ai", "The registry the models are pulled from.")
+	flag.StringVar(&cacheDir, "cache-dir", "/var/cache/models", "Directory storing the cached manifests and blobs.")
+	flag.StringVar(&maxSize, "max-size", "0",
+		"Size of the cached blobs beyond which the least recently used are evicted, e.g. 200Gi. 0 disables the eviction.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	upstreamURL, err := url.Parse(upstream)
+	if err != nil {
+		setupLog.Error(err, "invalid upstream", "upstream", upstream)
+		os.Exit(1)
+	}
+	maxBytes, err := resource.ParseQuantity(maxSize)
+	if err != nil {
+		setupLog.Error(err, "invalid max size", "max-size", maxSize)
+		os.Exit(1)
+	}
+
+	cache, err := modelcache.New(modelcache.Options{
+		Upstream: upstreamURL,
+		Dir:      cacheDir,
+		MaxBytes: maxBytes.Value(),
+		Logger:   setupLog,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to open cache", "dir", cacheDir)
+		os.Exit(1)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	registry.MustRegister(cache.Stats())
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.Handle("/", cache)
+	server := &http.Server{
+		Addr:              listenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	setupLog.Info("starting model cache", "address", listenAddr, "upstream", upstream, "dir", cacheDir)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		setupLog.Error(err, "problem running model cache")
+		os.Exit(1)
+	}
+}
@@ -32,6 +32,11 @@ helm install http-add-on kedacore/keda-add-ons-http  \
   --create-namespace --namespace keda \
   --set interceptor.responseHeaderTimeout=120s
 
+# Install cert-manager
+# issuing the certificate of the AIChatWorkspace admission webhook
+kubectl apply -f https://github.com/cert-manager/cert-manager/releases/download/v1.16.0/cert-manager.yaml
+kubectl wait deployment.apps/cert-manager-webhook --for condition=Available --namespace cert-manager --timeout 5m
+
 # Setup AIChat Workspace Operator
 make generate
 make manifests
@@ -16,7 +16,28 @@ limitations under the License.
 
 package modelfiles
 
-import "fmt"
+import (
+	"embed"
+	"fmt"
+	"strings"
+)
+
+// patterns holds the system.md of the fabric patterns.
+//
+//go:embed files
+var patterns embed.FS
+
+// SystemPrompt returns the system prompt of a fabric pattern, or an error if the pattern is unknown.
+func SystemPrompt(pattern string) (string, error) {
+	if pattern == "" || strings.ContainsAny(pattern, "/\\.") {
+		return "", fmt.Errorf("unknown pattern %q", pattern)
+	}
+	b, err := patterns.ReadFile("files/" + pattern + "/system.md")
+	if err != nil {
+		return "", fmt.Errorf("unknown pattern %q", pattern)
+	}
+	return string(b), nil
+}
 
 // GetSystemPromptPattern returns a system prompt pattern based on the provided model and pattern.
 // It calls the internal prompt function to generate the pattern.
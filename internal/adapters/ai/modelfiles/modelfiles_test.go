@@ -0,0 +1,37 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelfiles
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemPrompt(t *testing.T) {
+	prompt, err := SystemPrompt("explain_code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompt != explain_code || !strings.Contains(prompt, "IDENTITY") {
+		t.Errorf("SystemPrompt(explain_code) = %.60q..., want the system.md of the pattern", prompt)
+	}
+	for _, pattern := range []string{"", "missing", "../explain_code", "explain_code/user"} {
+		if _, err := SystemPrompt(pattern); err == nil {
+			t.Errorf("SystemPrompt(%q) succeeded, want an error", pattern)
+		}
+	}
+}
@@ -18,11 +18,14 @@ package k8s
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/ptr"
 
 	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
@@ -39,19 +42,20 @@ const (
  * @param namespace The namespace where the deployment will be created.
  * @param name      The name of the deployment.
  * @param port      The port that the Open WebUI container will listen on.
- * @param openwebuiContainerImageTag The tag for the Open WebUI container image to use.
+ * @param containerImage The Open WebUI container image to use.
+ * @param clusterDomain The DNS domain of the cluster, used to reach the Ollama Service.
  * @return A pointer to a new appsv1.Deployment object representing the Open WebUI workload.
  */
-func NewDeployment(namespace, name string, port int32, openwebuiContainerImageTag string) *appsv1.Deployment {
+func NewDeployment(namespace, name string, port int32, containerImage, clusterDomain string) *appsv1.Deployment {
 	appLabels := map[string]string{defaultNameLabel: name}
 
 	// config for ollama service
-	containerImage := fmt.Sprintf("%s:%s", constants.OpenwebuiContainerImageName, openwebuiContainerImageTag)
 	serviceName := fmt.Sprintf("%s-ollama", namespace)
-	ollamaServerURI := fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", serviceName, namespace, constants.OllamaPort)
-	openAIURI := fmt.Sprintf("http://%s.%s.svc.cluster.local:%d/v1", serviceName, namespace, constants.OllamaPort)
+	ollamaServerURI := ServiceURL(serviceName, namespace, clusterDomain, constants.OllamaPort)
+	openAIURI := ollamaServerURI + "/v1"
 	workspaceName := fmt.Sprintf("AIChat Workspace: %s", namespace)
 	saName := fmt.Sprintf("%s-openwebui", namespace)
+	secretName := fmt.Sprintf("%s-%s", namespace, constants.OpenwebuiSecretName)
 
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -91,10 +95,19 @@ func NewDeployment(namespace, name string, port int32, openwebuiContainerImageTa
 									Value: workspaceName,
 								},
 								{
-									Name:  "KEY_FILE",
-									Value: "/tmp/.webui_secret_key",
+									Name: constants.OpenwebuiSecretKey,
+									ValueFrom: &v1.EnvVarSource{
+										SecretKeyRef: &v1.SecretKeySelector{
+											LocalObjectReference: v1.LocalObjectReference{Name: secretName},
+											Key:                  constants.OpenwebuiSecretKey,
+										},
+									},
 								},
 							},
+							// the other keys of the Secret are sensitive settings of Open WebUI.
+							EnvFrom: []v1.EnvFromSource{
+								{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: secretName}}},
+							},
 							Ports: []v1.ContainerPort{{ContainerPort: port}},
 							TTY:   true,
 							VolumeMounts: []v1.VolumeMount{
@@ -122,6 +135,19 @@ func NewDeployment(namespace, name string, port int32, openwebuiContainerImageTa
 	}
 }
 
+/**
+ * Returns the in-cluster URL of a Service.
+ *
+ * @param name The name of the Service.
+ * @param namespace The namespace of the Service.
+ * @param clusterDomain The DNS domain of the cluster, e.g. cluster.local.
+ * @param port The port of the Service.
+ * @return The http URL of the Service.
+ */
+func ServiceURL(name, namespace, clusterDomain string, port int32) string {
+	return fmt.Sprintf("http://%s.%s.svc.%s:%d", name, namespace, clusterDomain, port)
+}
+
 /*
 NewStatefulSet creates a Kubernetes StatefulSet object that represents the
 Ollama workload. The StatefulSet ensures that a specified number of replicas
@@ -133,15 +159,14 @@ The function takes in several parameters:
   - port: the port number that the Ollama container will listen on
   - volumeSize: the size of the persistent volume claim (PVC) that will be created
     for the Ollama container
-  - ollamaContainerImageTag: the tag of the Ollama container image to use
+  - containerImage: the Ollama container image to use
 
 The function returns a pointer to an appsv1.StatefulSet object.
 */
-func NewStatefulSet(namespace, name string, port int32, volumeSize string, ollamaContainerImageTag string) *appsv1.StatefulSet {
+func NewStatefulSet(namespace, name string, port int32, volumeSize string, containerImage string) *appsv1.StatefulSet {
 	appLabels := map[string]string{defaultNameLabel: name}
 
 	// config for Open WebUI
-	containerImage := fmt.Sprintf("%s:%s", constants.OllamaContainerImageName, ollamaContainerImageTag)
 	saName := fmt.Sprintf("%s-ollama", namespace)
 	serviceName := fmt.Sprintf("%s-%s", namespace, constants.OllamaName)
 
@@ -203,6 +228,231 @@ func NewStatefulSet(namespace, name string, port int32, volumeSize string, ollam
 	}
 }
 
+/**
+ * AddAPIGatewaySidecar adds the operator API gateway as a sidecar of the inference StatefulSet.
+ *
+ * The gateway listens on port, validates bearer API keys against the hashes projected from
+ * the keysSecretName Secret and forwards the allowed paths to the inference server on localhost. Token usage
+ * metrics and the 24h usage summary are served on APIGatewayMetricsPort, which is not part of
+ * any Service.
+ *
+ * @param sts The StatefulSet returned by NewStatefulSet or NewLlamaCppStatefulSet.
+ * @param image The container image holding the gateway binary.
+ * @param keysSecretName The Secret holding the API key hashes.
+ * @param port The port the gateway listens on.
+ * @param upstreamPort The port of the inference server.
+ * @param allowedPaths The Ollama API paths forwarded by the gateway, the gateway defaults when empty.
+ */
+func AddAPIGatewaySidecar(sts *appsv1.StatefulSet, image, keysSecretName string, port, upstreamPort int32, allowedPaths []string) {
+	args := []string{
+		fmt.Sprintf("--listen-address=:%d", port),
+		fmt.Sprintf("--upstream=http://127.0.0.1:%d", upstreamPort),
+		fmt.Sprintf("--keys-dir=%s", constants.APIGatewayKeysMountPath),
+		fmt.Sprintf("--metrics-address=:%d", constants.APIGatewayMetricsPort),
+		fmt.Sprintf("--workspace=%s", sts.Namespace),
+	}
+	if len(allowedPaths) > 0 {
+		args = append(args, fmt.Sprintf("--allowed-paths=%s", strings.Join(allowedPaths, ",")))
+	}
+
+	podSpec := &sts.Spec.Template.Spec
+	podSpec.Containers = append(podSpec.Containers, v1.Container{
+		Name:            constants.APIGatewayContainerName,
+		Image:           image,
+		Command:         []string{"/gateway"},
+		Args:            args,
+		SecurityContext: defaultSecurityContext(),
+		Ports: []v1.ContainerPort{
+			{Name: "gateway", ContainerPort: port},
+			{Name: "gateway-metrics", ContainerPort: constants.APIGatewayMetricsPort},
+		},
+		ReadinessProbe: &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{
+				HTTPGet: &v1.HTTPGetAction{
+					Path: "/healthz",
+					Port: intstr.FromInt32(port),
+				},
+			},
+		},
+		VolumeMounts: []v1.VolumeMount{
+			{
+				Name:      constants.APIGatewayKeysVolumeName,
+				MountPath: constants.APIGatewayKeysMountPath,
+				ReadOnly:  true,
+			},
+		},
+	})
+	if sts.Spec.Template.Annotations == nil {
+		sts.Spec.Template.Annotations = map[string]string{}
+	}
+	sts.Spec.Template.Annotations["prometheus.io/scrape"] = "true"
+	sts.Spec.Template.Annotations["prometheus.io/port"] = fmt.Sprint(constants.APIGatewayMetricsPort)
+	sts.Spec.Template.Annotations["prometheus.io/path"] = "/metrics"
+
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: constants.APIGatewayKeysVolumeName,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName: keysSecretName,
+			},
+		},
+	})
+}
+
+/**
+ * AddEgressConfig configures how the inference container of the StatefulSet, Ollama or llama.cpp,
+ * reaches the model registries.
+ *
+ * The proxy is passed as HTTPS_PROXY and NO_PROXY. The CA bundle ConfigMap is mounted and added to
+ * SSL_CERT_DIR, next to the system certificates. Its hash is set on the pod template, so the pod
+ * restarts and loads the certificates again when they change.
+ *
+ * @param sts The StatefulSet returned by NewStatefulSet or NewLlamaCppStatefulSet.
+ * @param httpsProxy The proxy URL, or an empty string.
+ * @param noProxy The hosts reached without the proxy, or an empty string.
+ * @param caBundleConfigMap The ConfigMap holding the CA bundle, or an empty string.
+ * @param caBundleHash The hash of the CA bundle.
+ */
+func AddEgressConfig(sts *appsv1.StatefulSet, httpsProxy, noProxy, caBundleConfigMap, caBundleHash string) {
+	addEgressConfig(&sts.Spec.Template, httpsProxy, noProxy, caBundleConfigMap, caBundleHash, constants.OllamaContainerName, constants.LlamaCppContainerName)
+}
+
+// addEgressConfig adds the proxy and the CA bundle to the named containers of a pod template.
+func addEgressConfig(template *v1.PodTemplateSpec, httpsProxy, noProxy, caBundleConfigMap, caBundleHash string, containerNames ...string) {
+	podSpec := &template.Spec
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if !slices.Contains(containerNames, container.Name) {
+			continue
+		}
+
+		if httpsProxy != "" {
+			container.Env = append(container.Env, v1.EnvVar{Name: "HTTPS_PROXY", Value: httpsProxy})
+		}
+		if noProxy != "" {
+			container.Env = append(container.Env, v1.EnvVar{Name: "NO_PROXY", Value: noProxy})
+		}
+		if caBundleConfigMap != "" {
+			container.Env = append(container.Env, v1.EnvVar{Name: "SSL_CERT_DIR", Value: "/etc/ssl/certs:" + constants.CABundleMountPath})
+			container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+				Name:      constants.CABundleName,
+				MountPath: constants.CABundleMountPath,
+				ReadOnly:  true,
+			})
+		}
+	}
+
+	if caBundleConfigMap == "" {
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[constants.CABundleHashAnnotation] = caBundleHash
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: constants.CABundleName,
+		VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: caBundleConfigMap},
+			},
+		},
+	})
+}
+
+/**
+ * ConfigureOllamaPool turns the Ollama StatefulSet into the shared pool of an AIChatBackend.
+ *
+ * NewStatefulSet names the governing Service and the ServiceAccount after the workspace
+ * namespace, the pool uses its own name for both. The limits on parallel requests and loaded
+ * models are passed to Ollama when set.
+ *
+ * @param sts The Ollama StatefulSet returned by NewStatefulSet.
+ * @param resources The resources of the Ollama container, or nil.
+ * @param numParallel The value of OLLAMA_NUM_PARALLEL, or nil.
+ * @param maxLoadedModels The value of OLLAMA_MAX_LOADED_MODELS, or nil.
+ */
+func ConfigureOllamaPool(sts *appsv1.StatefulSet, resources *v1.ResourceRequirements, numParallel, maxLoadedModels *int32) {
+	sts.Spec.ServiceName = sts.Name
+	podSpec := &sts.Spec.Template.Spec
+	podSpec.ServiceAccountName = sts.Name
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if container.Name != constants.OllamaContainerName {
+			continue
+		}
+
+		if resources != nil {
+			container.Resources = *resources
+		}
+		if numParallel != nil {
+			container.Env = append(container.Env, v1.EnvVar{Name: "OLLAMA_NUM_PARALLEL", Value: fmt.Sprint(*numParallel)})
+		}
+		if maxLoadedModels != nil {
+			container.Env = append(container.Env, v1.EnvVar{Name: "OLLAMA_MAX_LOADED_MODELS", Value: fmt.Sprint(*maxLoadedModels)})
+		}
+	}
+}
+
+/**
+ * SetOllamaURL points the Open WebUI Deployment at another Ollama API than the one of the
+ * workspace, e.g. the pool of a shared AIChatBackend.
+ *
+ * @param deployment The Open WebUI Deployment returned by NewDeployment.
+ * @param ollamaServerURI The base URL of the Ollama API.
+ */
+func SetOllamaURL(deployment *appsv1.Deployment, ollamaServerURI string) {
+	podSpec := &deployment.Spec.Template.Spec
+	for i := range podSpec.Containers {
+		for j := range podSpec.Containers[i].Env {
+			env := &podSpec.Containers[i].Env[j]
+			switch env.Name {
+			case "OLLAMA_BASE_URL":
+				env.Value = ollamaServerURI
+			case "OPENAI_API_BASE_URL":
+				env.Value = ollamaServerURI + "/v1"
+			}
+		}
+	}
+}
+
+/**
+ * AddOpenAIProviders adds external OpenAI-compatible APIs to the Open WebUI Deployment.
+ *
+ * OPENAI_API_BASE_URL is replaced by OPENAI_API_BASE_URLS, the URL of the workspace followed by
+ * the providers, and OPENAI_API_KEYS is read from a Secret holding the matching ;-separated keys.
+ * The hash of the keys is set on the pod template, so the pods restart when a key changes.
+ *
+ * @param deployment The Open WebUI Deployment, configured for the inference server of the workspace.
+ * @param baseURLs The base URLs of the providers.
+ * @param keysSecretName The Secret holding the keys under OPENAI_API_KEYS, the first one for the workspace.
+ * @param keysHash The hash of the keys.
+ */
+func AddOpenAIProviders(deployment *appsv1.Deployment, baseURLs []string, keysSecretName, keysHash string) {
+	podSpec := &deployment.Spec.Template.Spec
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		for j := range container.Env {
+			if container.Env[j].Name == "OPENAI_API_BASE_URL" {
+				container.Env[j].Name = "OPENAI_API_BASE_URLS"
+				container.Env[j].Value = strings.Join(append([]string{container.Env[j].Value}, baseURLs...), ";")
+			}
+		}
+		container.Env = append(container.Env, v1.EnvVar{
+			Name: constants.ProvidersKeysSecretKey,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: keysSecretName},
+					Key:                  constants.ProvidersKeysSecretKey,
+				},
+			},
+		})
+	}
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.Annotations[constants.ProvidersKeysHashAnnotation] = keysHash
+}
+
 /**
  * defaultSecurityContext returns a v1.SecurityContext object with settings to secure containers.
  *
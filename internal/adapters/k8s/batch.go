@@ -0,0 +1,187 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"path"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// modelImportScript uploads the GGUF file as a blob of the Ollama server and creates the model
+// from it. The model name is validated by the operator, it can't contain quotes.
+const modelImportScript = `set -eu
+digest="sha256:$(sha256sum "$MODEL_FILE" | cut -d' ' -f1)"
+if ! curl -fsS -o /dev/null -I "$OLLAMA_HOST/api/blobs/$digest"; then
+  curl -fsS -X POST -T "$MODEL_FILE" "$OLLAMA_HOST/api/blobs/$digest"
+fi
+curl -fsS "$OLLAMA_HOST/api/create" -d "{\"model\":\"$MODEL_NAME\",\"modelfile\":\"FROM @$digest\",\"stream\":false}"
+`
+
+// modelURLImportScript streams the GGUF file from its URL to the Ollama server and creates the
+// model from it. Ollama rejects a blob which doesn't match its digest, so a failed or truncated
+// download fails the upload. The download is aborted when it doesn't connect within 30 seconds or
+// stays under 1 KiB/s for 5 minutes.
+const modelURLImportScript = `set -eu
+if ! curl -fsS -o /dev/null -I "$OLLAMA_HOST/api/blobs/$MODEL_DIGEST"; then
+  curl -fsSL --proto =https --connect-timeout 30 --speed-time 300 --speed-limit 1024 "$MODEL_URL" |
+    curl -fsS -X POST -T - "$OLLAMA_HOST/api/blobs/$MODEL_DIGEST"
+fi
+curl -fsS "$OLLAMA_HOST/api/create" -d "{\"model\":\"$MODEL_NAME\",\"modelfile\":\"FROM @$MODEL_DIGEST\",\"stream\":false}"
+`
+
+const (
+	// modelImportContainer is the name of the container of the import Jobs.
+	modelImportContainer = "import"
+
+	// modelImportVolume is the name of the volume of the claim the model is imported from.
+	modelImportVolume = "models"
+)
+
+/**
+ * Creates a new Job importing a GGUF file from a PersistentVolumeClaim into Ollama.
+ *
+ * The claim is mounted read only, the file is uploaded to the Ollama API of the workspace and the
+ * model is created from it. The pod runs without fsGroup, so the volume isn't relabelled: the file
+ * must be readable by the 10001 user or group. The Job is deleted an hour after it finished.
+ *
+ * @param namespace The namespace of the workspace, where the claim is.
+ * @param name The name of the Job.
+ * @param claimName The name of the PersistentVolumeClaim holding the file.
+ * @param filePath The path of the GGUF file on the volume.
+ * @param modelName The name of the model to create.
+ * @param ollamaURL The base URL of the Ollama API of the workspace.
+ * @param containerImage An image with sh, sha256sum and curl.
+ * @param appLabels A map of labels to apply to the Job and its pod.
+ * @return A pointer to a new batchv1.Job object.
+ */
+func NewModelImportJob(namespace, name, claimName, filePath, modelName, ollamaURL, containerImage string, appLabels map[string]string) *batchv1.Job {
+	job := newModelImportJob(namespace, name, modelImportScript, containerImage, appLabels, []v1.EnvVar{
+		{Name: "OLLAMA_HOST", Value: ollamaURL},
+		{Name: "MODEL_NAME", Value: modelName},
+		{Name: "MODEL_FILE", Value: path.Join("/", modelImportVolume, filePath)},
+	})
+	podSpec := &job.Spec.Template.Spec
+	podSpec.Containers[0].VolumeMounts = []v1.VolumeMount{{
+		Name:      modelImportVolume,
+		MountPath: "/" + modelImportVolume,
+		ReadOnly:  true,
+	}}
+	podSpec.Volumes = []v1.Volume{{
+		Name: modelImportVolume,
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+				ReadOnly:  true,
+			},
+		},
+	}}
+	return job
+}
+
+/**
+ * Creates a new Job importing a GGUF file from a URL into Ollama.
+ *
+ * The file is streamed from its URL to the Ollama API of the workspace, nothing is stored by the
+ * pod, and the model is created from it. The download is skipped when Ollama already has the blob.
+ * The Job is deleted an hour after it finished.
+ *
+ * @param namespace The namespace of the workspace.
+ * @param name The name of the Job.
+ * @param fileURL The https URL of the GGUF file.
+ * @param digest The sha256:<hex> digest of the file.
+ * @param modelName The name of the model to create.
+ * @param ollamaURL The base URL of the Ollama API of the workspace.
+ * @param containerImage An image with sh and curl.
+ * @param appLabels A map of labels to apply to the Job and its pod.
+ * @return A pointer to a new batchv1.Job object.
+ */
+func NewModelURLImportJob(namespace, name, fileURL, digest, modelName, ollamaURL, containerImage string, appLabels map[string]string) *batchv1.Job {
+	return newModelImportJob(namespace, name, modelURLImportScript, containerImage, appLabels, []v1.EnvVar{
+		{Name: "OLLAMA_HOST", Value: ollamaURL},
+		{Name: "MODEL_NAME", Value: modelName},
+		{Name: "MODEL_URL", Value: fileURL},
+		{Name: "MODEL_DIGEST", Value: digest},
+	})
+}
+
+/**
+ * AddModelImportEgressConfig configures how the container of an import Job reaches the URL of the
+ * model, in the same way as AddEgressConfig for the inference container.
+ *
+ * @param job The Job returned by NewModelURLImportJob.
+ * @param httpsProxy The proxy URL, or an empty string.
+ * @param noProxy The hosts reached without the proxy, or an empty string.
+ * @param caBundleConfigMap The ConfigMap holding the CA bundle, or an empty string.
+ * @param caBundleHash The hash of the CA bundle.
+ */
+func AddModelImportEgressConfig(job *batchv1.Job, httpsProxy, noProxy, caBundleConfigMap, caBundleHash string) {
+	addEgressConfig(&job.Spec.Template, httpsProxy, noProxy, caBundleConfigMap, caBundleHash, modelImportContainer)
+}
+
+// newModelImportJob returns a Job running an import script as the 10001 user, with the Ollama URL
+// and the model in its environment.
+func newModelImportJob(namespace, name, script, containerImage string, appLabels map[string]string, env []v1.EnvVar) *batchv1.Job {
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    appLabels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To[int32](2),
+			TTLSecondsAfterFinished: ptr.To[int32](3600),
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: appLabels,
+				},
+				Spec: v1.PodSpec{
+					RestartPolicy:                v1.RestartPolicyNever,
+					AutomountServiceAccountToken: ptr.To(false),
+					SecurityContext: &v1.PodSecurityContext{
+						RunAsUser:  ptr.To[int64](10001),
+						RunAsGroup: ptr.To[int64](10001),
+					},
+					Containers: []v1.Container{{
+						Name:    modelImportContainer,
+						Image:   containerImage,
+						Command: []string{"sh", "-c", script},
+						Env:     env,
+						Resources: v1.ResourceRequirements{
+							Requests: v1.ResourceList{
+								v1.ResourceCPU:    resource.MustParse("100m"),
+								v1.ResourceMemory: resource.MustParse("64Mi"),
+							},
+							Limits: v1.ResourceList{
+								v1.ResourceMemory: resource.MustParse("256Mi"),
+							},
+						},
+						SecurityContext: defaultSecurityContext(),
+					}},
+				},
+			},
+		},
+	}
+}
@@ -118,6 +118,20 @@ func NewPersistentVolumeClaim(name string, namespace string, storageSize string,
  * @return A pointer to a new corev1.Service object.
  */
 func NewService(namespace string, name string, port int32, appLabels map[string]string) *corev1.Service {
+	return NewServiceForWorkload(namespace, name, name, port, appLabels)
+}
+
+/**
+ * Creates a new Kubernetes Service object routing to the pods of another workload.
+ *
+ * @param namespace The namespace where the service will be created.
+ * @param name The name of the service to create.
+ * @param workload The app.kubernetes.io/name of the pods the service routes to.
+ * @param port The port number that the service will listen on.
+ * @param appLabels A map of labels to apply to the service.
+ * @return A pointer to a new corev1.Service object.
+ */
+func NewServiceForWorkload(namespace string, name string, workload string, port int32, appLabels map[string]string) *corev1.Service {
 	return &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
@@ -130,7 +144,7 @@ func NewService(namespace string, name string, port int32, appLabels map[string]
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: map[string]string{
-				"app.kubernetes.io/name": name,
+				"app.kubernetes.io/name": workload,
 			},
 			Ports: []corev1.ServicePort{{
 				Protocol:   corev1.ProtocolTCP,
@@ -299,3 +313,94 @@ func getName(workspace, workload string) string {
 	name := fmt.Sprintf("%s-%s", workspace, workload)
 	return name
 }
+
+/**
+ * Creates a new Kubernetes Secret object.
+ *
+ * @param name The name of the secret to create.
+ * @param namespace The namespace where the secret will be created.
+ * @param data The data to store in the secret.
+ * @param appLabels A map of labels to apply to the secret.
+ * @return A pointer to a new corev1.Secret object.
+ */
+func NewSecret(name, namespace string, data map[string][]byte, appLabels map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    appLabels,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+}
+
+/**
+ * Creates a new Kubernetes ConfigMap object.
+ *
+ * @param name The name of the config map to create.
+ * @param namespace The namespace where the config map will be created.
+ * @param data The data to store in the config map.
+ * @param appLabels A map of labels to apply to the config map.
+ * @return A pointer to a new corev1.ConfigMap object.
+ */
+func NewConfigMap(name, namespace string, data map[string]string, appLabels map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    appLabels,
+		},
+		Data: data,
+	}
+}
+
+/**
+ * Creates a new Kubernetes NetworkPolicy object that only admits traffic from
+ * pods running in the same namespace and from the operator namespace, whose
+ * controller lists and pulls the models through the Ollama API.
+ *
+ * @param namespace The namespace where the network policy will be created.
+ * @param name The name of the network policy, also used to select the protected pods.
+ * @param appLabels A map of labels to apply to the network policy.
+ * @return A pointer to a new networkingv1.NetworkPolicy object.
+ */
+func NewNamespaceOnlyNetworkPolicy(namespace, name string, appLabels map[string]string) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    appLabels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{defaultNameLabel: name},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{PodSelector: &metav1.LabelSelector{}},
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"kubernetes.io/metadata.name": constants.AIChatWorkspaceNamespace},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func TestNewNamespaceOnlyNetworkPolicy(t *testing.T) {
+	netpol := NewNamespaceOnlyNetworkPolicy("team-a", "team-a-ollama", nil)
+
+	if len(netpol.Spec.Ingress) != 1 {
+		t.Fatalf("ingress rules = %d, want 1", len(netpol.Spec.Ingress))
+	}
+	var sameNamespace, operatorNamespace bool
+	for _, peer := range netpol.Spec.Ingress[0].From {
+		if peer.PodSelector != nil && peer.NamespaceSelector == nil && len(peer.PodSelector.MatchLabels) == 0 {
+			sameNamespace = true
+		}
+		if peer.NamespaceSelector != nil && peer.NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"] == constants.AIChatWorkspaceNamespace {
+			operatorNamespace = true
+		}
+	}
+	if !sameNamespace {
+		t.Errorf("peers = %+v, want the pods of the same namespace", netpol.Spec.Ingress[0].From)
+	}
+	if !operatorNamespace {
+		t.Errorf("peers = %+v, want the operator namespace %s", netpol.Spec.Ingress[0].From, constants.AIChatWorkspaceNamespace)
+	}
+}
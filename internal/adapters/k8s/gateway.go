@@ -0,0 +1,106 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+/**
+ * Creates a new Gateway API HTTPRoute object.
+ *
+ * @param workspacename The name of the workspace where the HTTPRoute will be created.
+ * @param workload The name of the workload to create an HTTPRoute for.
+ * @param backendName The name of the service that the HTTPRoute will route traffic to.
+ * @param hostname The hostname that the HTTPRoute will match (e.g. example.com).
+ * @param backendPort The port number that the service is listening on.
+ * @param parentRef The Gateway (and optional listener) the HTTPRoute attaches to.
+ * @return A pointer to a new gatewayv1.HTTPRoute object.
+ */
+func NewHTTPRoute(workspacename, workload, backendName, hostname string, backendPort int32, parentRef gatewayv1.ParentReference) *gatewayv1.HTTPRoute {
+	pathType := gatewayv1.PathMatchPathPrefix
+	return &gatewayv1.HTTPRoute{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "HTTPRoute",
+			APIVersion: "gateway.networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getName(workspacename, workload),
+			Namespace: workspacename,
+			Labels: map[string]string{
+				"app.kubernetes.io/instance":  workspacename,
+				"app.kubernetes.io/component": workspacename,
+			},
+		},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{parentRef},
+			},
+			Hostnames: []gatewayv1.Hostname{gatewayv1.Hostname(hostname)},
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					Matches: []gatewayv1.HTTPRouteMatch{
+						{
+							Path: &gatewayv1.HTTPPathMatch{
+								Type:  &pathType,
+								Value: ptr.To("/"),
+							},
+						},
+					},
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						{
+							// the group, kind and weight are the defaults of the API server, set
+							// to compare the rules of an existing route.
+							BackendRef: gatewayv1.BackendRef{
+								BackendObjectReference: gatewayv1.BackendObjectReference{
+									Group: ptr.To(gatewayv1.Group("")),
+									Kind:  ptr.To(gatewayv1.Kind("Service")),
+									Name:  gatewayv1.ObjectName(backendName),
+									Port:  ptr.To(gatewayv1.PortNumber(backendPort)),
+								},
+								Weight: ptr.To(int32(1)),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+/**
+ * Creates a Gateway API ParentReference to a Gateway.
+ *
+ * @param name The name of the Gateway.
+ * @param namespace The namespace of the Gateway, left unset when empty.
+ * @param sectionName The listener on the Gateway, left unset when empty.
+ * @return A gatewayv1.ParentReference pointing at the Gateway.
+ */
+func NewGatewayParentRef(name, namespace, sectionName string) gatewayv1.ParentReference {
+	parentRef := gatewayv1.ParentReference{
+		Name: gatewayv1.ObjectName(name),
+	}
+	if namespace != "" {
+		parentRef.Namespace = ptr.To(gatewayv1.Namespace(namespace))
+	}
+	if sectionName != "" {
+		parentRef.SectionName = ptr.To(gatewayv1.SectionName(sectionName))
+	}
+	return parentRef
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// modelDownloadScript downloads a GGUF file into the cache volume and verifies its checksum. The
+// file is kept across restarts, it is only downloaded again when the checksum changes.
+const modelDownloadScript = `set -eu
+if [ ! -f "$MODEL_FILE" ]; then
+  curl -fsSL -o "$MODEL_FILE.tmp" "$MODEL_URL"
+  echo "$MODEL_SHA256  $MODEL_FILE.tmp" | sha256sum -c -
+  mv "$MODEL_FILE.tmp" "$MODEL_FILE"
+fi
+`
+
+// LlamaCppModel is the model a llama.cpp server loads at startup. Exactly one of HuggingFace,
+// URL or ClaimName is set.
+type LlamaCppModel struct {
+	// Name is the name the model is served under.
+	Name string
+
+	// HuggingFace is a GGUF repository, <org>/<repo>[:<quantization>], downloaded by the server.
+	HuggingFace string
+
+	// URL is a GGUF file downloaded by an init container running DownloadImage, verified against SHA256.
+	URL           string
+	SHA256        string
+	DownloadImage string
+
+	// ClaimName is a PersistentVolumeClaim holding the GGUF file at Path.
+	ClaimName string
+	Path      string
+}
+
+/**
+ * Creates the StatefulSet of a llama.cpp server serving one model through its OpenAI-compatible API.
+ *
+ * The server runs on CPU. The models downloaded from Hugging Face or a URL are kept on the cache
+ * volume, so a restart doesn't download them again. The ServiceAccount and the governing Service
+ * are the ones of the Ollama StatefulSet, see NewStatefulSet.
+ *
+ * @param namespace The namespace where the StatefulSet will be created.
+ * @param name The name of the StatefulSet.
+ * @param port The port the server listens on.
+ * @param volumeSize The size of the cache volume.
+ * @param containerImage The llama.cpp server image.
+ * @param model The model loaded by the server.
+ * @return A pointer to a new appsv1.StatefulSet object.
+ */
+func NewLlamaCppStatefulSet(namespace, name string, port int32, volumeSize, containerImage string, model LlamaCppModel) *appsv1.StatefulSet {
+	appLabels := map[string]string{defaultNameLabel: name}
+	saName := fmt.Sprintf("%s-ollama", namespace)
+	serviceName := fmt.Sprintf("%s-%s", namespace, constants.OllamaName)
+
+	args := []string{
+		"--host", "0.0.0.0",
+		"--port", fmt.Sprint(port),
+		"--alias", model.Name,
+	}
+	cacheMount := v1.VolumeMount{Name: constants.OllamaVolumeMountName, MountPath: constants.LlamaCppCachePath}
+	mounts := []v1.VolumeMount{cacheMount}
+	var volumes []v1.Volume
+	var initContainers []v1.Container
+
+	switch {
+	case model.HuggingFace != "":
+		args = append(args, "--hf-repo", model.HuggingFace)
+	case model.URL != "":
+		file := path.Join(constants.LlamaCppCachePath, strings.TrimPrefix(model.SHA256, "sha256:")+".gguf")
+		args = append(args, "--model", file)
+		initContainers = append(initContainers, v1.Container{
+			Name:    "download",
+			Image:   model.DownloadImage,
+			Command: []string{"sh", "-c", modelDownloadScript},
+			Env: []v1.EnvVar{
+				{Name: "MODEL_URL", Value: model.URL},
+				{Name: "MODEL_SHA256", Value: strings.TrimPrefix(model.SHA256, "sha256:")},
+				{Name: "MODEL_FILE", Value: file},
+			},
+			SecurityContext: defaultSecurityContext(),
+			VolumeMounts:    []v1.VolumeMount{cacheMount},
+		})
+	case model.ClaimName != "":
+		args = append(args, "--model", path.Join("/", modelImportVolume, model.Path))
+		mounts = append(mounts, v1.VolumeMount{Name: modelImportVolume, MountPath: "/" + modelImportVolume, ReadOnly: true})
+		volumes = append(volumes, v1.Volume{
+			Name: modelImportVolume,
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: model.ClaimName, ReadOnly: true},
+			},
+		})
+	}
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Selector:    &metav1.LabelSelector{MatchLabels: appLabels},
+			ServiceName: serviceName,
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      constants.OllamaVolumeMountName,
+						Namespace: namespace,
+					},
+					Spec: v1.PersistentVolumeClaimSpec{
+						AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+						Resources: v1.VolumeResourceRequirements{
+							Requests: v1.ResourceList{"storage": resource.MustParse(volumeSize)},
+						},
+					},
+				},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: appLabels},
+				Spec: v1.PodSpec{
+					RestartPolicy:                v1.RestartPolicyAlways,
+					ServiceAccountName:           saName,
+					AutomountServiceAccountToken: ptr.To[bool](false),
+					SecurityContext:              defaultPodSecurityContext(),
+					InitContainers:               initContainers,
+					Containers: []v1.Container{
+						{
+							Name:  constants.LlamaCppContainerName,
+							Image: containerImage,
+							Args:  args,
+							Env: []v1.EnvVar{
+								{Name: "LLAMA_CACHE", Value: constants.LlamaCppCachePath},
+								// the Hugging Face downloads go to $HOME/.cache when LLAMA_CACHE is ignored.
+								{Name: "HOME", Value: constants.LlamaCppCachePath},
+							},
+							SecurityContext: defaultSecurityContext(),
+							Ports:           []v1.ContainerPort{{ContainerPort: port}},
+							// the server answers 503 on /health until the model is loaded.
+							ReadinessProbe: &v1.Probe{
+								ProbeHandler: v1.ProbeHandler{
+									HTTPGet: &v1.HTTPGetAction{Path: "/health", Port: intstr.FromInt32(port)},
+								},
+								PeriodSeconds: 10,
+							},
+							VolumeMounts: mounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+/**
+ * SetOpenAIURL points the Open WebUI Deployment at an OpenAI-compatible API only, e.g. a llama.cpp
+ * server. The Ollama connection is disabled.
+ *
+ * @param deployment The Open WebUI Deployment returned by NewDeployment.
+ * @param baseURL The base URL of the server, without the /v1 suffix.
+ */
+func SetOpenAIURL(deployment *appsv1.Deployment, baseURL string) {
+	podSpec := &deployment.Spec.Template.Spec
+	for i := range podSpec.Containers {
+		env := podSpec.Containers[i].Env[:0]
+		for _, e := range podSpec.Containers[i].Env {
+			switch e.Name {
+			case "OLLAMA_BASE_URL":
+				continue
+			case "OPENAI_API_BASE_URL":
+				e.Value = baseURL + "/v1"
+			}
+			env = append(env, e)
+		}
+		podSpec.Containers[i].Env = append(env, v1.EnvVar{Name: "ENABLE_OLLAMA_API", Value: "false"})
+	}
+}
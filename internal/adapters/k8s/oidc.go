@@ -0,0 +1,103 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// OIDCSettings is the OpenID Connect provider Open WebUI signs the users in with.
+type OIDCSettings struct {
+	// URL is the public URL of Open WebUI, RedirectURL the callback registered with the provider.
+	URL         string
+	RedirectURL string
+
+	Issuer       string
+	ProviderName string
+	ClientID     string
+	Scopes       []string
+
+	// GroupsClaim, AllowedGroups and AdminGroup map the groups of the users to Open WebUI roles
+	// when AllowedGroups or AdminGroup is set.
+	GroupsClaim   string
+	AllowedGroups []string
+	AdminGroup    string
+
+	DisableLocalSignup bool
+}
+
+/**
+ * AddOIDC makes Open WebUI sign the users in with an OpenID Connect provider.
+ *
+ * The client secret is read from a Secret as OAUTH_CLIENT_SECRET. Its hash is set on the pod
+ * template, so the pods restart when the secret changes.
+ *
+ * @param deployment The Open WebUI Deployment returned by NewDeployment.
+ * @param settings The provider and the role mapping.
+ * @param clientSecretName The Secret holding the client secret under OAUTH_CLIENT_SECRET.
+ * @param clientSecretHash The hash of the client secret.
+ */
+func AddOIDC(deployment *appsv1.Deployment, settings OIDCSettings, clientSecretName, clientSecretHash string) {
+	env := []v1.EnvVar{
+		{Name: "WEBUI_URL", Value: settings.URL},
+		{Name: "ENABLE_OAUTH_SIGNUP", Value: "true"},
+		{Name: "OPENID_PROVIDER_URL", Value: strings.TrimSuffix(settings.Issuer, "/") + "/.well-known/openid-configuration"},
+		{Name: "OPENID_REDIRECT_URI", Value: settings.RedirectURL},
+		{Name: "OAUTH_PROVIDER_NAME", Value: settings.ProviderName},
+		{Name: "OAUTH_CLIENT_ID", Value: settings.ClientID},
+		{
+			Name: constants.OIDCClientSecretKey,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: clientSecretName},
+					Key:                  constants.OIDCClientSecretKey,
+				},
+			},
+		},
+		{Name: "OAUTH_SCOPES", Value: strings.Join(settings.Scopes, " ")},
+	}
+	if len(settings.AllowedGroups) > 0 || settings.AdminGroup != "" {
+		// an admin is allowed to sign in whether or not they are in an allowed group.
+		allowed := settings.AllowedGroups
+		if settings.AdminGroup != "" {
+			allowed = append(append([]string{}, allowed...), settings.AdminGroup)
+		}
+		env = append(env,
+			v1.EnvVar{Name: "ENABLE_OAUTH_ROLE_MANAGEMENT", Value: "true"},
+			v1.EnvVar{Name: "OAUTH_ROLES_CLAIM", Value: settings.GroupsClaim},
+			v1.EnvVar{Name: "OAUTH_ALLOWED_ROLES", Value: strings.Join(allowed, ",")},
+			v1.EnvVar{Name: "OAUTH_ADMIN_ROLES", Value: settings.AdminGroup},
+		)
+	}
+	if settings.DisableLocalSignup {
+		env = append(env, v1.EnvVar{Name: "ENABLE_SIGNUP", Value: "false"})
+	}
+
+	podSpec := &deployment.Spec.Template.Spec
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, env...)
+	}
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.Annotations[constants.OIDCSecretHashAnnotation] = clientSecretHash
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/**
+ * Creates the Role letting the owners of a workspace read and debug its workloads.
+ *
+ * The owners can read the pods, their logs, the events and the workloads, and port-forward to
+ * the pods. They can't exec into the pods nor read the Secrets.
+ *
+ * @param name The name of the Role.
+ * @param namespace The workspace namespace.
+ * @param appLabels A map of labels to apply to the Role.
+ * @return A pointer to a new rbacv1.Role object.
+ */
+func NewWorkspaceDebugRole(name, namespace string, appLabels map[string]string) *rbacv1.Role {
+	read := []string{"get", "list", "watch"}
+	return &rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Role",
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    appLabels,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods", "events", "services", "persistentvolumeclaims"}, Verbs: read},
+			{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"get"}},
+			{APIGroups: []string{""}, Resources: []string{"pods/portforward"}, Verbs: []string{"create"}},
+			{APIGroups: []string{"events.k8s.io"}, Resources: []string{"events"}, Verbs: read},
+			{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets"}, Verbs: read},
+		},
+	}
+}
+
+/**
+ * Creates the Role letting the owners of an AIChatWorkspace edit it, and only it.
+ *
+ * The validating webhook still stops the owners from changing the fields naming Secrets of the
+ * operator namespace or configuring the routes and the egress of the workspace.
+ *
+ * @param name The name of the Role.
+ * @param namespace The namespace of the AIChatWorkspace.
+ * @param workspace The name of the AIChatWorkspace.
+ * @param appLabels A map of labels to apply to the Role.
+ * @return A pointer to a new rbacv1.Role object.
+ */
+func NewWorkspaceEditorRole(name, namespace, workspace string, appLabels map[string]string) *rbacv1.Role {
+	return &rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Role",
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    appLabels,
+		},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{"apps.aichatworkspaces.io"},
+			Resources:     []string{"aichatworkspaces"},
+			ResourceNames: []string{workspace},
+			Verbs:         []string{"get", "watch", "update", "patch"},
+		}, {
+			APIGroups:     []string{"apps.aichatworkspaces.io"},
+			Resources:     []string{"aichatworkspaces/status"},
+			ResourceNames: []string{workspace},
+			Verbs:         []string{"get"},
+		}},
+	}
+}
+
+/**
+ * Creates a RoleBinding granting a Role of the same namespace to users and groups.
+ *
+ * @param name The name of the RoleBinding.
+ * @param namespace The namespace of the RoleBinding and the Role.
+ * @param roleName The name of the Role.
+ * @param users The Kubernetes user names.
+ * @param groups The Kubernetes group names.
+ * @param appLabels A map of labels to apply to the RoleBinding.
+ * @return A pointer to a new rbacv1.RoleBinding object.
+ */
+func NewRoleBinding(name, namespace, roleName string, users, groups []string, appLabels map[string]string) *rbacv1.RoleBinding {
+	subjects := make([]rbacv1.Subject, 0, len(users)+len(groups))
+	for _, user := range users {
+		subjects = append(subjects, rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: user})
+	}
+	for _, group := range groups {
+		subjects = append(subjects, rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: group})
+	}
+
+	return &rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "RoleBinding",
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    appLabels,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     roleName,
+		},
+		Subjects: subjects,
+	}
+}
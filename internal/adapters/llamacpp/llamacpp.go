@@ -0,0 +1,85 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llamacpp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// https://github.com/ggml-org/llama.cpp/tree/master/tools/server
+
+// httpClient is the HTTP client used for every llama.cpp server call. The server answers the
+// health and model endpoints without loading anything, so the timeout is short.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+/**
+ * Checks whether the llama.cpp server answers and has loaded its model.
+ *
+ * The server answers 503 while it downloads or loads the model.
+ *
+ * @param baseURL The base URL of the llama.cpp server.
+ * @return An error if the server is not ready.
+ */
+func Healthy(baseURL string) error {
+	resp, err := httpClient.Get(strings.TrimSuffix(baseURL, "/") + "/health")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("llama.cpp server is not ready: %s", resp.Status)
+	}
+	return nil
+}
+
+/**
+ * Lists the models served by the llama.cpp server through its OpenAI-compatible API.
+ *
+ * @param baseURL The base URL of the llama.cpp server.
+ * @return The names the models are served under, or an error if the listing fails.
+ */
+func ListModels(baseURL string) ([]string, error) {
+	resp, err := httpClient.Get(strings.TrimSuffix(baseURL, "/") + "/v1/models")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to list the llama.cpp models: %s", resp.Status)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, model := range list.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
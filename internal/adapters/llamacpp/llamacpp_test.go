@@ -0,0 +1,58 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package llamacpp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestHealthyAndListModels(t *testing.T) {
+	loading := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			if loading {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		case "/v1/models":
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"gemma3","object":"model"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if err := Healthy(server.URL); err == nil {
+		t.Error("Healthy() succeeded while the model loads, want an error")
+	}
+	loading = false
+	if err := Healthy(server.URL); err != nil {
+		t.Errorf("Healthy() = %v", err)
+	}
+
+	models, err := ListModels(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(models, []string{"gemma3"}) {
+		t.Errorf("ListModels() = %v, want [gemma3]", models)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ollama
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+
+	ollama "github.com/ollama/ollama/api"
+)
+
+// ErrChecksumMismatch is returned when an imported file doesn't have the expected checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+/**
+ * Returns whether the Ollama server has a blob.
+ *
+ * @param digest The sha256:<hex> digest of the blob.
+ * @param defaultBaseURL The base URL of the ollama API.
+ * @return True if the blob exists, and an error if the server could not be asked.
+ *
+ * https://github.com/ollama/ollama/blob/main/docs/api.md#check-if-a-blob-exists
+ */
+func BlobExists(digest, defaultBaseURL string) (bool, error) {
+	blobURL, err := url.JoinPath(defaultBaseURL, "api", "blobs", digest)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := instrumentedClient.Head(blobURL)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("checking blob %s: %s", digest, resp.Status)
+	}
+}
+
+/**
+ * Imports a GGUF file as a model.
+ *
+ * The file is uploaded as a blob, unless the server already has it, and the model is created from
+ * a Modelfile referencing the blob. The upload fails when the content doesn't match the digest.
+ *
+ * @param modelName The name of the model to create.
+ * @param digest The sha256:<hex> digest of the file.
+ * @param file The content of the GGUF file.
+ * @param defaultBaseURL The base URL of the ollama API.
+ * @return An error if the upload or the creation failed.
+ *
+ * https://github.com/ollama/ollama/blob/main/docs/api.md#push-a-blob
+ */
+func ImportGGUF(modelName, digest string, file io.Reader, defaultBaseURL string) error {
+	exists, err := BlobExists(digest, defaultBaseURL)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		baseClientURL, err := url.Parse(defaultBaseURL)
+		if err != nil {
+			return err
+		}
+
+		client := ollama.NewClient(baseClientURL, instrumentedClient)
+		if err := client.CreateBlob(context.Background(), digest, newVerifyingReader(file, digest)); err != nil {
+			return fmt.Errorf("uploading blob %s: %w", digest, err)
+		}
+	}
+
+	return CreateModel(modelName, fmt.Sprintf("FROM @%s\n", digest), defaultBaseURL)
+}
+
+// verifyingReader fails the read of the last byte when the content doesn't have the expected
+// digest, so a corrupted file is never completely uploaded.
+type verifyingReader struct {
+	r      io.Reader
+	hash   hash.Hash
+	digest string
+}
+
+func newVerifyingReader(r io.Reader, digest string) *verifyingReader {
+	return &verifyingReader{r: r, hash: sha256.New(), digest: digest}
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if got := "sha256:" + hex.EncodeToString(v.hash.Sum(nil)); got != v.digest {
+			return n, fmt.Errorf("%w: got %s, want %s", ErrChecksumMismatch, got, v.digest)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ollama
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// blobServer serves the blob and create endpoints of the Ollama API.
+type blobServer struct {
+	mu      sync.Mutex
+	blobs   map[string][]byte
+	created map[string]string
+}
+
+func (s *blobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/blobs/"):
+		digest := strings.TrimPrefix(r.URL.Path, "/api/blobs/")
+		if r.Method == http.MethodHead {
+			if _, ok := s.blobs[digest]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.blobs[digest] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.URL.Path == "/api/create":
+		var req struct {
+			Model     string `json:"model"`
+			Modelfile string `json:"modelfile"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.created[req.Model] = req.Modelfile
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestImportGGUF(t *testing.T) {
+	gguf := []byte("GGUF fake model weights")
+	sum := sha256.Sum256(gguf)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	fake := &blobServer{blobs: map[string][]byte{}, created: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	if err := ImportGGUF("tiny", digest, bytes.NewReader(gguf), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.blobs[digest]) != string(gguf) {
+		t.Errorf("uploaded %q", fake.blobs[digest])
+	}
+	if want := "FROM @" + digest + "\n"; fake.created["tiny"] != want {
+		t.Errorf("Modelfile = %q, want %q", fake.created["tiny"], want)
+	}
+
+	// the blob is on the server already, the file is not read again.
+	file := strings.NewReader("not read")
+	if err := ImportGGUF("tiny-copy", digest, file, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if file.Len() != len("not read") {
+		t.Error("the file should not be uploaded again")
+	}
+}
+
+func TestImportGGUFChecksumMismatch(t *testing.T) {
+	fake := &blobServer{blobs: map[string][]byte{}, created: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	digest := "sha256:" + strings.Repeat("0", 64)
+	err := ImportGGUF("tiny", digest, strings.NewReader("corrupted"), server.URL)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("ImportGGUF() = %v, want a checksum mismatch", err)
+	}
+	if len(fake.blobs) != 0 || len(fake.created) != 0 {
+		t.Error("a corrupted file should not be imported")
+	}
+}
@@ -18,34 +18,59 @@ package ollama
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	ollama "github.com/ollama/ollama/api"
 
 	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ai/modelfiles"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/metrics"
 )
 
 // https://github.com/ollama/ollama/blob/main/docs/api.md
 
+// instrumentedClient is the HTTP client used for every Ollama API call. It counts the requests
+// per endpoint so the load the operator puts on the workspaces can be measured.
+var instrumentedClient = &http.Client{Transport: countingTransport{next: http.DefaultTransport}}
+
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	metrics.ObserveOllamaRequest(req.URL.Path)
+	return t.next.RoundTrip(req)
+}
+
 // PullModel Download a model from the ollama library.
 /**
  * Downloads a model from the ollama library.
  *
+ * Models named hf.co/<org>/<repo>[:<quantization>] are pulled from the GGUF repositories of
+ * Hugging Face, which serves them through the same registry protocol.
+ *
  * @param modelName The name of the model to download.
+ * @param insecure Whether the registry certificate is verified.
  * @param defaultBaseURL The base URL of the ollama API.
- * @return An error if the download fails, or nil otherwise.
+ * @return The number of bytes downloaded, and an error if the download fails.
  *
  * https://github.com/ollama/ollama/blob/main/docs/api.md#pull-a-model
- * TODO: add support for huggingface (confirm it works)
+ * https://huggingface.co/docs/hub/ollama
  */
-func PullModel(modelName string, defaultBaseURL string) error {
-	httpClient := http.DefaultClient
+func PullModel(modelName string, insecure bool, defaultBaseURL string) (int64, error) {
+	httpClient := instrumentedClient
 
 	baseClientURL, err := url.Parse(defaultBaseURL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	client := ollama.NewClient(baseClientURL, httpClient)
@@ -53,20 +78,28 @@ func PullModel(modelName string, defaultBaseURL string) error {
 	ctx := context.Background()
 
 	req := &ollama.PullRequest{
-		Model: modelName,
+		Model:    modelName,
+		Insecure: insecure,
 	}
 
+	// Progress is reported per layer, keep the last completed count of each one.
+	layers := map[string]int64{}
 	progressFunc := func(resp ollama.ProgressResponse) error {
 		fmt.Printf("Progress: status=%v, total=%v, completed=%v\n", resp.Status, resp.Total, resp.Completed)
+		if resp.Digest != "" {
+			layers[resp.Digest] = resp.Completed
+		}
 		return nil
 	}
 
 	err = client.Pull(ctx, req, progressFunc)
-	if err != nil {
-		return err
+
+	var downloaded int64
+	for _, completed := range layers {
+		downloaded += completed
 	}
 
-	return nil
+	return downloaded, err
 }
 
 /**
@@ -78,7 +111,7 @@ func PullModel(modelName string, defaultBaseURL string) error {
  * @return An error if the copy operation fails, or nil otherwise.
  */
 func CopyModel(sourceName, destinationName string, defaultBaseURL string) error {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	baseClientURL, err := url.Parse(defaultBaseURL)
 	if err != nil {
@@ -111,7 +144,7 @@ func CopyModel(sourceName, destinationName string, defaultBaseURL string) error
  * @return An error if the creation fails, or nil otherwise.
  */
 func CreateModel(modelName, modelFile string, defaultBaseURL string) error {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	baseClientURL, err := url.Parse(defaultBaseURL)
 	if err != nil {
@@ -149,7 +182,7 @@ func CreateModel(modelName, modelFile string, defaultBaseURL string) error {
  * @return An error if the deletion fails, or nil otherwise.
  */
 func DeleteModel(modelName, defaultBaseURL string) error {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	baseClientURL, err := url.Parse(defaultBaseURL)
 	if err != nil {
@@ -180,7 +213,7 @@ func DeleteModel(modelName, defaultBaseURL string) error {
  * @return A ModelDetails object containing information about the model, or an error if the operation fails.
  */
 func ShowModel(modelName, defaultBaseURL string) (ollama.ModelDetails, error) {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	baseClientURL, err := url.Parse(defaultBaseURL)
 	if err != nil {
@@ -211,7 +244,7 @@ func ShowModel(modelName, defaultBaseURL string) (ollama.ModelDetails, error) {
  * @return A list of model names as strings, or an error if the operation fails.
  */
 func ListModels(defaultBaseURL string) ([]string, error) {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	var models = []string{}
 
@@ -236,6 +269,221 @@ func ListModels(defaultBaseURL string) ([]string, error) {
 	return models, nil
 }
 
+/**
+ * Lists the size on disk of every model in the AIChat Workspace.
+ *
+ * @param defaultBaseURL The base URL of the ollama API.
+ * @return A map of model names to their size in bytes, or an error if the operation fails.
+ */
+func ListModelSizes(defaultBaseURL string) (map[string]int64, error) {
+	httpClient := instrumentedClient
+
+	sizes := map[string]int64{}
+
+	baseClientURL, err := url.Parse(defaultBaseURL)
+	if err != nil {
+		return sizes, err
+	}
+
+	client := ollama.NewClient(baseClientURL, httpClient)
+
+	ctx := context.Background()
+
+	rp, err := client.List(ctx)
+	if err != nil {
+		return sizes, err
+	}
+
+	for _, llm := range rp.Models {
+		sizes[llm.Model] = llm.Size
+	}
+
+	return sizes, nil
+}
+
+/**
+ * Lists the manifest digest of every model in the AIChat Workspace.
+ *
+ * @param defaultBaseURL The base URL of the ollama API.
+ * @return A map of model names to their sha256:<hex> digest, or an error if the operation fails.
+ */
+func ListModelDigests(defaultBaseURL string) (map[string]string, error) {
+	httpClient := instrumentedClient
+
+	digests := map[string]string{}
+
+	baseClientURL, err := url.Parse(defaultBaseURL)
+	if err != nil {
+		return digests, err
+	}
+
+	client := ollama.NewClient(baseClientURL, httpClient)
+
+	ctx := context.Background()
+
+	rp, err := client.List(ctx)
+	if err != nil {
+		return digests, err
+	}
+
+	for _, llm := range rp.Models {
+		digests[llm.Model] = NormalizeDigest(llm.Digest)
+	}
+
+	return digests, nil
+}
+
+/**
+ * Returns the name Ollama lists a model under, with the :latest tag when the name has none.
+ */
+func FullName(name string) string {
+	if i := strings.LastIndex(name, "/"); !strings.Contains(name[i+1:], ":") {
+		return name + ":latest"
+	}
+	return name
+}
+
+/**
+ * Returns a digest in the sha256:<hex> form, Ollama lists the bare hex.
+ */
+func NormalizeDigest(digest string) string {
+	if digest == "" || strings.Contains(digest, ":") {
+		return digest
+	}
+	return "sha256:" + digest
+}
+
+// registryScheme and registryClient are used to read the model manifests from the registries,
+// insecureRegistryClient for the registries whose certificate isn't verified.
+var (
+	registryScheme         = "https"
+	registryClient         = &http.Client{Timeout: 30 * time.Second}
+	insecureRegistryClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, //nolint:gosec // opted in with insecureRegistry
+	}
+)
+
+// maxManifestSize bounds the manifests read from the registries, they are a few KB.
+const maxManifestSize = 4 << 20
+
+/**
+ * Returns the digest of the manifest a model tag points to in its registry.
+ *
+ * Model names follow the Ollama conventions: [host/][namespace/]model[:tag], defaulting to
+ * registry.ollama.ai, library and latest. The digest is the sha256 of the manifest, which is
+ * the digest Ollama lists for the installed model.
+ *
+ * @param modelName The name of the model.
+ * @param insecure Whether the registry certificate is verified.
+ * @return The sha256:<hex> digest of the manifest, and an error if the registry can't be read.
+ */
+func ManifestDigest(modelName string, insecure bool) (string, error) {
+	host, namespace, model, tag := "registry.ollama.ai", "library", modelName, "latest"
+	parts := strings.Split(modelName, "/")
+	switch len(parts) {
+	case 1:
+	case 2:
+		namespace, model = parts[0], parts[1]
+	case 3:
+		host, namespace, model = parts[0], parts[1], parts[2]
+	default:
+		return "", fmt.Errorf("invalid model name %q", modelName)
+	}
+	if name, t, ok := strings.Cut(model, ":"); ok {
+		model, tag = name, t
+	}
+
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/%s/manifests/%s", registryScheme, host, namespace, model, tag)
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+
+	httpClient := registryClient
+	if insecure {
+		httpClient = insecureRegistryClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading the manifest of %s: %s", modelName, resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(resp.Body, maxManifestSize)); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/**
+ * Creates an alias of a model, with default Modelfile parameters.
+ *
+ * Without parameters the model is copied, sharing its blobs. Otherwise the alias is created from
+ * a Modelfile setting the parameters on top of the model.
+ *
+ * @param alias The name of the alias.
+ * @param modelName The name of the model the alias points to.
+ * @param parameters The Modelfile parameters of the alias, e.g. temperature.
+ * @param defaultBaseURL The base URL of the ollama API.
+ * @return An error if the alias could not be created.
+ */
+func CreateAlias(alias, modelName string, parameters map[string]string, defaultBaseURL string) error {
+	if len(parameters) == 0 {
+		return CopyModel(modelName, alias, defaultBaseURL)
+	}
+
+	var modelfile strings.Builder
+	fmt.Fprintf(&modelfile, "FROM %s\n", modelName)
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&modelfile, "PARAMETER %s %s\n", name, parameters[name])
+	}
+	return CreateModel(alias, modelfile.String(), defaultBaseURL)
+}
+
+/**
+ * Loads a model in memory.
+ *
+ * @param modelName The name of the model to load.
+ * @param keepAlive How long the model stays loaded, nil for the Ollama default, negative to keep it loaded.
+ * @param defaultBaseURL The base URL of the ollama API.
+ * @return An error if the model could not be loaded.
+ *
+ * https://github.com/ollama/ollama/blob/main/docs/api.md#load-a-model
+ */
+func LoadModel(modelName string, keepAlive *time.Duration, defaultBaseURL string) error {
+	httpClient := instrumentedClient
+
+	baseClientURL, err := url.Parse(defaultBaseURL)
+	if err != nil {
+		return err
+	}
+
+	client := ollama.NewClient(baseClientURL, httpClient)
+
+	ctx := context.Background()
+
+	// a generate request without prompt only loads the model.
+	req := &ollama.GenerateRequest{
+		Model: modelName,
+	}
+	if keepAlive != nil {
+		req.KeepAlive = &ollama.Duration{Duration: *keepAlive}
+	}
+
+	return client.Generate(ctx, req, func(ollama.GenerateResponse) error { return nil })
+}
+
 /**
  * Checks if a model exists in the AIChat Workspace.
  *
@@ -244,7 +492,7 @@ func ListModels(defaultBaseURL string) ([]string, error) {
  * @return A boolean indicating whether the model exists, and an error if the operation fails.
  */
 func DoesModelExist(modelName string, defaultBaseURL string) (bool, error) {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	baseClientURL, err := url.Parse(defaultBaseURL)
 	if err != nil {
@@ -285,7 +533,7 @@ func DoesModelExist(modelName string, defaultBaseURL string) (bool, error) {
  * TODO: rename to CreateFromSystemPromptPattern
  */
 func CreateFromModelFile(modelName, defaultBaseURL string, patterns []string) (bool, error) {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	baseClientURL, err := url.Parse(defaultBaseURL)
 	if err != nil {
@@ -325,7 +573,7 @@ func CreateFromModelFile(modelName, defaultBaseURL string, patterns []string) (b
  * @return A list of model names as strings, or an error if the operation fails.
  */
 func ListRunningModels(defaultBaseURL string) ([]string, error) {
-	httpClient := http.DefaultClient
+	httpClient := instrumentedClient
 
 	var models []string
 
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ollama
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFullName(t *testing.T) {
+	for name, want := range map[string]string{
+		"llama3.2":           "llama3.2:latest",
+		"llama3.2:1b":        "llama3.2:1b",
+		"localhost:5000/m/x": "localhost:5000/m/x:latest",
+	} {
+		if got := FullName(name); got != want {
+			t.Errorf("FullName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestManifestDigest(t *testing.T) {
+	manifest := `{"schemaVersion":2,"layers":[]}`
+	sum := sha256.Sum256([]byte(manifest))
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/llama3.2/manifests/1b" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(manifest))
+	}))
+	defer registry.Close()
+	registryScheme = "http"
+	defer func() { registryScheme = "https" }()
+
+	host := strings.TrimPrefix(registry.URL, "http://")
+	digest, err := ManifestDigest(host+"/library/llama3.2:1b", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sha256:" + hex.EncodeToString(sum[:]); digest != want {
+		t.Errorf("ManifestDigest() = %q, want %q", digest, want)
+	}
+
+	if _, err := ManifestDigest(host+"/library/missing:1b", false); err == nil {
+		t.Error("expected an error for a missing manifest")
+	}
+}
@@ -0,0 +1,518 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openwebui calls the HTTP API of Open WebUI to manage its accounts and settings.
+package openwebui
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// https://docs.openwebui.com/getting-started/api-endpoints
+
+// httpClient is the HTTP client used for every Open WebUI call.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// ErrUnauthorized is returned when Open WebUI rejects the credentials or the token.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// APIError is an error answered by Open WebUI.
+type APIError struct {
+	Method, Path string
+	StatusCode   int
+	Detail       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Detail)
+}
+
+// Is matches ErrUnauthorized with the 401 answers.
+func (e *APIError) Is(target error) bool {
+	return target == ErrUnauthorized && e.StatusCode == http.StatusUnauthorized
+}
+
+// Session is a signed in account.
+type Session struct {
+	Token string `json:"token"`
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+/**
+ * Signs in with a local account.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param email The email of the account.
+ * @param password The password of the account.
+ * @return The session, or ErrUnauthorized if the account doesn't exist or the password is wrong.
+ */
+func SignIn(baseURL, email, password string) (Session, error) {
+	var session Session
+	err := call(http.MethodPost, baseURL, "/api/v1/auths/signin", "", map[string]string{"email": email, "password": password}, &session)
+	// the wrong credentials are answered with a 400.
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+		return session, fmt.Errorf("%w: %s", ErrUnauthorized, apiErr.Detail)
+	}
+	return session, err
+}
+
+/**
+ * Signs up a local account. The first account of Open WebUI is its admin.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param name The display name of the account.
+ * @param email The email of the account.
+ * @param password The password of the account.
+ * @return The session of the new account, or an error if signup is disabled or the email is taken.
+ */
+func SignUp(baseURL, name, email, password string) (Session, error) {
+	var session Session
+	err := call(http.MethodPost, baseURL, "/api/v1/auths/signup", "", map[string]string{"name": name, "email": email, "password": password}, &session)
+	return session, err
+}
+
+/**
+ * Updates the admin settings, e.g. ENABLE_SIGNUP and DEFAULT_USER_ROLE.
+ *
+ * The settings are read first and written back with the updated keys, Open WebUI expects every
+ * setting in the update.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param settings The settings to change.
+ * @return An error if the settings could not be read or written.
+ */
+func UpdateAdminConfig(baseURL, token string, settings map[string]any) error {
+	return updateConfig(baseURL, token, "/api/v1/auths/admin/config", settings)
+}
+
+/**
+ * Sets the models selected by default in new chats.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param models The ids of the models.
+ * @return An error if the models could not be set.
+ */
+func SetDefaultModels(baseURL, token string, models []string) error {
+	return updateConfig(baseURL, token, "/api/v1/configs/models", map[string]any{"DEFAULT_MODELS": strings.Join(models, ",")})
+}
+
+/**
+ * Limits the models Open WebUI offers from its OpenAI connections.
+ *
+ * The connections are matched by their base URL, an empty list of models offers every model of
+ * the connection. The other settings of the connections are kept.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param modelIDs The models of the connections, by base URL.
+ * @return An error if a connection is missing, or the settings could not be read or written.
+ */
+func SetOpenAIModelIDs(baseURL, token string, modelIDs map[string][]string) error {
+	current := map[string]any{}
+	if err := call(http.MethodGet, baseURL, "/openai/config", token, nil, &current); err != nil {
+		return err
+	}
+	urls, _ := current["OPENAI_API_BASE_URLS"].([]any)
+	configs, _ := current["OPENAI_API_CONFIGS"].(map[string]any)
+	if configs == nil {
+		configs = map[string]any{}
+	}
+
+	found := map[string]bool{}
+	for i, value := range urls {
+		connection, _ := value.(string)
+		connection = strings.TrimSuffix(connection, "/")
+		ids, ok := modelIDs[connection]
+		if !ok {
+			continue
+		}
+		found[connection] = true
+		if ids == nil {
+			ids = []string{}
+		}
+		config, _ := configs[strconv.Itoa(i)].(map[string]any)
+		if config == nil {
+			config = map[string]any{"enable": true}
+		}
+		config["model_ids"] = ids
+		configs[strconv.Itoa(i)] = config
+	}
+	for connection := range modelIDs {
+		if !found[connection] {
+			return fmt.Errorf("the connection %s isn't configured in Open WebUI", connection)
+		}
+	}
+
+	current["OPENAI_API_CONFIGS"] = configs
+	return call(http.MethodPost, baseURL, "/openai/config/update", token, current, nil)
+}
+
+// Banner is a message shown above the chats of every user.
+type Banner struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Content     string `json:"content"`
+	Dismissible bool   `json:"dismissible"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+/**
+ * Sets a banner shown to every user, the other banners are left untouched.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param banner The banner, replacing the banner with the same ID. It is removed when its content is empty.
+ * @return An error if the banners could not be read or written.
+ */
+func SetBanner(baseURL, token string, banner Banner) error {
+	var banners []Banner
+	if err := call(http.MethodGet, baseURL, "/api/v1/configs/banners", token, nil, &banners); err != nil {
+		return err
+	}
+
+	updated := make([]Banner, 0, len(banners)+1)
+	for _, existing := range banners {
+		if existing.ID != banner.ID {
+			updated = append(updated, existing)
+		}
+	}
+	if banner.Content != "" {
+		updated = append(updated, banner)
+	}
+	return call(http.MethodPost, baseURL, "/api/v1/configs/banners", token, map[string]any{"banners": updated}, nil)
+}
+
+// User is an account of Open WebUI.
+type User struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+/**
+ * Lists every account.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @return The accounts, or an error if they could not be listed.
+ */
+func ListUsers(baseURL, token string) ([]User, error) {
+	// the recent versions wrap the accounts in {"users": [...], "total": n}.
+	var raw json.RawMessage
+	if err := call(http.MethodGet, baseURL, "/api/v1/users/all", token, nil, &raw); err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := json.Unmarshal(raw, &users); err == nil {
+		return users, nil
+	}
+	var page struct {
+		Users []User `json:"users"`
+	}
+	if err := json.Unmarshal(raw, &page); err != nil {
+		return nil, err
+	}
+	return page.Users, nil
+}
+
+/**
+ * Creates a local account.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param name The display name of the account.
+ * @param email The email of the account.
+ * @param password The password of the account.
+ * @param role The role of the account, pending, user or admin.
+ * @return The account, or an error if it could not be created.
+ */
+func AddUser(baseURL, token, name, email, password, role string) (User, error) {
+	var user User
+	err := call(http.MethodPost, baseURL, "/api/v1/auths/add", token, map[string]string{"name": name, "email": email, "password": password, "role": role}, &user)
+	return user, err
+}
+
+/**
+ * Changes the role of an account.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param id The id of the account.
+ * @param role The role, pending, user or admin. A pending account can't use Open WebUI.
+ * @return An error if the role could not be changed.
+ */
+func UpdateUserRole(baseURL, token, id, role string) error {
+	return call(http.MethodPost, baseURL, "/api/v1/users/update/role", token, map[string]string{"id": id, "role": role}, nil)
+}
+
+// Group is a group of accounts sharing permissions and models.
+type Group struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	UserIDs     []string `json:"user_ids"`
+}
+
+/**
+ * Lists the groups.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @return The groups, or an error if they could not be listed.
+ */
+func ListGroups(baseURL, token string) ([]Group, error) {
+	var groups []Group
+	err := call(http.MethodGet, baseURL, "/api/v1/groups/", token, nil, &groups)
+	return groups, err
+}
+
+/**
+ * Creates a group without members.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param name The name of the group.
+ * @param description The description of the group.
+ * @return The group, or an error if it could not be created.
+ */
+func CreateGroup(baseURL, token, name, description string) (Group, error) {
+	var group Group
+	err := call(http.MethodPost, baseURL, "/api/v1/groups/create", token, map[string]string{"name": name, "description": description}, &group)
+	return group, err
+}
+
+/**
+ * Replaces the name, description and members of a group. Its permissions are left untouched.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param group The group, identified by its ID.
+ * @return An error if the group could not be updated.
+ */
+func UpdateGroup(baseURL, token string, group Group) error {
+	if group.UserIDs == nil {
+		group.UserIDs = []string{}
+	}
+	form := map[string]any{"name": group.Name, "description": group.Description, "user_ids": group.UserIDs}
+	return call(http.MethodPost, baseURL, "/api/v1/groups/id/"+url.PathEscape(group.ID)+"/update", token, form, nil)
+}
+
+// Prompt is a prompt inserted in the chat input with its /command.
+type Prompt struct {
+	// Command starts with a /.
+	Command string `json:"command"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+/**
+ * Lists the prompts.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @return The prompts, or an error if they could not be listed.
+ */
+func ListPrompts(baseURL, token string) ([]Prompt, error) {
+	var prompts []Prompt
+	err := call(http.MethodGet, baseURL, "/api/v1/prompts/", token, nil, &prompts)
+	return prompts, err
+}
+
+/**
+ * Creates a prompt, or updates the prompt with the same command. The prompt is shared with every user.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param prompt The prompt.
+ * @param exists Whether a prompt with the command exists.
+ * @return An error if the prompt could not be written.
+ */
+func SavePrompt(baseURL, token string, prompt Prompt, exists bool) error {
+	if exists {
+		return call(http.MethodPost, baseURL, promptPath(prompt.Command)+"/update", token, prompt, nil)
+	}
+	return call(http.MethodPost, baseURL, "/api/v1/prompts/create", token, prompt, nil)
+}
+
+/**
+ * Deletes a prompt.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param command The command of the prompt.
+ * @return An error if the prompt could not be deleted.
+ */
+func DeletePrompt(baseURL, token, command string) error {
+	return call(http.MethodDelete, baseURL, promptPath(command)+"/delete", token, nil, nil)
+}
+
+// promptPath is the path of a prompt, its command without the /.
+func promptPath(command string) string {
+	return "/api/v1/prompts/command/" + url.PathEscape(strings.TrimPrefix(command, "/"))
+}
+
+// ModelPreset is a model of Open WebUI built on a model of a connection, with its own system prompt.
+type ModelPreset struct {
+	ID          string
+	BaseModelID string
+	Name        string
+	Description string
+	System      string
+}
+
+// modelForm is the JSON representation of a ModelPreset.
+type modelForm struct {
+	ID          string `json:"id"`
+	BaseModelID string `json:"base_model_id"`
+	Name        string `json:"name"`
+	Meta        struct {
+		Description string `json:"description"`
+	} `json:"meta"`
+	Params struct {
+		System string `json:"system,omitempty"`
+	} `json:"params"`
+	IsActive bool `json:"is_active"`
+}
+
+/**
+ * Lists the model presets.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @return The model presets, or an error if they could not be listed.
+ */
+func ListModelPresets(baseURL, token string) ([]ModelPreset, error) {
+	var forms []modelForm
+	if err := call(http.MethodGet, baseURL, "/api/v1/models/", token, nil, &forms); err != nil {
+		return nil, err
+	}
+	presets := make([]ModelPreset, 0, len(forms))
+	for _, form := range forms {
+		presets = append(presets, ModelPreset{
+			ID:          form.ID,
+			BaseModelID: form.BaseModelID,
+			Name:        form.Name,
+			Description: form.Meta.Description,
+			System:      form.Params.System,
+		})
+	}
+	return presets, nil
+}
+
+/**
+ * Creates a model preset, or updates the preset with the same ID. The preset is shared with every user.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param preset The model preset.
+ * @param exists Whether a preset with the ID exists.
+ * @return An error if the preset could not be written.
+ */
+func SaveModelPreset(baseURL, token string, preset ModelPreset, exists bool) error {
+	form := modelForm{ID: preset.ID, BaseModelID: preset.BaseModelID, Name: preset.Name, IsActive: true}
+	form.Meta.Description = preset.Description
+	form.Params.System = preset.System
+	if exists {
+		return call(http.MethodPost, baseURL, "/api/v1/models/model/update?id="+url.QueryEscape(preset.ID), token, form, nil)
+	}
+	return call(http.MethodPost, baseURL, "/api/v1/models/create", token, form, nil)
+}
+
+/**
+ * Deletes a model preset.
+ *
+ * @param baseURL The base URL of Open WebUI.
+ * @param token The token of an admin session.
+ * @param id The ID of the preset.
+ * @return An error if the preset could not be deleted.
+ */
+func DeleteModelPreset(baseURL, token, id string) error {
+	return call(http.MethodDelete, baseURL, "/api/v1/models/model/delete?id="+url.QueryEscape(id), token, nil, nil)
+}
+
+// updateConfig reads a settings endpoint, updates some keys and writes every setting back.
+func updateConfig(baseURL, token, path string, settings map[string]any) error {
+	current := map[string]any{}
+	if err := call(http.MethodGet, baseURL, path, token, nil, &current); err != nil {
+		return err
+	}
+	for key, value := range settings {
+		current[key] = value
+	}
+	return call(http.MethodPost, baseURL, path, token, current, nil)
+}
+
+// call sends a JSON request to Open WebUI and decodes the JSON response into out, when set.
+func call(method, baseURL, path, token string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(baseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		// Open WebUI explains its errors in {"detail": "..."}.
+		var failure struct {
+			Detail any `json:"detail"`
+		}
+		detail := http.StatusText(resp.StatusCode)
+		if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.Detail != nil {
+			detail = fmt.Sprint(failure.Detail)
+		}
+		return &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Detail: detail}
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openwebui
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSignInAndUpdateSettings(t *testing.T) {
+	adminConfig := map[string]any{"ENABLE_SIGNUP": true, "DEFAULT_USER_ROLE": "pending", "SHOW_ADMIN_DETAILS": true}
+	banners := []Banner{{ID: "maintenance", Type: "warning", Content: "Down on Sunday"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/auths/signin" {
+			var credentials map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&credentials)
+			if credentials["password"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"detail":"The email or password provided is incorrect."}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"t0k3n","id":"1","email":"admin@example.com","role":"admin"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/auths/admin/config":
+			_ = json.NewEncoder(w).Encode(adminConfig)
+		case "POST /api/v1/auths/admin/config":
+			_ = json.NewDecoder(r.Body).Decode(&adminConfig)
+			_ = json.NewEncoder(w).Encode(adminConfig)
+		case "GET /api/v1/configs/banners":
+			_ = json.NewEncoder(w).Encode(banners)
+		case "POST /api/v1/configs/banners":
+			var form struct {
+				Banners []Banner `json:"banners"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&form)
+			banners = form.Banners
+			_ = json.NewEncoder(w).Encode(banners)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := SignIn(server.URL, "admin@example.com", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("SignIn() with a wrong password = %v, want ErrUnauthorized", err)
+	}
+	session, err := SignIn(server.URL+"/", "admin@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Token != "t0k3n" || session.Role != "admin" {
+		t.Errorf("SignIn() = %+v", session)
+	}
+
+	if err := UpdateAdminConfig(server.URL, "expired", map[string]any{"ENABLE_SIGNUP": false}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("UpdateAdminConfig() with an expired token = %v, want ErrUnauthorized", err)
+	}
+	if err := UpdateAdminConfig(server.URL, session.Token, map[string]any{"ENABLE_SIGNUP": false}); err != nil {
+		t.Fatal(err)
+	}
+	if adminConfig["ENABLE_SIGNUP"] != false || adminConfig["SHOW_ADMIN_DETAILS"] != true {
+		t.Errorf("admin config = %v, want ENABLE_SIGNUP changed and the other settings kept", adminConfig)
+	}
+
+	if err := SetBanner(server.URL, session.Token, Banner{ID: "welcome", Type: "info", Content: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(banners) != 2 || banners[1].Content != "Hello" {
+		t.Errorf("banners = %+v, want the maintenance and welcome banners", banners)
+	}
+	if err := SetBanner(server.URL, session.Token, Banner{ID: "welcome"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(banners) != 1 || banners[0].ID != "maintenance" {
+		t.Errorf("banners = %+v, want the welcome banner removed", banners)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	for name, body := range map[string]string{
+		"list": `[{"id":"1","name":"Alice","email":"alice@example.com","role":"admin"}]`,
+		"page": `{"users":[{"id":"1","name":"Alice","email":"alice@example.com","role":"admin"}],"total":1}`,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v1/users/all" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+
+		users, err := ListUsers(server.URL, "t0k3n")
+		server.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(users) != 1 || users[0] != (User{ID: "1", Name: "Alice", Email: "alice@example.com", Role: "admin"}) {
+			t.Errorf("%s: ListUsers() = %+v", name, users)
+		}
+	}
+}
+
+func TestSaveModelPreset(t *testing.T) {
+	var got map[string]any
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.String()
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	preset := ModelPreset{ID: "fabric-summarize", BaseModelID: "llama3.2:1b", Name: "summarize", Description: "Summarize", System: "# IDENTITY"}
+	if err := SaveModelPreset(server.URL, "t0k3n", preset, true); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v1/models/model/update?id=fabric-summarize" {
+		t.Errorf("path = %s, want the update of fabric-summarize", path)
+	}
+	if got["base_model_id"] != "llama3.2:1b" || got["params"].(map[string]any)["system"] != "# IDENTITY" || got["meta"].(map[string]any)["description"] != "Summarize" {
+		t.Errorf("body = %v, want the preset in the Open WebUI model form", got)
+	}
+}
+
+func TestSetOpenAIModelIDs(t *testing.T) {
+	config := map[string]any{
+		"ENABLE_OPENAI_API":    true,
+		"OPENAI_API_BASE_URLS": []any{"http://ollama:11434/v1", "https://api.openai.com/v1/", "https://api.groq.com/openai/v1"},
+		"OPENAI_API_KEYS":      []any{"", "sk-1", "gsk-2"},
+		"OPENAI_API_CONFIGS":   map[string]any{"2": map[string]any{"enable": false, "prefix_id": "groq"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /openai/config":
+			_ = json.NewEncoder(w).Encode(config)
+		case "POST /openai/config/update":
+			_ = json.NewDecoder(r.Body).Decode(&config)
+			_ = json.NewEncoder(w).Encode(config)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	modelIDs := map[string][]string{"https://api.openai.com/v1": {"gpt-4o-mini"}, "https://api.groq.com/openai/v1": nil}
+	if err := SetOpenAIModelIDs(server.URL, "t0k3n", modelIDs); err != nil {
+		t.Fatal(err)
+	}
+	configs := config["OPENAI_API_CONFIGS"].(map[string]any)
+	if got := configs["1"].(map[string]any); got["enable"] != true || !reflect.DeepEqual(got["model_ids"], []any{"gpt-4o-mini"}) {
+		t.Errorf("config of openai = %v, want the connection enabled with its models", got)
+	}
+	if got := configs["2"].(map[string]any); got["enable"] != false || got["prefix_id"] != "groq" || !reflect.DeepEqual(got["model_ids"], []any{}) {
+		t.Errorf("config of groq = %v, want its settings kept and every model offered", got)
+	}
+	if _, ok := configs["0"]; ok {
+		t.Errorf("configs = %v, want the connection of the workspace left alone", configs)
+	}
+	if keys := config["OPENAI_API_KEYS"].([]any); len(keys) != 3 || keys[1] != "sk-1" {
+		t.Errorf("OPENAI_API_KEYS = %v, want the keys kept", keys)
+	}
+
+	if err := SetOpenAIModelIDs(server.URL, "t0k3n", map[string][]string{"https://api.mistral.ai/v1": {"mistral-small"}}); err == nil {
+		t.Error("SetOpenAIModelIDs() with an unknown connection = nil, want an error")
+	}
+}
@@ -18,97 +18,492 @@ package config
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-
-	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
 
 	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
 )
 
 type Config struct {
-	DefaultDomain     string
-	OpenwebUIImageTag string
-	OllamaImageTag    string
+	DefaultDomain      string
+	OpenwebUIImageTag  string
+	OllamaImageTag     string
+	RoutingMode        string
+	GatewayName        string
+	GatewayNamespace   string
+	GatewaySectionName string
+	APIGatewayImage    string
+
+	// LlamaCppImageTag is the tag of the llama.cpp server image of the workspaces using the llamacpp engine.
+	LlamaCppImageTag string
+
+	// ClusterDomain is the DNS domain of the cluster Services, e.g. cluster.local.
+	ClusterDomain string
+
+	// RegistryMirrors maps a registry host (docker.io, ghcr.io, ...) to the host images are pulled from instead.
+	RegistryMirrors map[string]string
+
+	// IngressClassName is set on the Ingresses of the workspaces, when not empty.
+	IngressClassName string
+
+	// IngressAnnotations are added to the Ingresses of the workspaces.
+	IngressAnnotations map[string]string
+
+	// ModelImporterImage runs the Jobs importing models from a URL or a PersistentVolumeClaim. It
+	// needs sh, sha256sum and curl.
+	ModelImporterImage string
+
+	// HTTPSProxy is the proxy Ollama reaches the model registries through, when not empty.
+	HTTPSProxy string
+
+	// NoProxy lists the hosts Ollama reaches without the proxy, in the NO_PROXY format.
+	NoProxy string
+
+	// CABundle is a PEM bundle of the certificate authorities Ollama trusts on top of the system
+	// ones, e.g. to reach an internal mirror or a TLS intercepting proxy.
+	CABundle string
+
+	// InsecureRegistry allows pulling models from registries with an untrusted certificate.
+	InsecureRegistry bool
+
+	// ModelNameRewrites maps a model reference prefix to the prefix it is pulled from instead,
+	// e.g. registry.ollama.ai/library/ to mirror.internal/library/.
+	ModelNameRewrites map[string]string
+
+	// ModelCacheURL is the pull-through cache of the Ollama library shared by the workspaces,
+	// when not empty. See config/modelcache.
+	ModelCacheURL string
+
+	// Profiles are named sets of keys a workspace can select with spec.profile.
+	Profiles map[string]map[string]string
+
+	// data is the raw configuration the fields were parsed from.
+	data map[string]string
 }
 
+// OverridableKeys are the configuration keys a workspace can set through a profile or spec.overrides.
+// Keys affecting the whole cluster or the security of the workspaces (the API gateway image, the
+// registry mirrors, the model cache, the cluster domain, insecureRegistry and modelNameRewrites)
+// can only be set in the config map. insecureRegistry also turns off the TLS verification of the
+// tag checks made by the operator itself, and the workspace owners can edit their workspaces.
+var OverridableKeys = []string{
+	constants.DefaultDomain,
+	constants.OpenwebUIImageTag,
+	constants.OllamaImageTag,
+	constants.LlamaCppImageTag,
+	constants.RoutingMode,
+	constants.GatewayName,
+	constants.GatewayNamespace,
+	constants.GatewaySectionName,
+	constants.IngressClassName,
+	constants.IngressAnnotations,
+	constants.HTTPSProxy,
+	constants.NoProxy,
+	constants.CABundle,
+}
+
+// ErrInvalidConfig is wrapped by the errors of configurations failing validation.
+var ErrInvalidConfig = errors.New("invalid operator configuration")
+
+var imageTagPattern = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
 /**
- * GetConfig retrieves the configuration from a Kubernetes config map.
+ * Loader reads the operator configuration from a config map.
  *
- * This function fetches the config map and extracts the necessary values to create a new Config object.
- * It returns the Config object or an error if any of the required values are missing or cannot be retrieved.
+ * The config map is read through the client it is given, usually the manager cache, so loading
+ * the configuration on every reconcile does not call the API server.
  */
-func GetConfig() (*Config, error) {
-	configMap, err := configMap()
-	if err != nil {
-		return nil, err
+type Loader struct {
+	reader client.Reader
+	key    types.NamespacedName
+}
+
+/**
+ * NewLoader returns a Loader reading the config map name in namespace.
+ */
+func NewLoader(reader client.Reader, name, namespace string) *Loader {
+	return &Loader{reader: reader, key: types.NamespacedName{Name: name, Namespace: namespace}}
+}
+
+/**
+ * Key returns the namespaced name of the config map.
+ */
+func (l *Loader) Key() types.NamespacedName {
+	return l.key
+}
+
+/**
+ * IsConfigMap reports whether obj is the config map read by the loader.
+ */
+func (l *Loader) IsConfigMap(obj client.Object) bool {
+	return obj.GetName() == l.key.Name && obj.GetNamespace() == l.key.Namespace
+}
+
+/**
+ * Load retrieves and validates the configuration from the config map.
+ */
+func (l *Loader) Load(ctx context.Context) (*Config, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := l.reader.Get(ctx, l.key, configMap); err != nil {
+		return nil, fmt.Errorf("unable to read config map %s: %w", l.key, err)
 	}
 
-	openwebUIImageTag, err := getConfigMapString(configMap, constants.OpenwebUIImageTag)
-	if err != nil {
-		return nil, err
+	return Parse(configMap)
+}
+
+/**
+ * Parse extracts and validates the configuration held by a config map.
+ *
+ * It returns every problem found in the config map at once, or the Config when it is valid.
+ */
+func Parse(configMap *corev1.ConfigMap) (*Config, error) {
+	data := map[string]string{}
+	for key, value := range configMap.BinaryData {
+		data[key] = string(value)
 	}
+	maps.Copy(data, configMap.Data)
 
-	ollamaImageTag, err := getConfigMapString(configMap, constants.OllamaImageTag)
+	config, err := parse(data)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w in config map %s/%s: %w", ErrInvalidConfig, configMap.Namespace, configMap.Name, err)
 	}
+	return config, nil
+}
 
-	defaultDomain, err := getConfigMapString(configMap, constants.DefaultDomain)
+/**
+ * ForWorkspace returns the configuration of a workspace.
+ *
+ * The keys of the selected profile are applied on top of the config map, then the workspace
+ * overrides. Only OverridableKeys can be set by profiles and overrides.
+ *
+ * @param profile The name of the profile selected by the workspace, or an empty string.
+ * @param overrides The keys set by the workspace spec.overrides.
+ * @return The configuration of the workspace, and an error if the profile is unknown or a key is invalid.
+ */
+func (c *Config) ForWorkspace(profile string, overrides map[string]string) (*Config, error) {
+	data := map[string]string{}
+	maps.Copy(data, c.data)
+	delete(data, constants.Profiles)
+
+	if profile != "" {
+		keys, ok := c.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("%w: profile %q is not defined in the config map", ErrInvalidConfig, profile)
+		}
+		maps.Copy(data, keys)
+	}
+	if err := checkOverridable("spec.overrides", overrides); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	maps.Copy(data, overrides)
+
+	config, err := parse(data)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w for the workspace: %w", ErrInvalidConfig, err)
 	}
+	return config, nil
+}
+
+/**
+ * Equal reports whether two configurations set the same values, regardless of the keys of the
+ * config map the operator doesn't use.
+ */
+func (c *Config) Equal(other *Config) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	a, b := *c, *other
+	a.data, b.data = nil, nil
+	return reflect.DeepEqual(a, b)
+}
 
-	return &Config{
-		DefaultDomain:     defaultDomain,
-		OpenwebUIImageTag: openwebUIImageTag,
-		OllamaImageTag:    ollamaImageTag,
-	}, nil
+/**
+ * Image returns the reference of image with its registry replaced by the configured mirror, if any.
+ *
+ * Images without a registry host (e.g. ollama/ollama) are on docker.io.
+ */
+func (c *Config) Image(image string) string {
+	registry, path := "docker.io", image
+	if first, rest, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		registry, path = first, rest
+	}
 
+	mirror, ok := c.RegistryMirrors[registry]
+	if !ok {
+		return image
+	}
+	return mirror + "/" + path
 }
 
 /**
- * getConfigMapString retrieves a string value from a Kubernetes config map.
+ * RewriteModelName returns the name a model is pulled under, with the longest matching prefix of
+ * ModelNameRewrites replaced.
  *
- * This function takes a ConfigMap object and a key as input, and returns the corresponding string value.
- * If the key is not found in the ConfigMap's Data or BinaryData fields, it returns an error indicating that
- * the required key was not found.
+ * The prefixes match the full model reference, host/namespace/model:tag, the short names of the
+ * Ollama library are expanded to registry.ollama.ai/library/<model>:latest first. Names no prefix
+ * matches are returned unchanged.
  */
-func getConfigMapString(configMap *corev1.ConfigMap, key string) (string, error) {
-	if s, ok := configMap.Data[key]; ok {
-		return s, nil
+func (c *Config) RewriteModelName(name string) string {
+	ref := name
+	switch strings.Count(name, "/") {
+	case 0:
+		ref = "registry.ollama.ai/library/" + name
+	case 1:
+		ref = "registry.ollama.ai/" + name
+	}
+	if i := strings.LastIndex(ref, "/"); !strings.Contains(ref[i+1:], ":") {
+		ref += ":latest"
+	}
+
+	match := ""
+	for prefix := range c.ModelNameRewrites {
+		if strings.HasPrefix(ref, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
 	}
-	if b, ok := configMap.BinaryData[key]; ok {
-		return string(b), nil
+	if match == "" {
+		return name
 	}
-	return "", fmt.Errorf("malformed Config Map: required key %q not found", key)
+	return c.ModelNameRewrites[match] + strings.TrimPrefix(ref, match)
 }
 
 /**
- * configMap retrieves the configuration map from Kubernetes.
+ * CachedModelName returns the name a model is pulled under through the model cache, and whether
+ * the pull must allow an insecure registry.
  *
- * This function fetches a ConfigMap object with the specified name and namespace,
- * and returns it or an error if any issues occur during retrieval.
+ * The cache only serves the Ollama library: names on another registry, e.g. hf.co, and all the
+ * names when no cache is configured are returned unchanged, with InsecureRegistry. The name is
+ * expected to be rewritten by RewriteModelName already.
  */
-func configMap() (*corev1.ConfigMap, error) {
-	ctx := context.Background()
-	restConfig := ctrl.GetConfigOrDie()
-	ctrlClient, err := client.New(restConfig, client.Options{})
-	if err != nil {
-		return nil, err
+func (c *Config) CachedModelName(name string) (string, bool) {
+	if c.ModelCacheURL == "" {
+		return name, c.InsecureRegistry
 	}
 
-	configMap := &corev1.ConfigMap{}
-	if err := ctrlClient.Get(ctx, types.NamespacedName{
-		Name:      constants.AIChatWorspaceConfigMapName,
-		Namespace: constants.AIChatWorkspaceNamespace,
-	}, configMap); err != nil {
+	ref := name
+	switch strings.Count(name, "/") {
+	case 0:
+		ref = "registry.ollama.ai/library/" + name
+	case 1:
+		ref = "registry.ollama.ai/" + name
+	}
+	path, ok := strings.CutPrefix(ref, "registry.ollama.ai/")
+	if !ok {
+		return name, c.InsecureRegistry
+	}
+
+	cache, _ := url.Parse(c.ModelCacheURL)
+	return cache.Host + "/" + path, cache.Scheme == "http" || c.InsecureRegistry
+}
+
+// OpenWebUIImage returns the Open WebUI image, pulled through the registry mirrors.
+func (c *Config) OpenWebUIImage() string {
+	return c.Image(fmt.Sprintf("%s:%s", constants.OpenwebuiContainerImageName, c.OpenwebUIImageTag))
+}
+
+// OllamaImage returns the Ollama image, pulled through the registry mirrors.
+func (c *Config) OllamaImage() string {
+	return c.Image(fmt.Sprintf("%s:%s", constants.OllamaContainerImageName, c.OllamaImageTag))
+}
+
+// LlamaCppImage returns the llama.cpp server image, pulled through the registry mirrors.
+func (c *Config) LlamaCppImage() string {
+	return c.Image(fmt.Sprintf("%s:%s", constants.LlamaCppContainerImageName, c.LlamaCppImageTag))
+}
+
+// ImporterImage returns the model importer image, pulled through the registry mirrors.
+func (c *Config) ImporterImage() string {
+	return c.Image(c.ModelImporterImage)
+}
+
+// GatewayImage returns the API gateway sidecar image, pulled through the registry mirrors.
+func (c *Config) GatewayImage() string {
+	return c.Image(c.APIGatewayImage)
+}
+
+// parse builds a Config from the config map keys, collecting every validation error.
+func parse(data map[string]string) (*Config, error) {
+	var errs []error
+
+	required := func(key string) string {
+		value := data[key]
+		if value == "" {
+			errs = append(errs, fmt.Errorf("required key %q not found", key))
+		}
+		return value
+	}
+	optional := func(key, defaultValue string) string {
+		if value := data[key]; value != "" {
+			return value
+		}
+		return defaultValue
+	}
+
+	config := &Config{
+		DefaultDomain:      required(constants.DefaultDomain),
+		OpenwebUIImageTag:  required(constants.OpenwebUIImageTag),
+		OllamaImageTag:     required(constants.OllamaImageTag),
+		LlamaCppImageTag:   optional(constants.LlamaCppImageTag, constants.DefaultLlamaCppImageTag),
+		RoutingMode:        optional(constants.RoutingMode, constants.DefaultRoutingMode),
+		GatewayName:        optional(constants.GatewayName, ""),
+		GatewayNamespace:   optional(constants.GatewayNamespace, ""),
+		GatewaySectionName: optional(constants.GatewaySectionName, ""),
+		APIGatewayImage:    optional(constants.APIGatewayImage, constants.DefaultAPIGatewayImage),
+		ClusterDomain:      optional(constants.ClusterDomain, constants.DefaultClusterDomain),
+		IngressClassName:   optional(constants.IngressClassName, ""),
+		ModelImporterImage: optional(constants.ModelImporterImage, constants.DefaultModelImporterImage),
+		HTTPSProxy:         optional(constants.HTTPSProxy, ""),
+		NoProxy:            optional(constants.NoProxy, ""),
+		CABundle:           optional(constants.CABundle, ""),
+		ModelCacheURL:      optional(constants.ModelCacheURL, ""),
+		data:               data,
+	}
+
+	for key, domain := range map[string]string{constants.DefaultDomain: config.DefaultDomain, constants.ClusterDomain: config.ClusterDomain} {
+		if domain == "" {
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(domain) {
+			errs = append(errs, fmt.Errorf("%s %q: %s", key, domain, msg))
+		}
+	}
+	for key, tag := range map[string]string{constants.OpenwebUIImageTag: config.OpenwebUIImageTag, constants.OllamaImageTag: config.OllamaImageTag, constants.LlamaCppImageTag: config.LlamaCppImageTag} {
+		if tag != "" && !imageTagPattern.MatchString(tag) {
+			errs = append(errs, fmt.Errorf("%s %q is not a valid image tag", key, tag))
+		}
+	}
+	if config.RoutingMode != "Ingress" && config.RoutingMode != "GatewayAPI" {
+		errs = append(errs, fmt.Errorf("%s %q must be Ingress or GatewayAPI", constants.RoutingMode, config.RoutingMode))
+	}
+	if config.IngressClassName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(config.IngressClassName) {
+			errs = append(errs, fmt.Errorf("%s %q: %s", constants.IngressClassName, config.IngressClassName, msg))
+		}
+	}
+
+	if config.HTTPSProxy != "" {
+		if proxy, err := url.Parse(config.HTTPSProxy); err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https") || proxy.Host == "" {
+			errs = append(errs, fmt.Errorf("%s %q must be an http or https URL", constants.HTTPSProxy, config.HTTPSProxy))
+		}
+	}
+	if config.ModelCacheURL != "" {
+		if cache, err := url.Parse(config.ModelCacheURL); err != nil || (cache.Scheme != "http" && cache.Scheme != "https") || cache.Host == "" || strings.Trim(cache.Path, "/") != "" {
+			errs = append(errs, fmt.Errorf("%s %q must be an http or https URL without a path", constants.ModelCacheURL, config.ModelCacheURL))
+		}
+	}
+	if config.CABundle != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(config.CABundle)) {
+		errs = append(errs, fmt.Errorf("%s must hold PEM encoded certificates", constants.CABundle))
+	}
+
+	var err error
+	if value := data[constants.InsecureRegistry]; value != "" {
+		if config.InsecureRegistry, err = strconv.ParseBool(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s %q must be true or false", constants.InsecureRegistry, value))
+		}
+	}
+	if config.RegistryMirrors, err = parseRegistryMirrors(data[constants.RegistryMirrors]); err != nil {
+		errs = append(errs, err)
+	}
+	if config.ModelNameRewrites, err = parseModelNameRewrites(data[constants.ModelNameRewrites]); err != nil {
+		errs = append(errs, err)
+	}
+	if config.IngressAnnotations, err = parseIngressAnnotations(data[constants.IngressAnnotations]); err != nil {
+		errs = append(errs, err)
+	}
+	if config.Profiles, err = parseProfiles(data[constants.Profiles]); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
 		return nil, err
 	}
+	return config, nil
+}
+
+// parseRegistryMirrors parses "<registry>=<mirror>" entries separated by commas or new lines.
+func parseRegistryMirrors(value string) (map[string]string, error) {
+	mirrors := map[string]string{}
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		registry, mirror, ok := strings.Cut(entry, "=")
+		registry, mirror = strings.TrimSpace(registry), strings.TrimSuffix(strings.TrimSpace(mirror), "/")
+		if !ok || registry == "" || mirror == "" {
+			return nil, fmt.Errorf("%s entry %q must be <registry>=<mirror>", constants.RegistryMirrors, entry)
+		}
+		mirrors[registry] = mirror
+	}
+	return mirrors, nil
+}
 
-	return configMap, nil
+// parseModelNameRewrites parses "<prefix>=<replacement>" entries separated by commas or new lines.
+func parseModelNameRewrites(value string) (map[string]string, error) {
+	rewrites := map[string]string{}
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, replacement, ok := strings.Cut(entry, "=")
+		prefix, replacement = strings.TrimSpace(prefix), strings.TrimSpace(replacement)
+		if !ok || prefix == "" || replacement == "" || strings.ContainsAny(replacement, " @") {
+			return nil, fmt.Errorf("%s entry %q must be <prefix>=<replacement>", constants.ModelNameRewrites, entry)
+		}
+		rewrites[prefix] = replacement
+	}
+	return rewrites, nil
+}
 
+// parseIngressAnnotations parses a YAML map of annotations.
+func parseIngressAnnotations(value string) (map[string]string, error) {
+	annotations := map[string]string{}
+	if err := yaml.UnmarshalStrict([]byte(value), &annotations); err != nil {
+		return nil, fmt.Errorf("%s must be a map of strings: %w", constants.IngressAnnotations, err)
+	}
+	for name := range annotations {
+		for _, msg := range validation.IsQualifiedName(name) {
+			return nil, fmt.Errorf("%s %q: %s", constants.IngressAnnotations, name, msg)
+		}
+	}
+	return annotations, nil
+}
+
+// parseProfiles parses a YAML map of profile names to the keys they set.
+func parseProfiles(value string) (map[string]map[string]string, error) {
+	profiles := map[string]map[string]string{}
+	if err := yaml.UnmarshalStrict([]byte(value), &profiles); err != nil {
+		return nil, fmt.Errorf("%s must be a map of profile names to keys: %w", constants.Profiles, err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(profiles)) {
+		if err := checkOverridable(fmt.Sprintf("profile %q", name), profiles[name]); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+// checkOverridable returns an error naming the first key a workspace is not allowed to set.
+func checkOverridable(source string, keys map[string]string) error {
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		if !slices.Contains(OverridableKeys, key) {
+			return fmt.Errorf("%s sets %q, only %s can be overridden", source, key, strings.Join(OverridableKeys, ", "))
+		}
+	}
+	return nil
 }
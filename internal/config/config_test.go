@@ -0,0 +1,267 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func configMap(data map[string]string) *corev1.ConfigMap {
+	base := map[string]string{
+		"defaultDomain":     "localtest.me",
+		"openwebUIImageTag": "main",
+		"ollamaImageTag":    "0.4.1",
+	}
+	for key, value := range data {
+		base[key] = value
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "system"},
+		Data:       base,
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(configMap(map[string]string{
+		"registryMirrors":    "docker.io=mirror.example.com/hub, ghcr.io=mirror.example.com/ghcr/",
+		"ingressClassName":   "nginx",
+		"ingressAnnotations": "cert-manager.io/cluster-issuer: letsencrypt",
+	})).Build()
+
+	config, err := NewLoader(c, "config", "system").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClusterDomain != "cluster.local" || config.RoutingMode != "Ingress" {
+		t.Errorf("defaults not applied: clusterDomain %q, routingMode %q", config.ClusterDomain, config.RoutingMode)
+	}
+	if got, want := config.OllamaImage(), "mirror.example.com/hub/ollama/ollama:0.4.1"; got != want {
+		t.Errorf("OllamaImage() = %q, want %q", got, want)
+	}
+	if got, want := config.OpenWebUIImage(), "mirror.example.com/ghcr/open-webui/open-webui:main"; got != want {
+		t.Errorf("OpenWebUIImage() = %q, want %q", got, want)
+	}
+	if got, want := config.LlamaCppImage(), "mirror.example.com/ghcr/ggml-org/llama.cpp:server"; got != want {
+		t.Errorf("LlamaCppImage() = %q, want %q", got, want)
+	}
+	if got, want := config.Image("quay.io/org/image:v1"), "quay.io/org/image:v1"; got != want {
+		t.Errorf("Image() = %q, want %q", got, want)
+	}
+	if config.IngressClassName != "nginx" || config.IngressAnnotations["cert-manager.io/cluster-issuer"] != "letsencrypt" {
+		t.Errorf("ingress defaults not parsed: %q %v", config.IngressClassName, config.IngressAnnotations)
+	}
+
+	if _, err := NewLoader(c, "missing", "system").Load(context.Background()); err == nil || errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected a read error for a missing config map, got %v", err)
+	}
+}
+
+func TestParseReportsEveryError(t *testing.T) {
+	cm := configMap(map[string]string{
+		"ollamaImageTag":   "",
+		"routingMode":      "LoadBalancer",
+		"clusterDomain":    "Not_A_Domain",
+		"registryMirrors":  "docker.io",
+		"profiles":         "canary:\n  apiGatewayImage: evil/gateway",
+		"httpsProxy":       "proxy.internal:3128",
+		"caBundle":         "not a certificate",
+		"insecureRegistry": "maybe",
+		"modelCacheURL":    "modelcache:5000",
+	})
+
+	_, err := Parse(cm)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+	for _, want := range []string{`"ollamaImageTag" not found`, "routingMode", "clusterDomain", "registryMirrors", `sets "apiGatewayImage"`, "httpsProxy", "caBundle", "insecureRegistry", "modelCacheURL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestForWorkspace(t *testing.T) {
+	config, err := Parse(configMap(map[string]string{
+		"profiles": "canary:\n  openwebUIImageTag: dev\n  ollamaImageTag: 0.5.0",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workspace, err := config.ForWorkspace("canary", map[string]string{"ollamaImageTag": "0.5.1", "routingMode": "GatewayAPI"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workspace.OpenwebUIImageTag != "dev" || workspace.OllamaImageTag != "0.5.1" || workspace.RoutingMode != "GatewayAPI" {
+		t.Errorf("profile and overrides not applied in order: %+v", workspace)
+	}
+	if workspace.DefaultDomain != "localtest.me" {
+		t.Errorf("DefaultDomain = %q, want the config map value", workspace.DefaultDomain)
+	}
+
+	unchanged, err := config.ForWorkspace("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := config.ForWorkspace("", nil); !unchanged.Equal(again) {
+		t.Error("expected the same configuration to be equal")
+	}
+	if unchanged.Equal(workspace) {
+		t.Error("expected the overridden configuration to differ")
+	}
+
+	for name, tc := range map[string]struct {
+		profile   string
+		overrides map[string]string
+	}{
+		"unknown profile":      {profile: "missing"},
+		"not overridable":      {overrides: map[string]string{"registryMirrors": "docker.io=evil.example.com"}},
+		"insecure registry":    {overrides: map[string]string{"insecureRegistry": "true"}},
+		"model name rewrites":  {overrides: map[string]string{"modelNameRewrites": "registry.ollama.ai/=evil.example.com/"}},
+		"invalid routing mode": {overrides: map[string]string{"routingMode": "NodePort"}},
+	} {
+		if _, err := config.ForWorkspace(tc.profile, tc.overrides); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestRewriteModelName(t *testing.T) {
+	config, err := Parse(configMap(map[string]string{
+		"modelNameRewrites": "registry.ollama.ai/library/=mirror.internal/library/\nregistry.ollama.ai/=mirror.internal/ollama/\nhf.co/=mirror.internal/hf/",
+		"insecureRegistry":  "true",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.InsecureRegistry {
+		t.Error("InsecureRegistry not parsed")
+	}
+
+	for name, want := range map[string]string{
+		"llama3.2":              "mirror.internal/library/llama3.2:latest",
+		"llama3.2:1b":           "mirror.internal/library/llama3.2:1b",
+		"someone/model:7b":      "mirror.internal/ollama/someone/model:7b",
+		"hf.co/org/repo:Q4_K_M": "mirror.internal/hf/org/repo:Q4_K_M",
+		"quay.io/models/x:v1":   "quay.io/models/x:v1",
+		"localhost:5000/m/x:v1": "localhost:5000/m/x:v1",
+	} {
+		if got := config.RewriteModelName(name); got != want {
+			t.Errorf("RewriteModelName(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	if _, err := Parse(configMap(map[string]string{"modelNameRewrites": "registry.ollama.ai/library/"})); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig for an entry without replacement, got %v", err)
+	}
+}
+
+func TestCachedModelName(t *testing.T) {
+	config, err := Parse(configMap(map[string]string{"modelCacheURL": "http://modelcache.system.svc:5000"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"llama3.2":                                "modelcache.system.svc:5000/library/llama3.2",
+		"someone/model:7b":                        "modelcache.system.svc:5000/someone/model:7b",
+		"registry.ollama.ai/library/llama3.2:1b":  "modelcache.system.svc:5000/library/llama3.2:1b",
+		"hf.co/org/repo:Q4_K_M":                   "hf.co/org/repo:Q4_K_M",
+		"mirror.internal/library/llama3.2:latest": "mirror.internal/library/llama3.2:latest",
+	} {
+		got, insecure := config.CachedModelName(name)
+		if got != want {
+			t.Errorf("CachedModelName(%q) = %q, want %q", name, got, want)
+		}
+		if wantInsecure := got != name; insecure != wantInsecure {
+			t.Errorf("CachedModelName(%q) insecure = %t, want %t", name, insecure, wantInsecure)
+		}
+	}
+
+	config, err = Parse(configMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, insecure := config.CachedModelName("llama3.2"); got != "llama3.2" || insecure {
+		t.Errorf("CachedModelName without a cache = %q, %t", got, insecure)
+	}
+}
+
+// TestOverridableKeysMatchCRD keeps the spec.overrides validation of the CRD, which is written
+// by hand in the kubebuilder markers, in line with OverridableKeys.
+func TestOverridableKeysMatchCRD(t *testing.T) {
+	b, err := os.ReadFile("../../config/crd/bases/apps.aichatworkspaces.io_aichatworkspaces.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var crd struct {
+		Spec struct {
+			Versions []struct {
+				Schema struct {
+					OpenAPIV3Schema struct {
+						Properties struct {
+							Spec struct {
+								Properties struct {
+									Overrides struct {
+										MaxProperties int `json:"maxProperties"`
+										Validations   []struct {
+											Rule string `json:"rule"`
+										} `json:"x-kubernetes-validations"`
+									} `json:"overrides"`
+								} `json:"properties"`
+							} `json:"spec"`
+						} `json:"properties"`
+					} `json:"openAPIV3Schema"`
+				} `json:"schema"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(b, &crd); err != nil {
+		t.Fatal(err)
+	}
+	if len(crd.Spec.Versions) == 0 {
+		t.Fatal("the CRD has no versions")
+	}
+
+	overrides := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties.Spec.Properties.Overrides
+	if overrides.MaxProperties != len(OverridableKeys) {
+		t.Errorf("maxProperties = %d, want %d, the number of OverridableKeys", overrides.MaxProperties, len(OverridableKeys))
+	}
+	if len(overrides.Validations) != 1 {
+		t.Fatalf("x-kubernetes-validations = %+v, want the rule listing the keys", overrides.Validations)
+	}
+	var keys []string
+	for _, match := range regexp.MustCompile(`'([^']+)'`).FindAllStringSubmatch(overrides.Validations[0].Rule, -1) {
+		keys = append(keys, match[1])
+	}
+	slices.Sort(keys)
+	want := slices.Sorted(slices.Values(OverridableKeys))
+	if !slices.Equal(keys, want) {
+		t.Errorf("spec.overrides rule keys = %v, want OverridableKeys %v", keys, want)
+	}
+}
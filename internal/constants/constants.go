@@ -20,6 +20,8 @@ const (
 	Version                      = "0.0.1"
 	ManagedBy                    = "aichat-workspace-operator"
 	AIChatWorkspaceName          = "aichatworkspace"
+	AIChatWorkspaceAPIKeyName    = "aichatworkspaceapikey"
+	AIChatBackendName            = "aichatbackend"
 	AIChatWorkspaceFinalizerName = "core.aichatworkspace.io/finalizer"
 	AIChatWorkspaceNamespace     = "aichat-workspace-operator-system"
 	AIChatWorspaceConfigMapName  = "aichat-workspace-operator-config"
@@ -34,6 +36,29 @@ const (
 	OpenwebuiContainerPort     = int32(8080)
 	OpenwebuiDefaultVolumeSize = "2Gi"
 
+	// Open WebUI secrets
+	OpenwebuiSecretName                 = "openwebui-secret"
+	OpenwebuiSecretKey                  = "WEBUI_SECRET_KEY"
+	OpenwebuiSecretHashAnnotation       = "aichatworkspaces.io/openwebui-secret-hash"
+	RotateOpenwebuiSecretKeyAnnotation  = "aichatworkspaces.io/rotate-webui-secret-key"
+	RotatedOpenwebuiSecretKeyAnnotation = "aichatworkspaces.io/rotated-for"
+
+	// Open WebUI OIDC
+	OIDCSecretName           = "oidc"
+	OIDCClientSecretKey      = "OAUTH_CLIENT_SECRET"
+	OIDCSecretHashAnnotation = "aichatworkspaces.io/oidc-secret-hash"
+	OIDCCallbackPath         = "/oauth/oidc/callback"
+
+	// Open WebUI bootstrap, the keys of the admin Secret and the ID of the operator banner
+	BootstrapAdminEmailKey    = "email"
+	BootstrapAdminPasswordKey = "password"
+	BootstrapAdminNameKey     = "name"
+	BootstrapBannerID         = "aichatworkspace"
+
+	// Owners, the Role and RoleBinding are named <workspaceName>-owner in the workspace namespace
+	// and <name>-owner in the namespace of the AIChatWorkspace.
+	OwnerName = "owner"
+
 	// Ollama
 	OllamaName               = "ollama"
 	OllamaVolumeMountName    = "ollama-volume"
@@ -42,24 +67,106 @@ const (
 	OllamaPort               = int32(11434)
 	OllamaDefaultVolumeSize  = "20Gi"
 
+	// llama.cpp server. It runs as the inference workload of the workspace, which keeps the
+	// ollama name whatever its engine so its Service, routes and network policies don't change.
+	LlamaCppContainerName      = "llamacpp"
+	LlamaCppContainerImageName = "ghcr.io/ggml-org/llama.cpp"
+	LlamaCppPort               = int32(8080)
+	LlamaCppCachePath          = "/cache"
+
+	// Shared Ollama pool of an AIChatBackend
+	BackendDefaultVolumeSize = "50Gi"
+	BackendLabelName         = "aichatbackend"
+
 	// KEDA scaled-to-zero
 	ExternalServiceName      = "openwebui-http-interceptor-proxy"
 	KedaHttpInterceptorProxy = "keda-add-ons-http-interceptor-proxy.keda"
 
 	// ResourceQuota
-	ResourceQuotaName         = "rquota"
-	MaxPods                   = "2"
-	MaxPersistentVolumeClaims = "2"
+	ResourceQuotaName = "rquota"
+	// room for the model import Jobs and a claim holding the models to import.
+	MaxPods                   = "3"
+	MaxPersistentVolumeClaims = "3"
 	MaxService                = "5"
 
 	// Label Names
+	WorkspaceLabelName      = "aichatworkspace"
+	ManagedByLabelName      = "app.kubernetes.io/managed-by"
 	ServiceLabelName        = "svc"
 	ServiceAccountLabelName = "sa"
 	ResourceQuotaLabelName  = "resourceQuota"
 	PVCLabelName            = "pvc"
+	SecretLabelName         = "secret"
+	NetworkPolicyLabelName  = "netpol"
+	RoleLabelName           = "role"
+	RoleBindingLabelName    = "rolebinding"
+
+	// Gateway API
+	HTTPRouteLabelName = "httproute"
+
+	// Ollama API exposure
+	OllamaBasicAuthName      = "ollama-basic-auth"
+	OllamaBasicAuthSecretKey = "auth"
+
+	// API gateway
+	APIGatewayName            = "api-gateway"
+	APIGatewayContainerName   = "api-gateway"
+	APIGatewayPort            = int32(8000)
+	APIGatewayMetricsPort     = int32(9090)
+	APIGatewayKeysVolumeName  = "api-keys"
+	APIGatewayKeysMountPath   = "/etc/aichat-gateway/keys"
+	APIKeysName               = "api-keys"
+	APIKeyName                = "api-key"
+	APIKeySecretKey           = "apiKey"
+	APIEndpointSecretKey      = "endpoint"
+	DefaultAPIKeyID           = "default"
+	RotateAPIKeyAnnotation    = "aichatworkspaces.io/rotate-api-key"
+	RotatedAPIKeyAnnotation   = "aichatworkspaces.io/rotated-for"
+	TemplateHashAnnotation    = "aichatworkspaces.io/template-hash"
+	OrphanedSinceAnnotation   = "aichatworkspaces.io/orphaned-since"
+	ForceDeleteAnnotation     = "aichatworkspaces.io/force-delete"
+	CreatedForAnnotation      = "aichatworkspaces.io/created-for"
+	DefaultAPIGatewayImage    = "controller:latest"
+	ModelImportLabelName      = "model-import"
+	DefaultModelImporterImage = "curlimages/curl:8.11.1"
+	CABundleName              = "ca-bundle"
+	CABundleKey               = "ca.crt"
+	CABundleMountPath         = "/etc/aichat/ca"
+	CABundleHashAnnotation    = "aichatworkspaces.io/ca-bundle-hash"
+
+	// External OpenAI-compatible providers
+	ProvidersName               = "providers"
+	ProvidersKeysSecretKey      = "OPENAI_API_KEYS"
+	ProvidersKeysHashAnnotation = "aichatworkspaces.io/providers-keys-hash"
+	// ProviderKeyLabel marks the Secrets of the operator namespace a workspace may read the
+	// provider keys from, its value is the workspaceName.
+	ProviderKeyLabel = "aichatworkspaces.io/provider-key"
 
 	// Configmap Keys
-	DefaultDomain     = "defaultDomain"
-	OpenwebUIImageTag = "openwebUIImageTag"
-	OllamaImageTag    = "ollamaImageTag"
+	DefaultDomain      = "defaultDomain"
+	OpenwebUIImageTag  = "openwebUIImageTag"
+	OllamaImageTag     = "ollamaImageTag"
+	LlamaCppImageTag   = "llamaCppImageTag"
+	RoutingMode        = "routingMode"
+	GatewayName        = "gatewayName"
+	GatewayNamespace   = "gatewayNamespace"
+	GatewaySectionName = "gatewaySectionName"
+	APIGatewayImage    = "apiGatewayImage"
+	ClusterDomain      = "clusterDomain"
+	RegistryMirrors    = "registryMirrors"
+	IngressClassName   = "ingressClassName"
+	IngressAnnotations = "ingressAnnotations"
+	Profiles           = "profiles"
+	ModelImporterImage = "modelImporterImage"
+	HTTPSProxy         = "httpsProxy"
+	NoProxy            = "noProxy"
+	CABundle           = "caBundle"
+	InsecureRegistry   = "insecureRegistry"
+	ModelNameRewrites  = "modelNameRewrites"
+	ModelCacheURL      = "modelCacheURL"
+
+	// Configmap defaults
+	DefaultRoutingMode      = "Ingress"
+	DefaultClusterDomain    = "cluster.local"
+	DefaultLlamaCppImageTag = "server"
 )
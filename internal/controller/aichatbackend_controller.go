@@ -0,0 +1,477 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ollama"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+)
+
+// Reasons of the events emitted on the AIChatBackend.
+const (
+	EventReasonModelDeleted      = "ModelDeleted"
+	EventReasonModelDeleteFailed = "ModelDeleteFailed"
+)
+
+// AIChatBackendReconciler reconciles a AIChatBackend object
+type AIChatBackendReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Config loads the operator configuration. When nil, the default config map is read.
+	Config *config.Loader
+}
+
+// +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatbackends,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatbackends/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatbackends/finalizers,verbs=update
+
+/**
+ * Reconciles an AIChatBackend object.
+ *
+ * The backend runs an Ollama StatefulSet, its Service and ServiceAccount in the namespace of the
+ * AIChatBackend, owned by it so they are garbage collected with it. The models are installed by
+ * the AIChatWorkspaces using the backend, like in their dedicated Ollama; the backend counts the
+ * workspaces referencing each model in status.models and deletes the models no workspace
+ * references anymore.
+ *
+ * @param ctx The context for the reconciliation request.
+ * @param req The request to reconcile, containing the namespace and name of the AIChatBackend object.
+ * @return A ctrl.Result indicating whether the reconciliation was successful or if it should be retried.
+ */
+func (r *AIChatBackendReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	backend := &appsv1alpha1.AIChatBackend{}
+	if err := r.Get(ctx, req.NamespacedName, backend); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !backend.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	cfg, err := r.configLoader().Load(ctx)
+	if err != nil {
+		return r.setReady(ctx, backend, metav1.ConditionFalse, appsv1alpha1.InvalidConfigReason, err.Error(), err)
+	}
+
+	poolName := generateName(backend.Name, constants.OllamaName)
+	if err := r.ensureOwned(ctx, backend, k8s.NewServiceAccount(poolName, backend.Namespace, backendLabels(backend, poolName, constants.ServiceAccountLabelName))); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureOwned(ctx, backend, k8s.NewService(backend.Namespace, poolName, constants.OllamaPort, backendLabels(backend, poolName, constants.ServiceLabelName))); err != nil {
+		return ctrl.Result{}, err
+	}
+	sts, err := r.ensurePool(ctx, backend, cfg, poolName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	backend.Status.URL = k8s.ServiceURL(poolName, backend.Namespace, cfg.ClusterDomain, constants.OllamaPort)
+	ready := sts.Status.ReadyReplicas > 0
+	err = r.countModelReferences(ctx, backend, ready)
+
+	if !ready {
+		return r.setReady(ctx, backend, metav1.ConditionFalse, appsv1alpha1.BackendNotReadyReason,
+			fmt.Sprintf("waiting for StatefulSet %s to be ready", poolName), err)
+	}
+	return r.setReady(ctx, backend, metav1.ConditionTrue, appsv1alpha1.BackendReadyReason,
+		fmt.Sprintf("the Ollama pool serves %d workspaces", backend.Status.Workspaces), err)
+}
+
+/**
+ * Sets up the AIChatBackendReconciler with the provided manager.
+ *
+ * Besides the objects it owns, the controller watches the AIChatWorkspaces using the backend,
+ * so the model references are counted again when their models change, and the operator config
+ * map, which sets the Ollama image of the pool.
+ *
+ * The field indexes must be registered with SetupFieldIndexes first.
+ *
+ * @param mgr The manager to set up the controller with.
+ * @return An error if there is an issue setting up the controller, or nil otherwise.
+ */
+func (r *AIChatBackendReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv1alpha1.AIChatBackend{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ServiceAccount{}).
+		Watches(&appsv1alpha1.AIChatWorkspace{}, workspaceBackendHandler(),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapOperatorConfig),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.configLoader().IsConfigMap))).
+		Named(constants.AIChatBackendName).
+		Complete(r)
+}
+
+/**
+ * Handles the AIChatWorkspace events of the AIChatBackend controller.
+ *
+ * Updates enqueue the backend of the new and of the old spec, so a workspace leaving shared mode
+ * or switching to another backend releases its models on the former one.
+ *
+ * @return The event handler enqueuing the AIChatBackends used by the workspaces.
+ */
+func workspaceBackendHandler() handler.EventHandler {
+	enqueue := func(q workqueue.TypedRateLimitingInterface[reconcile.Request], objs ...client.Object) {
+		for _, obj := range objs {
+			workspace, ok := obj.(*appsv1alpha1.AIChatWorkspace)
+			if ok && backendMode(workspace) == appsv1alpha1.BackendModeShared {
+				q.Add(reconcile.Request{NamespacedName: backendRef(workspace)})
+			}
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(_ context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(q, e.Object)
+		},
+		UpdateFunc: func(_ context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(q, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(_ context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(q, e.Object)
+		},
+	}
+}
+
+/**
+ * Maps the operator config map to every AIChatBackend.
+ *
+ * @param ctx The context of the watch event.
+ * @param obj The config map that changed.
+ * @return The reconcile requests of the AIChatBackends.
+ */
+func (r *AIChatBackendReconciler) mapOperatorConfig(ctx context.Context, _ client.Object) []reconcile.Request {
+	backends := &appsv1alpha1.AIChatBackendList{}
+	if err := r.List(ctx, backends); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list AIChatBackends")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(backends.Items))
+	for _, backend := range backends.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&backend)})
+	}
+	return requests
+}
+
+/**
+ * Ensures the Ollama StatefulSet of the pool exists and runs the desired pod template.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param backend The AIChatBackend the pool belongs to.
+ * @param cfg The operator configuration.
+ * @param name The name of the StatefulSet.
+ * @return The StatefulSet, and an error if it could not be read, created or updated.
+ */
+func (r *AIChatBackendReconciler) ensurePool(ctx context.Context, backend *appsv1alpha1.AIChatBackend, cfg *config.Config, name string) (*appsv1.StatefulSet, error) {
+	logger := log.FromContext(ctx)
+
+	image := cfg.OllamaImage()
+	if backend.Spec.OllamaImageTag != "" {
+		image = cfg.Image(fmt.Sprintf("%s:%s", constants.OllamaContainerImageName, backend.Spec.OllamaImageTag))
+	}
+	volumeSize := constants.BackendDefaultVolumeSize
+	if backend.Spec.StorageSize != nil {
+		volumeSize = backend.Spec.StorageSize.String()
+	}
+
+	sts := k8s.NewStatefulSet(backend.Namespace, name, constants.OllamaPort, volumeSize, image)
+	sts.Labels = backendLabels(backend, name, constants.OllamaName)
+	k8s.ConfigureOllamaPool(sts, backend.Spec.Resources, backend.Spec.NumParallel, backend.Spec.MaxLoadedModels)
+	if cfg.HTTPSProxy != "" || cfg.NoProxy != "" {
+		k8s.AddEgressConfig(sts, cfg.HTTPSProxy, cfg.NoProxy, "", "")
+	}
+	hash := templateHash(sts.Spec.Template)
+	sts.Annotations = map[string]string{constants.TemplateHashAnnotation: hash}
+
+	found := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: backend.Namespace}, found)
+	if apierrors.IsNotFound(err) {
+		if err := controllerutil.SetControllerReference(backend, sts, r.Scheme); err != nil {
+			return nil, err
+		}
+		logger.Info("Creating a new StatefulSet", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		if err := r.Create(ctx, sts); err != nil {
+			return nil, err
+		}
+		r.Recorder.Eventf(backend, corev1.EventTypeNormal, EventReasonCreated, "Created StatefulSet %s", objectName(sts))
+		return sts, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !metav1.IsControlledBy(found, backend) {
+		return nil, fmt.Errorf("statefulset %s exists and is not owned by AIChatBackend %s", objectName(found), backend.Name)
+	}
+	if found.Annotations[constants.TemplateHashAnnotation] != hash {
+		logger.Info("Updating StatefulSet pod template", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+		found.Annotations[constants.TemplateHashAnnotation] = hash
+		found.Spec.Template = sts.Spec.Template
+		if err := r.Update(ctx, found); err != nil {
+			return nil, err
+		}
+		r.Recorder.Eventf(backend, corev1.EventTypeNormal, EventReasonUpdated, "Updated StatefulSet %s", objectName(found))
+	}
+	return found, nil
+}
+
+/**
+ * Ensures an object of the pool exists. Existing objects are left as they are, unless they are
+ * owned by something else.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param backend The AIChatBackend the object belongs to.
+ * @param obj The desired object.
+ * @return An error if the object could not be read or created.
+ */
+func (r *AIChatBackendReconciler) ensureOwned(ctx context.Context, backend *appsv1alpha1.AIChatBackend, obj client.Object) error {
+	found := obj.DeepCopyObject().(client.Object)
+	err := r.Get(ctx, client.ObjectKeyFromObject(obj), found)
+	if err == nil {
+		if !metav1.IsControlledBy(found, backend) {
+			return fmt.Errorf("%T %s exists and is not owned by AIChatBackend %s", obj, objectName(found), backend.Name)
+		}
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	if err := controllerutil.SetControllerReference(backend, obj, r.Scheme); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Creating object", "Object.Namespace", obj.GetNamespace(), "Object.Name", obj.GetName(), "Object.Kind", fmt.Sprintf("%T", obj))
+	if err := r.Create(ctx, obj); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(backend, corev1.EventTypeNormal, EventReasonCreated, "Created %T %s", obj, objectName(obj))
+	return nil
+}
+
+/**
+ * Counts the workspaces referencing each model of the pool into status.models.
+ *
+ * Every model of spec.models of the workspaces using the backend is referenced under its name
+ * and its alias. Models that were referenced and no longer are get deleted from the pool; they
+ * stay in status.models, without workspaces, until the deletion succeeded. Models the backend
+ * never counted, e.g. the personas or models pulled by hand, are left alone.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param backend The AIChatBackend whose status is updated, not patched.
+ * @param ready Whether the pool is running, models are only deleted then.
+ * @return An error if the workspaces could not be listed or a model could not be deleted.
+ */
+func (r *AIChatBackendReconciler) countModelReferences(ctx context.Context, backend *appsv1alpha1.AIChatBackend, ready bool) error {
+	logger := log.FromContext(ctx)
+
+	workspaces := &appsv1alpha1.AIChatWorkspaceList{}
+	if err := r.List(ctx, workspaces, client.MatchingFields{backendRefField: client.ObjectKeyFromObject(backend).String()}); err != nil {
+		return err
+	}
+
+	references := map[string][]string{}
+	var count int32
+	for _, workspace := range workspaces.Items {
+		if !workspace.DeletionTimestamp.IsZero() || !backendNamespaceAllowed(backend, workspace.Namespace) {
+			continue
+		}
+		count++
+		key := client.ObjectKeyFromObject(&workspace).String()
+		for _, model := range workspace.Spec.Models {
+			for _, name := range []string{model.Name, model.Alias} {
+				if name == "" {
+					continue
+				}
+				name = ollama.FullName(name)
+				if !slices.Contains(references[name], key) {
+					references[name] = append(references[name], key)
+				}
+			}
+		}
+	}
+
+	var errs error
+	var installed map[string]string
+	pool := inference.Ollama{}
+	for _, previous := range backend.Status.Models {
+		if _, ok := references[previous.Name]; ok {
+			continue
+		}
+		// keep the model until it is deleted.
+		references[previous.Name] = nil
+		if !ready {
+			continue
+		}
+		if installed == nil {
+			var err error
+			if installed, err = pool.ListModels(backend.Status.URL); err != nil {
+				errs = errors.Join(errs, err)
+				break
+			}
+		}
+		if _, ok := installed[previous.Name]; ok {
+			if err := pool.DeleteModel(previous.Name, backend.Status.URL); err != nil {
+				logger.Error(err, "Failed to delete model", "ModelName", previous.Name)
+				r.Recorder.Eventf(backend, corev1.EventTypeWarning, EventReasonModelDeleteFailed, "Failed to delete model %s: %v", previous.Name, err)
+				errs = errors.Join(errs, fmt.Errorf("unable to delete model %s: %w", previous.Name, err))
+				continue
+			}
+			r.Recorder.Eventf(backend, corev1.EventTypeNormal, EventReasonModelDeleted, "Deleted model %s, no workspace references it", previous.Name)
+		}
+		delete(references, previous.Name)
+	}
+
+	models := make([]appsv1alpha1.BackendModelStatus, 0, len(references))
+	for name, keys := range references {
+		slices.Sort(keys)
+		models = append(models, appsv1alpha1.BackendModelStatus{Name: name, Workspaces: keys})
+	}
+	slices.SortFunc(models, func(a, b appsv1alpha1.BackendModelStatus) int {
+		switch {
+		case a.Name < b.Name:
+			return -1
+		case a.Name > b.Name:
+			return 1
+		}
+		return 0
+	})
+
+	backend.Status.Workspaces = count
+	if !equality.Semantic.DeepEqual(backend.Status.Models, models) {
+		backend.Status.Models = models
+	}
+	return errs
+}
+
+/**
+ * Sets the Ready condition of an AIChatBackend and patches its status.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param backend The AIChatBackend to update, with its other status fields already set.
+ * @param status The status of the Ready condition.
+ * @param reason The reason of the Ready condition.
+ * @param message The message of the Ready condition.
+ * @param err The error of the reconcile, returned along with the status patch error.
+ * @return A ctrl.Result and the errors of the reconcile and of the status patch.
+ */
+func (r *AIChatBackendReconciler) setReady(ctx context.Context, backend *appsv1alpha1.AIChatBackend, status metav1.ConditionStatus, reason, message string, err error) (ctrl.Result, error) {
+	latest := &appsv1alpha1.AIChatBackend{}
+	if getErr := r.Get(ctx, client.ObjectKeyFromObject(backend), latest); getErr != nil {
+		return ctrl.Result{}, errors.Join(err, getErr)
+	}
+	apimeta.SetStatusCondition(&backend.Status.Conditions, metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: backend.Generation,
+	})
+	if patchErr := r.Status().Patch(ctx, backend, client.MergeFrom(latest)); patchErr != nil {
+		return ctrl.Result{}, errors.Join(err, patchErr)
+	}
+	return ctrl.Result{}, err
+}
+
+/**
+ * Returns the loader of the operator configuration.
+ *
+ * When the reconciler was not given one, the default config map is read through the reconciler client.
+ */
+func (r *AIChatBackendReconciler) configLoader() *config.Loader {
+	if r.Config == nil {
+		r.Config = config.NewLoader(r.Client, constants.AIChatWorspaceConfigMapName, constants.AIChatWorkspaceNamespace)
+	}
+	return r.Config
+}
+
+// backendLabels returns the labels of the objects of a pool. They don't carry the workspace
+// label, the pool belongs to no workspace.
+func backendLabels(backend *appsv1alpha1.AIChatBackend, name, component string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       name,
+		"app.kubernetes.io/part-of":    fmt.Sprintf("aichat-backend-%s", backend.Name),
+		"app.kubernetes.io/component":  component,
+		"app.kubernetes.io/version":    constants.Version,
+		"app.kubernetes.io/managed-by": constants.ManagedBy,
+		constants.BackendLabelName:     backend.Name,
+	}
+}
+
+// backendNamespaceAllowed reports whether the workspaces of namespace can use the backend.
+func backendNamespaceAllowed(backend *appsv1alpha1.AIChatBackend, namespace string) bool {
+	return namespace == backend.Namespace || slices.Contains(backend.Spec.AllowedNamespaces, namespace)
+}
+
+// backendMode returns the backend mode of the workspace, dedicated when spec.backend is omitted.
+func backendMode(instance *appsv1alpha1.AIChatWorkspace) appsv1alpha1.BackendMode {
+	if instance.Spec.Backend == nil || instance.Spec.Backend.Mode == "" {
+		return appsv1alpha1.BackendModeDedicated
+	}
+	return instance.Spec.Backend.Mode
+}
+
+// inferenceBackend returns the inference backend of a workspace. The pools of the shared mode run Ollama.
+func inferenceBackend(instance *appsv1alpha1.AIChatWorkspace) (inference.Backend, error) {
+	if instance.Spec.Backend == nil || backendMode(instance) == appsv1alpha1.BackendModeShared {
+		return inference.Ollama{}, nil
+	}
+	return inference.For(instance.Spec.Backend.Engine)
+}
+
+// backendRef returns the namespaced name of the AIChatBackend referenced by a workspace in shared mode.
+func backendRef(instance *appsv1alpha1.AIChatWorkspace) types.NamespacedName {
+	if instance.Spec.Backend == nil || instance.Spec.Backend.BackendRef == nil {
+		return types.NamespacedName{}
+	}
+	namespace := instance.Spec.Backend.BackendRef.Namespace
+	if namespace == "" {
+		namespace = instance.Namespace
+	}
+	return types.NamespacedName{Name: instance.Spec.Backend.BackendRef.Name, Namespace: namespace}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func sharedBackend(url string, ready bool) *appsv1alpha1.AIChatBackend {
+	backend := &appsv1alpha1.AIChatBackend{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: constants.AIChatWorkspaceNamespace},
+		Status:     appsv1alpha1.AIChatBackendStatus{URL: url},
+	}
+	if ready {
+		backend.Status.Conditions = []metav1.Condition{{Type: appsv1alpha1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: appsv1alpha1.BackendReadyReason}}
+	}
+	return backend
+}
+
+func sharedWorkspace(name string, models ...appsv1alpha1.ModelSpec) *appsv1alpha1.AIChatWorkspace {
+	workspace := configuredWorkspace(name, "", nil)
+	workspace.Spec.Backend = &appsv1alpha1.BackendSpec{
+		Mode:       appsv1alpha1.BackendModeShared,
+		BackendRef: &appsv1alpha1.BackendReference{Name: "pool"},
+	}
+	workspace.Spec.Models = models
+	return workspace
+}
+
+func TestAIChatBackendReconcileCreatesPool(t *testing.T) {
+	backend := sharedBackend("", false)
+	c := newFakeClient(t, operatorConfigMap(nil), backend)
+	r := &AIChatBackendReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(backend)}); err != nil {
+		t.Fatal(err)
+	}
+
+	key := types.NamespacedName{Name: "pool-ollama", Namespace: backend.Namespace}
+	sts := &appsv1.StatefulSet{}
+	if err := c.Get(context.Background(), key, sts); err != nil {
+		t.Fatal(err)
+	}
+	if sts.Spec.ServiceName != key.Name || sts.Spec.Template.Spec.ServiceAccountName != key.Name {
+		t.Errorf("StatefulSet uses service %q and service account %q, want %q", sts.Spec.ServiceName, sts.Spec.Template.Spec.ServiceAccountName, key.Name)
+	}
+	if _, ok := sts.Labels[constants.WorkspaceLabelName]; ok {
+		t.Error("the pool must not carry the workspace label")
+	}
+	if !metav1.IsControlledBy(sts, backend) {
+		t.Error("the StatefulSet should be owned by the AIChatBackend")
+	}
+	if err := c.Get(context.Background(), key, &corev1.Service{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.Background(), key, &corev1.ServiceAccount{}); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := &appsv1alpha1.AIChatBackend{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(backend), updated); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(updated.Status.URL, "http://pool-ollama.") {
+		t.Errorf("status.url = %q", updated.Status.URL)
+	}
+	if condition := apimeta.FindStatusCondition(updated.Status.Conditions, appsv1alpha1.ConditionTypeReady); condition == nil || condition.Reason != appsv1alpha1.BackendNotReadyReason {
+		t.Errorf("Ready condition = %+v, want %s", condition, appsv1alpha1.BackendNotReadyReason)
+	}
+}
+
+func TestAIChatBackendCountsModelReferences(t *testing.T) {
+	fake := &fakeOllama{installed: map[string]string{
+		"llama3.2:1b":    strings.Repeat("a", 64),
+		"mistral:latest": strings.Repeat("b", 64),
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	backend := sharedBackend(server.URL, true)
+	backend.Status.Models = []appsv1alpha1.BackendModelStatus{
+		{Name: "llama3.2:1b", Workspaces: []string{"aichat-workspace-operator-system/team-a"}},
+		{Name: "mistral:latest", Workspaces: []string{"aichat-workspace-operator-system/team-c"}},
+		{Name: "phi3:latest", Workspaces: []string{"aichat-workspace-operator-system/team-c"}},
+	}
+	other := sharedWorkspace("team-d", appsv1alpha1.ModelSpec{Name: "gemma2:2b"})
+	other.Namespace = "team-d"
+	c := newFakeClient(t,
+		sharedWorkspace("team-a", appsv1alpha1.ModelSpec{Name: "llama3.2:1b", Alias: "assistant"}),
+		sharedWorkspace("team-b", appsv1alpha1.ModelSpec{Name: "llama3.2:1b"}),
+		configuredWorkspace("team-c", "", nil),
+		other,
+	)
+	recorder := record.NewFakeRecorder(20)
+	r := &AIChatBackendReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+	if err := r.countModelReferences(context.Background(), backend, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if backend.Status.Workspaces != 2 {
+		t.Errorf("status.workspaces = %d, want 2", backend.Status.Workspaces)
+	}
+	want := []appsv1alpha1.BackendModelStatus{
+		{Name: "assistant:latest", Workspaces: []string{"aichat-workspace-operator-system/team-a"}},
+		{Name: "llama3.2:1b", Workspaces: []string{"aichat-workspace-operator-system/team-a", "aichat-workspace-operator-system/team-b"}},
+	}
+	if !reflect.DeepEqual(backend.Status.Models, want) {
+		t.Errorf("status.models = %+v, want %+v", backend.Status.Models, want)
+	}
+	// phi3 was never installed, only the unreferenced model of the pool is deleted.
+	if got := strings.Join(fake.deletes, ","); got != "mistral:latest" {
+		t.Errorf("deleted %q, want mistral:latest", got)
+	}
+}
+
+func TestAIChatBackendKeepsModelsWhileNotReady(t *testing.T) {
+	backend := sharedBackend("http://127.0.0.1:1", false)
+	backend.Status.Models = []appsv1alpha1.BackendModelStatus{{Name: "mistral:latest"}}
+	c := newFakeClient(t)
+	r := &AIChatBackendReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	if err := r.countModelReferences(context.Background(), backend, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.Status.Models) != 1 || len(backend.Status.Models[0].Workspaces) != 0 {
+		t.Errorf("status.models = %+v, want the unreferenced model kept until it can be deleted", backend.Status.Models)
+	}
+}
+
+func TestEnsureSharedBackend(t *testing.T) {
+	fake := &fakeOllama{
+		tags:      map[string]string{"llama3.2:1b": strings.Repeat("a", 64)},
+		installed: map[string]string{},
+		created:   map[string]string{},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	workspace := sharedWorkspace("team-a", appsv1alpha1.ModelSpec{Name: "llama3.2:1b"})
+	dedicated := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "team-a-ollama", Namespace: "team-a"}}
+	backend := sharedBackend(server.URL, false)
+	c := newFakeClient(t, workspace, dedicated, backend)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	_, result, err := r.ensureSharedBackend(context.Background(), workspace, testConfig(t))
+	if err != nil || result == nil || result.RequeueAfter == 0 {
+		t.Fatalf("ensureSharedBackend() = %v, %v, want a requeue until the backend is ready", result, err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(dedicated), &appsv1.StatefulSet{}); !apierrors.IsNotFound(err) {
+		t.Errorf("the dedicated Ollama should be deleted, got %v", err)
+	}
+
+	apimeta.SetStatusCondition(&backend.Status.Conditions, metav1.Condition{Type: appsv1alpha1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: appsv1alpha1.BackendReadyReason})
+	if err := c.Status().Update(context.Background(), backend); err != nil {
+		t.Fatal(err)
+	}
+	url, result, err := r.ensureSharedBackend(context.Background(), workspace, testConfig(t))
+	if err != nil || result != nil {
+		t.Fatalf("ensureSharedBackend() = %v, %v", result, err)
+	}
+	if url != server.URL {
+		t.Errorf("url = %q, want %q", url, server.URL)
+	}
+	if got := strings.Join(fake.pulls, ","); got != "llama3.2:1b" {
+		t.Errorf("pulled %q on the pool", got)
+	}
+
+	// workspaces of other namespaces must be allowed by the backend.
+	workspace.Namespace = "team-b"
+	workspace.Spec.Backend.BackendRef.Namespace = backend.Namespace
+	if _, _, err := r.ensureSharedBackend(context.Background(), workspace, testConfig(t)); !errors.Is(err, reconcile.TerminalError(nil)) {
+		t.Errorf("ensureSharedBackend() error = %v, want a terminal error", err)
+	}
+}
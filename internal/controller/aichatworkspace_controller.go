@@ -18,28 +18,44 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"strings"
 	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
 	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/metrics"
 
 	"github.com/go-logr/logr"
 )
 
 const (
-	ReconcileErrorInterval       = 10 * time.Second
-	ReconcileSuccessInterval     = 30 * time.Second
+	// UsageRefreshInterval is how often status.usage is refreshed from the API gateway. The
+	// usage summary changes without any watched object changing, so it is polled.
+	UsageRefreshInterval = 5 * time.Minute
+
+	// NamespaceDeletionPollInterval is how often a deleted workspace checks whether its namespace
+	// is gone, in addition to the namespace watch.
+	NamespaceDeletionPollInterval = 10 * time.Second
+
 	reconcileStarted             = "staring reconcile"
 	aichatWorkspaceFinalizerName = "core.aichatworkspace.io/finalizer"
 )
@@ -50,6 +66,9 @@ type AIChatWorkspaceReconciler struct {
 	kubeconfig *restclient.Config
 	Scheme     *runtime.Scheme
 	Recorder   record.EventRecorder
+
+	// Config loads the operator configuration. When nil, the default config map is read.
+	Config *config.Loader
 }
 
 type AIChatWorkspaceInstance struct {
@@ -58,6 +77,25 @@ type AIChatWorkspaceInstance struct {
 	ctx                   context.Context
 	aichatWorkspaceConfig *appsv1alpha1.AIChatWorkspace
 	logger                logr.Logger
+
+	// step is the running step of the reconcile chain, timed from stepStarted.
+	step        string
+	stepStarted time.Time
+}
+
+// startStep records the duration of the running step and starts timing the next one.
+// Steps call the next step from their execute, so each step starts the clock itself.
+func (instance *AIChatWorkspaceInstance) startStep(step string) {
+	instance.endStep()
+	instance.step, instance.stepStarted = step, time.Now()
+}
+
+// endStep records the duration of the running step, if any.
+func (instance *AIChatWorkspaceInstance) endStep() {
+	if instance.step != "" {
+		metrics.ObserveStep(instance.step, instance.stepStarted)
+		instance.step = ""
+	}
 }
 
 type AIChatWorkspace interface {
@@ -73,11 +111,13 @@ var (
 // +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatworkspaces/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatworkspaces/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=*
-// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=*
-// +kubebuilder:rbac:groups="",resources=namespaces;pods;services;persistentvolumeclaims;serviceaccounts;resourcequotas,verbs=*
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;networkpolicies,verbs=*
+// +kubebuilder:rbac:groups="",resources=namespaces;pods;services;persistentvolumeclaims;serviceaccounts;resourcequotas;secrets;configmaps,verbs=*
 // +kubebuilder:rbac:groups="",resources=events,verbs=create
 // +kubebuilder:rbac:groups="metrics.k8s.io",resources=pods,verbs=get;watch;list
 // +kubebuilder:rbac:groups="http.keda.sh",resources=httpscaledobjects,verbs=*
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 
 /**
  * Reconciles an AIChatWorkspace object by executing a series of steps in order.
@@ -116,30 +156,52 @@ func (r *AIChatWorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	createStep.setNext(&updateStep)
 	updateStep.setNext(&deleteStep)
 
-	return initStep.execute(&instance)
+	defer instance.endStep()
+	result, err := initStep.execute(&instance)
+	if err == nil && result.IsZero() && instance.aichatWorkspaceConfig != nil {
+		result.RequeueAfter = scheduledRequeue(instance.aichatWorkspaceConfig)
+	}
+	return result, err
 }
 
 /**
  * Sets up the AIChatWorkspaceReconciler with the provided manager.
  *
- * This function is responsible for setting up the controller's dependencies and
- * registering it with the manager. It also defines the resources that the
- * controller owns, which includes Namespaces, ResourceQuotas, ServiceAccounts,
- * PersistentVolumeClaims, Services, Deployments, and StatefulSets.
+ * The controller is driven by watches rather than periodic requeues. Spec and annotation changes
+ * of the AIChatWorkspace trigger a reconcile, status updates written by the controller itself do
+ * not. The objects created in the workspace namespace are mapped back to their AIChatWorkspace by
+ * the aichatworkspace label, as owner references can't point across namespaces. Changes to the
+ * operator ConfigMap reconcile the workspaces whose configuration changed, and an AIChatBackend
+ * becoming ready or moving reconciles the workspaces using it.
+ *
+ * The field indexes must be registered with SetupFieldIndexes first.
  *
  * @param mgr The manager to set up the controller with.
  * @return An error if there is an issue setting up the controller, or nil otherwise.
  */
 func (r *AIChatWorkspaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&appsv1alpha1.AIChatWorkspace{}).
-		Owns(&corev1.Namespace{}).
-		Owns(&corev1.ResourceQuota{}).
-		Owns(&corev1.ServiceAccount{}).
-		Owns(&corev1.PersistentVolumeClaim{}).
-		Owns(&corev1.Service{}).
-		Owns(&appsv1.Deployment{}).
-		Owns(&appsv1.StatefulSet{}).
+	bldr := ctrl.NewControllerManagedBy(mgr).
+		For(&appsv1alpha1.AIChatWorkspace{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}),
+		)).
+		Watches(&corev1.ConfigMap{}, r.configMapHandler(), builder.WithPredicates(r.isOperatorConfig())).
+		Watches(&appsv1alpha1.AIChatBackend{}, handler.EnqueueRequestsFromMapFunc(r.mapBackendWorkspaces), builder.WithPredicates(backendReadyChanged))
+
+	objs := watchedWorkspaceObjects(mgr.GetRESTMapper())
+	for _, obj := range objs {
+		bldr = bldr.Watches(obj, handler.EnqueueRequestsFromMapFunc(r.mapWorkspaceObject), builder.WithPredicates(hasWorkspaceLabel))
+	}
+
+	// the cache only holds labelled objects, label the ones of earlier versions once the manager leads.
+	reader := mgr.GetAPIReader()
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		r.trackExistingObjects(ctx, reader, objs)
+		return nil
+	})); err != nil {
+		return err
+	}
+
+	return bldr.
 		Named(constants.AIChatWorkspaceName).
 		Complete(r)
 }
@@ -147,29 +209,57 @@ func (r *AIChatWorkspaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 /**
  * Finishes the reconciliation process by determining if it was successful or not.
  *
- * If an error occurred during the reconciliation, this function will return a
- * ctrl.Result with Requeue set to true and RequeueAfter set to ReconcileErrorInterval.
- * If no error occurred, but requeueImmediate is true, it will return a ctrl.Result
- * with Requeue set to true and RequeueAfter set to 0. Otherwise, it will return a
- * ctrl.Result with Requeue set to true and RequeueAfter set to ReconcileSuccessInterval.
+ * Errors are returned as is, so the request is retried with the exponential backoff of the
+ * controller workqueue. When result is set, e.g. while waiting for Ollama to start, it is
+ * passed through. Otherwise the AIChatWorkspace is not requeued and the next reconcile is
+ * triggered by a watch event.
  *
  * @param err The error that occurred during reconciliation, if any.
- * @param requeueImmediate Whether or not the controller should be immediately requeued.
+ * @param result The result requested by the reconciliation, if any.
  * @return A ctrl.Result indicating whether the reconciliation was successful or if it should be retried.
  */
-func (r *AIChatWorkspaceReconciler) finishReconcile(err error, requeueImmediate bool) (ctrl.Result, error) {
+func (r *AIChatWorkspaceReconciler) finishReconcile(err error, result *ctrl.Result) (ctrl.Result, error) {
 	if err != nil {
-		interval := ReconcileErrorInterval
-		if requeueImmediate {
-			interval = 0
-		}
-		return ctrl.Result{Requeue: true, RequeueAfter: interval}, err
+		return ctrl.Result{}, err
+	}
+	if result != nil {
+		return *result, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+/**
+ * Returns when a reconciled AIChatWorkspace has to be reconciled again without a watch event.
+ *
+ * Only state that isn't observable through the Kubernetes API is polled: the token usage metered
+ * by the API gateway, the model tags in the registries with the OnTagChange update policy, the
+ * external providers of spec.providers, and the Open WebUI members and patterns which failed to
+ * sync.
+ *
+ * @param instance The AIChatWorkspace that was reconciled.
+ * @return The delay before the next reconcile, 0 to wait for a watch event.
+ */
+func scheduledRequeue(instance *appsv1alpha1.AIChatWorkspace) time.Duration {
+	if instance.DeletionTimestamp != nil {
+		return 0
+	}
+	var requeue time.Duration
+	if apiAuthMode(instance) == appsv1alpha1.APIAuthModeAPIKey {
+		requeue = UsageRefreshInterval
+	}
+	if interval, ok := modelUpdateCheckInterval(instance); ok && (requeue == 0 || interval < requeue) {
+		requeue = interval
+	}
+	if len(instance.Spec.Providers) > 0 && (requeue == 0 || ProviderCheckInterval < requeue) {
+		requeue = ProviderCheckInterval
+	}
+	if membersFailed(instance) && (requeue == 0 || MemberSyncRetryInterval < requeue) {
+		requeue = MemberSyncRetryInterval
 	}
-	interval := ReconcileSuccessInterval
-	if requeueImmediate {
-		interval = 0
+	if patternsPublishFailed(instance) && (requeue == 0 || PatternPublishRetryInterval < requeue) {
+		requeue = PatternPublishRetryInterval
 	}
-	return ctrl.Result{Requeue: true, RequeueAfter: interval}, nil
+	return requeue
 }
 
 /**
@@ -208,43 +298,121 @@ func defaultLabels(namespace string, name string, component string) map[string]s
 	partOf := fmt.Sprintf("aichat-workspace-%s", namespace)
 
 	return map[string]string{
-		"app.kubernetes.io/name":       name,
-		"app.kubernetes.io/part-of":    partOf,
-		"app.kubernetes.io/component":  component,
-		"app.kubernetes.io/version":    constants.Version,
-		"app.kubernetes.io/managed-by": constants.ManagedBy,
-		"aichatworkspace":              namespace,
+		"app.kubernetes.io/name":      name,
+		"app.kubernetes.io/part-of":   partOf,
+		"app.kubernetes.io/component": component,
+		"app.kubernetes.io/version":   constants.Version,
+		constants.ManagedByLabelName:  constants.ManagedBy,
+		constants.WorkspaceLabelName:  namespace,
 	}
 }
 
 /**
- * Deletes an AIChatWorkspace object and its associated resources.
+ * Deletes the namespace of an AIChatWorkspace and the resources in it.
  *
- * This function takes a context, logger, and instance as parameters. It deletes the
- * namespace with the given name from the spec of the provided instance. If any error
- * occurs during this process, it returns that error; otherwise, it logs information about
- * deleting the AIChatWorkspace object and returns nil.
+ * The deletion of the namespace is only started here, the namespace controller removes its content
+ * asynchronously. The namespace is returned until it is gone so the finalizer can wait for it.
+ * Works whether or not the workspace was ever fully created. A namespace the operator didn't create
+ * for this workspace, e.g. an existing namespace named after it, is left in place.
  *
  * @param ctx The context for the request to the Kubernetes API.
  * @param instance The AIChatWorkspace object to be deleted.
- * @return An error if there is a problem deleting the resources associated with the AIChatWorkspace object, or nil otherwise.
+ * @return The namespace while it is terminating, nil once it is gone, and an error if the namespace could not be read or deleted.
  */
-func (r *AIChatWorkspaceReconciler) deleteAIChatWorkspace(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) error {
+func (r *AIChatWorkspaceReconciler) deleteAIChatWorkspace(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (*corev1.Namespace, error) {
 	logger := log.FromContext(ctx)
 
-	namespace := &corev1.Namespace{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: instance.Spec.WorkspaceName,
-		},
+	namespace := &corev1.Namespace{}
+	err := r.Get(ctx, types.NamespacedName{Name: instance.Spec.WorkspaceName}, namespace)
+	if apierrors.IsNotFound(err) {
+		metrics.DeleteWorkspace(instance.Spec.WorkspaceName)
+		logger.Info("deleted aichatworkspace", "aichatworkspace", instance.Spec.WorkspaceName, "action", "deleted")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
-	err := r.Delete(context.TODO(), namespace)
-	if err != nil {
+
+	if !createdForWorkspace(instance, namespace) {
+		metrics.DeleteWorkspace(instance.Spec.WorkspaceName)
+		logger.Info("leaving the namespace the operator didn't create", "aichatworkspace", instance.Spec.WorkspaceName, "action", "kept")
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonNamespaceKept,
+			"Namespace %s was not created for this workspace, it is left in place with the objects of the workspace", namespace.Name)
+		return nil, nil
+	}
+
+	if namespace.DeletionTimestamp == nil {
+		logger.Info("deleting aichatworkspace namespace", "aichatworkspace", instance.Spec.WorkspaceName, "action", "deleting")
+		if err := r.Delete(ctx, namespace); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+	}
+
+	return namespace, nil
+}
+
+/**
+ * Describes what keeps a terminating namespace from being removed.
+ *
+ * @param namespace The terminating namespace.
+ * @return The messages of the namespace deletion conditions that are true, or an empty string.
+ */
+func namespaceDeletionBlockers(namespace *corev1.Namespace) string {
+	var blockers []string
+	for _, condition := range namespace.Status.Conditions {
+		switch condition.Type {
+		case corev1.NamespaceDeletionDiscoveryFailure,
+			corev1.NamespaceDeletionContentFailure,
+			corev1.NamespaceDeletionGVParsingFailure,
+			corev1.NamespaceContentRemaining,
+			corev1.NamespaceFinalizersRemaining:
+			if condition.Status == corev1.ConditionTrue {
+				blockers = append(blockers, condition.Message)
+			}
+		}
+	}
+	return strings.Join(blockers, "; ")
+}
+
+/**
+ * Deletes an object of the workspace if it exists.
+ *
+ * Objects that are already gone, or whose kind is not installed in the cluster
+ * (e.g. Gateway API CRDs), are ignored.
+ *
+ * @param ctx The context for the request to the Kubernetes API.
+ * @param obj An empty object of the kind to delete.
+ * @param namespace The namespace of the object.
+ * @param name The name of the object.
+ * @return An error if the object could not be deleted, or nil otherwise.
+ */
+func (r *AIChatWorkspaceReconciler) deleteIfExists(ctx context.Context, obj client.Object, namespace, name string) error {
+	logger := log.FromContext(ctx)
+
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, obj); err != nil {
+		if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			return nil
+		}
 		return err
 	}
 
-	logger.Info("deleted aichatworkspace", "aichatworkspace", instance.Spec.WorkspaceName, "action", "deleted")
+	logger.Info("Deleting object", "Object.Namespace", namespace, "Object.Name", name, "Object.Kind", fmt.Sprintf("%T", obj))
+	return client.IgnoreNotFound(r.Delete(ctx, obj))
+}
 
-	return nil
+/**
+ * Returns a short hash of a pod template.
+ *
+ * The hash is stored on the owning workload so changes to the desired template can be
+ * detected without comparing against the fields defaulted by the API server.
+ *
+ * @param template The desired pod template.
+ * @return The hex encoded FNV-1a hash of the template.
+ */
+func templateHash(template corev1.PodTemplateSpec) string {
+	hasher := fnv.New64a()
+	b, _ := json.Marshal(template)
+	hasher.Write(b)
+	return fmt.Sprintf("%x", hasher.Sum64())
 }
 
 /**
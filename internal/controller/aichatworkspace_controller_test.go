@@ -23,6 +23,7 @@ import (
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -55,7 +56,7 @@ var _ = Describe("AIChatWorkspace Controller", func() {
 					Spec: appsv1alpha1.AIChatWorkspaceSpec{
 						WorkspaceName: "e2e-test",
 						WorkspaceEnv:  "dev",
-						Models:        []string{"gemma2:2b", "phi3.5:latest"},
+						Models:        []appsv1alpha1.ModelSpec{{Name: "gemma2:2b"}, {Name: "phi3.5:latest"}},
 					},
 				}
 				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
@@ -74,8 +75,9 @@ var _ = Describe("AIChatWorkspace Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &AIChatWorkspaceReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
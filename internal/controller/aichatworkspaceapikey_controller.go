@@ -0,0 +1,379 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/gateway"
+)
+
+const (
+	aichatWorkspaceAPIKeyFinalizerName = "core.aichatworkspace.io/apikey-finalizer"
+)
+
+// AIChatWorkspaceAPIKeyReconciler reconciles a AIChatWorkspaceAPIKey object
+type AIChatWorkspaceAPIKeyReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatworkspaceapikeys,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatworkspaceapikeys/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apps.aichatworkspaces.io,resources=aichatworkspaceapikeys/finalizers,verbs=update
+
+/**
+ * Reconciles an AIChatWorkspaceAPIKey object.
+ *
+ * A random key is written to a Secret in the namespace of the AIChatWorkspaceAPIKey and its
+ * hash, scopes and expiry are registered with the API gateway of the referenced workspace.
+ * The key is revoked when the AIChatWorkspaceAPIKey is deleted or expires.
+ *
+ * @param ctx The context for the reconciliation request.
+ * @param req The request to reconcile, containing the namespace and name of the AIChatWorkspaceAPIKey object.
+ * @return A ctrl.Result indicating whether the reconciliation was successful or if it should be retried.
+ */
+func (r *AIChatWorkspaceAPIKeyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx, "ns", req.Namespace, "cr", req.Name)
+
+	apiKey := &appsv1alpha1.AIChatWorkspaceAPIKey{}
+	if err := r.Get(ctx, req.NamespacedName, apiKey); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	workspace := &appsv1alpha1.AIChatWorkspace{}
+	err := r.Get(ctx, apiKeyWorkspaceRef(apiKey), workspace)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	workspaceFound := err == nil
+
+	if !apiKey.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(apiKey, aichatWorkspaceAPIKeyFinalizerName) {
+			return ctrl.Result{}, nil
+		}
+		if workspaceFound {
+			if err := revokeAPIKey(ctx, r.Client, workspace.Spec.WorkspaceName, apiKeyID(apiKey)); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		logger.Info("revoked api key", "key", apiKeyID(apiKey))
+		controllerutil.RemoveFinalizer(apiKey, aichatWorkspaceAPIKeyFinalizerName)
+		return ctrl.Result{}, r.Update(ctx, apiKey)
+	}
+
+	if !controllerutil.ContainsFinalizer(apiKey, aichatWorkspaceAPIKeyFinalizerName) {
+		controllerutil.AddFinalizer(apiKey, aichatWorkspaceAPIKeyFinalizerName)
+		if err := r.Update(ctx, apiKey); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	switch {
+	case !workspaceFound:
+		return r.setReady(ctx, apiKey, metav1.ConditionFalse, appsv1alpha1.WorkspaceNotFoundReason,
+			fmt.Sprintf("AIChatWorkspace %s not found", apiKeyWorkspaceRef(apiKey)), 0)
+	case !namespaceAllowed(workspace, apiKey.Namespace):
+		return r.setReady(ctx, apiKey, metav1.ConditionFalse, appsv1alpha1.NamespaceNotAllowedReason,
+			fmt.Sprintf("namespace %s is not listed in spec.api.auth.allowedKeyNamespaces of the workspace", apiKey.Namespace), 0)
+	case apiAuthMode(workspace) != appsv1alpha1.APIAuthModeAPIKey:
+		return r.setReady(ctx, apiKey, metav1.ConditionFalse, appsv1alpha1.APIKeyAuthDisabledReason,
+			"the workspace spec.api.auth.mode is not APIKey", 0)
+	}
+
+	if apiKey.Spec.ExpiresAt != nil && !time.Now().Before(apiKey.Spec.ExpiresAt.Time) {
+		if err := revokeAPIKey(ctx, r.Client, workspace.Spec.WorkspaceName, apiKeyID(apiKey)); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.deleteKeySecret(ctx, apiKey); err != nil {
+			return ctrl.Result{}, err
+		}
+		return r.setReady(ctx, apiKey, metav1.ConditionFalse, appsv1alpha1.APIKeyExpiredReason,
+			fmt.Sprintf("the key expired at %s", apiKey.Spec.ExpiresAt.UTC().Format(time.RFC3339)), 0)
+	}
+
+	rawKey, err := r.ensureKeySecret(ctx, apiKey, workspace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	scopes := make([]string, 0, len(apiKey.Spec.Scopes))
+	for _, scope := range apiKey.Spec.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	var expiresAt time.Time
+	if apiKey.Spec.ExpiresAt != nil {
+		expiresAt = apiKey.Spec.ExpiresAt.Time
+	}
+	entry := gateway.FormatKey(gateway.HashKey(rawKey), scopes, expiresAt)
+	if err := registerAPIKey(ctx, r.Client, workspace.Spec.WorkspaceName, apiKeyID(apiKey), entry); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Changes to the workspace and its key registry are watched, only come back when the key expires.
+	var requeueAfter time.Duration
+	if !expiresAt.IsZero() {
+		requeueAfter = time.Until(expiresAt)
+	}
+
+	return r.setReady(ctx, apiKey, metav1.ConditionTrue, appsv1alpha1.APIKeyIssuedReason,
+		fmt.Sprintf("the key is registered with workspace %s", workspace.Spec.WorkspaceName), requeueAfter)
+}
+
+/**
+ * Sets up the AIChatWorkspaceAPIKeyReconciler with the provided manager.
+ *
+ * Besides the Secrets it owns, the controller watches the referenced AIChatWorkspaces, so keys
+ * become ready or are disabled when the workspace changes, and the key registry Secrets of the
+ * workspaces, so keys are registered again when the registry is recreated.
+ *
+ * The field indexes must be registered with SetupFieldIndexes first.
+ *
+ * @param mgr The manager to set up the controller with.
+ * @return An error if there is an issue setting up the controller, or nil otherwise.
+ */
+func (r *AIChatWorkspaceAPIKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv1alpha1.AIChatWorkspaceAPIKey{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.Secret{}).
+		Watches(&appsv1alpha1.AIChatWorkspace{}, handler.EnqueueRequestsFromMapFunc(r.mapWorkspace),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapKeyRegistry),
+			builder.WithPredicates(hasWorkspaceLabel, isKeyRegistry)).
+		Named(constants.AIChatWorkspaceAPIKeyName).
+		Complete(r)
+}
+
+// isKeyRegistry filters the Secret watch events to the API key registries of the workspaces.
+var isKeyRegistry = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	return obj.GetName() == getName(obj.GetLabels()[constants.WorkspaceLabelName], constants.APIKeysName)
+})
+
+/**
+ * Maps an AIChatWorkspace to the AIChatWorkspaceAPIKeys referencing it.
+ *
+ * @param ctx The context of the watch event.
+ * @param obj The AIChatWorkspace that changed.
+ * @return The reconcile requests of the AIChatWorkspaceAPIKeys.
+ */
+func (r *AIChatWorkspaceAPIKeyReconciler) mapWorkspace(ctx context.Context, obj client.Object) []reconcile.Request {
+	apiKeys := &appsv1alpha1.AIChatWorkspaceAPIKeyList{}
+	if err := r.List(ctx, apiKeys, client.MatchingFields{workspaceRefField: client.ObjectKeyFromObject(obj).String()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list AIChatWorkspaceAPIKeys")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(apiKeys.Items))
+	for _, apiKey := range apiKeys.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&apiKey)})
+	}
+	return requests
+}
+
+/**
+ * Maps the API key registry of a workspace to the AIChatWorkspaceAPIKeys registered in it.
+ *
+ * @param ctx The context of the watch event.
+ * @param obj The registry Secret that changed.
+ * @return The reconcile requests of the AIChatWorkspaceAPIKeys.
+ */
+func (r *AIChatWorkspaceAPIKeyReconciler) mapKeyRegistry(ctx context.Context, obj client.Object) []reconcile.Request {
+	workspaces := &appsv1alpha1.AIChatWorkspaceList{}
+	if err := r.List(ctx, workspaces, client.MatchingFields{workspaceNameField: obj.GetLabels()[constants.WorkspaceLabelName]}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list AIChatWorkspaces")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, workspace := range workspaces.Items {
+		requests = append(requests, r.mapWorkspace(ctx, &workspace)...)
+	}
+	return requests
+}
+
+/**
+ * Ensures the Secret holding the raw API key exists and returns the key.
+ *
+ * The Secret is owned by the AIChatWorkspaceAPIKey so it is garbage collected with it. An existing
+ * Secret owned by something else is never overwritten.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param apiKey The AIChatWorkspaceAPIKey the Secret belongs to.
+ * @param workspace The AIChatWorkspace the key grants access to.
+ * @return The raw API key, and an error if the Secret could not be read or written.
+ */
+func (r *AIChatWorkspaceAPIKeyReconciler) ensureKeySecret(ctx context.Context, apiKey *appsv1alpha1.AIChatWorkspaceAPIKey, workspace *appsv1alpha1.AIChatWorkspace) (string, error) {
+	logger := log.FromContext(ctx)
+	secretName := apiKeySecretNameFor(apiKey)
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: apiKey.Namespace}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if err == nil {
+		if !metav1.IsControlledBy(secret, apiKey) {
+			return "", fmt.Errorf("secret %s/%s exists and is not owned by AIChatWorkspaceAPIKey %s", apiKey.Namespace, secretName, apiKey.Name)
+		}
+		if rawKey := string(secret.Data[constants.APIKeySecretKey]); rawKey != "" {
+			return rawKey, nil
+		}
+	}
+
+	rawKey, genErr := gateway.GenerateKey()
+	if genErr != nil {
+		return "", genErr
+	}
+	data := map[string][]byte{
+		constants.APIKeySecretKey:      []byte(rawKey),
+		constants.APIEndpointSecretKey: []byte(apiGatewayEndpoint(workspace)),
+	}
+
+	if apierrors.IsNotFound(err) {
+		secretLabels := defaultLabels(workspace.Spec.WorkspaceName, secretName, constants.SecretLabelName)
+		secret = k8s.NewSecret(secretName, apiKey.Namespace, data, secretLabels)
+		if err := controllerutil.SetControllerReference(apiKey, secret, r.Scheme); err != nil {
+			return "", err
+		}
+		logger.Info("Creating API key Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			return "", err
+		}
+		r.Recorder.Eventf(apiKey, corev1.EventTypeNormal, appsv1alpha1.APIKeyIssuedReason, "API key written to Secret %s", secretName)
+		return rawKey, nil
+	}
+
+	secret.Data = data
+	logger.Info("Regenerating API key Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+	if err := r.Update(ctx, secret); err != nil {
+		return "", err
+	}
+	return rawKey, nil
+}
+
+/**
+ * Deletes the Secret holding the raw API key, if it is owned by the AIChatWorkspaceAPIKey.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param apiKey The AIChatWorkspaceAPIKey the Secret belongs to.
+ * @return An error if the Secret could not be deleted, or nil otherwise.
+ */
+func (r *AIChatWorkspaceAPIKeyReconciler) deleteKeySecret(ctx context.Context, apiKey *appsv1alpha1.AIChatWorkspaceAPIKey) error {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: apiKeySecretNameFor(apiKey), Namespace: apiKey.Namespace}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(secret, apiKey) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+/**
+ * Sets the Ready condition and status fields of an AIChatWorkspaceAPIKey.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param apiKey The AIChatWorkspaceAPIKey to update.
+ * @param status The status of the Ready condition.
+ * @param reason The reason of the Ready condition.
+ * @param message The message of the Ready condition.
+ * @param requeueAfter When to reconcile the AIChatWorkspaceAPIKey again, 0 to wait for a change.
+ * @return A ctrl.Result and an error if the status could not be updated.
+ */
+func (r *AIChatWorkspaceAPIKeyReconciler) setReady(ctx context.Context, apiKey *appsv1alpha1.AIChatWorkspaceAPIKey, status metav1.ConditionStatus, reason, message string, requeueAfter time.Duration) (ctrl.Result, error) {
+	latest := apiKey.DeepCopy()
+	apiKey.Status.KeyID = apiKeyID(apiKey)
+	apiKey.Status.SecretName = ""
+	if status == metav1.ConditionTrue {
+		apiKey.Status.SecretName = apiKeySecretNameFor(apiKey)
+	}
+	apimeta.SetStatusCondition(&apiKey.Status.Conditions, metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: apiKey.Generation,
+	})
+	if err := r.Status().Patch(ctx, apiKey, client.MergeFrom(latest)); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// apiKeyWorkspaceRef returns the namespaced name of the AIChatWorkspace referenced by the key.
+func apiKeyWorkspaceRef(apiKey *appsv1alpha1.AIChatWorkspaceAPIKey) types.NamespacedName {
+	namespace := apiKey.Spec.WorkspaceRef.Namespace
+	if namespace == "" {
+		namespace = apiKey.Namespace
+	}
+	return types.NamespacedName{Name: apiKey.Spec.WorkspaceRef.Name, Namespace: namespace}
+}
+
+// apiKeyID returns the name the key is registered under with the workspace gateway.
+// Namespaces and names can't contain dots next to each other, so the ID is unique.
+func apiKeyID(apiKey *appsv1alpha1.AIChatWorkspaceAPIKey) string {
+	return apiKey.Namespace + "." + apiKey.Name
+}
+
+// apiKeySecretNameFor returns the Secret the raw key of an AIChatWorkspaceAPIKey is written to.
+func apiKeySecretNameFor(apiKey *appsv1alpha1.AIChatWorkspaceAPIKey) string {
+	if apiKey.Spec.SecretName != "" {
+		return apiKey.Spec.SecretName
+	}
+	return apiKey.Name
+}
+
+// namespaceAllowed reports whether keys for the workspace can be created in namespace.
+func namespaceAllowed(workspace *appsv1alpha1.AIChatWorkspace, namespace string) bool {
+	if namespace == workspace.Namespace {
+		return true
+	}
+	if workspace.Spec.API == nil || workspace.Spec.API.Auth == nil {
+		return false
+	}
+	return slices.Contains(workspace.Spec.API.Auth.AllowedKeyNamespaces, namespace)
+}
+
+// apiGatewayEndpoint returns the in-cluster URL of the workspace API gateway.
+func apiGatewayEndpoint(workspace *appsv1alpha1.AIChatWorkspace) string {
+	gatewayName := getName(workspace.Spec.WorkspaceName, constants.APIGatewayName)
+	return fmt.Sprintf("http://%s.%s.svc:%d", gatewayName, workspace.Spec.WorkspaceName, constants.APIGatewayPort)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func apiKeyWorkspace(mode appsv1alpha1.APIAuthMode, allowedKeyNamespaces ...string) *appsv1alpha1.AIChatWorkspace {
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.API = &appsv1alpha1.APISpec{
+		Exposure: appsv1alpha1.APIExposurePublic,
+		Auth:     &appsv1alpha1.APIAuthSpec{Mode: mode, AllowedKeyNamespaces: allowedKeyNamespaces},
+	}
+	return workspace
+}
+
+func newAPIKey(namespace, name string, expiresAt *metav1.Time) *appsv1alpha1.AIChatWorkspaceAPIKey {
+	return &appsv1alpha1.AIChatWorkspaceAPIKey{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: appsv1alpha1.AIChatWorkspaceAPIKeySpec{
+			WorkspaceRef: appsv1alpha1.WorkspaceReference{Name: "team-a", Namespace: constants.AIChatWorkspaceNamespace},
+			ExpiresAt:    expiresAt,
+		},
+	}
+}
+
+func reconcileAPIKey(t *testing.T, r *AIChatWorkspaceAPIKeyReconciler, apiKey *appsv1alpha1.AIChatWorkspaceAPIKey) ctrl.Result {
+	t.Helper()
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apiKey)})
+	if err != nil {
+		t.Fatalf("Reconcile() = %v", err)
+	}
+	return result
+}
+
+// keyRegistry returns the entries of the API key registry of team-a.
+func keyRegistry(t *testing.T, c client.Client) map[string][]byte {
+	t.Helper()
+	keys := &corev1.Secret{}
+	err := c.Get(context.Background(), types.NamespacedName{Name: "team-a-api-keys", Namespace: "team-a"}, keys)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys.Data
+}
+
+func assertAPIKeyReady(t *testing.T, c client.Client, apiKey *appsv1alpha1.AIChatWorkspaceAPIKey, status metav1.ConditionStatus, reason string) {
+	t.Helper()
+	latest := &appsv1alpha1.AIChatWorkspaceAPIKey{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(apiKey), latest); err != nil {
+		t.Fatal(err)
+	}
+	condition := apimeta.FindStatusCondition(latest.Status.Conditions, appsv1alpha1.ConditionTypeReady)
+	if condition == nil || condition.Status != status || condition.Reason != reason {
+		t.Fatalf("Ready = %+v, want %s/%s", condition, status, reason)
+	}
+}
+
+func TestAPIKeyIssueAndRevokeOnDelete(t *testing.T) {
+	expiresAt := metav1.NewTime(time.Now().Add(time.Hour))
+	apiKey := newAPIKey(constants.AIChatWorkspaceNamespace, "ci", &expiresAt)
+	c := newFakeClient(t, apiKeyWorkspace(appsv1alpha1.APIAuthModeAPIKey), apiKey)
+	r := &AIChatWorkspaceAPIKeyReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	result := reconcileAPIKey(t, r, apiKey)
+	if result.RequeueAfter <= 0 || result.RequeueAfter > time.Hour {
+		t.Errorf("RequeueAfter = %s, want the time until the key expires", result.RequeueAfter)
+	}
+	assertAPIKeyReady(t, c, apiKey, metav1.ConditionTrue, appsv1alpha1.APIKeyIssuedReason)
+	if _, ok := keyRegistry(t, c)["aichat-workspace-operator-system.ci"]; !ok {
+		t.Fatalf("registry = %v, want the key registered", keyRegistry(t, c))
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "ci", Namespace: constants.AIChatWorkspaceNamespace}, secret); err != nil {
+		t.Fatalf("key Secret: %v", err)
+	}
+	if len(secret.Data[constants.APIKeySecretKey]) == 0 {
+		t.Error("the key Secret holds no key")
+	}
+
+	// deleting the key waits for the finalizer, which revokes the registry entry.
+	if err := c.Get(ctx, client.ObjectKeyFromObject(apiKey), apiKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, apiKey); err != nil {
+		t.Fatal(err)
+	}
+	reconcileAPIKey(t, r, apiKey)
+	if _, ok := keyRegistry(t, c)["aichat-workspace-operator-system.ci"]; ok {
+		t.Error("the key is still registered after the delete")
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(apiKey), apiKey); !apierrors.IsNotFound(err) {
+		t.Errorf("AIChatWorkspaceAPIKey: %v, want it gone once the finalizer is removed", err)
+	}
+}
+
+func TestAPIKeyExpiryRevokes(t *testing.T) {
+	expired := metav1.NewTime(time.Now().Add(-time.Minute))
+	apiKey := newAPIKey(constants.AIChatWorkspaceNamespace, "ci", &expired)
+	apiKey.UID = "ci-uid"
+	keys := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-api-keys", Namespace: "team-a"},
+		Data:       map[string][]byte{"aichat-workspace-operator-system.ci": []byte("sha256:00"), "other": []byte("sha256:01")},
+	}
+	keySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: constants.AIChatWorkspaceNamespace, OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: appsv1alpha1.GroupVersion.String(), Kind: "AIChatWorkspaceAPIKey", Name: "ci", UID: "ci-uid", Controller: ptr.To(true),
+		}}},
+		Data: map[string][]byte{constants.APIKeySecretKey: []byte("acw_old")},
+	}
+	c := newFakeClient(t, apiKeyWorkspace(appsv1alpha1.APIAuthModeAPIKey), apiKey, keys, keySecret)
+	r := &AIChatWorkspaceAPIKeyReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	if result := reconcileAPIKey(t, r, apiKey); result.RequeueAfter != 0 {
+		t.Errorf("RequeueAfter = %s, want no requeue for an expired key", result.RequeueAfter)
+	}
+	assertAPIKeyReady(t, c, apiKey, metav1.ConditionFalse, appsv1alpha1.APIKeyExpiredReason)
+	registry := keyRegistry(t, c)
+	if _, ok := registry["aichat-workspace-operator-system.ci"]; ok || len(registry) != 1 {
+		t.Errorf("registry = %v, want only the other key", registry)
+	}
+	err := c.Get(context.Background(), types.NamespacedName{Name: "ci", Namespace: constants.AIChatWorkspaceNamespace}, &corev1.Secret{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("key Secret: %v, want it deleted", err)
+	}
+}
+
+func TestAPIKeyAllowedKeyNamespaces(t *testing.T) {
+	denied := newAPIKey("ci", "build", nil)
+	allowed := newAPIKey("team-b", "build", nil)
+	c := newFakeClient(t, apiKeyWorkspace(appsv1alpha1.APIAuthModeAPIKey, "team-b"), denied, allowed)
+	r := &AIChatWorkspaceAPIKeyReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	reconcileAPIKey(t, r, denied)
+	assertAPIKeyReady(t, c, denied, metav1.ConditionFalse, appsv1alpha1.NamespaceNotAllowedReason)
+	if _, ok := keyRegistry(t, c)["ci.build"]; ok {
+		t.Error("a key of a namespace that isn't allowed was registered")
+	}
+
+	reconcileAPIKey(t, r, allowed)
+	assertAPIKeyReady(t, c, allowed, metav1.ConditionTrue, appsv1alpha1.APIKeyIssuedReason)
+	if _, ok := keyRegistry(t, c)["team-b.build"]; !ok {
+		t.Error("the key of an allowed namespace wasn't registered")
+	}
+}
+
+func TestAPIKeyAuthModeDisabled(t *testing.T) {
+	apiKey := newAPIKey(constants.AIChatWorkspaceNamespace, "ci", nil)
+	c := newFakeClient(t, apiKeyWorkspace(appsv1alpha1.APIAuthModeBasicAuth), apiKey)
+	r := &AIChatWorkspaceAPIKeyReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	reconcileAPIKey(t, r, apiKey)
+	assertAPIKeyReady(t, c, apiKey, metav1.ConditionFalse, appsv1alpha1.APIKeyAuthDisabledReason)
+	if registry := keyRegistry(t, c); registry != nil {
+		t.Errorf("registry = %v, want none without APIKey auth", registry)
+	}
+}
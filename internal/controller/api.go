@@ -0,0 +1,145 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+)
+
+/**
+ * Ensures the Ollama API is exposed according to spec.api.exposure.
+ *
+ * - none: a NetworkPolicy only admits pods from the workspace namespace.
+ * - internal: the Ollama Service is reachable from the cluster, nothing is published.
+ * - public: an Ingress or HTTPRoute publishes <workspaceName>-api.<defaultDomain> behind the selected auth.
+ *
+ * Objects belonging to another exposure level are removed so the workspace can be switched in place.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace instance whose API is exposed.
+ * @param backend The inference backend serving the API.
+ * @param config The operator configuration.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureAPIExposure(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, backend inference.Backend, config *config.Config) (*ctrl.Result, error) {
+	exposure := apiExposure(instance)
+	ollamaName := getName(instance.Spec.WorkspaceName, constants.OllamaName)
+
+	if exposure == appsv1alpha1.APIExposureNone {
+		netpolLabels := defaultLabels(instance.Spec.WorkspaceName, ollamaName, constants.NetworkPolicyLabelName)
+		result, err := r.ensureNetworkPolicy(ctx, instance, k8s.NewNamespaceOnlyNetworkPolicy(instance.Spec.WorkspaceName, ollamaName, netpolLabels))
+		if result != nil {
+			return result, err
+		}
+	} else if err := r.deleteIfExists(ctx, &networkingv1.NetworkPolicy{}, instance.Spec.WorkspaceName, ollamaName); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if exposure != appsv1alpha1.APIExposurePublic {
+		if err := r.deleteIfExists(ctx, &networkingv1.Ingress{}, instance.Spec.WorkspaceName, ollamaName); err != nil {
+			return &ctrl.Result{}, err
+		}
+		if err := r.deleteIfExists(ctx, &gatewayv1.HTTPRoute{}, instance.Spec.WorkspaceName, ollamaName); err != nil {
+			return &ctrl.Result{}, err
+		}
+		return nil, nil
+	}
+
+	annotations, result, err := r.ensureAPIAuth(ctx, instance, config)
+	if result != nil {
+		return result, err
+	}
+
+	// With APIKey auth the route points at the gateway sidecar instead of the inference server.
+	backendName, backendPort := ollamaName, backend.Port()
+	if apiAuthMode(instance) == appsv1alpha1.APIAuthModeAPIKey {
+		backendName, backendPort = getName(instance.Spec.WorkspaceName, constants.APIGatewayName), constants.APIGatewayPort
+	}
+
+	ollamaDNSName := setIngressDNSHost(config, instance.Spec.WorkspaceName, constants.OllamaName)
+	return r.ensureRoute(ctx, instance, config, constants.OllamaName, backendName, ollamaDNSName, backendPort, annotations)
+}
+
+/**
+ * Ensures the credentials for a public Ollama API are available in the workspace namespace.
+ *
+ * BasicAuth copies the htpasswd Secret referenced by spec.api.auth.secretName from the namespace of the
+ * AIChatWorkspace into the workspace namespace and returns the ingress-nginx annotations that enable it.
+ * APIKey needs no annotations, the keys are handled by ensureAPIGateway.
+ *
+ * @return The annotations to add to the Ingress, and a ctrl.Result and error when reconciliation must stop.
+ */
+func (r *AIChatWorkspaceReconciler) ensureAPIAuth(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, config *config.Config) (map[string]string, *ctrl.Result, error) {
+	auth := instance.Spec.API.Auth
+	if auth == nil {
+		return nil, &ctrl.Result{}, fmt.Errorf("spec.api.auth is required when the API exposure is %s", appsv1alpha1.APIExposurePublic)
+	}
+
+	switch auth.Mode {
+	case appsv1alpha1.APIAuthModeAPIKey:
+		return nil, nil, nil
+	case appsv1alpha1.APIAuthModeBasicAuth:
+		if routingMode(config, instance) != appsv1alpha1.RoutingModeIngress {
+			return nil, &ctrl.Result{}, fmt.Errorf("api auth mode %s is only supported with %s routing", auth.Mode, appsv1alpha1.RoutingModeIngress)
+		}
+
+		source := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: auth.SecretName, Namespace: instance.Namespace}, source); err != nil {
+			return nil, &ctrl.Result{}, fmt.Errorf("unable to read basic auth secret %s/%s: %w", instance.Namespace, auth.SecretName, err)
+		}
+		if _, ok := source.Data[constants.OllamaBasicAuthSecretKey]; !ok {
+			return nil, &ctrl.Result{}, fmt.Errorf("basic auth secret %s/%s has no %q key", instance.Namespace, auth.SecretName, constants.OllamaBasicAuthSecretKey)
+		}
+
+		secretName := getName(instance.Spec.WorkspaceName, constants.OllamaBasicAuthName)
+		secretLabels := defaultLabels(instance.Spec.WorkspaceName, secretName, constants.SecretLabelName)
+		data := map[string][]byte{constants.OllamaBasicAuthSecretKey: source.Data[constants.OllamaBasicAuthSecretKey]}
+		result, err := r.ensureSecret(ctx, instance, k8s.NewSecret(secretName, instance.Spec.WorkspaceName, data, secretLabels))
+		if result != nil {
+			return nil, result, err
+		}
+
+		return map[string]string{
+			"nginx.ingress.kubernetes.io/auth-type":   "basic",
+			"nginx.ingress.kubernetes.io/auth-secret": secretName,
+			"nginx.ingress.kubernetes.io/auth-realm":  fmt.Sprintf("AIChat Workspace %s API", instance.Spec.WorkspaceName),
+		}, nil, nil
+	}
+
+	return nil, &ctrl.Result{}, fmt.Errorf("unsupported api auth mode %q", auth.Mode)
+}
+
+// apiExposure returns the exposure of the Ollama API, defaulting to internal.
+func apiExposure(instance *appsv1alpha1.AIChatWorkspace) appsv1alpha1.APIExposure {
+	if instance.Spec.API == nil || instance.Spec.API.Exposure == "" {
+		return appsv1alpha1.APIExposureInternal
+	}
+	return instance.Spec.API.Exposure
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/gateway"
+)
+
+/**
+ * Ensures the objects backing the API gateway exist when spec.api.auth.mode is APIKey.
+ *
+ * The gateway runs as a sidecar of the Ollama StatefulSet (see k8s.AddAPIGatewaySidecar). This
+ * function generates the workspace API key, registers its hash in the Secret mounted by the
+ * gateway and creates the Service routing to the gateway port. When another auth mode is
+ * selected the gateway Service is removed.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace instance whose API is guarded.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureAPIGateway(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (*ctrl.Result, error) {
+	gatewayName := getName(instance.Spec.WorkspaceName, constants.APIGatewayName)
+
+	if apiAuthMode(instance) != appsv1alpha1.APIAuthModeAPIKey {
+		if err := r.deleteIfExists(ctx, &corev1.Service{}, instance.Spec.WorkspaceName, gatewayName); err != nil {
+			return &ctrl.Result{}, err
+		}
+		return nil, nil
+	}
+
+	result, err := r.ensureAPIKeys(ctx, instance)
+	if result != nil {
+		return result, err
+	}
+
+	ollamaName := getName(instance.Spec.WorkspaceName, constants.OllamaName)
+	gatewayServiceLabels := defaultLabels(instance.Spec.WorkspaceName, gatewayName, constants.ServiceLabelName)
+	return r.ensureService(ctx, instance, k8s.NewServiceForWorkload(instance.Spec.WorkspaceName, gatewayName, ollamaName, constants.APIGatewayPort, gatewayServiceLabels))
+}
+
+/**
+ * Ensures the workspace API key exists and its hash is registered with the gateway.
+ *
+ * The raw key is written to a Secret in the namespace of the AIChatWorkspace so the owners of the
+ * resource can read it. Only the hash is copied into the workspace namespace. Setting the
+ * aichatworkspaces.io/rotate-api-key annotation to a new value on the AIChatWorkspace generates a new
+ * key and replaces the registered hash, revoking the previous key.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace instance owning the key.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureAPIKeys(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	rotateFor := instance.GetAnnotations()[constants.RotateAPIKeyAnnotation]
+	keySecretName := apiKeySecretName(instance)
+
+	keySecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: keySecretName, Namespace: instance.Namespace}, keySecret)
+	if err != nil && errors.IsNotFound(err) {
+		apiKey, err := gateway.GenerateKey()
+		if err != nil {
+			return &ctrl.Result{}, err
+		}
+
+		keySecretLabels := defaultLabels(instance.Spec.WorkspaceName, keySecretName, constants.SecretLabelName)
+		keySecret = k8s.NewSecret(keySecretName, instance.Namespace, map[string][]byte{constants.APIKeySecretKey: []byte(apiKey)}, keySecretLabels)
+		keySecret.Annotations = map[string]string{constants.RotatedAPIKeyAnnotation: rotateFor}
+		if err := controllerutil.SetControllerReference(instance, keySecret, r.Scheme); err != nil {
+			return &ctrl.Result{}, err
+		}
+
+		logger.Info("Creating the workspace API key", "Secret.Namespace", instance.Namespace, "Secret.Name", keySecretName)
+		if err := r.Create(ctx, keySecret); err != nil {
+			logger.Error(err, "Failed to create the workspace API key", "Secret.Namespace", instance.Namespace, "Secret.Name", keySecretName)
+			return &ctrl.Result{}, err
+		}
+		r.eventCreated(instance, "Secret", keySecret)
+	} else if err != nil {
+		logger.Error(err, "Failed to get the workspace API key")
+		return &ctrl.Result{}, err
+	} else if len(keySecret.Data[constants.APIKeySecretKey]) == 0 || keySecret.GetAnnotations()[constants.RotatedAPIKeyAnnotation] != rotateFor {
+		apiKey, err := gateway.GenerateKey()
+		if err != nil {
+			return &ctrl.Result{}, err
+		}
+
+		if keySecret.Data == nil {
+			keySecret.Data = map[string][]byte{}
+		}
+		keySecret.Data[constants.APIKeySecretKey] = []byte(apiKey)
+		if keySecret.Annotations == nil {
+			keySecret.Annotations = map[string]string{}
+		}
+		keySecret.Annotations[constants.RotatedAPIKeyAnnotation] = rotateFor
+
+		logger.Info("Rotating the workspace API key", "Secret.Namespace", instance.Namespace, "Secret.Name", keySecretName)
+		if err := r.Update(ctx, keySecret); err != nil {
+			logger.Error(err, "Failed to rotate the workspace API key", "Secret.Namespace", instance.Namespace, "Secret.Name", keySecretName)
+			return &ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonUpdated, "Rotated the workspace API key in Secret %s", objectName(keySecret))
+	}
+
+	hash := gateway.HashKey(string(keySecret.Data[constants.APIKeySecretKey]))
+	if err := registerAPIKey(ctx, r.Client, instance.Spec.WorkspaceName, constants.DefaultAPIKeyID, hash); err != nil {
+		return &ctrl.Result{}, err
+	}
+	return nil, nil
+}
+
+/**
+ * Registers an API key in the Secret mounted by the workspace API gateway.
+ *
+ * Other entries of the Secret are left untouched. The Secret is created when missing.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param c The client used to read and write the Secret.
+ * @param workspaceName The workspace whose gateway accepts the key.
+ * @param keyID The name the key is registered under.
+ * @param entry The value registered for the key, see gateway.HashKey and gateway.FormatKey.
+ * @return An error if the key could not be registered, or nil otherwise.
+ */
+func registerAPIKey(ctx context.Context, c client.Client, workspaceName, keyID, entry string) error {
+	logger := log.FromContext(ctx)
+	keysName := getName(workspaceName, constants.APIKeysName)
+
+	keys := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: keysName, Namespace: workspaceName}, keys)
+	if err != nil && errors.IsNotFound(err) {
+		keysLabels := defaultLabels(workspaceName, keysName, constants.SecretLabelName)
+		keys = k8s.NewSecret(keysName, workspaceName, map[string][]byte{keyID: []byte(entry)}, keysLabels)
+
+		logger.Info("Creating the API gateway keys", "Secret.Namespace", workspaceName, "Secret.Name", keysName)
+		if err := c.Create(ctx, keys); err != nil {
+			logger.Error(err, "Failed to create the API gateway keys", "Secret.Namespace", workspaceName, "Secret.Name", keysName)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get the API gateway keys")
+		return err
+	}
+
+	if string(keys.Data[keyID]) == entry {
+		return nil
+	}
+
+	if keys.Data == nil {
+		keys.Data = map[string][]byte{}
+	}
+	keys.Data[keyID] = []byte(entry)
+
+	logger.Info("Registering API key", "Secret.Namespace", keys.Namespace, "Secret.Name", keys.Name, "key", keyID)
+	if err := c.Update(ctx, keys); err != nil {
+		logger.Error(err, "Failed to register API key", "Secret.Namespace", keys.Namespace, "Secret.Name", keys.Name, "key", keyID)
+		return err
+	}
+
+	return nil
+}
+
+/**
+ * Removes an API key from the Secret mounted by the workspace API gateway.
+ *
+ * A missing Secret or key is not an error, the key is already revoked.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param c The client used to read and write the Secret.
+ * @param workspaceName The workspace whose gateway accepted the key.
+ * @param keyID The name the key is registered under.
+ * @return An error if the key could not be revoked, or nil otherwise.
+ */
+func revokeAPIKey(ctx context.Context, c client.Client, workspaceName, keyID string) error {
+	logger := log.FromContext(ctx)
+	keysName := getName(workspaceName, constants.APIKeysName)
+
+	keys := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: keysName, Namespace: workspaceName}, keys); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if _, ok := keys.Data[keyID]; !ok {
+		return nil
+	}
+	delete(keys.Data, keyID)
+
+	logger.Info("Revoking API key", "Secret.Namespace", keys.Namespace, "Secret.Name", keys.Name, "key", keyID)
+	if err := c.Update(ctx, keys); err != nil {
+		logger.Error(err, "Failed to revoke API key", "Secret.Namespace", keys.Namespace, "Secret.Name", keys.Name, "key", keyID)
+		return err
+	}
+
+	return nil
+}
+
+// apiAuthMode returns the auth mode of the Ollama API, or an empty string when none is configured.
+func apiAuthMode(instance *appsv1alpha1.AIChatWorkspace) appsv1alpha1.APIAuthMode {
+	if instance.Spec.API == nil || instance.Spec.API.Auth == nil {
+		return ""
+	}
+	return instance.Spec.API.Auth.Mode
+}
+
+// apiKeySecretName returns the Secret, in the namespace of the AIChatWorkspace, holding the workspace API key.
+func apiKeySecretName(instance *appsv1alpha1.AIChatWorkspace) string {
+	if instance.Spec.API != nil && instance.Spec.API.Auth != nil && instance.Spec.API.Auth.SecretName != "" {
+		return instance.Spec.API.Auth.SecretName
+	}
+	return getName(instance.Spec.WorkspaceName, constants.APIKeyName)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+)
+
+// EventReasonBackendNotFound is emitted when the AIChatBackend of a workspace in shared mode does not exist.
+const EventReasonBackendNotFound = "BackendNotFound"
+
+/**
+ * Ensures a workspace in shared backend mode uses the Ollama pool of its AIChatBackend.
+ *
+ * The dedicated Ollama StatefulSet, Service and ServiceAccount of the workspace are removed, and
+ * the models of the workspace are installed on the pool. The AIChatBackend counts the references
+ * to the models and deletes them once no workspace needs them.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace in shared backend mode.
+ * @param cfg The configuration of the workspace.
+ * @return The URL of the Ollama API of the pool, a ctrl.Result and an error, or a nil ctrl.Result if the pool is ready.
+ */
+func (r *AIChatWorkspaceReconciler) ensureSharedBackend(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, cfg *config.Config) (string, *ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	ollamaName := generateName(instance.Spec.WorkspaceName, constants.OllamaName)
+	for _, obj := range []client.Object{&appsv1.StatefulSet{}, &corev1.Service{}, &corev1.ServiceAccount{}} {
+		if err := r.deleteIfExists(ctx, obj, instance.Spec.WorkspaceName, ollamaName); err != nil {
+			return "", &ctrl.Result{}, err
+		}
+	}
+	if err := r.deleteIfExists(ctx, &corev1.ConfigMap{}, instance.Spec.WorkspaceName, caBundleName(instance)); err != nil {
+		return "", &ctrl.Result{}, err
+	}
+
+	ref := backendRef(instance)
+	backend := &appsv1alpha1.AIChatBackend{}
+	if err := r.Get(ctx, ref, backend); apierrors.IsNotFound(err) {
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonBackendNotFound, "AIChatBackend %s does not exist", ref)
+		return "", &ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	} else if err != nil {
+		return "", &ctrl.Result{}, err
+	}
+
+	if !backendNamespaceAllowed(backend, instance.Namespace) {
+		return "", &ctrl.Result{}, reconcile.TerminalError(fmt.Errorf("AIChatBackend %s does not allow workspaces of namespace %s", ref, instance.Namespace))
+	}
+	if !backendReady(backend) {
+		delay := 10 * time.Second
+		logger.Info(fmt.Sprintf("AIChatBackend %s isn't ready, waiting for %s", ref, delay))
+		return "", &ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	if err := r.ensureModels(ctx, instance, inference.Ollama{}, cfg, backend.Status.URL); err != nil {
+		return "", &ctrl.Result{}, err
+	}
+	return backend.Status.URL, nil, nil
+}
+
+/**
+ * Maps an AIChatBackend to the AIChatWorkspaces using it.
+ *
+ * @param ctx The context of the watch event.
+ * @param obj The AIChatBackend that changed.
+ * @return The reconcile requests of the AIChatWorkspaces referencing the backend.
+ */
+func (r *AIChatWorkspaceReconciler) mapBackendWorkspaces(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.workspaceRequests(ctx, client.MatchingFields{backendRefField: client.ObjectKeyFromObject(obj).String()})
+}
+
+// backendReadyChanged filters the AIChatBackend events to the ones moving its pool, or making it ready.
+var backendReadyChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldBackend, okOld := e.ObjectOld.(*appsv1alpha1.AIChatBackend)
+		newBackend, okNew := e.ObjectNew.(*appsv1alpha1.AIChatBackend)
+		if !okOld || !okNew {
+			return false
+		}
+		return oldBackend.Status.URL != newBackend.Status.URL || backendReady(oldBackend) != backendReady(newBackend)
+	},
+}
+
+// backendReady reports whether the Ollama pool of the AIChatBackend is running.
+func backendReady(backend *appsv1alpha1.AIChatBackend) bool {
+	return backend.Status.URL != "" && apimeta.IsStatusConditionTrue(backend.Status.Conditions, appsv1alpha1.ConditionTypeReady)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/openwebui"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+/**
+ * Ensures the Open WebUI admin exists and the default settings of spec.bootstrap are applied.
+ *
+ * Once the Open WebUI Deployment is ready, the admin of the Secret spec.bootstrap.adminSecretName
+ * signs in, or signs up when the account doesn't exist yet, which makes it the admin as the first
+ * account. The signup mode, the default user role, the default models (spec.models) and the
+ * banner are then applied through the API of Open WebUI. The outcome is recorded in the
+ * OpenWebUIBootstrapped condition and the settings are applied again when the generation changes.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose Open WebUI is bootstrapped.
+ * @param baseURL The URL of the Open WebUI Service.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureOpenWebUIBootstrap(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, baseURL string) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if instance.Spec.Bootstrap == nil {
+		if apimeta.RemoveStatusCondition(&instance.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped) {
+			return nil, r.patchStatus(ctx, instance)
+		}
+		return nil, nil
+	}
+	current := apimeta.FindStatusCondition(instance.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped)
+	if current != nil && current.Status == metav1.ConditionTrue && current.ObservedGeneration == instance.GetGeneration() {
+		return nil, nil
+	}
+
+	// the ready Deployment is watched, its next status update reconciles the workspace again.
+	deployment := &appsv1.Deployment{}
+	deploymentName := getName(instance.Spec.WorkspaceName, constants.OpenwebuiName)
+	err := r.Get(ctx, types.NamespacedName{Name: deploymentName, Namespace: instance.Spec.WorkspaceName}, deployment)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return &ctrl.Result{}, err
+	}
+	if err != nil || deployment.Status.ReadyReplicas < 1 {
+		logger.Info("Open WebUI isn't ready, waiting to bootstrap it", "Deployment.Name", deploymentName)
+		return nil, r.setBootstrapCondition(ctx, instance, metav1.ConditionFalse, appsv1alpha1.WaitingForOpenWebUIReason, "waiting for the Open WebUI Deployment to be ready")
+	}
+
+	if err := r.bootstrapOpenWebUI(ctx, instance, baseURL); err != nil {
+		if statusErr := r.setBootstrapCondition(ctx, instance, metav1.ConditionFalse, appsv1alpha1.BootstrapFailedReason, err.Error()); statusErr != nil {
+			return &ctrl.Result{}, statusErr
+		}
+		return &ctrl.Result{}, err
+	}
+
+	logger.Info("Open WebUI bootstrapped", "Deployment.Name", deploymentName)
+	return nil, r.setBootstrapCondition(ctx, instance, metav1.ConditionTrue, appsv1alpha1.BootstrappedReason, "the admin exists and the default settings are applied")
+}
+
+// openWebUIBootstrapPending reports whether the admin of spec.bootstrap isn't created yet, until
+// then the first account to sign up would become the admin of Open WebUI.
+func openWebUIBootstrapPending(instance *appsv1alpha1.AIChatWorkspace) bool {
+	return instance.Spec.Bootstrap != nil && !apimeta.IsStatusConditionTrue(instance.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped)
+}
+
+// bootstrapOpenWebUI signs the admin in, or up, and applies the settings of spec.bootstrap and the models of spec.providers.
+func (r *AIChatWorkspaceReconciler) bootstrapOpenWebUI(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, baseURL string) error {
+	bootstrap := instance.Spec.Bootstrap
+
+	name, email, password, err := r.adminCredentials(ctx, instance)
+	if err != nil {
+		return err
+	}
+	session, err := openwebui.SignIn(baseURL, email, password)
+	if errors.Is(err, openwebui.ErrUnauthorized) {
+		session, err = openwebui.SignUp(baseURL, name, email, password)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to sign the admin in: %w", err)
+	}
+	// only the first account is an admin, a later one waits for an approval.
+	if session.Role != string(appsv1alpha1.UserRoleAdmin) {
+		return fmt.Errorf("the account %s has the %s role, Open WebUI already had an admin", email, session.Role)
+	}
+
+	settings := map[string]any{}
+	if bootstrap.Signup != "" {
+		settings["ENABLE_SIGNUP"] = bootstrap.Signup == appsv1alpha1.SignupModeEnabled
+	}
+	// the admin settings override the environment, keep the signup form of an OIDC only workspace removed.
+	if auth := instance.Spec.Auth; auth != nil && auth.OIDC != nil && auth.OIDC.DisableLocalSignup {
+		settings["ENABLE_SIGNUP"] = false
+	}
+	if bootstrap.DefaultUserRole != "" {
+		settings["DEFAULT_USER_ROLE"] = string(bootstrap.DefaultUserRole)
+	}
+	if len(settings) > 0 {
+		if err := openwebui.UpdateAdminConfig(baseURL, session.Token, settings); err != nil {
+			return fmt.Errorf("unable to apply the signup settings: %w", err)
+		}
+	}
+
+	models := make([]string, 0, len(instance.Spec.Models))
+	for _, model := range instance.Spec.Models {
+		models = append(models, model.ServedName())
+	}
+	if err := openwebui.SetDefaultModels(baseURL, session.Token, models); err != nil {
+		return fmt.Errorf("unable to apply the default models: %w", err)
+	}
+	if len(instance.Spec.Providers) > 0 {
+		modelIDs := make(map[string][]string, len(instance.Spec.Providers))
+		for _, provider := range instance.Spec.Providers {
+			modelIDs[strings.TrimSuffix(provider.BaseURL, "/")] = provider.Models
+		}
+		if err := openwebui.SetOpenAIModelIDs(baseURL, session.Token, modelIDs); err != nil {
+			return fmt.Errorf("unable to apply the provider models: %w", err)
+		}
+	}
+
+	banner := openwebui.Banner{
+		ID:          constants.BootstrapBannerID,
+		Type:        "info",
+		Content:     bootstrap.Banner,
+		Dismissible: true,
+		Timestamp:   time.Now().Unix(),
+	}
+	if err := openwebui.SetBanner(baseURL, session.Token, banner); err != nil {
+		return fmt.Errorf("unable to apply the banner: %w", err)
+	}
+	return nil
+}
+
+// adminCredentials reads the name, email and password of the admin from spec.bootstrap.adminSecretName.
+func (r *AIChatWorkspaceReconciler) adminCredentials(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (string, string, string, error) {
+	secretName := instance.Spec.Bootstrap.AdminSecretName
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: instance.Namespace}, secret); err != nil {
+		return "", "", "", fmt.Errorf("unable to read the admin secret %s/%s: %w", instance.Namespace, secretName, err)
+	}
+	email := string(secret.Data[constants.BootstrapAdminEmailKey])
+	password := string(secret.Data[constants.BootstrapAdminPasswordKey])
+	if email == "" || password == "" {
+		return "", "", "", fmt.Errorf("the admin secret %s/%s needs the %q and %q keys", instance.Namespace, secretName, constants.BootstrapAdminEmailKey, constants.BootstrapAdminPasswordKey)
+	}
+	name := string(secret.Data[constants.BootstrapAdminNameKey])
+	if name == "" {
+		name = "Admin"
+	}
+	return name, email, password, nil
+}
+
+// setBootstrapCondition sets the OpenWebUIBootstrapped condition, the status is only patched when it changes.
+func (r *AIChatWorkspaceReconciler) setBootstrapCondition(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, status metav1.ConditionStatus, reason, message string) error {
+	changed := apimeta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeOpenWebUIBootstrapped,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: instance.GetGeneration(),
+	})
+	if !changed {
+		return nil
+	}
+	return r.patchStatus(ctx, instance)
+}
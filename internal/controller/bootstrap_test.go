@@ -0,0 +1,410 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/openwebui"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+)
+
+// fakeOpenWebUI serves the parts of the Open WebUI API used by the operator.
+type fakeOpenWebUI struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	passwords     map[string]string
+	roles         map[string]string
+	adminConfig   map[string]any
+	modelsConfig  map[string]any
+	openaiConfig  map[string]any
+	banners       []openwebui.Banner
+	groups        []openwebui.Group
+	prompts       map[string]openwebui.Prompt
+	presets       map[string]fakeModelPreset
+	signupEnabled bool
+}
+
+// fakeModelPreset is the JSON representation of a model preset of Open WebUI.
+type fakeModelPreset struct {
+	ID          string `json:"id"`
+	BaseModelID string `json:"base_model_id"`
+	Name        string `json:"name"`
+	Meta        struct {
+		Description string `json:"description"`
+	} `json:"meta"`
+	Params struct {
+		System string `json:"system"`
+	} `json:"params"`
+}
+
+func newFakeOpenWebUI(t *testing.T) *fakeOpenWebUI {
+	t.Helper()
+	f := &fakeOpenWebUI{
+		passwords:     map[string]string{},
+		roles:         map[string]string{},
+		adminConfig:   map[string]any{"ENABLE_SIGNUP": true, "DEFAULT_USER_ROLE": "pending"},
+		modelsConfig:  map[string]any{"DEFAULT_MODELS": "", "MODEL_ORDER_LIST": []string{}},
+		openaiConfig:  map[string]any{"ENABLE_OPENAI_API": true, "OPENAI_API_BASE_URLS": []any{}, "OPENAI_API_KEYS": []any{}, "OPENAI_API_CONFIGS": map[string]any{}},
+		prompts:       map[string]openwebui.Prompt{},
+		presets:       map[string]fakeModelPreset{},
+		signupEnabled: true,
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOpenWebUI) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/v1/auths/signin":
+		var form map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&form)
+		if password, ok := f.passwords[form["email"]]; !ok || password != form["password"] {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"detail":"The email or password provided is incorrect."}`))
+			return
+		}
+		f.writeSession(w, form["email"])
+		return
+	case "/api/v1/auths/signup":
+		var form map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&form)
+		if !f.signupEnabled && len(f.passwords) > 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		role := f.adminConfig["DEFAULT_USER_ROLE"].(string)
+		if len(f.passwords) == 0 {
+			role = "admin"
+		}
+		f.passwords[form["email"]] = form["password"]
+		f.roles[form["email"]] = role
+		f.writeSession(w, form["email"])
+		return
+	}
+
+	email := r.Header.Get("Authorization")[len("Bearer "):]
+	if f.roles[email] != "admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method + " " + r.URL.Path {
+	case "GET /api/v1/auths/admin/config":
+		_ = json.NewEncoder(w).Encode(f.adminConfig)
+	case "POST /api/v1/auths/admin/config":
+		_ = json.NewDecoder(r.Body).Decode(&f.adminConfig)
+		f.signupEnabled = f.adminConfig["ENABLE_SIGNUP"] == true
+		_ = json.NewEncoder(w).Encode(f.adminConfig)
+	case "GET /api/v1/configs/models":
+		_ = json.NewEncoder(w).Encode(f.modelsConfig)
+	case "POST /api/v1/configs/models":
+		_ = json.NewDecoder(r.Body).Decode(&f.modelsConfig)
+		_ = json.NewEncoder(w).Encode(f.modelsConfig)
+	case "GET /openai/config":
+		_ = json.NewEncoder(w).Encode(f.openaiConfig)
+	case "POST /openai/config/update":
+		_ = json.NewDecoder(r.Body).Decode(&f.openaiConfig)
+		_ = json.NewEncoder(w).Encode(f.openaiConfig)
+	case "GET /api/v1/users/all":
+		users := []openwebui.User{}
+		for _, email := range slices.Sorted(maps.Keys(f.roles)) {
+			users = append(users, openwebui.User{ID: email, Name: email, Email: email, Role: f.roles[email]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"users": users, "total": len(users)})
+	case "POST /api/v1/auths/add":
+		var form map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&form)
+		f.passwords[form["email"]] = form["password"]
+		f.roles[form["email"]] = form["role"]
+		_ = json.NewEncoder(w).Encode(openwebui.User{ID: form["email"], Name: form["name"], Email: form["email"], Role: form["role"]})
+	case "POST /api/v1/users/update/role":
+		var form map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&form)
+		if _, ok := f.roles[form["id"]]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.roles[form["id"]] = form["role"]
+		_ = json.NewEncoder(w).Encode(form)
+	case "GET /api/v1/groups/":
+		_ = json.NewEncoder(w).Encode(f.groups)
+	case "POST /api/v1/groups/create":
+		var group openwebui.Group
+		_ = json.NewDecoder(r.Body).Decode(&group)
+		group.ID = fmt.Sprintf("group-%d", len(f.groups)+1)
+		group.UserIDs = []string{}
+		f.groups = append(f.groups, group)
+		_ = json.NewEncoder(w).Encode(group)
+	case "GET /api/v1/configs/banners":
+		_ = json.NewEncoder(w).Encode(f.banners)
+	case "POST /api/v1/configs/banners":
+		var form struct {
+			Banners []openwebui.Banner `json:"banners"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&form)
+		f.banners = form.Banners
+		_ = json.NewEncoder(w).Encode(f.banners)
+	case "GET /api/v1/prompts/":
+		prompts := []openwebui.Prompt{}
+		for _, command := range slices.Sorted(maps.Keys(f.prompts)) {
+			prompts = append(prompts, f.prompts[command])
+		}
+		_ = json.NewEncoder(w).Encode(prompts)
+	case "POST /api/v1/prompts/create":
+		var prompt openwebui.Prompt
+		_ = json.NewDecoder(r.Body).Decode(&prompt)
+		if _, ok := f.prompts[prompt.Command]; ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.prompts[prompt.Command] = prompt
+		_ = json.NewEncoder(w).Encode(prompt)
+	case "GET /api/v1/models/":
+		presets := []fakeModelPreset{}
+		for _, id := range slices.Sorted(maps.Keys(f.presets)) {
+			presets = append(presets, f.presets[id])
+		}
+		_ = json.NewEncoder(w).Encode(presets)
+	case "POST /api/v1/models/create", "POST /api/v1/models/model/update":
+		var preset fakeModelPreset
+		_ = json.NewDecoder(r.Body).Decode(&preset)
+		if _, ok := f.presets[preset.ID]; ok == (r.URL.Path == "/api/v1/models/create") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.presets[preset.ID] = preset
+		_ = json.NewEncoder(w).Encode(preset)
+	case "DELETE /api/v1/models/model/delete":
+		delete(f.presets, r.URL.Query().Get("id"))
+		_ = json.NewEncoder(w).Encode(true)
+	default:
+		if command, ok := strings.CutPrefix(r.URL.Path, "/api/v1/prompts/command/"); ok {
+			command, action, _ := strings.Cut(command, "/")
+			if _, ok := f.prompts["/"+command]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			switch r.Method + " " + action {
+			case "POST update":
+				var prompt openwebui.Prompt
+				_ = json.NewDecoder(r.Body).Decode(&prompt)
+				f.prompts["/"+command] = prompt
+				_ = json.NewEncoder(w).Encode(prompt)
+			case "DELETE delete":
+				delete(f.prompts, "/"+command)
+				_ = json.NewEncoder(w).Encode(true)
+			default:
+				http.NotFound(w, r)
+			}
+			return
+		}
+		for i, group := range f.groups {
+			if r.Method == http.MethodPost && r.URL.Path == "/api/v1/groups/id/"+group.ID+"/update" {
+				_ = json.NewDecoder(r.Body).Decode(&f.groups[i])
+				_ = json.NewEncoder(w).Encode(f.groups[i])
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
+
+// writeSession answers a session whose token is the email of the account.
+func (f *fakeOpenWebUI) writeSession(w http.ResponseWriter, email string) {
+	_ = json.NewEncoder(w).Encode(openwebui.Session{Token: email, ID: email, Email: email, Role: f.roles[email]})
+}
+
+func TestEnsureOpenWebUIBootstrap(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{{Name: "llama3.2:1b"}, {Name: "qwen2.5:0.5b", Alias: "qwen"}}
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{
+		AdminSecretName: "team-a-admin",
+		Signup:          appsv1alpha1.SignupModeDisabled,
+		DefaultUserRole: appsv1alpha1.UserRoleUser,
+		Banner:          "Chats are deleted after 30 days",
+	}
+	workspace.Spec.Providers = []appsv1alpha1.ProviderSpec{{Name: "openai", BaseURL: "https://api.openai.com/v1/", Models: []string{"gpt-4o-mini"}}}
+	webui.openaiConfig["OPENAI_API_BASE_URLS"] = []any{"http://team-a-ollama.team-a.svc:11434/v1", "https://api.openai.com/v1"}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "team-a-openwebui", Namespace: "team-a"}}
+	c := newFakeClient(t, workspace, admin, deployment)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	// Open WebUI isn't ready yet.
+	if result, err := r.ensureOpenWebUIBootstrap(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureOpenWebUIBootstrap() = %v, %v", result, err)
+	}
+	condition := apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped)
+	if condition == nil || condition.Reason != appsv1alpha1.WaitingForOpenWebUIReason {
+		t.Fatalf("condition = %+v, want WaitingForOpenWebUI", condition)
+	}
+	if len(webui.passwords) != 0 {
+		t.Fatalf("accounts = %v, want none before Open WebUI is ready", webui.passwords)
+	}
+
+	deployment.Status.ReadyReplicas = 1
+	if err := c.Status().Update(ctx, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureOpenWebUIBootstrap(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureOpenWebUIBootstrap() = %v, %v", result, err)
+	}
+	if !apimeta.IsStatusConditionTrue(workspace.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped) {
+		t.Fatalf("conditions = %+v, want OpenWebUIBootstrapped", workspace.Status.Conditions)
+	}
+	if webui.roles["admin@example.com"] != "admin" {
+		t.Errorf("roles = %v, want admin@example.com signed up as the admin", webui.roles)
+	}
+	if webui.adminConfig["ENABLE_SIGNUP"] != false || webui.adminConfig["DEFAULT_USER_ROLE"] != "user" {
+		t.Errorf("admin config = %v, want signup disabled and the user role", webui.adminConfig)
+	}
+	if got := webui.modelsConfig["DEFAULT_MODELS"]; got != "llama3.2:1b,qwen" {
+		t.Errorf("DEFAULT_MODELS = %v, want llama3.2:1b,qwen", got)
+	}
+	if len(webui.banners) != 1 || webui.banners[0].Content != "Chats are deleted after 30 days" {
+		t.Errorf("banners = %+v, want the banner of spec.bootstrap", webui.banners)
+	}
+	configs, _ := webui.openaiConfig["OPENAI_API_CONFIGS"].(map[string]any)
+	if config, _ := configs["1"].(map[string]any); config == nil || !reflect.DeepEqual(config["model_ids"], []any{"gpt-4o-mini"}) {
+		t.Errorf("OPENAI_API_CONFIGS = %v, want the models of the provider on its connection", configs)
+	}
+	if _, ok := configs["0"]; ok {
+		t.Errorf("OPENAI_API_CONFIGS = %v, want the connection of the workspace left alone", configs)
+	}
+
+	// a new generation signs the admin in again and removes the banner.
+	workspace.Generation = 2
+	workspace.Spec.Bootstrap.Banner = ""
+	if result, err := r.ensureOpenWebUIBootstrap(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureOpenWebUIBootstrap() = %v, %v", result, err)
+	}
+	if len(webui.banners) != 0 {
+		t.Errorf("banners = %+v, want the banner removed", webui.banners)
+	}
+
+	// an admin Secret with another password can't sign in nor sign up, Open WebUI has its admin.
+	workspace.Generation = 3
+	admin.Data["password"] = []byte("changed")
+	if err := c.Update(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureOpenWebUIBootstrap(ctx, workspace, webui.URL); result == nil || err == nil {
+		t.Fatalf("ensureOpenWebUIBootstrap() = %v, %v, want an error", result, err)
+	}
+	condition = apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped)
+	if condition == nil || condition.Reason != appsv1alpha1.BootstrapFailedReason {
+		t.Errorf("condition = %+v, want BootstrapFailed", condition)
+	}
+}
+
+func TestEnsureOpenWebUIBootstrapKeepsOIDCSignupDisabled(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin", Signup: appsv1alpha1.SignupModeEnabled}
+	workspace.Spec.Auth = &appsv1alpha1.AuthSpec{OIDC: &appsv1alpha1.OIDCSpec{DisableLocalSignup: true}}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-openwebui", Namespace: "team-a"},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	c := newFakeClient(t, workspace, admin, deployment)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	if result, err := r.ensureOpenWebUIBootstrap(context.Background(), workspace, webui.URL); result != nil {
+		t.Fatalf("ensureOpenWebUIBootstrap() = %v, %v", result, err)
+	}
+	if webui.adminConfig["ENABLE_SIGNUP"] != false {
+		t.Errorf("admin config = %v, want the signup kept disabled by auth.oidc.disableLocalSignup", webui.adminConfig)
+	}
+}
+
+func TestEnsureWorkspaceAccessWaitsForBootstrap(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin"}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "team-a-openwebui", Namespace: "team-a"}}
+	c := newFakeClient(t, workspace, admin, deployment)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+	route := types.NamespacedName{Name: "team-a-openwebui", Namespace: "team-a"}
+
+	// the admin doesn't exist yet, Open WebUI isn't published.
+	if result, err := r.ensureWorkspaceAccess(ctx, workspace, inference.Ollama{}, testConfig(t), webui.URL); result != nil {
+		t.Fatalf("ensureWorkspaceAccess() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, route, &networkingv1.Ingress{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("the Open WebUI Ingress should wait for the bootstrap, got %v", err)
+	}
+
+	// the admin signed up, the route is created.
+	deployment.Status.ReadyReplicas = 1
+	if err := c.Status().Update(ctx, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureWorkspaceAccess(ctx, workspace, inference.Ollama{}, testConfig(t), webui.URL); result != nil {
+		t.Fatalf("ensureWorkspaceAccess() = %v, %v", result, err)
+	}
+	if webui.roles["admin@example.com"] != "admin" {
+		t.Fatalf("roles = %v, want admin@example.com signed up as the admin", webui.roles)
+	}
+	if err := c.Get(ctx, route, &networkingv1.Ingress{}); err != nil {
+		t.Errorf("the Open WebUI Ingress should be created once bootstrapped: %v", err)
+	}
+}
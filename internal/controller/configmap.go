@@ -0,0 +1,127 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// ensureConfigMap ensures that the specified ConfigMap exists in the workspace namespace
+// and holds the desired data.
+//
+// If the ConfigMap does not exist, it is created. If it exists with different data, the
+// data is replaced. If an error occurs during this process, it logs the error and returns it.
+func (r *AIChatWorkspaceReconciler) ensureConfigMap(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, configMap *corev1.ConfigMap) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	found := &corev1.ConfigMap{}
+
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      configMap.Name,
+		Namespace: instance.Spec.WorkspaceName,
+	}, found)
+
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a ConfigMap", "ConfigMap.Namespace", instance.Spec.WorkspaceName, "ConfigMap.Name", configMap.Name)
+
+		setWorkspaceLabel(instance, configMap)
+		if err = r.Create(ctx, configMap); err != nil {
+			logger.Error(err, "Failed to create ConfigMap", "ConfigMap.Namespace", instance.Spec.WorkspaceName, "ConfigMap.Name", configMap.Name)
+
+			return &ctrl.Result{}, err
+		}
+
+		r.eventCreated(instance, "ConfigMap", configMap)
+		return nil, nil
+
+	} else if err != nil {
+		logger.Error(err, "Failed to get ConfigMap")
+
+		return &ctrl.Result{}, err
+	}
+
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if !reflect.DeepEqual(found.Data, configMap.Data) {
+		logger.Info("Updating ConfigMap", "ConfigMap.Namespace", found.Namespace, "ConfigMap.Name", found.Name)
+		found.Data = configMap.Data
+		if err = r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to update ConfigMap", "ConfigMap.Namespace", found.Namespace, "ConfigMap.Name", found.Name)
+
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "ConfigMap", found)
+	}
+
+	return nil, nil
+}
+
+/**
+ * Ensures the CA bundle of the workspace configuration is available to Ollama.
+ *
+ * The bundle is copied to a ConfigMap of the workspace namespace, mounted by the Ollama
+ * StatefulSet (see k8s.AddEgressConfig). The ConfigMap is removed when no bundle is configured.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace instance.
+ * @param cfg The configuration of the workspace.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureCABundle(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, cfg *config.Config) (*ctrl.Result, error) {
+	name := caBundleName(instance)
+
+	if cfg.CABundle == "" {
+		if err := r.deleteIfExists(ctx, &corev1.ConfigMap{}, instance.Spec.WorkspaceName, name); err != nil {
+			return &ctrl.Result{}, err
+		}
+		return nil, nil
+	}
+
+	labels := defaultLabels(instance.Spec.WorkspaceName, name, constants.CABundleName)
+	data := map[string]string{constants.CABundleKey: cfg.CABundle}
+	return r.ensureConfigMap(ctx, instance, k8s.NewConfigMap(name, instance.Spec.WorkspaceName, data, labels))
+}
+
+// caBundleName returns the name of the CA bundle ConfigMap of a workspace.
+func caBundleName(instance *appsv1alpha1.AIChatWorkspace) string {
+	return generateName(instance.Spec.WorkspaceName, constants.CABundleName)
+}
+
+// caBundleHash identifies the content of a CA bundle, an empty string when there is none.
+func caBundleHash(bundle string) string {
+	if bundle == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(bundle))
+	return hex.EncodeToString(sum[:8])
+}
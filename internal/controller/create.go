@@ -19,6 +19,7 @@ package controller
 import (
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -31,6 +32,7 @@ type CreateAIChatWorkspaceStep struct {
 }
 
 func (step *CreateAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance) (ctrl.Result, error) {
+	instance.startStep("Create")
 
 	var result *ctrl.Result
 	var err error
@@ -40,7 +42,10 @@ func (step *CreateAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance
 	if !isCreated && !pendingDeletion {
 		result, err = instance.r.handleReconcile(instance.ctx, result, instance.aichatWorkspaceConfig)
 		if result != nil {
-			return instance.r.finishReconcile(err, false)
+			if err != nil {
+				instance.r.Recorder.Event(instance.aichatWorkspaceConfig, corev1.EventTypeWarning, EventReasonReconcileFailed, err.Error())
+			}
+			return instance.r.finishReconcile(err, result)
 		}
 
 		instance.aichatWorkspaceConfig.Status.IsCreated = true
@@ -55,7 +60,7 @@ func (step *CreateAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance
 			})
 			if err = instance.r.patchStatus(instance.ctx, instance.aichatWorkspaceConfig); err != nil {
 				err = fmt.Errorf("unable to patch status after progressing: %w", err)
-				return instance.r.finishReconcile(err, false)
+				return instance.r.finishReconcile(err, nil)
 			}
 		}
 		apimeta.SetStatusCondition(&instance.aichatWorkspaceConfig.Status.Conditions, metav1.Condition{
@@ -75,18 +80,18 @@ func (step *CreateAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance
 
 		if err = instance.r.patchStatus(instance.ctx, instance.aichatWorkspaceConfig); err != nil {
 			err = fmt.Errorf("unable to patch status after progressing: %w", err)
-			return instance.r.finishReconcile(err, false)
+			return instance.r.finishReconcile(err, nil)
 		}
 
-		// instance.r.Recorder.Event(instance.aichatWorkspaceConfig, "Normal", "Created",
-		// 	fmt.Sprintf("aichatWorkspace %s was created in namespace %s",
-		// 		instance.aichatWorkspaceConfig.Name,
-		// 		instance.aichatWorkspaceConfig.Namespace))
+		instance.r.Recorder.Event(instance.aichatWorkspaceConfig, corev1.EventTypeNormal, EventReasonCreated,
+			fmt.Sprintf("aichatWorkspace %s was created in namespace %s",
+				instance.aichatWorkspaceConfig.Name,
+				instance.aichatWorkspaceConfig.Namespace))
 
 	}
 
 	if step.next == nil {
-		return instance.r.finishReconcile(nil, false)
+		return instance.r.finishReconcile(nil, nil)
 	}
 
 	return step.next.execute(instance)
@@ -17,46 +17,101 @@ limitations under the License.
 package controller
 
 import (
+	"context"
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
 )
 
 type DeleteAIChatWorkspaceStep struct {
 	next AIChatWorkspace
 }
 
+/**
+ * Cleans up a deleted AIChatWorkspace before releasing its finalizer.
+ *
+ * Runs from any state, including workspaces whose creation never completed. The finalizer is only
+ * removed once the workspace namespace is gone; until then the progress is reported in the
+ * Terminating condition. Setting the aichatworkspaces.io/force-delete annotation to "true" removes
+ * the finalizer without waiting, for namespaces stuck on finalizers the operator can't resolve.
+ */
 func (step *DeleteAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance) (ctrl.Result, error) {
-	var err error
-	isCreated := instance.aichatWorkspaceConfig.Status.IsCreated
-	pendingDeletion := instance.aichatWorkspaceConfig.ObjectMeta.DeletionTimestamp != nil
-
-	if isCreated && pendingDeletion {
-		instance.logger.Info("reconciling aichat", "aichat", instance.aichatWorkspaceConfig, "action", "delete")
-		if controllerutil.ContainsFinalizer(instance.aichatWorkspaceConfig, aichatWorkspaceFinalizerName) {
-			if err = instance.r.deleteAIChatWorkspace(instance.ctx, instance.aichatWorkspaceConfig); err != nil {
-				return instance.r.finishReconcile(err, false)
-			}
-			instance.r.Recorder.Event(instance.aichatWorkspaceConfig, "Warning", "Deleting",
-				fmt.Sprintf("aichatWorkspace %s is being deleted from the namespace %s",
-					instance.aichatWorkspaceConfig.Name,
-					instance.aichatWorkspaceConfig.Namespace))
-			controllerutil.RemoveFinalizer(instance.aichatWorkspaceConfig, aichatWorkspaceFinalizerName)
-			if err = instance.r.Update(instance.ctx, instance.aichatWorkspaceConfig); err != nil {
-				return instance.r.finishReconcile(err, false)
+	instance.startStep("Delete")
+	aichat := instance.aichatWorkspaceConfig
+	pendingDeletion := aichat.ObjectMeta.DeletionTimestamp != nil
+
+	if pendingDeletion && controllerutil.ContainsFinalizer(aichat, aichatWorkspaceFinalizerName) {
+		instance.logger.Info("reconciling aichat", "aichat", aichat, "action", "delete")
+		force := aichat.GetAnnotations()[constants.ForceDeleteAnnotation] == "true"
+
+		namespace, err := instance.r.deleteAIChatWorkspace(instance.ctx, aichat)
+		if err != nil && !force {
+			return instance.r.finishReconcile(err, nil)
+		}
+
+		if namespace != nil || err != nil {
+			if !force {
+				message := fmt.Sprintf("waiting for namespace %s to be deleted", aichat.Spec.WorkspaceName)
+				if blockers := namespaceDeletionBlockers(namespace); blockers != "" {
+					message = fmt.Sprintf("%s: %s", message, blockers)
+				}
+				instance.r.Recorder.Event(aichat, corev1.EventTypeWarning, EventReasonDeleting,
+					fmt.Sprintf("aichatWorkspace %s is being deleted from the namespace %s", aichat.Name, aichat.Namespace))
+				if err := instance.r.setTerminating(instance.ctx, aichat, appsv1alpha1.NamespaceTerminatingReason, message); err != nil {
+					return instance.r.finishReconcile(err, nil)
+				}
+				return instance.r.finishReconcile(nil, &ctrl.Result{RequeueAfter: NamespaceDeletionPollInterval})
 			}
+
+			instance.r.Recorder.Eventf(aichat, corev1.EventTypeWarning, EventReasonCleanupForced,
+				"Removing the finalizer without waiting for namespace %s, it may need to be cleaned up by hand", aichat.Spec.WorkspaceName)
 		}
 
+		controllerutil.RemoveFinalizer(aichat, aichatWorkspaceFinalizerName)
+		if err = instance.r.Update(instance.ctx, aichat); err != nil {
+			return instance.r.finishReconcile(err, nil)
+		}
 	}
 
 	if step.next == nil {
-		return instance.r.finishReconcile(nil, false)
+		return instance.r.finishReconcile(nil, nil)
 	}
 
 	return step.next.execute(instance)
 }
 
+/**
+ * Sets the Terminating condition of a deleted AIChatWorkspace.
+ *
+ * The status is only patched when the condition changes.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace being deleted.
+ * @param reason The reason of the Terminating condition.
+ * @param message The message of the Terminating condition.
+ * @return An error if the status could not be patched, or nil otherwise.
+ */
+func (r *AIChatWorkspaceReconciler) setTerminating(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, reason, message string) error {
+	changed := apimeta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeTerminating,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: instance.GetGeneration(),
+	})
+	if !changed {
+		return nil
+	}
+	return r.patchStatus(ctx, instance)
+}
+
 func (step *DeleteAIChatWorkspaceStep) setNext(next AIChatWorkspace) {
 	step.next = next
 }
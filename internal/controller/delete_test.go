@@ -0,0 +1,162 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func deletedWorkspace(annotations map[string]string) *appsv1alpha1.AIChatWorkspace {
+	now := metav1.Now()
+	return &appsv1alpha1.AIChatWorkspace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "team-a",
+			Namespace:         constants.AIChatWorkspaceNamespace,
+			Finalizers:        []string{aichatWorkspaceFinalizerName},
+			DeletionTimestamp: &now,
+			Annotations:       annotations,
+		},
+		// Status.IsCreated is false, the creation never completed.
+		Spec: appsv1alpha1.AIChatWorkspaceSpec{WorkspaceName: "team-a"},
+	}
+}
+
+func runDeleteStep(t *testing.T, c client.Client, name string) (ctrl.Result, error) {
+	t.Helper()
+	instance := &AIChatWorkspaceInstance{
+		r:      &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10)},
+		ctx:    context.Background(),
+		logger: ctrl.Log,
+	}
+	instance.aichatWorkspaceConfig = &appsv1alpha1.AIChatWorkspace{}
+	if err := c.Get(instance.ctx, client.ObjectKey{Name: name, Namespace: constants.AIChatWorkspaceNamespace}, instance.aichatWorkspaceConfig); err != nil {
+		t.Fatal(err)
+	}
+	step := &DeleteAIChatWorkspaceStep{}
+	return step.execute(instance)
+}
+
+func TestDeleteStepWaitsForNamespace(t *testing.T) {
+	c := newFakeClient(t, deletedWorkspace(nil), workspaceNamespace("team-a", nil))
+
+	result, err := runDeleteStep(t, c, "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != NamespaceDeletionPollInterval {
+		t.Errorf("RequeueAfter = %s, want %s", result.RequeueAfter, NamespaceDeletionPollInterval)
+	}
+
+	workspace := &appsv1alpha1.AIChatWorkspace{}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "team-a", Namespace: constants.AIChatWorkspaceNamespace}, workspace); err != nil {
+		t.Fatalf("expected the finalizer to be kept until the namespace is gone: %v", err)
+	}
+	if !apimeta.IsStatusConditionTrue(workspace.Status.Conditions, appsv1alpha1.ConditionTypeTerminating) {
+		t.Errorf("expected the Terminating condition to be set, got %v", workspace.Status.Conditions)
+	}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "team-a"}, &corev1.Namespace{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the namespace to be deleted, got %v", err)
+	}
+
+	// The namespace is gone, the finalizer is released.
+	if _, err := runDeleteStep(t, c, "team-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "team-a", Namespace: constants.AIChatWorkspaceNamespace}, workspace); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the AIChatWorkspace to be gone, got %v", err)
+	}
+}
+
+func TestDeleteStepForced(t *testing.T) {
+	namespace := workspaceNamespace("team-a", nil)
+	namespace.Finalizers = []string{"example.com/stuck"}
+	c := newFakeClient(t, deletedWorkspace(map[string]string{constants.ForceDeleteAnnotation: "true"}), namespace)
+
+	if _, err := runDeleteStep(t, c, "team-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "team-a", Namespace: constants.AIChatWorkspaceNamespace}, &appsv1alpha1.AIChatWorkspace{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the finalizer to be removed, got %v", err)
+	}
+}
+
+func TestDeleteStepKeepsAdoptedNamespace(t *testing.T) {
+	// an existing namespace named after the workspace, adopted rather than created by the operator.
+	adopted := workspaceNamespace("team-a", nil)
+	delete(adopted.Annotations, constants.CreatedForAnnotation)
+	// a namespace created for another AIChatWorkspace with the same workspace name.
+	other := workspaceNamespace("team-a", map[string]string{constants.CreatedForAnnotation: "elsewhere/team-a"})
+
+	for name, namespace := range map[string]*corev1.Namespace{"adopted": adopted, "other workspace": other} {
+		c := newFakeClient(t, deletedWorkspace(nil), namespace)
+
+		result, err := runDeleteStep(t, c, "team-a")
+		if err != nil || !result.IsZero() {
+			t.Fatalf("%s: delete step = %v, %v, want the finalizer released", name, result, err)
+		}
+		if err := c.Get(context.Background(), client.ObjectKey{Name: "team-a"}, &corev1.Namespace{}); err != nil {
+			t.Errorf("%s: namespace: %v, want it kept", name, err)
+		}
+		if err := c.Get(context.Background(), client.ObjectKey{Name: "team-a", Namespace: constants.AIChatWorkspaceNamespace}, &appsv1alpha1.AIChatWorkspace{}); !apierrors.IsNotFound(err) {
+			t.Errorf("%s: AIChatWorkspace: %v, want it gone", name, err)
+		}
+	}
+}
+
+func TestEnsureNamespaceRecordsCreation(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	existing := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}}
+	c := newFakeClient(t, workspace, existing)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10)}
+	ctx := context.Background()
+
+	if result, err := r.ensureNamespace(ctx, workspace, k8s.NewNamespace("team-a", nil)); result != nil {
+		t.Fatalf("ensureNamespace() = %v, %v", result, err)
+	}
+	created := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "team-a"}, created); err != nil {
+		t.Fatal(err)
+	}
+	if !createdForWorkspace(workspace, created) {
+		t.Errorf("namespace = %+v, want it recorded as created for the workspace", created.ObjectMeta)
+	}
+
+	// an existing namespace is tracked, not recorded as created.
+	workspace.Spec.WorkspaceName = "team-b"
+	if result, err := r.ensureNamespace(ctx, workspace, k8s.NewNamespace("team-b", nil)); result != nil {
+		t.Fatalf("ensureNamespace() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Name: "team-b"}, existing); err != nil {
+		t.Fatal(err)
+	}
+	if existing.Labels[constants.WorkspaceLabelName] != "team-b" || createdForWorkspace(workspace, existing) {
+		t.Errorf("namespace = %+v, want it tracked but not recorded as created", existing.ObjectMeta)
+	}
+}
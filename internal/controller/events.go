@@ -0,0 +1,64 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+)
+
+// Reasons of the events emitted on the AIChatWorkspace.
+const (
+	EventReasonCreated                = "Created"
+	EventReasonUpdated                = "Updated"
+	EventReasonDeleting               = "Deleting"
+	EventReasonReconcileFailed        = "ReconcileFailed"
+	EventReasonModelPullStarted       = "ModelPullStarted"
+	EventReasonModelPulled            = "ModelPulled"
+	EventReasonModelPullFailed        = "ModelPullFailed"
+	EventReasonModelUpdateAvailable   = "ModelUpdateAvailable"
+	EventReasonModelUpdateCheckFailed = "ModelUpdateCheckFailed"
+	EventReasonModelDigestMismatch    = "ModelDigestMismatch"
+	EventReasonPersonaCreated         = "PersonaCreated"
+	EventReasonPersonaFailed          = "PersonaFailed"
+	EventReasonIngressReady           = "IngressReady"
+	EventReasonQuotaExceeded          = "QuotaExceeded"
+	EventReasonCleanupForced          = "CleanupForced"
+	EventReasonNamespaceKept          = "NamespaceKept"
+	EventReasonProviderConnected      = "ProviderConnected"
+	EventReasonProviderFailed         = "ProviderFailed"
+)
+
+// eventCreated records that the operator created an object of the workspace.
+func (r *AIChatWorkspaceReconciler) eventCreated(instance *appsv1alpha1.AIChatWorkspace, kind string, obj client.Object) {
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonCreated, "Created %s %s", kind, objectName(obj))
+}
+
+// eventUpdated records that the operator updated an object of the workspace.
+func (r *AIChatWorkspaceReconciler) eventUpdated(instance *appsv1alpha1.AIChatWorkspace, kind string, obj client.Object) {
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonUpdated, "Updated %s %s", kind, objectName(obj))
+}
+
+// objectName returns namespace/name, or name for cluster scoped objects.
+func objectName(obj client.Object) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
@@ -26,6 +26,7 @@ type FinalizerStep struct {
 }
 
 func (step *FinalizerStep) execute(instance *AIChatWorkspaceInstance) (ctrl.Result, error) {
+	instance.startStep("Finalizer")
 	var err error
 	pendingDeletion := instance.aichatWorkspaceConfig.ObjectMeta.DeletionTimestamp != nil
 	hasFinalizer := controllerutil.ContainsFinalizer(instance.aichatWorkspaceConfig, aichatWorkspaceFinalizerName)
@@ -34,12 +35,12 @@ func (step *FinalizerStep) execute(instance *AIChatWorkspaceInstance) (ctrl.Resu
 		instance.logger.Info("reconciling aichat", "aichat", instance.aichatWorkspaceConfig, "action", "add finalizer")
 		controllerutil.AddFinalizer(instance.aichatWorkspaceConfig, aichatWorkspaceFinalizerName)
 		if err = instance.r.Update(instance.ctx, instance.aichatWorkspaceConfig); err != nil {
-			return instance.r.finishReconcile(err, false)
+			return instance.r.finishReconcile(err, nil)
 		}
 	}
 
 	if step.next == nil {
-		return instance.r.finishReconcile(nil, false)
+		return instance.r.finishReconcile(nil, nil)
 	}
 
 	return step.next.execute(instance)
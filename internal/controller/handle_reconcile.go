@@ -22,21 +22,38 @@ import (
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
 	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
 	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
 	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/metrics"
 )
 
 func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result *ctrl.Result, aichat *appsv1alpha1.AIChatWorkspace) (*ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 	var err error
 
-	// get config
-	config, err := config.GetConfig()
+	// get the operator config, with the profile and overrides of the workspace applied.
+	config, err := r.workspaceConfig(ctx, aichat)
 	if err != nil {
-		return result, err
+		return &ctrl.Result{}, err
+	}
+
+	// the model entries are schemaless in the CRD, an invalid entry stops the reconcile until it is fixed.
+	if err := appsv1alpha1.ValidateModels(aichat.Spec.Models); err != nil {
+		return &ctrl.Result{}, reconcile.TerminalError(err)
+	}
+
+	// the inference server of the workspace, some engines only serve a subset of the model entries.
+	backend, err := inferenceBackend(aichat)
+	if err != nil {
+		return &ctrl.Result{}, reconcile.TerminalError(err)
+	}
+	if err := backend.ValidateModels(aichat.Spec.Models); err != nil {
+		return &ctrl.Result{}, reconcile.TerminalError(err)
 	}
 
 	logger.Info("reconciling aichatworkspace")
@@ -45,6 +62,7 @@ func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result
 	// to run the AIChat Workspace.
 	namespaceDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, aichat.Spec.WorkspaceName, constants.AIChatWorkspaceName)
 	result, err = r.ensureNamespace(ctx, aichat, k8s.NewNamespace(aichat.Spec.WorkspaceName, namespaceDefaultLabels))
+	metrics.ObserveEnsure("Namespace", result != nil, err)
 	if result != nil {
 		return result, err
 	}
@@ -53,6 +71,7 @@ func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result
 	resourceQuotaName := generateName(aichat.Spec.WorkspaceName, constants.ResourceQuotaName)
 	resourceQuotaDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, aichat.Spec.WorkspaceName, constants.ResourceQuotaLabelName)
 	result, err = r.ensureResourceQuota(ctx, aichat, k8s.NewResourceQuota(aichat.Spec.WorkspaceName, resourceQuotaName, resourceQuotaDefaultLabels))
+	metrics.ObserveEnsure("ResourceQuota", result != nil, err)
 	if result != nil {
 		return result, err
 	}
@@ -61,6 +80,7 @@ func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result
 	pvcName := generateName(aichat.Spec.WorkspaceName, constants.OpenwebuiName)
 	openwebuiPVCLabels := defaultLabels(aichat.Spec.WorkspaceName, pvcName, constants.PVCLabelName)
 	result, err = r.ensurePVC(ctx, aichat, k8s.NewPersistentVolumeClaim(pvcName, aichat.Spec.WorkspaceName, constants.OpenwebuiDefaultVolumeSize, openwebuiPVCLabels))
+	metrics.ObserveEnsure("PersistentVolumeClaim", result != nil, err)
 	if result != nil {
 		return result, err
 	}
@@ -69,35 +89,66 @@ func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result
 	serviceAccountForOpenWebUIName := generateName(aichat.Spec.WorkspaceName, constants.OpenwebuiName)
 	openwebuiDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, serviceAccountForOpenWebUIName, constants.ServiceAccountLabelName)
 	result, err = r.ensureServiceAccount(ctx, aichat, k8s.NewServiceAccount(serviceAccountForOpenWebUIName, aichat.Spec.WorkspaceName, openwebuiDefaultLabels))
+	metrics.ObserveEnsure("ServiceAccount", result != nil, err)
 	if result != nil {
 		return result, err
 	}
 
-	// serviceAccout for the Ollama workload
-	serviceAccountForOllamaName := generateName(aichat.Spec.WorkspaceName, constants.OllamaName)
-	ollamaDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, serviceAccountForOllamaName, constants.ServiceAccountLabelName)
-	result, err = r.ensureServiceAccount(ctx, aichat, k8s.NewServiceAccount(serviceAccountForOllamaName, aichat.Spec.WorkspaceName, ollamaDefaultLabels))
+	// ensureOwners - granting spec.owners access to the workspace namespace and their AIChatWorkspace.
+	result, err = r.ensureOwners(ctx, aichat)
+	metrics.ObserveEnsure("Owners", result != nil, err)
 	if result != nil {
 		return result, err
 	}
 
-	// ensureStatefulSet - creating the StatefulSet used to run the Ollama API
-	ollamaName := generateName(aichat.Spec.WorkspaceName, constants.OllamaName)
-	result, err = r.ensureStatefulSet(ctx, aichat, k8s.NewStatefulSet(aichat.Spec.WorkspaceName, ollamaName, constants.OllamaPort, constants.OllamaDefaultVolumeSize, config.OllamaImageTag))
+	// ensureAPIGateway - generating the API key and the Service for the gateway guarding the Ollama API.
+	result, err = r.ensureAPIGateway(ctx, aichat)
+	metrics.ObserveEnsure("APIGateway", result != nil, err)
 	if result != nil {
 		return result, err
 	}
 
-	// ensureService - creating the Service used to route traffic to the Ollama API pod.
-	ollamaServiceDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, ollamaName, constants.ServiceLabelName)
-	result, err = r.ensureService(ctx, aichat, k8s.NewService(aichat.Spec.WorkspaceName, ollamaName, constants.OllamaPort, ollamaServiceDefaultLabels))
+	// ensureBackend - running the dedicated inference server of the workspace, or using the pool of a shared AIChatBackend.
+	var serverURI string
+	if backendMode(aichat) == appsv1alpha1.BackendModeShared {
+		serverURI, result, err = r.ensureSharedBackend(ctx, aichat, config)
+		metrics.ObserveEnsure("SharedBackend", result != nil, err)
+	} else {
+		serverURI, result, err = r.ensureDedicatedBackend(ctx, aichat, backend, config)
+	}
+	if result != nil {
+		return result, err
+	}
+
+	// ensureOpenWebUISecret - keeping the Open WebUI secret key across restarts.
+	openwebuiSecretHash, result, err := r.ensureOpenWebUISecret(ctx, aichat)
+	metrics.ObserveEnsure("Secret", result != nil, err)
 	if result != nil {
 		return result, err
 	}
 
 	// ensureDeployment - creating the Deployment used to deploy the Open WebUI workload.
 	openwebuiName := generateName(aichat.Spec.WorkspaceName, constants.OpenwebuiName)
-	result, err = r.ensureDeployment(ctx, aichat, k8s.NewDeployment(aichat.Spec.WorkspaceName, openwebuiName, constants.OpenwebuiContainerPort, config.OpenwebUIImageTag))
+	openwebuiDeployment := k8s.NewDeployment(aichat.Spec.WorkspaceName, openwebuiName, constants.OpenwebuiContainerPort, config.OpenWebUIImage(), config.ClusterDomain)
+	backend.ConfigureOpenWebUI(openwebuiDeployment, serverURI)
+	openwebuiDeployment.Spec.Template.Annotations = map[string]string{constants.OpenwebuiSecretHashAnnotation: openwebuiSecretHash}
+
+	// ensureOIDC - signing the users in with the OpenID Connect provider of the workspace.
+	result, err = r.ensureOIDC(ctx, aichat, config, openwebuiDeployment)
+	metrics.ObserveEnsure("OIDC", result != nil, err)
+	if result != nil {
+		return result, err
+	}
+
+	// ensureProviders - offering the external OpenAI-compatible providers next to the models of the workspace.
+	result, err = r.ensureProviders(ctx, aichat, openwebuiDeployment)
+	metrics.ObserveEnsure("Providers", result != nil, err)
+	if result != nil {
+		return result, err
+	}
+
+	result, err = r.ensureDeployment(ctx, aichat, openwebuiDeployment)
+	metrics.ObserveEnsure("Deployment", result != nil, err)
 	if result != nil {
 		return result, err
 	}
@@ -105,6 +156,7 @@ func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result
 	// ensureService - creating the Service used to route traffic to the Open WebUI pod.
 	openwebuiServiceDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, openwebuiName, constants.ServiceLabelName)
 	result, err = r.ensureService(ctx, aichat, k8s.NewService(aichat.Spec.WorkspaceName, openwebuiName, constants.OpenwebuiContainerPort, openwebuiServiceDefaultLabels))
+	metrics.ObserveEnsure("Service", result != nil, err)
 	if result != nil {
 		return result, err
 	}
@@ -112,27 +164,92 @@ func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result
 	// ensureService - creating the Service used to route traffic to the Open WebUI pod.
 	openwebuiExternalServiceDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, openwebuiName, constants.ServiceLabelName)
 	result, err = r.ensureService(ctx, aichat, k8s.NewExternalService(aichat.Spec.WorkspaceName, openwebuiExternalServiceDefaultLabels))
+	metrics.ObserveEnsure("Service", result != nil, err)
 	if result != nil {
 		return result, err
 	}
 
-	// ensureIngress - creating the Ingress used for Open WebUI service
-	// proxyName := fmt.Sprintf("%s", "openwebui")
-	openwebBackend := getName(aichat.Spec.WorkspaceName, constants.OpenwebuiName)
-	openwebuiDNSName := setIngressDNSHost(config, aichat.Spec.WorkspaceName, constants.OpenwebuiName)
-	result, err = r.ensureIngress(ctx, aichat, k8s.NewIngress(aichat.Spec.WorkspaceName, constants.OpenwebuiName, openwebBackend, openwebuiDNSName, constants.OpenwebuiContainerPort))
+	openwebuiURL := k8s.ServiceURL(openwebuiName, aichat.Spec.WorkspaceName, config.ClusterDomain, constants.OpenwebuiContainerPort)
+	return r.ensureWorkspaceAccess(ctx, aichat, backend, config, openwebuiURL)
+}
+
+/**
+ * Ensures Open WebUI is set up for the workspace and the workspace is reachable.
+ *
+ * The admin, the members and the patterns are applied through the API of Open WebUI, then the
+ * routes of Open WebUI and of the inference API are published and their status reported. With
+ * spec.bootstrap, the Open WebUI route is only created or updated once the admin exists, so nobody
+ * can sign up as the first account, the admin, before the operator.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param aichat The AIChatWorkspace whose Open WebUI runs.
+ * @param backend The inference backend of the workspace.
+ * @param config The configuration of the workspace.
+ * @param openwebuiURL The URL of the Open WebUI Service.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureWorkspaceAccess(ctx context.Context, aichat *appsv1alpha1.AIChatWorkspace, backend inference.Backend, config *config.Config, openwebuiURL string) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// ensureOpenWebUIBootstrap - creating the Open WebUI admin and applying the default settings once it runs.
+	result, err := r.ensureOpenWebUIBootstrap(ctx, aichat, openwebuiURL)
+	metrics.ObserveEnsure("Bootstrap", result != nil, err)
+	if result != nil {
+		return result, err
+	}
+
+	// ensureMembers - provisioning the Open WebUI accounts and groups of spec.members.
+	result, err = r.ensureMembers(ctx, aichat, openwebuiURL)
+	metrics.ObserveEnsure("Members", result != nil, err)
 	if result != nil {
 		return result, err
 	}
 
-	// ensureIngress - creating the Ingress used for Ollama service
-	ollamaBackend := getName(aichat.Spec.WorkspaceName, constants.OllamaName)
-	ollamaDNSName := setIngressDNSHost(config, aichat.Spec.WorkspaceName, constants.OllamaName)
-	result, err = r.ensureIngress(ctx, aichat, k8s.NewIngress(aichat.Spec.WorkspaceName, constants.OllamaName, ollamaBackend, ollamaDNSName, constants.OllamaPort))
+	// ensurePatterns - publishing spec.patterns as Open WebUI prompts or model presets.
+	result, err = r.ensurePatterns(ctx, aichat, openwebuiURL)
+	metrics.ObserveEnsure("Patterns", result != nil, err)
 	if result != nil {
 		return result, err
 	}
 
+	// ensureRoute - creating the Ingress or HTTPRoute used for Open WebUI service, once its admin exists.
+	if openWebUIBootstrapPending(aichat) {
+		logger.Info("Open WebUI isn't bootstrapped, waiting to publish its route")
+	} else {
+		openwebBackend := getName(aichat.Spec.WorkspaceName, constants.OpenwebuiName)
+		openwebuiDNSName := setIngressDNSHost(config, aichat.Spec.WorkspaceName, constants.OpenwebuiName)
+		result, err = r.ensureRoute(ctx, aichat, config, constants.OpenwebuiName, openwebBackend, openwebuiDNSName, constants.OpenwebuiContainerPort, nil)
+		metrics.ObserveEnsure("Route", result != nil, err)
+		if result != nil {
+			return result, err
+		}
+	}
+
+	// ensureAPIExposure - keep the Ollama API private, or publish it behind auth when spec.api.exposure is public.
+	result, err = r.ensureAPIExposure(ctx, aichat, backend, config)
+	metrics.ObserveEnsure("APIExposure", result != nil, err)
+	if result != nil {
+		return result, err
+	}
+
+	// ensureIngressCondition - reflect the Ingress or HTTPRoute status into the IngressReady condition.
+	routedWorkloads := []string{constants.OpenwebuiName}
+	if apiExposure(aichat) == appsv1alpha1.APIExposurePublic {
+		routedWorkloads = append(routedWorkloads, constants.OllamaName)
+	}
+	err = r.ensureIngressCondition(ctx, aichat, config, routedWorkloads...)
+	metrics.ObserveEnsure("IngressCondition", false, err)
+	if err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	// ensureUsageStatus - summarise the token usage metered by the API gateway.
+	err = r.ensureUsageStatus(ctx, aichat)
+	metrics.ObserveEnsure("UsageStatus", false, err)
+	if err != nil {
+		return &ctrl.Result{}, err
+	}
+
 	// hosts := []string{openwebuiDNSName}
 	// result, err = r.ensureHTTPScaledObject(ctx, aichat, k8s.NewHttpSo(aichat.Spec.WorkspaceName, "Deployment", constants.OpenwebuiName, constants.OpenwebuiContainerPort, hosts))
 	// if result != nil {
@@ -142,6 +259,70 @@ func (r *AIChatWorkspaceReconciler) handleReconcile(ctx context.Context, result
 	return result, nil
 }
 
+/**
+ * Ensures the dedicated inference server of a workspace runs in its namespace, with the CA bundle
+ * it trusts.
+ *
+ * The workload and its Service keep the <workspace>-ollama name whatever the engine, so the routes
+ * and network policies of the API don't change when the engine does.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param aichat The AIChatWorkspace in dedicated backend mode.
+ * @param backend The inference backend of the workspace.
+ * @param config The configuration of the workspace.
+ * @return The URL of the inference API, a ctrl.Result and an error, or a nil ctrl.Result if the server is ready.
+ */
+func (r *AIChatWorkspaceReconciler) ensureDedicatedBackend(ctx context.Context, aichat *appsv1alpha1.AIChatWorkspace, backend inference.Backend, config *config.Config) (string, *ctrl.Result, error) {
+	// serviceAccout for the inference workload
+	serviceAccountForOllamaName := generateName(aichat.Spec.WorkspaceName, constants.OllamaName)
+	ollamaDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, serviceAccountForOllamaName, constants.ServiceAccountLabelName)
+	result, err := r.ensureServiceAccount(ctx, aichat, k8s.NewServiceAccount(serviceAccountForOllamaName, aichat.Spec.WorkspaceName, ollamaDefaultLabels))
+	metrics.ObserveEnsure("ServiceAccount", result != nil, err)
+	if result != nil {
+		return "", result, err
+	}
+
+	// ensureCABundle - copying the CA bundle the server trusts to reach the model registries.
+	result, err = r.ensureCABundle(ctx, aichat, config)
+	metrics.ObserveEnsure("ConfigMap", result != nil, err)
+	if result != nil {
+		return "", result, err
+	}
+
+	// ensureStatefulSet - creating the StatefulSet used to run the inference API
+	ollamaName := generateName(aichat.Spec.WorkspaceName, constants.OllamaName)
+	serverStatefulSet := backend.StatefulSet(aichat.Spec.WorkspaceName, ollamaName, aichat.Spec.Models, config)
+	if apiAuthMode(aichat) == appsv1alpha1.APIAuthModeAPIKey {
+		apiKeysName := getName(aichat.Spec.WorkspaceName, constants.APIKeysName)
+		k8s.AddAPIGatewaySidecar(serverStatefulSet, config.GatewayImage(), apiKeysName, constants.APIGatewayPort, backend.Port(), aichat.Spec.API.Auth.AllowedPaths)
+	}
+	if config.HTTPSProxy != "" || config.NoProxy != "" || config.CABundle != "" {
+		caBundleConfigMap := ""
+		if config.CABundle != "" {
+			caBundleConfigMap = caBundleName(aichat)
+		}
+		k8s.AddEgressConfig(serverStatefulSet, config.HTTPSProxy, config.NoProxy, caBundleConfigMap, caBundleHash(config.CABundle))
+	}
+
+	// ensureService - creating the Service used to route traffic to the inference API pod.
+	// It is created before the server runs, the models are installed through it.
+	ollamaServiceDefaultLabels := defaultLabels(aichat.Spec.WorkspaceName, ollamaName, constants.ServiceLabelName)
+	result, err = r.ensureService(ctx, aichat, k8s.NewService(aichat.Spec.WorkspaceName, ollamaName, backend.Port(), ollamaServiceDefaultLabels))
+	metrics.ObserveEnsure("Service", result != nil, err)
+	if result != nil {
+		return "", result, err
+	}
+
+	serverURI := k8s.ServiceURL(ollamaName, aichat.Spec.WorkspaceName, config.ClusterDomain, backend.Port())
+	result, err = r.ensureStatefulSet(ctx, aichat, serverStatefulSet, backend, config, serverURI)
+	metrics.ObserveEnsure("StatefulSet", result != nil, err)
+	if result != nil {
+		return "", result, err
+	}
+
+	return serverURI, nil, nil
+}
+
 func getName(workspace, workload string) string {
 	name := fmt.Sprintf("%s-%s", workspace, workload)
 	return name
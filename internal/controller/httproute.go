@@ -0,0 +1,148 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+)
+
+// ensureHTTPRoute ensures that the specified HTTPRoute exists in the cluster.
+// If it does not exist, it will be created. If it exists but is attached to a
+// different Gateway or host, or routes to a different backend, the spec is updated.
+// If an error occurs during this process, it will be logged and returned.
+func (r *AIChatWorkspaceReconciler) ensureHTTPRoute(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, route *gatewayv1.HTTPRoute) (*reconcile.Result, error) {
+	logger := log.FromContext(ctx)
+	found := &gatewayv1.HTTPRoute{}
+
+	err := r.Get(context.TODO(), types.NamespacedName{
+		Name:      route.Name,
+		Namespace: instance.Spec.WorkspaceName,
+	}, found)
+	if err != nil && errors.IsNotFound(err) {
+
+		// Create the HTTPRoute
+		logger.Info("Creating a new HTTPRoute", "HTTPRoute.Namespace", instance.Spec.WorkspaceName, "HTTPRoute.Name", route.Name)
+		setWorkspaceLabel(instance, route)
+		err = r.Create(context.TODO(), route)
+
+		if err != nil {
+			// Creation failed
+			logger.Error(err, "Failed to create new HTTPRoute", "HTTPRoute.Namespace", instance.Spec.WorkspaceName, "HTTPRoute.Name", route.Name)
+			return &reconcile.Result{}, err
+		}
+		r.eventCreated(instance, "HTTPRoute", route)
+		// Creation was successful
+		return nil, nil
+
+	} else if err != nil {
+		// Error that isn't due to the HTTPRoute not existing
+		logger.Error(err, "Failed to get HTTPRoute")
+		return &reconcile.Result{}, err
+	}
+
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &reconcile.Result{}, err
+	}
+
+	// The parent Gateway can be changed per workspace or globally, keep the route attached to it.
+	// The backend changes with the API auth mode, keep the route pointing at it.
+	if !parentRefsEqual(found.Spec.ParentRefs, route.Spec.ParentRefs) || !slices.Equal(found.Spec.Hostnames, route.Spec.Hostnames) ||
+		!equality.Semantic.DeepEqual(found.Spec.Rules, route.Spec.Rules) {
+		found.Spec = route.Spec
+		logger.Info("Updating HTTPRoute", "HTTPRoute.Namespace", found.Namespace, "HTTPRoute.Name", found.Name)
+		if err = r.Update(context.TODO(), found); err != nil {
+			logger.Error(err, "Failed to update HTTPRoute", "HTTPRoute.Namespace", found.Namespace, "HTTPRoute.Name", found.Name)
+			return &reconcile.Result{}, err
+		}
+		r.eventUpdated(instance, "HTTPRoute", found)
+	}
+
+	return nil, nil
+}
+
+// isHTTPRouteAccepted returns whether the HTTPRoute has been accepted by at least one
+// parent Gateway and its backend references have been resolved.
+func (r *AIChatWorkspaceReconciler) isHTTPRouteAccepted(ctx context.Context, namespace, name string) (bool, error) {
+	route := &gatewayv1.HTTPRoute{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, route); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	for _, parent := range route.Status.Parents {
+		accepted := apimeta.IsStatusConditionTrue(parent.Conditions, string(gatewayv1.RouteConditionAccepted))
+		resolved := apimeta.FindStatusCondition(parent.Conditions, string(gatewayv1.RouteConditionResolvedRefs))
+		if accepted && (resolved == nil || resolved.Status == metav1.ConditionTrue) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// gatewayParentRef resolves the Gateway the workspace HTTPRoutes attach to.
+// The workspace spec takes precedence over the operator configuration.
+func gatewayParentRef(config *config.Config, aichat *appsv1alpha1.AIChatWorkspace) (gatewayv1.ParentReference, error) {
+	if aichat.Spec.Routing != nil && aichat.Spec.Routing.ParentRef != nil {
+		ref := aichat.Spec.Routing.ParentRef
+		return k8s.NewGatewayParentRef(ref.Name, ref.Namespace, ref.SectionName), nil
+	}
+
+	if config.GatewayName == "" {
+		return gatewayv1.ParentReference{}, fmt.Errorf("routing mode %s requires spec.routing.parentRef or the gatewayName config key", appsv1alpha1.RoutingModeGatewayAPI)
+	}
+
+	return k8s.NewGatewayParentRef(config.GatewayName, config.GatewayNamespace, config.GatewaySectionName), nil
+}
+
+// parentRefsEqual compares the fields the operator sets on a ParentReference,
+// ignoring the group and kind defaults filled in by the API server.
+func parentRefsEqual(a, b []gatewayv1.ParentReference) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name ||
+			ptrValue(a[i].Namespace) != ptrValue(b[i].Namespace) ||
+			ptrValue(a[i].SectionName) != ptrValue(b[i].SectionName) {
+			return false
+		}
+	}
+	return true
+}
+
+func ptrValue[T ~string](p *T) T {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
@@ -23,7 +23,6 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	kedahttpv1alpha1 "github.com/kedacore/http-add-on/operator/apis/http/v1alpha1"
@@ -56,7 +55,7 @@ func (r *AIChatWorkspaceReconciler) ensureHTTPScaledObject(ctx context.Context,
 
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a HTTPScaledObject", "HTTPScaledObject.Namespace", instance.Spec.WorkspaceName, "HTTPScaledObject.Name", httpso.Name)
-		controllerutil.SetControllerReference(instance, httpso, r.Scheme)
+		setWorkspaceLabel(instance, httpso)
 		err = r.Create(context.TODO(), httpso)
 
 		if err != nil {
@@ -64,6 +63,7 @@ func (r *AIChatWorkspaceReconciler) ensureHTTPScaledObject(ctx context.Context,
 			return &ctrl.Result{}, err
 		}
 
+		r.eventCreated(instance, "HTTPScaledObject", httpso)
 		return nil, nil
 
 	} else if err != nil {
@@ -18,18 +18,30 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
 )
 
 // ensureIngress ensures that the specified ingress resource exists in the cluster.
-// If it does not exist, it will be created. If an error occurs during this process,
+// If it does not exist, it will be created. If it exists with different rules,
+// ingress class or annotations, it will be updated. If an error occurs during this process,
 // it will be logged and returned.
 func (r *AIChatWorkspaceReconciler) ensureIngress(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, ing *networkingv1.Ingress) (*reconcile.Result, error) {
 	logger := log.FromContext(ctx)
@@ -43,6 +55,7 @@ func (r *AIChatWorkspaceReconciler) ensureIngress(ctx context.Context, instance
 
 		// Create the ingress
 		logger.Info("Creating a new Ingress", "Ingress.Namespace", instance.Spec.WorkspaceName, "Ingress.Name", ing.Name)
+		setWorkspaceLabel(instance, ing)
 		err = r.Create(context.TODO(), ing)
 
 		if err != nil {
@@ -50,6 +63,7 @@ func (r *AIChatWorkspaceReconciler) ensureIngress(ctx context.Context, instance
 			logger.Error(err, "Failed to create new Ingress", "Ingress.Namespace", instance.Spec.WorkspaceName, "Ingress.Name", ing.Name)
 			return &reconcile.Result{}, err
 		}
+		r.eventCreated(instance, "Ingress", ing)
 		// Creation was successful
 		return nil, nil
 
@@ -59,5 +73,133 @@ func (r *AIChatWorkspaceReconciler) ensureIngress(ctx context.Context, instance
 		return &reconcile.Result{}, err
 	}
 
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &reconcile.Result{}, err
+	}
+
+	if !maps.Equal(found.Annotations, ing.Annotations) || !equality.Semantic.DeepEqual(found.Spec.Rules, ing.Spec.Rules) ||
+		(ing.Spec.IngressClassName != nil && !equality.Semantic.DeepEqual(found.Spec.IngressClassName, ing.Spec.IngressClassName)) {
+		found.Annotations = ing.Annotations
+		found.Spec.Rules = ing.Spec.Rules
+		// without an ingressClassName the class set by the default IngressClass admission is kept.
+		if ing.Spec.IngressClassName != nil {
+			found.Spec.IngressClassName = ing.Spec.IngressClassName
+		}
+		logger.Info("Updating Ingress", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+		if err = r.Update(context.TODO(), found); err != nil {
+			logger.Error(err, "Failed to update Ingress", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+			return &reconcile.Result{}, err
+		}
+		r.eventUpdated(instance, "Ingress", found)
+	}
+
 	return nil, nil
 }
+
+// isIngressAdmitted returns whether the ingress controller has published an
+// address for the Ingress.
+func (r *AIChatWorkspaceReconciler) isIngressAdmitted(ctx context.Context, namespace, name string) (bool, error) {
+	ing := &networkingv1.Ingress{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, ing); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	return len(ing.Status.LoadBalancer.Ingress) > 0, nil
+}
+
+// ensureRoute exposes a workload of the workspace on hostname using the routing
+// mode selected for the workspace, either an Ingress or a Gateway API HTTPRoute.
+// Annotations are only applied to Ingresses, on top of the ingressAnnotations
+// and with the ingressClassName of the configuration. The route of the other
+// mode is deleted, so switching the routing mode doesn't leave it serving traffic.
+func (r *AIChatWorkspaceReconciler) ensureRoute(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, config *config.Config, workload, backendName, hostname string, backendPort int32, annotations map[string]string) (*reconcile.Result, error) {
+	name := getName(instance.Spec.WorkspaceName, workload)
+
+	if routingMode(config, instance) == appsv1alpha1.RoutingModeGatewayAPI {
+		parentRef, err := gatewayParentRef(config, instance)
+		if err != nil {
+			return &reconcile.Result{}, err
+		}
+		if err := r.deleteIfExists(ctx, &networkingv1.Ingress{}, instance.Spec.WorkspaceName, name); err != nil {
+			return &reconcile.Result{}, err
+		}
+		return r.ensureHTTPRoute(ctx, instance, k8s.NewHTTPRoute(instance.Spec.WorkspaceName, workload, backendName, hostname, backendPort, parentRef))
+	}
+
+	if err := r.deleteIfExists(ctx, &gatewayv1.HTTPRoute{}, instance.Spec.WorkspaceName, name); err != nil {
+		return &reconcile.Result{}, err
+	}
+	ing := k8s.NewIngress(instance.Spec.WorkspaceName, workload, backendName, hostname, backendPort)
+	if len(config.IngressAnnotations) > 0 || len(annotations) > 0 {
+		ing.Annotations = maps.Clone(config.IngressAnnotations)
+		if ing.Annotations == nil {
+			ing.Annotations = map[string]string{}
+		}
+		maps.Copy(ing.Annotations, annotations)
+	}
+	if config.IngressClassName != "" {
+		ing.Spec.IngressClassName = &config.IngressClassName
+	}
+	return r.ensureIngress(ctx, instance, ing)
+}
+
+// ensureIngressCondition reflects the admission state of the workspace routes
+// into the IngressReady condition. The status is only patched when the
+// condition changes.
+func (r *AIChatWorkspaceReconciler) ensureIngressCondition(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, config *config.Config, workloads ...string) error {
+	mode := routingMode(config, instance)
+
+	var pending []string
+	for _, workload := range workloads {
+		name := getName(instance.Spec.WorkspaceName, workload)
+
+		var admitted bool
+		var err error
+		if mode == appsv1alpha1.RoutingModeGatewayAPI {
+			admitted, err = r.isHTTPRouteAccepted(ctx, instance.Spec.WorkspaceName, name)
+		} else {
+			admitted, err = r.isIngressAdmitted(ctx, instance.Spec.WorkspaceName, name)
+		}
+		if err != nil {
+			return err
+		}
+		if !admitted {
+			pending = append(pending, name)
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeIngressReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             appsv1alpha1.IngressAdmittedReason,
+		Message:            fmt.Sprintf("%s routes admitted", mode),
+		ObservedGeneration: instance.GetGeneration(),
+	}
+	if len(pending) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = appsv1alpha1.IngressPendingReason
+		condition.Message = fmt.Sprintf("waiting for %s routes to be admitted: %s", mode, strings.Join(pending, ", "))
+	}
+
+	if !apimeta.SetStatusCondition(&instance.Status.Conditions, condition) {
+		return nil
+	}
+
+	if condition.Status == metav1.ConditionTrue {
+		r.Recorder.Event(instance, corev1.EventTypeNormal, EventReasonIngressReady, condition.Message)
+	}
+
+	return r.patchStatus(ctx, instance)
+}
+
+// routingMode returns the routing mode for the workspace, falling back to the
+// operator configuration when the workspace does not set one.
+func routingMode(config *config.Config, instance *appsv1alpha1.AIChatWorkspace) appsv1alpha1.RoutingMode {
+	if instance.Spec.Routing != nil && instance.Spec.Routing.Mode != "" {
+		return instance.Spec.Routing.Mode
+	}
+	if config.RoutingMode != "" {
+		return appsv1alpha1.RoutingMode(config.RoutingMode)
+	}
+	return appsv1alpha1.RoutingModeIngress
+}
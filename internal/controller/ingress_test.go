@@ -0,0 +1,202 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func TestEnsureRouteSwitchesRoutingMode(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+	cfg := &config.Config{
+		IngressClassName:   "nginx",
+		IngressAnnotations: map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "0"},
+		GatewayName:        "shared",
+		GatewayNamespace:   "gateways",
+	}
+	name := types.NamespacedName{Name: "team-a-openwebui", Namespace: "team-a"}
+
+	if result, err := r.ensureRoute(ctx, workspace, cfg, constants.OpenwebuiName, "team-a-openwebui", "team-a.localtest.me", constants.OpenwebuiContainerPort, nil); result != nil {
+		t.Fatalf("ensureRoute() = %v, %v", result, err)
+	}
+	ing := &networkingv1.Ingress{}
+	if err := c.Get(ctx, name, ing); err != nil {
+		t.Fatalf("Ingress: %v", err)
+	}
+	if ing.Spec.IngressClassName == nil || *ing.Spec.IngressClassName != "nginx" || ing.Annotations["nginx.ingress.kubernetes.io/proxy-body-size"] != "0" {
+		t.Errorf("Ingress = %+v, want the class and annotations of the config", ing)
+	}
+
+	// switching to the Gateway API replaces the Ingress with an HTTPRoute.
+	workspace.Spec.Routing = &appsv1alpha1.RoutingSpec{Mode: appsv1alpha1.RoutingModeGatewayAPI}
+	if result, err := r.ensureRoute(ctx, workspace, cfg, constants.OpenwebuiName, "team-a-openwebui", "team-a.localtest.me", constants.OpenwebuiContainerPort, nil); result != nil {
+		t.Fatalf("ensureRoute() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, name, &networkingv1.Ingress{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Ingress: %v, want it deleted", err)
+	}
+	route := &gatewayv1.HTTPRoute{}
+	if err := c.Get(ctx, name, route); err != nil {
+		t.Fatalf("HTTPRoute: %v", err)
+	}
+	if len(route.Spec.ParentRefs) != 1 || route.Spec.ParentRefs[0].Name != "shared" || ptrValue(route.Spec.ParentRefs[0].Namespace) != "gateways" {
+		t.Errorf("parentRefs = %+v, want the gateway of the config", route.Spec.ParentRefs)
+	}
+	if len(route.Spec.Hostnames) != 1 || route.Spec.Hostnames[0] != "team-a.localtest.me" {
+		t.Errorf("hostnames = %v, want team-a.localtest.me", route.Spec.Hostnames)
+	}
+
+	// and back, the HTTPRoute is deleted.
+	workspace.Spec.Routing = nil
+	if result, err := r.ensureRoute(ctx, workspace, cfg, constants.OpenwebuiName, "team-a-openwebui", "team-a.localtest.me", constants.OpenwebuiContainerPort, nil); result != nil {
+		t.Fatalf("ensureRoute() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, name, &gatewayv1.HTTPRoute{}); !apierrors.IsNotFound(err) {
+		t.Errorf("HTTPRoute: %v, want it deleted", err)
+	}
+	if err := c.Get(ctx, name, &networkingv1.Ingress{}); err != nil {
+		t.Errorf("Ingress: %v, want it created again", err)
+	}
+}
+
+func TestEnsureHTTPRouteUpdatesBackend(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+	parentRef := k8s.NewGatewayParentRef("shared", "gateways", "")
+	name := types.NamespacedName{Name: "team-a-ollama", Namespace: "team-a"}
+
+	if result, err := r.ensureHTTPRoute(ctx, workspace, k8s.NewHTTPRoute("team-a", constants.OllamaName, "team-a-ollama", "team-a-api.localtest.me", 11434, parentRef)); result != nil {
+		t.Fatalf("ensureHTTPRoute() = %v, %v", result, err)
+	}
+	route := &gatewayv1.HTTPRoute{}
+	if err := c.Get(ctx, name, route); err != nil {
+		t.Fatal(err)
+	}
+	resourceVersion := route.ResourceVersion
+
+	// an unchanged route isn't updated.
+	if result, err := r.ensureHTTPRoute(ctx, workspace, k8s.NewHTTPRoute("team-a", constants.OllamaName, "team-a-ollama", "team-a-api.localtest.me", 11434, parentRef)); result != nil {
+		t.Fatalf("ensureHTTPRoute() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, name, route); err != nil || route.ResourceVersion != resourceVersion {
+		t.Errorf("resourceVersion = %s, %v, want %s unchanged", route.ResourceVersion, err, resourceVersion)
+	}
+
+	// moving the API behind the API gateway points the route at it.
+	if result, err := r.ensureHTTPRoute(ctx, workspace, k8s.NewHTTPRoute("team-a", constants.OllamaName, "team-a-apigateway", "team-a-api.localtest.me", 8080, parentRef)); result != nil {
+		t.Fatalf("ensureHTTPRoute() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, name, route); err != nil {
+		t.Fatal(err)
+	}
+	backend := route.Spec.Rules[0].BackendRefs[0]
+	if backend.Name != "team-a-apigateway" || backend.Port == nil || *backend.Port != 8080 {
+		t.Errorf("backendRef = %+v, want team-a-apigateway:8080", backend.BackendObjectReference)
+	}
+}
+
+func TestGatewayParentRef(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	if _, err := gatewayParentRef(&config.Config{}, workspace); err == nil {
+		t.Error("gatewayParentRef() without a gateway succeeded, want an error")
+	}
+
+	ref, err := gatewayParentRef(&config.Config{GatewayName: "shared", GatewaySectionName: "https"}, workspace)
+	if err != nil || ref.Name != "shared" || ref.Namespace != nil || ptrValue(ref.SectionName) != "https" {
+		t.Errorf("gatewayParentRef() = %+v, %v, want the gateway of the config", ref, err)
+	}
+
+	workspace.Spec.Routing = &appsv1alpha1.RoutingSpec{ParentRef: &appsv1alpha1.GatewayParentRef{Name: "team", Namespace: "team-a"}}
+	ref, err = gatewayParentRef(&config.Config{GatewayName: "shared"}, workspace)
+	if err != nil || ref.Name != "team" || ptrValue(ref.Namespace) != "team-a" || ref.SectionName != nil {
+		t.Errorf("gatewayParentRef() = %+v, %v, want spec.routing.parentRef", ref, err)
+	}
+}
+
+func TestEnsureIngressCondition(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	admitted := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-openwebui", Namespace: "team-a"},
+		Status: networkingv1.IngressStatus{LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+			Ingress: []networkingv1.IngressLoadBalancerIngress{{IP: "10.0.0.1"}},
+		}},
+	}
+	pending := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "team-a-ollama", Namespace: "team-a"}}
+	accepted := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-openwebui", Namespace: "team-a"},
+		Status: gatewayv1.HTTPRouteStatus{RouteStatus: gatewayv1.RouteStatus{Parents: []gatewayv1.RouteParentStatus{{
+			ParentRef:      gatewayv1.ParentReference{Name: "shared"},
+			ControllerName: "example.com/gateway",
+			Conditions: []metav1.Condition{{
+				Type:               string(gatewayv1.RouteConditionAccepted),
+				Status:             metav1.ConditionTrue,
+				Reason:             string(gatewayv1.RouteReasonAccepted),
+				LastTransitionTime: metav1.Now(),
+			}},
+		}}}},
+	}
+	c := newFakeClient(t, workspace, admitted, pending, accepted)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+	cfg := &config.Config{}
+
+	if err := r.ensureIngressCondition(ctx, workspace, cfg, constants.OpenwebuiName, constants.OllamaName); err != nil {
+		t.Fatal(err)
+	}
+	condition := apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypeIngressReady)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != appsv1alpha1.IngressPendingReason {
+		t.Fatalf("condition = %+v, want IngressPending", condition)
+	}
+
+	if err := r.ensureIngressCondition(ctx, workspace, cfg, constants.OpenwebuiName); err != nil {
+		t.Fatal(err)
+	}
+	condition = apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypeIngressReady)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != appsv1alpha1.IngressAdmittedReason {
+		t.Fatalf("condition = %+v, want IngressAdmitted", condition)
+	}
+
+	// with the Gateway API the HTTPRoutes are checked instead.
+	cfg.RoutingMode = string(appsv1alpha1.RoutingModeGatewayAPI)
+	if err := r.ensureIngressCondition(ctx, workspace, cfg, constants.OpenwebuiName, constants.OllamaName); err != nil {
+		t.Fatal(err)
+	}
+	condition = apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypeIngressReady)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Message != "waiting for GatewayAPI routes to be admitted: team-a-ollama" {
+		t.Fatalf("condition = %+v, want team-a-ollama pending", condition)
+	}
+}
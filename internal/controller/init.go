@@ -28,6 +28,7 @@ type InitAIChatWorkspaceStep struct {
 }
 
 func (step *InitAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance) (ctrl.Result, error) {
+	instance.startStep("Init")
 	instance.logger.Info("starting InitStep")
 	aichatWorkspaceConfig := &appsv1alpha1.AIChatWorkspace{}
 	err := instance.r.Get(instance.ctx, instance.req.NamespacedName, aichatWorkspaceConfig)
@@ -41,7 +42,7 @@ func (step *InitAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance)
 	instance.logger.Info("ending InitStep")
 
 	if step.next == nil {
-		return instance.r.finishReconcile(nil, false)
+		return instance.r.finishReconcile(nil, nil)
 	}
 
 	return step.next.execute(instance)
@@ -0,0 +1,317 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/openwebui"
+)
+
+// MemberSyncRetryInterval is how often the members are synced again while one of them failed.
+// Open WebUI isn't watched, so nothing else reconciles the workspace once it recovers.
+const MemberSyncRetryInterval = time.Minute
+
+/**
+ * Ensures the Open WebUI accounts and groups match spec.members.
+ *
+ * The members are managed with the admin of spec.bootstrap once Open WebUI is bootstrapped. A
+ * missing account is created with a random password, the members sign in with OIDC or have
+ * their password reset by an admin. The role of an existing account is set to the role of the
+ * member, and the groups of spec.members list exactly the members in them, next to the accounts
+ * the operator doesn't manage. The account of a member removed from spec.members is moved back
+ * to the pending role, which can't use Open WebUI.
+ *
+ * The sync state of every member is reported in status.members. A failure to reach Open WebUI
+ * is reported there rather than failing or stopping the reconcile, the next steps still run and
+ * the members are synced again after MemberSyncRetryInterval while one of them is Failed (see
+ * scheduledRequeue).
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose members are synced.
+ * @param baseURL The URL of the Open WebUI Service.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureMembers(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, baseURL string) (*ctrl.Result, error) {
+	if len(instance.Spec.Members) == 0 && len(instance.Status.Members) == 0 {
+		return nil, nil
+	}
+
+	statuses, err := r.syncMembers(ctx, instance, baseURL)
+	if err != nil {
+		log.FromContext(ctx).Info("Unable to sync the Open WebUI members", "error", err.Error())
+		statuses = failedMembers(instance, err)
+	}
+
+	if !equality.Semantic.DeepEqual(instance.Status.Members, statuses) {
+		instance.Status.Members = statuses
+		if err := r.patchStatus(ctx, instance); err != nil {
+			return &ctrl.Result{}, fmt.Errorf("unable to patch status.members: %w", err)
+		}
+	}
+	return nil, nil
+}
+
+// membersFailed reports whether a member of status.members failed to sync.
+func membersFailed(instance *appsv1alpha1.AIChatWorkspace) bool {
+	for _, status := range instance.Status.Members {
+		if status.State == appsv1alpha1.MemberStateFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// syncMembers creates and updates the accounts and groups of spec.members, and deactivates the
+// removed members. The error is returned when Open WebUI can't be used at all.
+func (r *AIChatWorkspaceReconciler) syncMembers(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, baseURL string) ([]appsv1alpha1.MemberStatus, error) {
+	// without an admin the accounts can't be managed anymore, they are left as they are.
+	if instance.Spec.Bootstrap == nil {
+		return nil, nil
+	}
+	bootstrapped := apimeta.FindStatusCondition(instance.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped)
+	if bootstrapped == nil || bootstrapped.Reason != appsv1alpha1.BootstrappedReason || bootstrapped.ObservedGeneration != instance.GetGeneration() {
+		return pendingMembers(instance), nil
+	}
+
+	_, adminEmail, password, err := r.adminCredentials(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	session, err := openwebui.SignIn(baseURL, adminEmail, password)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign the admin in: %w", err)
+	}
+	users, err := openwebui.ListUsers(baseURL, session.Token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the accounts: %w", err)
+	}
+	accounts := map[string]openwebui.User{}
+	for _, user := range users {
+		accounts[strings.ToLower(user.Email)] = user
+	}
+
+	members := map[string]bool{}
+	statuses := make([]appsv1alpha1.MemberStatus, 0, len(instance.Spec.Members)+len(instance.Status.Members))
+	for _, member := range instance.Spec.Members {
+		members[strings.ToLower(member.Email)] = true
+		statuses = append(statuses, syncMember(baseURL, session.Token, adminEmail, member, accounts))
+	}
+
+	// the removed members are kept in the status once deactivated, their accounts still exist.
+	for _, previous := range instance.Status.Members {
+		if members[strings.ToLower(previous.Email)] {
+			continue
+		}
+		status := deactivateMember(baseURL, session.Token, adminEmail, previous, accounts)
+		if status != nil {
+			statuses = append(statuses, *status)
+		}
+	}
+
+	if err := syncGroups(baseURL, session.Token, instance.Spec.Members, statuses); err != nil {
+		for i := range statuses {
+			if statuses[i].State == appsv1alpha1.MemberStateSynced && memberGroup(instance.Spec.Members, statuses[i].Email) != "" {
+				statuses[i].State = appsv1alpha1.MemberStateFailed
+				statuses[i].Message = err.Error()
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// syncMember creates the account of a member, or updates its role.
+func syncMember(baseURL, token, adminEmail string, member appsv1alpha1.MemberSpec, accounts map[string]openwebui.User) appsv1alpha1.MemberStatus {
+	role := string(member.Role)
+	if role == "" {
+		role = string(appsv1alpha1.MemberRoleUser)
+	}
+	status := appsv1alpha1.MemberStatus{Email: member.Email, State: appsv1alpha1.MemberStateFailed}
+	if strings.EqualFold(member.Email, adminEmail) && role != string(appsv1alpha1.MemberRoleAdmin) {
+		status.Message = "the admin of spec.bootstrap must keep the admin role"
+		return status
+	}
+
+	account, ok := accounts[strings.ToLower(member.Email)]
+	if !ok {
+		name := member.Name
+		if name == "" {
+			name = member.Email
+		}
+		password, err := generateSecretKey()
+		if err != nil {
+			status.Message = err.Error()
+			return status
+		}
+		account, err = openwebui.AddUser(baseURL, token, name, member.Email, password, role)
+		if err != nil {
+			status.Message = fmt.Sprintf("unable to create the account: %v", err)
+			return status
+		}
+		accounts[strings.ToLower(member.Email)] = account
+	} else if account.Role != role {
+		if err := openwebui.UpdateUserRole(baseURL, token, account.ID, role); err != nil {
+			status.UserID = account.ID
+			status.Message = fmt.Sprintf("unable to set the %s role: %v", role, err)
+			return status
+		}
+	}
+
+	status.State = appsv1alpha1.MemberStateSynced
+	status.UserID = account.ID
+	return status
+}
+
+// deactivateMember moves the account of a removed member to the pending role. It returns nil
+// when the account no longer exists.
+func deactivateMember(baseURL, token, adminEmail string, previous appsv1alpha1.MemberStatus, accounts map[string]openwebui.User) *appsv1alpha1.MemberStatus {
+	account, ok := accounts[strings.ToLower(previous.Email)]
+	if !ok {
+		return nil
+	}
+	status := appsv1alpha1.MemberStatus{Email: previous.Email, State: appsv1alpha1.MemberStateDeactivated, UserID: account.ID}
+	if strings.EqualFold(previous.Email, adminEmail) || account.Role == string(appsv1alpha1.UserRolePending) {
+		return &status
+	}
+	if err := openwebui.UpdateUserRole(baseURL, token, account.ID, string(appsv1alpha1.UserRolePending)); err != nil {
+		status.State = appsv1alpha1.MemberStateFailed
+		status.Message = fmt.Sprintf("unable to deactivate the account: %v", err)
+	}
+	return &status
+}
+
+// syncGroups creates the groups of spec.members and sets their members. The accounts the operator
+// doesn't manage are left in their groups.
+func syncGroups(baseURL, token string, members []appsv1alpha1.MemberSpec, statuses []appsv1alpha1.MemberStatus) error {
+	managed := map[string]bool{}
+	userIDs := map[string]string{}
+	for _, status := range statuses {
+		if status.UserID != "" {
+			managed[status.UserID] = true
+			userIDs[strings.ToLower(status.Email)] = status.UserID
+		}
+	}
+	desired := map[string][]string{}
+	for _, member := range members {
+		if member.Group == "" {
+			continue
+		}
+		if _, ok := desired[member.Group]; !ok {
+			desired[member.Group] = []string{}
+		}
+		if id := userIDs[strings.ToLower(member.Email)]; id != "" {
+			desired[member.Group] = append(desired[member.Group], id)
+		}
+	}
+	if len(desired) == 0 && len(managed) == 0 {
+		return nil
+	}
+
+	groups, err := openwebui.ListGroups(baseURL, token)
+	if err != nil {
+		return fmt.Errorf("unable to list the groups: %w", err)
+	}
+	for _, group := range groups {
+		delete(desired, group.Name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(desired)) {
+		group, err := openwebui.CreateGroup(baseURL, token, name, "Managed by the aichat-workspace-operator")
+		if err != nil {
+			return fmt.Errorf("unable to create the %s group: %w", name, err)
+		}
+		groups = append(groups, group)
+	}
+
+	for _, group := range groups {
+		want := []string{}
+		for _, id := range group.UserIDs {
+			if !managed[id] {
+				want = append(want, id)
+			}
+		}
+		for _, member := range members {
+			if id := userIDs[strings.ToLower(member.Email)]; member.Group == group.Name && id != "" {
+				want = append(want, id)
+			}
+		}
+		if slices.Equal(slices.Sorted(slices.Values(want)), slices.Sorted(slices.Values(group.UserIDs))) {
+			continue
+		}
+		group.UserIDs = want
+		if err := openwebui.UpdateGroup(baseURL, token, group); err != nil {
+			return fmt.Errorf("unable to update the %s group: %w", group.Name, err)
+		}
+	}
+	return nil
+}
+
+// memberGroup returns the group of a member of spec.members.
+func memberGroup(members []appsv1alpha1.MemberSpec, email string) string {
+	for _, member := range members {
+		if strings.EqualFold(member.Email, email) {
+			return member.Group
+		}
+	}
+	return ""
+}
+
+// pendingMembers reports the members of spec.members as waiting for the Open WebUI bootstrap.
+func pendingMembers(instance *appsv1alpha1.AIChatWorkspace) []appsv1alpha1.MemberStatus {
+	return unsyncedMembers(instance, appsv1alpha1.MemberStatePending, "waiting for the Open WebUI bootstrap")
+}
+
+// failedMembers reports the members of spec.members as failed with err.
+func failedMembers(instance *appsv1alpha1.AIChatWorkspace, err error) []appsv1alpha1.MemberStatus {
+	return unsyncedMembers(instance, appsv1alpha1.MemberStateFailed, err.Error())
+}
+
+// unsyncedMembers reports the members of spec.members in state, keeping their account id, and
+// the removed members as they were.
+func unsyncedMembers(instance *appsv1alpha1.AIChatWorkspace, state appsv1alpha1.MemberState, message string) []appsv1alpha1.MemberStatus {
+	previous := map[string]appsv1alpha1.MemberStatus{}
+	for _, status := range instance.Status.Members {
+		previous[strings.ToLower(status.Email)] = status
+	}
+
+	statuses := make([]appsv1alpha1.MemberStatus, 0, len(instance.Spec.Members)+len(instance.Status.Members))
+	for _, member := range instance.Spec.Members {
+		statuses = append(statuses, appsv1alpha1.MemberStatus{
+			Email:   member.Email,
+			State:   state,
+			UserID:  previous[strings.ToLower(member.Email)].UserID,
+			Message: message,
+		})
+		delete(previous, strings.ToLower(member.Email))
+	}
+	for _, status := range instance.Status.Members {
+		if _, removed := previous[strings.ToLower(status.Email)]; removed {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
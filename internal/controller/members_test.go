@@ -0,0 +1,213 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/openwebui"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+)
+
+func TestEnsureMembers(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+	webui.passwords["admin@example.com"] = "s3cret"
+	webui.roles["admin@example.com"] = "admin"
+	webui.passwords["bob@example.com"] = "bob"
+	webui.roles["bob@example.com"] = "pending"
+	webui.groups = []openwebui.Group{{ID: "group-1", Name: "research", UserIDs: []string{"someone@example.com"}}}
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin"}
+	workspace.Spec.Members = []appsv1alpha1.MemberSpec{
+		{Email: "alice@example.com", Role: appsv1alpha1.MemberRoleAdmin, Group: "research"},
+		{Email: "Bob@example.com", Role: appsv1alpha1.MemberRoleUser, Group: "research"},
+		{Email: "carol@example.com", Name: "Carol", Group: "support"},
+	}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	c := newFakeClient(t, workspace, admin)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	// the members wait for the bootstrap.
+	if result, err := r.ensureMembers(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureMembers() = %v, %v", result, err)
+	}
+	assertMemberStates(t, workspace, map[string]appsv1alpha1.MemberState{
+		"alice@example.com": appsv1alpha1.MemberStatePending,
+		"Bob@example.com":   appsv1alpha1.MemberStatePending,
+		"carol@example.com": appsv1alpha1.MemberStatePending,
+	})
+
+	apimeta.SetStatusCondition(&workspace.Status.Conditions, metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeOpenWebUIBootstrapped,
+		Status:             metav1.ConditionTrue,
+		Reason:             appsv1alpha1.BootstrappedReason,
+		ObservedGeneration: 1,
+	})
+	if result, err := r.ensureMembers(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureMembers() = %v, %v", result, err)
+	}
+	assertMemberStates(t, workspace, map[string]appsv1alpha1.MemberState{
+		"alice@example.com": appsv1alpha1.MemberStateSynced,
+		"Bob@example.com":   appsv1alpha1.MemberStateSynced,
+		"carol@example.com": appsv1alpha1.MemberStateSynced,
+	})
+	if webui.roles["alice@example.com"] != "admin" || webui.roles["bob@example.com"] != "user" || webui.roles["carol@example.com"] != "user" {
+		t.Errorf("roles = %v, want alice admin, bob and carol users", webui.roles)
+	}
+	assertGroup(t, webui, "research", "alice@example.com", "bob@example.com", "someone@example.com")
+	assertGroup(t, webui, "support", "carol@example.com")
+
+	// removing bob deactivates his account and removes him from his group.
+	workspace.Spec.Members = slices.Delete(workspace.Spec.Members, 1, 2)
+	if err := c.Update(ctx, workspace); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureMembers(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureMembers() = %v, %v", result, err)
+	}
+	assertMemberStates(t, workspace, map[string]appsv1alpha1.MemberState{
+		"alice@example.com": appsv1alpha1.MemberStateSynced,
+		"Bob@example.com":   appsv1alpha1.MemberStateDeactivated,
+		"carol@example.com": appsv1alpha1.MemberStateSynced,
+	})
+	if webui.roles["bob@example.com"] != "pending" {
+		t.Errorf("role of bob = %s, want pending", webui.roles["bob@example.com"])
+	}
+	assertGroup(t, webui, "research", "alice@example.com", "someone@example.com")
+
+	// the admin of spec.bootstrap can't be demoted by spec.members.
+	workspace.Spec.Members = append(workspace.Spec.Members, appsv1alpha1.MemberSpec{Email: "admin@example.com", Role: appsv1alpha1.MemberRoleUser})
+	if err := c.Update(ctx, workspace); err != nil {
+		t.Fatal(err)
+	}
+	// a failed member is synced again after a delay, Open WebUI isn't watched.
+	if result, err := r.ensureMembers(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureMembers() = %v, %v", result, err)
+	}
+	if requeue := scheduledRequeue(workspace); requeue != MemberSyncRetryInterval {
+		t.Errorf("scheduledRequeue() = %s, want %s", requeue, MemberSyncRetryInterval)
+	}
+	assertMemberStates(t, workspace, map[string]appsv1alpha1.MemberState{
+		"alice@example.com": appsv1alpha1.MemberStateSynced,
+		"carol@example.com": appsv1alpha1.MemberStateSynced,
+		"admin@example.com": appsv1alpha1.MemberStateFailed,
+		"Bob@example.com":   appsv1alpha1.MemberStateDeactivated,
+	})
+	if webui.roles["admin@example.com"] != "admin" {
+		t.Errorf("role of the admin = %s, want admin", webui.roles["admin@example.com"])
+	}
+
+	// an unreachable Open WebUI fails every member and retries later rather than failing the reconcile.
+	webui.Close()
+	if result, err := r.ensureMembers(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensureMembers() = %v, %v", result, err)
+	}
+	if requeue := scheduledRequeue(workspace); requeue != MemberSyncRetryInterval {
+		t.Errorf("scheduledRequeue() = %s, want %s", requeue, MemberSyncRetryInterval)
+	}
+	assertMemberStates(t, workspace, map[string]appsv1alpha1.MemberState{
+		"alice@example.com": appsv1alpha1.MemberStateFailed,
+		"carol@example.com": appsv1alpha1.MemberStateFailed,
+		"admin@example.com": appsv1alpha1.MemberStateFailed,
+		"Bob@example.com":   appsv1alpha1.MemberStateDeactivated,
+	})
+}
+
+func assertMemberStates(t *testing.T, workspace *appsv1alpha1.AIChatWorkspace, want map[string]appsv1alpha1.MemberState) {
+	t.Helper()
+	got := map[string]appsv1alpha1.MemberState{}
+	for _, status := range workspace.Status.Members {
+		got[status.Email] = status.State
+	}
+	if len(got) != len(want) {
+		t.Errorf("status.members = %+v, want %v", workspace.Status.Members, want)
+	}
+	for email, state := range want {
+		if got[email] != state {
+			t.Errorf("state of %s = %q, want %q (status.members = %+v)", email, got[email], state, workspace.Status.Members)
+		}
+	}
+}
+
+func assertGroup(t *testing.T, webui *fakeOpenWebUI, name string, userIDs ...string) {
+	t.Helper()
+	for _, group := range webui.groups {
+		if group.Name == name {
+			if got := slices.Sorted(slices.Values(group.UserIDs)); !slices.Equal(got, userIDs) {
+				t.Errorf("members of %s = %v, want %v", name, got, userIDs)
+			}
+			return
+		}
+	}
+	t.Errorf("group %s not found in %+v", name, webui.groups)
+}
+
+func TestEnsureWorkspaceAccessWithFailedMembers(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+	webui.passwords["admin@example.com"] = "s3cret"
+	webui.roles["admin@example.com"] = "admin"
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin"}
+	// the admin of spec.bootstrap can't be demoted, the member fails.
+	workspace.Spec.Members = []appsv1alpha1.MemberSpec{{Email: "admin@example.com", Role: appsv1alpha1.MemberRoleUser}}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "team-a-openwebui", Namespace: "team-a"}}
+	c := newFakeClient(t, workspace, admin, deployment)
+	deployment.Status.ReadyReplicas = 1
+	if err := c.Status().Update(context.Background(), deployment); err != nil {
+		t.Fatal(err)
+	}
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	if result, err := r.ensureWorkspaceAccess(ctx, workspace, inference.Ollama{}, testConfig(t), webui.URL); result != nil {
+		t.Fatalf("ensureWorkspaceAccess() = %v, %v", result, err)
+	}
+	assertMemberStates(t, workspace, map[string]appsv1alpha1.MemberState{"admin@example.com": appsv1alpha1.MemberStateFailed})
+	// the steps after the members still run.
+	if err := c.Get(ctx, types.NamespacedName{Name: "team-a-openwebui", Namespace: "team-a"}, &networkingv1.Ingress{}); err != nil {
+		t.Errorf("the Open WebUI Ingress should be reconciled while a member is Failed: %v", err)
+	}
+	if apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypeIngressReady) == nil {
+		t.Error("the IngressReady condition should be reported while a member is Failed")
+	}
+	if requeue := scheduledRequeue(workspace); requeue != MemberSyncRetryInterval {
+		t.Errorf("scheduledRequeue() = %s, want %s", requeue, MemberSyncRetryInterval)
+	}
+}
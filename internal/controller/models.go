@@ -0,0 +1,412 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ollama"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/metrics"
+)
+
+const (
+	// DefaultModelCheckInterval is how often the registry is asked for the digest of the model
+	// tags when spec.modelUpdatePolicy.checkInterval is not set.
+	DefaultModelCheckInterval = 24 * time.Hour
+
+	// MinModelCheckInterval is the shortest interval between two checks of a model tag.
+	MinModelCheckInterval = 10 * time.Minute
+)
+
+/**
+ * Ensures the models of spec.models are installed and reports their digest in status.models.
+ *
+ * Missing models are installed from their source, see installModel. Pinned models are verified
+ * against their digest after the pull; a mismatch is reported, not pulled again, as the tag no
+ * longer points to the pinned manifest. With the OnTagChange update policy, the registry is asked
+ * for the digest of the unpinned model tags every check interval, and the models whose tag moved
+ * are pulled again. Aliases are created from the installed models, and models marked for
+ * preloading are loaded when they aren't running.
+ *
+ * The backends loading their models at startup are only listed, their models are reported
+ * Missing until the server serves them.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose models are installed.
+ * @param backend The inference backend serving the models.
+ * @param cfg The configuration of the workspace.
+ * @param ollamaServerURI The base URL of the inference API of the workspace.
+ * @return An error if the models could not be listed, installed or reported.
+ */
+func (r *AIChatWorkspaceReconciler) ensureModels(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, backend inference.Backend, cfg *config.Config, ollamaServerURI string) error {
+	logger := log.FromContext(ctx)
+
+	installed, err := backend.ListModels(ollamaServerURI)
+	if err != nil {
+		return err
+	}
+
+	previous := map[string]appsv1alpha1.ModelStatus{}
+	for _, model := range instance.Status.Models {
+		previous[model.Name] = model
+	}
+	checkInterval, checkUpdates := modelUpdateCheckInterval(instance)
+
+	var errs error
+	var running []string
+	statuses := make([]appsv1alpha1.ModelStatus, 0, len(instance.Spec.Models))
+	for _, model := range instance.Spec.Models {
+		name := model.Name
+		status := appsv1alpha1.ModelStatus{Name: name, PinnedDigest: model.Digest, LastUpdateCheck: previous[name].LastUpdateCheck}
+		source, fromRegistry := inference.RegistryName(model, cfg)
+
+		digest, ok := installed[ollama.FullName(name)]
+		pull := !ok
+		if ok && fromRegistry && backend.InstallsModels() && model.Digest == "" && checkUpdates && updateCheckDue(status.LastUpdateCheck, checkInterval) {
+			now := metav1.Now()
+			status.LastUpdateCheck = &now
+			remote, err := ollama.ManifestDigest(source, cfg.InsecureRegistry)
+			if err != nil {
+				logger.Error(err, "Failed to check the model tag for updates", "ModelName", name)
+				r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonModelUpdateCheckFailed, "Failed to check model %s for updates: %v", name, err)
+			} else if remote != digest {
+				r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonModelUpdateAvailable, "Tag %s moved from %s to %s, pulling it again", source, digest, remote)
+				pull = true
+			}
+		}
+
+		pulled, importing := false, false
+		if pull {
+			state, err := r.installModel(ctx, instance, backend, model, cfg, ollamaServerURI)
+			switch {
+			case err != nil:
+				errs = errors.Join(errs, fmt.Errorf("unable to install model %s: %w", name, err))
+			case state == appsv1alpha1.ModelStateImporting:
+				importing = true
+			case state == appsv1alpha1.ModelStateInstalled:
+				pulled = true
+				if installed, err = backend.ListModels(ollamaServerURI); err != nil {
+					return err
+				}
+			}
+			digest, ok = installed[ollama.FullName(name)]
+		}
+
+		// the model was imported by a Job the previous reconcile left running.
+		if ok && !pull && model.Source != nil && (model.Source.PVC != nil || model.Source.URL != nil) {
+			deleted, err := r.deleteModelImportJob(ctx, instance, model)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("unable to delete the import Job of model %s: %w", name, err))
+			}
+			pulled = deleted
+		}
+
+		status.Digest = digest
+		switch {
+		case !ok && importing:
+			status.State = appsv1alpha1.ModelStateImporting
+		case !ok:
+			status.State = appsv1alpha1.ModelStateMissing
+		case model.Digest != "" && digest != model.Digest:
+			status.State = appsv1alpha1.ModelStateDigestMismatch
+			if previous[name].State != appsv1alpha1.ModelStateDigestMismatch || previous[name].Digest != digest {
+				r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonModelDigestMismatch,
+					"Model %s has digest %s, it is pinned to %s", name, digest, model.Digest)
+			}
+		default:
+			status.State = appsv1alpha1.ModelStateInstalled
+		}
+
+		if ok && model.Alias != "" {
+			status.AliasHash = aliasHash(digest, model.Parameters)
+			if _, aliased := installed[ollama.FullName(model.Alias)]; !aliased || previous[name].AliasHash != status.AliasHash {
+				if err := ollama.CreateAlias(model.Alias, name, model.Parameters, ollamaServerURI); err != nil {
+					logger.Error(err, "Failed to create model alias", "ModelName", name, "Alias", model.Alias)
+					errs = errors.Join(errs, fmt.Errorf("unable to create alias %s of model %s: %w", model.Alias, name, err))
+					status.AliasHash = ""
+				} else {
+					pulled = true
+				}
+			}
+		}
+
+		if pulled {
+			r.createPersonas(ctx, instance, model.ServedName(), ollamaServerURI)
+		}
+
+		if ok && model.Preload {
+			if running == nil {
+				if running, err = ollama.ListRunningModels(ollamaServerURI); err != nil {
+					return err
+				}
+			}
+			if !slices.Contains(running, ollama.FullName(model.ServedName())) {
+				var keepAlive *time.Duration
+				if model.KeepAlive != nil {
+					keepAlive = &model.KeepAlive.Duration
+				}
+				if err := ollama.LoadModel(model.ServedName(), keepAlive, ollamaServerURI); err != nil {
+					logger.Error(err, "Failed to preload model", "ModelName", model.ServedName())
+					errs = errors.Join(errs, fmt.Errorf("unable to preload model %s: %w", model.ServedName(), err))
+				}
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	if !equality.Semantic.DeepEqual(instance.Status.Models, statuses) {
+		instance.Status.Models = statuses
+		if err := r.patchStatus(ctx, instance); err != nil {
+			return errors.Join(errs, fmt.Errorf("unable to patch status.models: %w", err))
+		}
+	}
+	return errs
+}
+
+/**
+ * Installs a model from its source.
+ *
+ * Models without a source are pulled from the Ollama library, Hugging Face models through the
+ * hf.co registry. Models from a URL or a PersistentVolumeClaim are imported by a Job of the
+ * workspace namespace, so multi-GB downloads don't run in the reconcile and claims the operator
+ * can't mount are readable. The import Job is left to the next reconciles, triggered by its
+ * status changes.
+ * Backends loading their models at startup install nothing, the model stays Missing until the
+ * server has loaded it.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace the model is installed for.
+ * @param backend The inference backend serving the model.
+ * @param model The model of spec.models.
+ * @param cfg The configuration of the workspace.
+ * @param ollamaServerURI The base URL of the inference API of the workspace.
+ * @return Installed, Importing while the import Job runs or Missing when it failed, and an error if the install failed.
+ */
+func (r *AIChatWorkspaceReconciler) installModel(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, backend inference.Backend, model appsv1alpha1.ModelSpec, cfg *config.Config, ollamaServerURI string) (appsv1alpha1.ModelState, error) {
+	logger := log.FromContext(ctx)
+
+	if !backend.InstallsModels() {
+		return appsv1alpha1.ModelStateMissing, nil
+	}
+	if model.Source != nil && (model.Source.PVC != nil || model.Source.URL != nil) {
+		return r.ensureModelImportJob(ctx, instance, model, cfg, ollamaServerURI)
+	}
+
+	source, _ := inference.RegistryName(model, cfg)
+
+	logger.Info("Installing model", "ModelName", model.Name, "Source", source)
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonModelPullStarted, "Pulling model %s from %s", model.Name, source)
+	pullStarted := time.Now()
+	pulledBytes, err := backend.InstallModel(model, cfg, ollamaServerURI)
+	metrics.ObserveModelPull(instance.Spec.WorkspaceName, model.Name, time.Since(pullStarted), pulledBytes, err)
+	if err != nil {
+		logger.Error(err, "Failed to pull Model", "ModelName", model.Name, "Namespace", instance.Spec.WorkspaceName)
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonModelPullFailed, "Failed to pull model %s from %s: %v", model.Name, source, err)
+		return appsv1alpha1.ModelStateMissing, err
+	}
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonModelPulled, "Pulled model %s in %s", model.Name, time.Since(pullStarted).Round(time.Second))
+	return appsv1alpha1.ModelStateInstalled, nil
+}
+
+/**
+ * Ensures the Job importing a model from a URL or a PersistentVolumeClaim runs.
+ *
+ * The Job is created when the model is missing, and deleted once it succeeded. A failed Job is
+ * reported and left in place until its TTL expires, the deletion retries the import.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace the model is imported for.
+ * @param model The model of spec.models, with a URL or a PVC source.
+ * @param cfg The configuration of the workspace.
+ * @param ollamaServerURI The base URL of the Ollama API of the workspace.
+ * @return The state of the model, and an error if the Job could not be read, created or deleted.
+ */
+func (r *AIChatWorkspaceReconciler) ensureModelImportJob(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, model appsv1alpha1.ModelSpec, cfg *config.Config, ollamaServerURI string) (appsv1alpha1.ModelState, error) {
+	logger := log.FromContext(ctx)
+	name := modelImportJobName(instance, model)
+
+	found := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: instance.Spec.WorkspaceName}, found)
+	if apierrors.IsNotFound(err) {
+		labels := defaultLabels(instance.Spec.WorkspaceName, name, constants.ModelImportLabelName)
+		job := newModelImportJob(instance, name, model, cfg, ollamaServerURI, labels)
+		setWorkspaceLabel(instance, job)
+		logger.Info("Creating a model import Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create model import Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return appsv1alpha1.ModelStateMissing, err
+		}
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonModelPullStarted, "Importing model %s from %s", model.Name, modelImportSource(model))
+		return appsv1alpha1.ModelStateImporting, nil
+	} else if err != nil {
+		return appsv1alpha1.ModelStateMissing, err
+	}
+
+	for _, condition := range found.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			if _, err := r.deleteModelImportJob(ctx, instance, model); err != nil {
+				return appsv1alpha1.ModelStateMissing, err
+			}
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonModelPulled, "Imported model %s from %s", model.Name, modelImportSource(model))
+			return appsv1alpha1.ModelStateInstalled, nil
+		case batchv1.JobFailed:
+			r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonModelPullFailed, "Job %s failed to import model %s: %s", name, model.Name, condition.Message)
+			return appsv1alpha1.ModelStateMissing, nil
+		}
+	}
+	return appsv1alpha1.ModelStateImporting, nil
+}
+
+/**
+ * Deletes the Job importing a model, if it exists.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace the model was imported for.
+ * @param model The model of spec.models, with a URL or a PVC source.
+ * @return True if a Job was deleted, and an error if the Job could not be deleted.
+ */
+func (r *AIChatWorkspaceReconciler) deleteModelImportJob(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, model appsv1alpha1.ModelSpec) (bool, error) {
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: modelImportJobName(instance, model), Namespace: instance.Spec.WorkspaceName}, job)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
+
+// newModelImportJob returns the Job importing a model from its URL or PVC source. The URL is
+// reached through the proxy and with the CA bundle of the workspace configuration.
+func newModelImportJob(instance *appsv1alpha1.AIChatWorkspace, name string, model appsv1alpha1.ModelSpec, cfg *config.Config, ollamaServerURI string, labels map[string]string) *batchv1.Job {
+	if source := model.Source.PVC; source != nil {
+		return k8s.NewModelImportJob(instance.Spec.WorkspaceName, name, source.ClaimName, source.Path, model.Name, ollamaServerURI, cfg.ImporterImage(), labels)
+	}
+
+	source := model.Source.URL
+	job := k8s.NewModelURLImportJob(instance.Spec.WorkspaceName, name, source.URL, source.SHA256, model.Name, ollamaServerURI, cfg.ImporterImage(), labels)
+	if cfg.HTTPSProxy != "" || cfg.NoProxy != "" || cfg.CABundle != "" {
+		caBundleConfigMap := ""
+		if cfg.CABundle != "" {
+			caBundleConfigMap = caBundleName(instance)
+		}
+		k8s.AddModelImportEgressConfig(job, cfg.HTTPSProxy, cfg.NoProxy, caBundleConfigMap, caBundleHash(cfg.CABundle))
+	}
+	return job
+}
+
+// modelImportSource describes the URL or the file of the claim a model is imported from.
+func modelImportSource(model appsv1alpha1.ModelSpec) string {
+	if source := model.Source.PVC; source != nil {
+		return source.ClaimName + "/" + source.Path
+	}
+	return model.Source.URL.URL
+}
+
+// modelImportJobName names the import Job after the model and its file, so a new Job is created
+// when either changes.
+func modelImportJobName(instance *appsv1alpha1.AIChatWorkspace, model appsv1alpha1.ModelSpec) string {
+	hasher := fnv.New32a()
+	if source := model.Source.PVC; source != nil {
+		hasher.Write([]byte(model.Name + "\x00" + source.ClaimName + "\x00" + source.Path))
+	} else {
+		hasher.Write([]byte(model.Name + "\x00" + model.Source.URL.URL + "\x00" + model.Source.URL.SHA256))
+	}
+	return generateName(instance.Spec.WorkspaceName, fmt.Sprintf("model-import-%08x", hasher.Sum32()))
+}
+
+/**
+ * Creates the personas of spec.patterns from a model.
+ *
+ * Personas are created from the blobs of the model, so they are created again when the model is
+ * updated. Failures are only reported as events. Nothing is created unless spec.patternDelivery is
+ * Modelfile, the other deliveries are published by ensurePatterns.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace the personas are created for.
+ * @param name The name of the model the personas are created from.
+ * @param ollamaServerURI The base URL of the Ollama API of the workspace.
+ */
+func (r *AIChatWorkspaceReconciler) createPersonas(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, name, ollamaServerURI string) {
+	if patternDelivery(instance) != appsv1alpha1.PatternDeliveryModelfile {
+		return
+	}
+	if _, err := ollama.CreateFromModelFile(name, ollamaServerURI, instance.Spec.Patterns); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create personas", "ModelName", name)
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonPersonaFailed, "Failed to create personas for model %s: %v", name, err)
+	} else if len(instance.Spec.Patterns) > 0 {
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonPersonaCreated, "Created %d personas from model %s", len(instance.Spec.Patterns), name)
+	}
+}
+
+// aliasHash identifies the model digest and parameters an alias is created from.
+func aliasHash(digest string, parameters map[string]string) string {
+	hasher := fnv.New64a()
+	b, _ := json.Marshal(parameters)
+	hasher.Write([]byte(digest))
+	hasher.Write(b)
+	return fmt.Sprintf("%x", hasher.Sum64())
+}
+
+/**
+ * Returns how often the model tags of a workspace are checked for updates.
+ *
+ * @param instance The AIChatWorkspace.
+ * @return The check interval, and false when the models are never updated.
+ */
+func modelUpdateCheckInterval(instance *appsv1alpha1.AIChatWorkspace) (time.Duration, bool) {
+	policy := instance.Spec.ModelUpdatePolicy
+	if policy == nil || policy.Type != appsv1alpha1.ModelUpdatePolicyOnTagChange {
+		return 0, false
+	}
+	interval := DefaultModelCheckInterval
+	if policy.CheckInterval != nil {
+		interval = max(policy.CheckInterval.Duration, MinModelCheckInterval)
+	}
+	return interval, true
+}
+
+// updateCheckDue returns whether a model tag last checked at lastCheck has to be checked again.
+func updateCheckDue(lastCheck *metav1.Time, interval time.Duration) bool {
+	return lastCheck == nil || time.Since(lastCheck.Time) >= interval
+}
@@ -0,0 +1,437 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ollama"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+)
+
+// fakeOllama serves the model endpoints of the Ollama API. Pulled models get the digest
+// registered for them in tags, created models the digest of their Modelfile.
+type fakeOllama struct {
+	mu        sync.Mutex
+	tags      map[string]string
+	installed map[string]string
+	pulls     []string
+	created   map[string]string
+	running   []string
+	loads     []string
+	deletes   []string
+}
+
+func (f *fakeOllama) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/tags":
+		models := []map[string]string{}
+		for name, digest := range f.installed {
+			models = append(models, map[string]string{"name": name, "model": name, "digest": digest})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"models": models})
+	case "/api/pull":
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.pulls = append(f.pulls, req.Model)
+		digest, ok := f.tags[req.Model]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "pull model manifest: file does not exist"})
+			return
+		}
+		f.installed[req.Model] = digest
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	case "/api/copy":
+		var req struct {
+			Source      string `json:"source"`
+			Destination string `json:"destination"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.installed[ollama.FullName(req.Destination)] = f.installed[req.Source]
+	case "/api/create":
+		var req struct {
+			Model     string `json:"model"`
+			Modelfile string `json:"modelfile"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		sum := sha256.Sum256([]byte(req.Modelfile))
+		f.created[req.Model] = req.Modelfile
+		f.installed[ollama.FullName(req.Model)] = hex.EncodeToString(sum[:])
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	case "/api/ps":
+		models := []map[string]string{}
+		for _, name := range f.running {
+			models = append(models, map[string]string{"name": name, "model": name})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"models": models})
+	case "/api/generate":
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.loads = append(f.loads, req.Model)
+		f.running = append(f.running, req.Model)
+		_ = json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "done": true})
+	case "/api/delete":
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.deletes = append(f.deletes, req.Model)
+		delete(f.installed, req.Model)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEnsureModelsReportsDigests(t *testing.T) {
+	tagged := strings.Repeat("a", 64)
+	pinned := strings.Repeat("b", 64)
+	fake := &fakeOllama{
+		tags:      map[string]string{"llama3.2:1b": tagged, "qwen2.5:0.5b": tagged},
+		installed: map[string]string{"gemma2:2b": pinned},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{
+		{Name: "llama3.2:1b"},
+		{Name: "qwen2.5:0.5b", Digest: "sha256:" + pinned},
+		{Name: "gemma2:2b", Digest: "sha256:" + pinned},
+		{Name: "missing:1b"},
+	}
+	c := newFakeClient(t, workspace)
+	recorder := record.NewFakeRecorder(20)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+	if err := r.ensureModels(context.Background(), workspace, inference.Ollama{}, testConfig(t), server.URL); err == nil {
+		t.Fatal("expected the pull error of the missing model")
+	}
+
+	want := map[string]appsv1alpha1.ModelStatus{
+		"llama3.2:1b":  {Name: "llama3.2:1b", Digest: "sha256:" + tagged, State: appsv1alpha1.ModelStateInstalled},
+		"qwen2.5:0.5b": {Name: "qwen2.5:0.5b", Digest: "sha256:" + tagged, PinnedDigest: "sha256:" + pinned, State: appsv1alpha1.ModelStateDigestMismatch},
+		"gemma2:2b":    {Name: "gemma2:2b", Digest: "sha256:" + pinned, PinnedDigest: "sha256:" + pinned, State: appsv1alpha1.ModelStateInstalled},
+		"missing:1b":   {Name: "missing:1b", State: appsv1alpha1.ModelStateMissing},
+	}
+	if len(workspace.Status.Models) != len(want) {
+		t.Fatalf("status.models = %+v", workspace.Status.Models)
+	}
+	for _, got := range workspace.Status.Models {
+		if got != want[got.Name] {
+			t.Errorf("status of %s = %+v, want %+v", got.Name, got, want[got.Name])
+		}
+	}
+	if strings.Join(fake.pulls, ",") != "llama3.2:1b,qwen2.5:0.5b,missing:1b" {
+		t.Errorf("pulled %v, the installed models should not be pulled again", fake.pulls)
+	}
+
+	// the mismatch is reported, the model isn't pulled again.
+	fake.pulls = nil
+	delete(fake.tags, "missing:1b")
+	workspace.Spec.Models = workspace.Spec.Models[:3]
+	if err := r.ensureModels(context.Background(), workspace, inference.Ollama{}, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.pulls) != 0 {
+		t.Errorf("pulled %v, want no pull", fake.pulls)
+	}
+}
+
+func TestEnsureModelsCreatesAliasesAndPreloads(t *testing.T) {
+	fake := &fakeOllama{
+		tags:      map[string]string{"qwen2.5:0.5b": strings.Repeat("a", 64)},
+		installed: map[string]string{},
+		created:   map[string]string{},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{{
+		Name:       "qwen2.5:0.5b",
+		Alias:      "qwen-precise",
+		Parameters: map[string]string{"temperature": "0.2", "num_ctx": "8192"},
+		Preload:    true,
+	}}
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	if err := r.ensureModels(context.Background(), workspace, inference.Ollama{}, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	want := "FROM qwen2.5:0.5b\nPARAMETER num_ctx 8192\nPARAMETER temperature 0.2\n"
+	if got := fake.created["qwen-precise"]; got != want {
+		t.Errorf("alias Modelfile = %q, want %q", got, want)
+	}
+	if strings.Join(fake.loads, ",") != "qwen-precise" {
+		t.Errorf("loaded %v, want the alias", fake.loads)
+	}
+	hash := workspace.Status.Models[0].AliasHash
+	if hash == "" {
+		t.Fatal("status.models should record the alias hash")
+	}
+
+	// nothing changed: the alias is not created again and the running model not loaded again.
+	fake.created = map[string]string{}
+	fake.running = []string{"qwen-precise:latest"}
+	if err := r.ensureModels(context.Background(), workspace, inference.Ollama{}, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.created) != 0 || len(fake.loads) != 1 {
+		t.Errorf("created %v and loaded %v, want no change", fake.created, fake.loads)
+	}
+
+	// a parameter change creates the alias again.
+	workspace.Spec.Models[0].Parameters["temperature"] = "0.7"
+	if err := r.ensureModels(context.Background(), workspace, inference.Ollama{}, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.created["qwen-precise"]; !ok || workspace.Status.Models[0].AliasHash == hash {
+		t.Error("the alias should be created again when its parameters change")
+	}
+}
+
+func TestEnsureModelsPullsThroughModelCache(t *testing.T) {
+	cached := "modelcache.system.svc:5000/library/llama3.2"
+	fake := &fakeOllama{
+		tags:      map[string]string{cached: strings.Repeat("a", 64), "hf.co/org/repo": strings.Repeat("b", 64)},
+		installed: map[string]string{},
+		created:   map[string]string{},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{
+		{Name: "llama3.2"},
+		{Name: "repo", Source: &appsv1alpha1.ModelSource{HuggingFace: "org/repo"}},
+	}
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	cfg, err := config.Parse(operatorConfigMap(map[string]string{"modelCacheURL": "http://modelcache.system.svc:5000"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.ensureModels(context.Background(), workspace, inference.Ollama{}, cfg, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	// the library model is pulled through the cache, Hugging Face directly.
+	if got := strings.Join(fake.pulls, ","); got != "modelcache.system.svc:5000/library/llama3.2,hf.co/org/repo" {
+		t.Errorf("pulled %s", got)
+	}
+	if fake.installed["llama3.2:latest"] != fake.installed[cached] {
+		t.Error("the cached model should be copied to its name in spec.models")
+	}
+}
+
+func TestEnsureModelsImportsFromPVC(t *testing.T) {
+	fake := &fakeOllama{tags: map[string]string{}, installed: map[string]string{}, created: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{{
+		Name:   "tiny",
+		Source: &appsv1alpha1.ModelSource{PVC: &appsv1alpha1.PVCModelSource{ClaimName: "weights", Path: "tiny/model.gguf"}},
+	}}
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	if err := r.ensureModels(ctx, workspace, inference.Ollama{}, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if state := workspace.Status.Models[0].State; state != appsv1alpha1.ModelStateImporting {
+		t.Errorf("state = %s, want %s", state, appsv1alpha1.ModelStateImporting)
+	}
+	job := &batchv1.Job{}
+	key := types.NamespacedName{Name: modelImportJobName(workspace, workspace.Spec.Models[0]), Namespace: workspace.Spec.WorkspaceName}
+	if err := c.Get(ctx, key, job); err != nil {
+		t.Fatalf("the import Job should be created: %v", err)
+	}
+	if claim := job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName; claim != "weights" {
+		t.Errorf("Job mounts claim %q, want weights", claim)
+	}
+
+	// the Job imported the model: it is reported installed and the Job is deleted.
+	fake.installed["tiny:latest"] = strings.Repeat("c", 64)
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	if err := c.Update(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureModels(ctx, workspace, inference.Ollama{}, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if state := workspace.Status.Models[0].State; state != appsv1alpha1.ModelStateInstalled {
+		t.Errorf("state = %s, want %s", state, appsv1alpha1.ModelStateInstalled)
+	}
+	if err := c.Get(ctx, key, job); !apierrors.IsNotFound(err) {
+		t.Errorf("the completed import Job should be deleted, got %v", err)
+	}
+}
+
+func TestEnsureModelsImportsFromURL(t *testing.T) {
+	fake := &fakeOllama{tags: map[string]string{}, installed: map[string]string{}, created: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	digest := "sha256:" + strings.Repeat("d", 64)
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{{
+		Name:   "tiny",
+		Source: &appsv1alpha1.ModelSource{URL: &appsv1alpha1.URLModelSource{URL: "https://models.example.com/tiny.gguf", SHA256: digest}},
+	}}
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+	cfg, err := config.Parse(operatorConfigMap(map[string]string{"httpsProxy": "http://proxy.example.com:3128"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is downloaded by a Job, not by the operator.
+	if err := r.ensureModels(ctx, workspace, inference.Ollama{}, cfg, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if state := workspace.Status.Models[0].State; state != appsv1alpha1.ModelStateImporting {
+		t.Errorf("state = %s, want %s", state, appsv1alpha1.ModelStateImporting)
+	}
+	if len(fake.pulls) != 0 || len(fake.created) != 0 {
+		t.Errorf("the operator should not import the model, pulled %v created %v", fake.pulls, fake.created)
+	}
+	job := &batchv1.Job{}
+	key := types.NamespacedName{Name: modelImportJobName(workspace, workspace.Spec.Models[0]), Namespace: workspace.Spec.WorkspaceName}
+	if err := c.Get(ctx, key, job); err != nil {
+		t.Fatalf("the import Job should be created: %v", err)
+	}
+	env := map[string]string{}
+	for _, v := range job.Spec.Template.Spec.Containers[0].Env {
+		env[v.Name] = v.Value
+	}
+	if env["MODEL_URL"] != "https://models.example.com/tiny.gguf" || env["MODEL_DIGEST"] != digest || env["HTTPS_PROXY"] != "http://proxy.example.com:3128" {
+		t.Errorf("Job env = %v, want the URL, the digest and the proxy", env)
+	}
+
+	// another digest is imported by another Job.
+	changed := workspace.Spec.Models[0]
+	changed.Source = &appsv1alpha1.ModelSource{URL: &appsv1alpha1.URLModelSource{URL: changed.Source.URL.URL, SHA256: "sha256:" + strings.Repeat("e", 64)}}
+	if modelImportJobName(workspace, changed) == key.Name {
+		t.Error("the Job name should change with the digest")
+	}
+}
+
+func TestEnsureModelsListsLlamaCppModels(t *testing.T) {
+	var served []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/models" {
+			t.Errorf("unexpected request %s %s, the llama.cpp models are loaded at startup", req.Method, req.URL.Path)
+			http.NotFound(w, req)
+			return
+		}
+		data := []map[string]string{}
+		for _, name := range served {
+			data = append(data, map[string]string{"id": name})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+	}))
+	defer server.Close()
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Backend = &appsv1alpha1.BackendSpec{Engine: appsv1alpha1.BackendEngineLlamaCpp}
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{{
+		Name:   "gemma3",
+		Source: &appsv1alpha1.ModelSource{HuggingFace: "ggml-org/gemma-3-1b-it-GGUF"},
+	}}
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	backend, err := inferenceBackend(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureModels(context.Background(), workspace, backend, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if state := workspace.Status.Models[0].State; state != appsv1alpha1.ModelStateMissing {
+		t.Errorf("state = %s while the server loads the model, want Missing", state)
+	}
+
+	served = []string{"gemma3"}
+	if err := r.ensureModels(context.Background(), workspace, backend, testConfig(t), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if state := workspace.Status.Models[0].State; state != appsv1alpha1.ModelStateInstalled {
+		t.Errorf("state = %s once the model is served, want Installed", state)
+	}
+}
+
+func TestModelUpdateCheckInterval(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	if _, ok := modelUpdateCheckInterval(workspace); ok {
+		t.Error("models should not be checked without an update policy")
+	}
+
+	workspace.Spec.ModelUpdatePolicy = &appsv1alpha1.ModelUpdatePolicy{Type: appsv1alpha1.ModelUpdatePolicyOnTagChange}
+	if interval, _ := modelUpdateCheckInterval(workspace); interval != DefaultModelCheckInterval {
+		t.Errorf("interval = %s, want %s", interval, DefaultModelCheckInterval)
+	}
+
+	workspace.Spec.ModelUpdatePolicy.CheckInterval = &metav1.Duration{Duration: time.Minute}
+	if interval, _ := modelUpdateCheckInterval(workspace); interval != MinModelCheckInterval {
+		t.Errorf("interval = %s, want %s", interval, MinModelCheckInterval)
+	}
+	if requeue := scheduledRequeue(workspace); requeue != MinModelCheckInterval {
+		t.Errorf("scheduledRequeue() = %s, want %s", requeue, MinModelCheckInterval)
+	}
+}
+
+// testConfig returns the operator configuration of the sample config map.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Parse(operatorConfigMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
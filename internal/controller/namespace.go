@@ -23,16 +23,17 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
 )
 
 // ensureNamespace ensures that a namespace exists for the given AIChatWorkspace instance.
 //
 // It checks if the namespace already exists, and if not, creates it. If an error occurs during this process,
-// it logs the error and returns it.
+// it logs the error and returns it. A created namespace is annotated with the AIChatWorkspace it was created
+// for, only such a namespace is deleted with the workspace; an existing namespace is adopted but kept.
 func (r *AIChatWorkspaceReconciler) ensureNamespace(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, ns *corev1.Namespace) (*ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
@@ -45,13 +46,18 @@ func (r *AIChatWorkspaceReconciler) ensureNamespace(ctx context.Context, instanc
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating the namespace", "instance.Spec.Namespace", instance.Spec.WorkspaceName)
 
-		controllerutil.SetControllerReference(instance, ns, r.Scheme)
+		setWorkspaceLabel(instance, ns)
+		if ns.Annotations == nil {
+			ns.Annotations = map[string]string{}
+		}
+		ns.Annotations[constants.CreatedForAnnotation] = createdFor(instance)
 		err = r.Create(context.TODO(), ns)
 		if err != nil {
 			logger.Error(err, "Failed to create namespace", "instance.Spec.Namespace", instance.Spec.WorkspaceName)
 			return &ctrl.Result{}, err
 		}
 
+		r.eventCreated(instance, "Namespace", ns)
 		return nil, nil
 
 	} else if err != nil {
@@ -60,5 +66,22 @@ func (r *AIChatWorkspaceReconciler) ensureNamespace(ctx context.Context, instanc
 		return &ctrl.Result{}, err
 	}
 
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
 	return nil, nil
 }
+
+// createdFor returns the value of the created-for annotation of the namespace of a workspace.
+func createdFor(instance *appsv1alpha1.AIChatWorkspace) string {
+	return instance.Namespace + "/" + instance.Name
+}
+
+// createdForWorkspace reports whether the operator created the namespace for the workspace, rather
+// than adopting an existing one.
+func createdForWorkspace(instance *appsv1alpha1.AIChatWorkspace, namespace *corev1.Namespace) bool {
+	return namespace.Labels[constants.WorkspaceLabelName] == instance.Spec.WorkspaceName &&
+		namespace.Labels[constants.ManagedByLabelName] == constants.ManagedBy &&
+		namespace.Annotations[constants.CreatedForAnnotation] == createdFor(instance)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+)
+
+// ensureNetworkPolicy ensures that the specified NetworkPolicy exists in the cluster.
+// If it does not exist, it creates a new one. If its rules differ from the desired ones,
+// it is updated. If an error occurs during this process, it returns the error and logs it.
+func (r *AIChatWorkspaceReconciler) ensureNetworkPolicy(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, netpol *networkingv1.NetworkPolicy) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	found := &networkingv1.NetworkPolicy{}
+
+	err := r.Get(context.TODO(), types.NamespacedName{
+		Name:      netpol.Name,
+		Namespace: instance.Spec.WorkspaceName,
+	}, found)
+
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a NetworkPolicy", "NetworkPolicy.Namespace", instance.Spec.WorkspaceName, "NetworkPolicy.Name", netpol.Name)
+
+		setWorkspaceLabel(instance, netpol)
+		err = r.Create(context.TODO(), netpol)
+		if err != nil {
+			logger.Error(err, "Failed to create NetworkPolicy", "NetworkPolicy.Namespace", instance.Spec.WorkspaceName, "NetworkPolicy.Name", netpol.Name)
+
+			return &ctrl.Result{}, err
+		}
+
+		r.eventCreated(instance, "NetworkPolicy", netpol)
+		return nil, nil
+
+	} else if err != nil {
+		logger.Error(err, "Failed to get NetworkPolicy")
+
+		return &ctrl.Result{}, err
+	}
+
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if !equality.Semantic.DeepEqual(found.Spec, netpol.Spec) {
+		found.Spec = netpol.Spec
+		logger.Info("Updating NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+		if err = r.Update(context.TODO(), found); err != nil {
+			logger.Error(err, "Failed to update NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "NetworkPolicy", found)
+	}
+
+	return nil, nil
+}
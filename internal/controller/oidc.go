@@ -0,0 +1,108 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// defaultOIDCScopes are requested when spec.auth.oidc.scopes is empty.
+var defaultOIDCScopes = []string{"openid", "email", "profile"}
+
+/**
+ * Ensures Open WebUI signs the users in with the OpenID Connect provider of spec.auth.oidc.
+ *
+ * The client secret is copied from the namespace of the AIChatWorkspace into the
+ * <workspaceName>-oidc Secret of the workspace namespace. The redirect URL is derived from the
+ * Open WebUI host, see setIngressDNSHost. Without spec.auth.oidc the Secret is removed and the
+ * users sign up with local accounts.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose Open WebUI is configured.
+ * @param config The configuration of the workspace.
+ * @param deployment The Open WebUI Deployment, updated with the provider before it is ensured.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureOIDC(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, config *config.Config, deployment *appsv1.Deployment) (*ctrl.Result, error) {
+	secretName := getName(instance.Spec.WorkspaceName, constants.OIDCSecretName)
+	if instance.Spec.Auth == nil || instance.Spec.Auth.OIDC == nil {
+		if err := r.deleteIfExists(ctx, &corev1.Secret{}, instance.Spec.WorkspaceName, secretName); err != nil {
+			return &ctrl.Result{}, err
+		}
+		return nil, nil
+	}
+	oidc := instance.Spec.Auth.OIDC
+
+	secretKey := oidc.ClientSecretKey
+	if secretKey == "" {
+		secretKey = "clientSecret"
+	}
+	source := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: oidc.ClientSecretName, Namespace: instance.Namespace}, source); err != nil {
+		return &ctrl.Result{}, fmt.Errorf("unable to read oidc client secret %s/%s: %w", instance.Namespace, oidc.ClientSecretName, err)
+	}
+	clientSecret, ok := source.Data[secretKey]
+	if !ok {
+		return &ctrl.Result{}, fmt.Errorf("oidc client secret %s/%s has no %q key", instance.Namespace, oidc.ClientSecretName, secretKey)
+	}
+
+	data := map[string][]byte{constants.OIDCClientSecretKey: clientSecret}
+	secretLabels := defaultLabels(instance.Spec.WorkspaceName, secretName, constants.SecretLabelName)
+	result, err := r.ensureSecret(ctx, instance, k8s.NewSecret(secretName, instance.Spec.WorkspaceName, data, secretLabels))
+	if result != nil {
+		return result, err
+	}
+
+	scopes := oidc.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultOIDCScopes
+	}
+	providerName := oidc.ProviderName
+	if providerName == "" {
+		providerName = "SSO"
+	}
+	groupsClaim := oidc.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	url := "https://" + setIngressDNSHost(config, instance.Spec.WorkspaceName, constants.OpenwebuiName)
+	k8s.AddOIDC(deployment, k8s.OIDCSettings{
+		URL:                url,
+		RedirectURL:        url + constants.OIDCCallbackPath,
+		Issuer:             oidc.Issuer,
+		ProviderName:       providerName,
+		ClientID:           oidc.ClientID,
+		Scopes:             scopes,
+		GroupsClaim:        groupsClaim,
+		AllowedGroups:      oidc.AllowedGroups,
+		AdminGroup:         oidc.AdminGroup,
+		DisableLocalSignup: oidc.DisableLocalSignup,
+	}, secretName, secretDataHash(data))
+	return nil, nil
+}
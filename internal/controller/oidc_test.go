@@ -0,0 +1,97 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func TestEnsureOIDC(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Auth = &appsv1alpha1.AuthSpec{OIDC: &appsv1alpha1.OIDCSpec{
+		Issuer:             "https://login.example.com/realms/ai/",
+		ClientID:           "openwebui",
+		ClientSecretName:   "openwebui-oidc",
+		AllowedGroups:      []string{"team-a"},
+		AdminGroup:         "team-a-admins",
+		DisableLocalSignup: true,
+	}}
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "openwebui-oidc", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"clientSecret": []byte("s3cr3t")},
+	}
+	c := newFakeClient(t, workspace, source)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	deployment := k8s.NewDeployment("team-a", "team-a-openwebui", constants.OpenwebuiContainerPort, "open-webui:main", "cluster.local")
+	if result, err := r.ensureOIDC(ctx, workspace, testConfig(t), deployment); result != nil {
+		t.Fatalf("ensureOIDC() = %v, %v", result, err)
+	}
+
+	env := map[string]corev1.EnvVar{}
+	for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e
+	}
+	for name, want := range map[string]string{
+		"WEBUI_URL":           "https://team-a.localtest.me",
+		"OPENID_REDIRECT_URI": "https://team-a.localtest.me/oauth/oidc/callback",
+		"OPENID_PROVIDER_URL": "https://login.example.com/realms/ai/.well-known/openid-configuration",
+		"OAUTH_CLIENT_ID":     "openwebui",
+		"OAUTH_SCOPES":        "openid email profile",
+		"OAUTH_ROLES_CLAIM":   "groups",
+		"OAUTH_ALLOWED_ROLES": "team-a,team-a-admins",
+		"OAUTH_ADMIN_ROLES":   "team-a-admins",
+		"ENABLE_SIGNUP":       "false",
+	} {
+		if got := env[name].Value; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if ref := env["OAUTH_CLIENT_SECRET"].ValueFrom; ref == nil || ref.SecretKeyRef.Name != "team-a-oidc" {
+		t.Errorf("OAUTH_CLIENT_SECRET = %+v, want a reference to the team-a-oidc Secret", env["OAUTH_CLIENT_SECRET"])
+	}
+
+	copied := &corev1.Secret{}
+	key := types.NamespacedName{Name: "team-a-oidc", Namespace: "team-a"}
+	if err := c.Get(ctx, key, copied); err != nil {
+		t.Fatal(err)
+	}
+	if string(copied.Data[constants.OIDCClientSecretKey]) != "s3cr3t" {
+		t.Errorf("OAUTH_CLIENT_SECRET = %q, want the client secret", copied.Data[constants.OIDCClientSecretKey])
+	}
+
+	// without spec.auth.oidc the copy is removed.
+	workspace.Spec.Auth = nil
+	if result, err := r.ensureOIDC(ctx, workspace, testConfig(t), deployment); result != nil {
+		t.Fatalf("ensureOIDC() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, key, copied); !apierrors.IsNotFound(err) {
+		t.Errorf("Secret team-a-oidc: %v, want it deleted", err)
+	}
+}
@@ -25,23 +25,30 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
 	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ollama"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/metrics"
 )
 
-// ensureStatefulSet ensures the Ollama service is created and running as a StatefulSet.
+// ensureStatefulSet ensures the inference server is created and running as a StatefulSet.
 /**
  * This function checks if the given StatefulSet exists in the cluster.
  * If it does not, it creates a new one with the provided instance and returns nil.
+ * If it exists with a different pod template (e.g. the API gateway sidecar was added),
+ * the template is updated.
  * If an error occurs during this process, it logs the error and returns a Result.
  */
-func (r *AIChatWorkspaceReconciler) ensureStatefulSet(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, sts *appsv1.StatefulSet) (*ctrl.Result, error) {
+func (r *AIChatWorkspaceReconciler) ensureStatefulSet(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, sts *appsv1.StatefulSet, backend inference.Backend, config *config.Config, serverURI string) (*ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
 	found := &appsv1.StatefulSet{}
+	hash := templateHash(sts.Spec.Template)
+	sts.Annotations = map[string]string{constants.TemplateHashAnnotation: hash}
 
 	// Check if the StatefulSet already exists
 	err := r.Get(context.TODO(), types.NamespacedName{
@@ -54,8 +61,7 @@ func (r *AIChatWorkspaceReconciler) ensureStatefulSet(ctx context.Context, insta
 		 */
 		logger.Info("Creating a new StatefulSet", "StatefulSet.Namespace", instance.Spec.WorkspaceName, "StatefulSet.Name", sts.Name)
 
-		// Set the controller reference for the StatefulSet
-		controllerutil.SetControllerReference(instance, sts, r.Scheme)
+		setWorkspaceLabel(instance, sts)
 		err = r.Create(context.TODO(), sts)
 		if err != nil {
 			logger.Error(err, "Failed to create new StatefulSet", "StatefulSet.Namespace", instance.Spec.WorkspaceName, "StatefulSet.Name", sts.Name)
@@ -63,6 +69,7 @@ func (r *AIChatWorkspaceReconciler) ensureStatefulSet(ctx context.Context, insta
 			return &ctrl.Result{}, err
 		}
 
+		r.eventCreated(instance, "StatefulSet", sts)
 		return nil, nil
 	} else if err != nil {
 		/**
@@ -73,38 +80,55 @@ func (r *AIChatWorkspaceReconciler) ensureStatefulSet(ctx context.Context, insta
 		return &ctrl.Result{}, err
 	}
 
-	// ensure ollama is running.
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if found.GetAnnotations()[constants.TemplateHashAnnotation] != hash {
+		logger.Info("Updating StatefulSet pod template", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+		found.Annotations[constants.TemplateHashAnnotation] = hash
+		found.Spec.Template = sts.Spec.Template
+		if err = r.Update(context.TODO(), found); err != nil {
+			logger.Error(err, "Failed to update StatefulSet", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "StatefulSet", found)
+	}
+
+	// ensure the server is running.
 	// it needs to be running in order to pull in the instance.Spec.Models
-	ollamaRunning := r.isOllamaUp(ctx, instance)
-	if !ollamaRunning {
+	serverRunning := r.isServerUp(ctx, instance)
+	if !serverRunning {
 		delay := time.Second * time.Duration(5)
-		logger.Info(fmt.Sprintf("Ollama isn't running, waiting for %s", delay))
+		logger.Info(fmt.Sprintf("%s isn't running, waiting for %s", backend.Engine(), delay))
 
 		return &ctrl.Result{RequeueAfter: delay}, nil
 	}
 
 	// ensure the instance.Spec.Models are available.
-	serviceName := fmt.Sprintf("%s-ollama", instance.Spec.WorkspaceName)
-	ollamaPort := int64(11434)
-	ollamaServerURI := fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", serviceName, instance.Spec.WorkspaceName, ollamaPort)
+	if err := r.ensureModels(ctx, instance, backend, config, serverURI); err != nil {
+		return &ctrl.Result{}, err
+	}
 
-	for _, llm := range instance.Spec.Models {
-		ok, err := ollama.DoesModelExist(llm, ollamaServerURI)
-		if err != nil {
-			return &ctrl.Result{}, err
-		}
-		if !ok {
-			fmt.Printf("The %s LLM does not exist. Starting the ollama pull ...\n", llm)
-			err = ollama.PullModel(llm, ollamaServerURI)
-			if err != nil {
-				logger.Error(err, "Failed to pull Model", "ModelName", llm, "StatefulSet.Namespace", instance.Spec.WorkspaceName, "StatefulSet.Name", sts.Name)
-				return &ctrl.Result{}, err
-			}
-			ollama.CreateFromModelFile(llm, ollamaServerURI, instance.Spec.Patterns)
-		}
+	// the sizes and the running models are only reported by the Ollama API.
+	if backend.Engine() != appsv1alpha1.BackendEngineOllama {
+		return nil, nil
+	}
+
+	sizes, err := ollama.ListModelSizes(serverURI)
+	if err != nil {
+		return &ctrl.Result{}, err
+	}
+	var modelBytes int64
+	for _, size := range sizes {
+		modelBytes += size
 	}
+	metrics.SetWorkspaceModels(instance.Spec.WorkspaceName, len(sizes), modelBytes)
 
-	models, err := ollama.ListRunningModels(ollamaServerURI)
+	models, err := ollama.ListRunningModels(serverURI)
 	if err != nil {
 		return &ctrl.Result{}, err
 	}
@@ -113,8 +137,8 @@ func (r *AIChatWorkspaceReconciler) ensureStatefulSet(ctx context.Context, insta
 	return nil, nil
 }
 
-// Returns whether or not the ollama StatefulSet is running
-func (r *AIChatWorkspaceReconciler) isOllamaUp(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) bool {
+// Returns whether or not the inference server StatefulSet is running
+func (r *AIChatWorkspaceReconciler) isServerUp(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) bool {
 	logger := log.FromContext(ctx)
 	sts := &appsv1.StatefulSet{}
 	ollamaName := generateName(instance.Spec.WorkspaceName, "ollama")
@@ -125,7 +149,7 @@ func (r *AIChatWorkspaceReconciler) isOllamaUp(ctx context.Context, instance *ap
 	}, sts)
 
 	if err != nil {
-		logger.Error(err, "StatefulSet for Ollama not found")
+		logger.Error(err, "StatefulSet for the inference server not found")
 		return false
 	}
 
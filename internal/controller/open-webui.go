@@ -18,22 +18,30 @@ package controller
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"maps"
+	"slices"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
 )
 
 /**
  * Ensures the existence and desired state of a Deployment.
  *
  * This function checks if a Deployment with the given name exists in the specified namespace. If it does not exist, it creates a new Deployment.
- * If the Deployment already exists, this function checks for any changes to the Deployment's spec and updates it if necessary.
+ * If the Deployment already exists with a different pod template, the template is updated.
  *
  * @param ctx The context in which the function is being executed.
  * @param instance The AIChatWorkspace instance that owns the Deployment.
@@ -44,6 +52,11 @@ func (r *AIChatWorkspaceReconciler) ensureDeployment(ctx context.Context, instan
 	logger := log.FromContext(ctx)
 
 	found := &appsv1.Deployment{}
+	hash := templateHash(deploy.Spec.Template)
+	if deploy.Annotations == nil {
+		deploy.Annotations = map[string]string{}
+	}
+	deploy.Annotations[constants.TemplateHashAnnotation] = hash
 
 	err := r.Get(context.TODO(), types.NamespacedName{
 		Name:      deploy.Name,
@@ -53,7 +66,7 @@ func (r *AIChatWorkspaceReconciler) ensureDeployment(ctx context.Context, instan
 	if err != nil && errors.IsNotFound(err) {
 		// Create the Deployment
 		logger.Info("Creating a new Deployment", "Deployment.Namespace", instance.Spec.WorkspaceName, "Deployment.Name", deploy.Name)
-		controllerutil.SetControllerReference(instance, deploy, r.Scheme)
+		setWorkspaceLabel(instance, deploy)
 		err = r.Create(context.TODO(), deploy)
 
 		if err != nil {
@@ -61,6 +74,7 @@ func (r *AIChatWorkspaceReconciler) ensureDeployment(ctx context.Context, instan
 			logger.Error(err, "Failed to create new Deployment", "Deployment.Namespace", instance.Spec.WorkspaceName, "Deployment.Name", deploy.Name)
 			return &ctrl.Result{}, err
 		}
+		r.eventCreated(instance, "Deployment", deploy)
 		// Creation was successful
 		return nil, nil
 
@@ -70,42 +84,117 @@ func (r *AIChatWorkspaceReconciler) ensureDeployment(ctx context.Context, instan
 		return &ctrl.Result{}, err
 	}
 
-	// TODO: implement checks for deployment and sts
-	// Check for any changes and redeployment
-	// applyChange := false
-
-	// // Ensure the deployment size is same as the spec
-	// size := int32(1)
-	// if deploy.Spec.Replicas != &size {
-	// 	deploy.Spec.Replicas = &size
-	// 	applyChange = true
-	// }
-
-	// // Ensure image name is correct, update image if required
-	// image := "nginx:1.26.2"
-	// var currentImage string = ""
-
-	// if found.Spec.Template.Spec.Containers != nil {
-	//	currentImage = found.Spec.Template.Spec.Containers[0].Image
-	// }
-
-	// if image != currentImage {
-	//	deploy.Spec.Template.Spec.Containers[0].Image = image
-	//	applyChange = true
-	// }
-
-	// if applyChange {
-	// 	fmt.Println("image: ", image, "found: ", currentImage)
-	// }
-
-	// if applyChange {
-	// 	err = r.Update(context.TODO(), deploy)
-	// 	if err != nil {
-	// 		logger.Error(err, "Failed to update Deployment.", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
-	// 		return &ctrl.Result{}, err
-	// 	}
-	// 	logger.Info("Updated Deployment to desired state.")
-	// }
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	// the pod template changes e.g. when the workspace switches between a dedicated and a shared backend.
+	if found.GetAnnotations()[constants.TemplateHashAnnotation] != hash {
+		logger.Info("Updating Deployment pod template", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+		found.Annotations[constants.TemplateHashAnnotation] = hash
+		found.Spec.Template = deploy.Spec.Template
+		if err = r.Update(context.TODO(), found); err != nil {
+			logger.Error(err, "Failed to update Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "Deployment", found)
+	}
 
 	return nil, nil
 }
+
+/**
+ * Ensures the Secret holding the Open WebUI secret key exists in the workspace namespace.
+ *
+ * Open WebUI signs its sessions with WEBUI_SECRET_KEY, a key generated at startup would log every
+ * user out when the pod restarts. The key is generated once and kept in the <workspaceName>-openwebui-secret
+ * Secret, whose other keys are set in the Open WebUI environment as well. Setting the
+ * aichatworkspaces.io/rotate-webui-secret-key annotation to a new value on the AIChatWorkspace
+ * generates a new key. A Secret created by a user, without the workspace label, is left alone
+ * and never rotated.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose Open WebUI uses the key.
+ * @return The hash of the Secret data, set on the pod template to restart Open WebUI when it changes, a ctrl.Result and an error.
+ */
+func (r *AIChatWorkspaceReconciler) ensureOpenWebUISecret(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (string, *ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	rotateFor := instance.GetAnnotations()[constants.RotateOpenwebuiSecretKeyAnnotation]
+	secretName := getName(instance.Spec.WorkspaceName, constants.OpenwebuiSecretName)
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: instance.Spec.WorkspaceName}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		key, err := generateSecretKey()
+		if err != nil {
+			return "", &ctrl.Result{}, err
+		}
+
+		secretLabels := defaultLabels(instance.Spec.WorkspaceName, secretName, constants.SecretLabelName)
+		secret = k8s.NewSecret(secretName, instance.Spec.WorkspaceName, map[string][]byte{constants.OpenwebuiSecretKey: []byte(key)}, secretLabels)
+		secret.Annotations = map[string]string{constants.RotatedOpenwebuiSecretKeyAnnotation: rotateFor}
+		setWorkspaceLabel(instance, secret)
+
+		logger.Info("Creating the Open WebUI secret key", "Secret.Namespace", secret.Namespace, "Secret.Name", secretName)
+		if err := r.Create(ctx, secret); err != nil {
+			logger.Error(err, "Failed to create the Open WebUI secret key", "Secret.Namespace", secret.Namespace, "Secret.Name", secretName)
+			return "", &ctrl.Result{}, err
+		}
+		r.eventCreated(instance, "Secret", secret)
+	} else if err != nil {
+		logger.Error(err, "Failed to get the Open WebUI secret key")
+		return "", &ctrl.Result{}, err
+	} else if secret.GetLabels()[constants.WorkspaceLabelName] != instance.Spec.WorkspaceName {
+		// created by a user, the key is theirs to manage.
+		if len(secret.Data[constants.OpenwebuiSecretKey]) == 0 {
+			r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonReconcileFailed, "Secret %s has no %s key, Open WebUI can't start", objectName(secret), constants.OpenwebuiSecretKey)
+		}
+	} else if len(secret.Data[constants.OpenwebuiSecretKey]) == 0 || secret.GetAnnotations()[constants.RotatedOpenwebuiSecretKeyAnnotation] != rotateFor {
+		key, err := generateSecretKey()
+		if err != nil {
+			return "", &ctrl.Result{}, err
+		}
+
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[constants.OpenwebuiSecretKey] = []byte(key)
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[constants.RotatedOpenwebuiSecretKeyAnnotation] = rotateFor
+
+		logger.Info("Rotating the Open WebUI secret key", "Secret.Namespace", secret.Namespace, "Secret.Name", secretName)
+		if err := r.Update(ctx, secret); err != nil {
+			logger.Error(err, "Failed to rotate the Open WebUI secret key", "Secret.Namespace", secret.Namespace, "Secret.Name", secretName)
+			return "", &ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonUpdated, "Rotated the Open WebUI secret key in Secret %s", objectName(secret))
+	}
+
+	return secretDataHash(secret.Data), nil, nil
+}
+
+// generateSecretKey returns a random key for signing the Open WebUI sessions.
+func generateSecretKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// secretDataHash identifies the data of a Secret, in key order.
+func secretDataHash(data map[string][]byte) string {
+	hasher := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		hasher.Write([]byte(key + "\x00"))
+		hasher.Write(data[key])
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil)[:8])
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func TestEnsureOpenWebUISecret(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "team-a-openwebui-secret", Namespace: "team-a"}
+
+	hash, result, err := r.ensureOpenWebUISecret(ctx, workspace)
+	if result != nil {
+		t.Fatalf("ensureOpenWebUISecret() = %v, %v", result, err)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	generated := string(secret.Data[constants.OpenwebuiSecretKey])
+	if len(generated) < 32 {
+		t.Fatalf("WEBUI_SECRET_KEY = %q, want a generated key", generated)
+	}
+
+	// the key is kept across reconciles.
+	again, _, _ := r.ensureOpenWebUISecret(ctx, workspace)
+	if err := c.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if again != hash || string(secret.Data[constants.OpenwebuiSecretKey]) != generated {
+		t.Error("the key changed without a rotation")
+	}
+
+	// a new value of the rotation annotation generates a new key.
+	workspace.Annotations = map[string]string{constants.RotateOpenwebuiSecretKeyAnnotation: "2026-10-19"}
+	rotated, _, _ := r.ensureOpenWebUISecret(ctx, workspace)
+	if err := c.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if rotated == hash || string(secret.Data[constants.OpenwebuiSecretKey]) == generated {
+		t.Error("the key was not rotated")
+	}
+}
+
+func TestEnsureOpenWebUISecretKeepsUserSecret(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Annotations = map[string]string{constants.RotateOpenwebuiSecretKeyAnnotation: "now"}
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-openwebui-secret", Namespace: "team-a"},
+		Data: map[string][]byte{
+			constants.OpenwebuiSecretKey: []byte("user-key"),
+			"DATABASE_URL":               []byte("postgres://openwebui@db/openwebui"),
+		},
+	}
+	c := newFakeClient(t, workspace, userSecret)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	hash, result, err := r.ensureOpenWebUISecret(context.Background(), workspace)
+	if result != nil {
+		t.Fatalf("ensureOpenWebUISecret() = %v, %v", result, err)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(userSecret), secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[constants.OpenwebuiSecretKey]) != "user-key" || len(secret.Labels) != 0 {
+		t.Errorf("Secret = %+v, want the user Secret left alone", secret)
+	}
+	if hash != secretDataHash(userSecret.Data) {
+		t.Errorf("hash = %s, want the hash of the user Secret", hash)
+	}
+}
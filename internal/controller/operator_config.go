@@ -0,0 +1,163 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+/**
+ * Returns the loader of the operator configuration.
+ *
+ * When the reconciler was not given one, the default config map is read through the reconciler client.
+ */
+func (r *AIChatWorkspaceReconciler) configLoader() *config.Loader {
+	if r.Config == nil {
+		r.Config = config.NewLoader(r.Client, constants.AIChatWorspaceConfigMapName, constants.AIChatWorkspaceNamespace)
+	}
+	return r.Config
+}
+
+/**
+ * Loads the configuration of an AIChatWorkspace and reflects it into the ConfigMapReady condition.
+ *
+ * Invalid configurations are returned as terminal errors: retrying won't fix them, the watches on
+ * the config map and on the AIChatWorkspace reconcile the workspace again once they are fixed.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose profile and overrides are applied.
+ * @return The configuration of the workspace, and an error if it could not be loaded.
+ */
+func (r *AIChatWorkspaceReconciler) workspaceConfig(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (*config.Config, error) {
+	base, err := r.configLoader().Load(ctx)
+	var cfg *config.Config
+	if err == nil {
+		cfg, err = base.ForWorkspace(instance.Spec.Profile, instance.Spec.Overrides)
+	}
+
+	condition := metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeConfigMapReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             appsv1alpha1.ConfigValidReason,
+		Message:            "Configuration loaded from config map " + r.configLoader().Key().String(),
+		ObservedGeneration: instance.GetGeneration(),
+	}
+	if err != nil {
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, appsv1alpha1.ConfigUnavailableReason, err.Error()
+		if errors.Is(err, config.ErrInvalidConfig) {
+			condition.Reason = appsv1alpha1.InvalidConfigReason
+			err = reconcile.TerminalError(err)
+		}
+	}
+
+	if apimeta.SetStatusCondition(&instance.Status.Conditions, condition) {
+		if patchErr := r.patchStatus(ctx, instance); patchErr != nil {
+			return nil, errors.Join(err, patchErr)
+		}
+	}
+	return cfg, err
+}
+
+// isOperatorConfig filters the ConfigMap watch events to the operator configuration.
+func (r *AIChatWorkspaceReconciler) isOperatorConfig() predicate.Predicate {
+	return predicate.NewPredicateFuncs(r.configLoader().IsConfigMap)
+}
+
+/**
+ * Returns the handler of the operator config map events.
+ *
+ * Creating or deleting the config map reconciles every workspace. An update only reconciles the
+ * workspaces whose configuration changed, once their profile and overrides are applied, or every
+ * workspace when the old or new configuration is invalid.
+ */
+func (r *AIChatWorkspaceReconciler) configMapHandler() handler.EventHandler {
+	enqueueAll := func(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+		for _, req := range r.workspaceRequests(ctx) {
+			q.Add(req)
+		}
+	}
+
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, _ event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueAll(ctx, q)
+		},
+		DeleteFunc: func(ctx context.Context, _ event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueAll(ctx, q)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			oldCM, oldOK := e.ObjectOld.(*corev1.ConfigMap)
+			newCM, newOK := e.ObjectNew.(*corev1.ConfigMap)
+			if !oldOK || !newOK {
+				enqueueAll(ctx, q)
+				return
+			}
+			for _, req := range r.affectedWorkspaces(ctx, oldCM, newCM) {
+				q.Add(req)
+			}
+		},
+	}
+}
+
+/**
+ * Returns the workspaces whose configuration differs between two versions of the config map.
+ *
+ * @param ctx The context of the watch event.
+ * @param oldCM The config map before the update.
+ * @param newCM The config map after the update.
+ * @return The reconcile requests of the affected AIChatWorkspaces.
+ */
+func (r *AIChatWorkspaceReconciler) affectedWorkspaces(ctx context.Context, oldCM, newCM *corev1.ConfigMap) []reconcile.Request {
+	oldConfig, oldErr := config.Parse(oldCM)
+	newConfig, newErr := config.Parse(newCM)
+	if oldErr != nil || newErr != nil {
+		return r.workspaceRequests(ctx)
+	}
+
+	workspaces := &appsv1alpha1.AIChatWorkspaceList{}
+	if err := r.List(ctx, workspaces); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list AIChatWorkspaces")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, workspace := range workspaces.Items {
+		before, beforeErr := oldConfig.ForWorkspace(workspace.Spec.Profile, workspace.Spec.Overrides)
+		after, afterErr := newConfig.ForWorkspace(workspace.Spec.Profile, workspace.Spec.Overrides)
+		if beforeErr != nil || afterErr != nil || !before.Equal(after) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: workspace.Name, Namespace: workspace.Namespace},
+			})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func operatorConfigMap(data map[string]string) *corev1.ConfigMap {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: constants.AIChatWorspaceConfigMapName, Namespace: constants.AIChatWorkspaceNamespace},
+		Data: map[string]string{
+			constants.DefaultDomain:     "localtest.me",
+			constants.OpenwebUIImageTag: "main",
+			constants.OllamaImageTag:    "0.4.1",
+			constants.Profiles:          "canary:\n  openwebUIImageTag: dev",
+		},
+	}
+	for key, value := range data {
+		cm.Data[key] = value
+	}
+	return cm
+}
+
+func configuredWorkspace(name, profile string, overrides map[string]string) *appsv1alpha1.AIChatWorkspace {
+	return &appsv1alpha1.AIChatWorkspace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: constants.AIChatWorkspaceNamespace},
+		Spec:       appsv1alpha1.AIChatWorkspaceSpec{WorkspaceName: name, Profile: profile, Overrides: overrides},
+	}
+}
+
+func TestConfigMapUpdateReconcilesAffectedWorkspaces(t *testing.T) {
+	c := newFakeClient(t,
+		configuredWorkspace("team-a", "", nil),
+		configuredWorkspace("team-b", "canary", nil),
+		configuredWorkspace("team-c", "", map[string]string{constants.OllamaImageTag: "0.5.0"}),
+	)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme()}
+
+	requests := r.affectedWorkspaces(context.Background(),
+		operatorConfigMap(nil),
+		operatorConfigMap(map[string]string{constants.OllamaImageTag: "0.4.2", constants.Profiles: "canary:\n  openwebUIImageTag: dev"}),
+	)
+	assertRequests(t, requests, "team-a", "team-b")
+
+	requests = r.affectedWorkspaces(context.Background(),
+		operatorConfigMap(nil),
+		operatorConfigMap(map[string]string{constants.Profiles: "canary:\n  openwebUIImageTag: nightly"}),
+	)
+	assertRequests(t, requests, "team-b")
+
+	requests = r.affectedWorkspaces(context.Background(),
+		operatorConfigMap(nil),
+		operatorConfigMap(map[string]string{constants.RoutingMode: "NodePort"}),
+	)
+	assertRequests(t, requests, "team-a", "team-b", "team-c")
+}
+
+func TestWorkspaceConfigSetsCondition(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "missing", nil)
+	c := newFakeClient(t, operatorConfigMap(nil), workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme()}
+
+	if _, err := r.workspaceConfig(context.Background(), workspace); !errors.Is(err, reconcile.TerminalError(nil)) {
+		t.Fatalf("expected a terminal error for an unknown profile, got %v", err)
+	}
+	stored := &appsv1alpha1.AIChatWorkspace{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(workspace), stored); err != nil {
+		t.Fatal(err)
+	}
+	condition := apimeta.FindStatusCondition(stored.Status.Conditions, appsv1alpha1.ConditionTypeConfigMapReady)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != appsv1alpha1.InvalidConfigReason {
+		t.Errorf("ConfigMapReady = %+v, want False/%s", condition, appsv1alpha1.InvalidConfigReason)
+	}
+
+	stored.Spec.Profile = "canary"
+	config, err := r.workspaceConfig(context.Background(), stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.OpenwebUIImageTag != "dev" {
+		t.Errorf("OpenwebUIImageTag = %q, want the profile value", config.OpenwebUIImageTag)
+	}
+	if !apimeta.IsStatusConditionTrue(stored.Status.Conditions, appsv1alpha1.ConditionTypeConfigMapReady) {
+		t.Error("expected ConfigMapReady to be True")
+	}
+}
+
+func assertRequests(t *testing.T, requests []reconcile.Request, names ...string) {
+	t.Helper()
+	got := map[string]bool{}
+	for _, req := range requests {
+		got[req.Name] = true
+	}
+	if len(got) != len(names) {
+		t.Errorf("reconciled %v, want %v", got, names)
+		return
+	}
+	for _, name := range names {
+		if !got[name] {
+			t.Errorf("reconciled %v, want %v", got, names)
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/metrics"
+)
+
+const (
+	DefaultOrphanSweepInterval = 10 * time.Minute
+	DefaultOrphanGracePeriod   = time.Hour
+)
+
+// OrphanSweeper finds the workspace namespaces whose AIChatWorkspace no longer exists, e.g. because
+// the finalizer was removed by hand. Workspace objects are tracked by label rather than owner
+// references, so the garbage collector never removes them.
+//
+// Orphaned namespaces are annotated with the time they were first found. They are only deleted
+// when Delete is set and they stayed orphaned for GracePeriod.
+type OrphanSweeper struct {
+	client.Client
+
+	Interval    time.Duration
+	GracePeriod time.Duration
+	Delete      bool
+}
+
+// Start runs a sweep every interval until ctx is done. It implements manager.Runnable.
+func (s *OrphanSweeper) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, s.sweep, s.Interval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, only the leader sweeps.
+func (s *OrphanSweeper) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *OrphanSweeper) sweep(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("orphan-sweeper")
+
+	namespaces := &corev1.NamespaceList{}
+	if err := s.List(ctx, namespaces,
+		client.MatchingLabels{"app.kubernetes.io/managed-by": constants.ManagedBy},
+		client.HasLabels{constants.WorkspaceLabelName},
+	); err != nil {
+		logger.Error(err, "Failed to list workspace namespaces")
+		return
+	}
+
+	orphaned := 0
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if ns.DeletionTimestamp != nil {
+			continue
+		}
+
+		isOrphan, err := s.isOrphan(ctx, ns)
+		if err != nil {
+			logger.Error(err, "Failed to look up the AIChatWorkspace of the namespace", "Namespace.Name", ns.Name)
+			continue
+		}
+		if !isOrphan {
+			if _, ok := ns.Annotations[constants.OrphanedSinceAnnotation]; ok {
+				if err := s.setOrphanedSince(ctx, ns, ""); err != nil {
+					logger.Error(err, "Failed to unmark the namespace as orphaned", "Namespace.Name", ns.Name)
+				}
+			}
+			continue
+		}
+		orphaned++
+
+		since, err := time.Parse(time.RFC3339, ns.Annotations[constants.OrphanedSinceAnnotation])
+		if err != nil {
+			logger.Info("Found an orphaned workspace namespace", "Namespace.Name", ns.Name, "aichatworkspace", ns.Labels[constants.WorkspaceLabelName])
+			if err := s.setOrphanedSince(ctx, ns, time.Now().UTC().Format(time.RFC3339)); err != nil {
+				logger.Error(err, "Failed to mark the namespace as orphaned", "Namespace.Name", ns.Name)
+			}
+			continue
+		}
+
+		// a namespace adopted by a workspace isn't the operator's to delete.
+		if !s.Delete || time.Since(since) < s.GracePeriod || ns.Annotations[constants.CreatedForAnnotation] == "" {
+			continue
+		}
+
+		logger.Info("Deleting orphaned workspace namespace", "Namespace.Name", ns.Name, "orphanedSince", since)
+		if err := s.Client.Delete(ctx, ns); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, "Failed to delete the orphaned namespace", "Namespace.Name", ns.Name)
+		}
+	}
+
+	metrics.SetOrphanedNamespaces(orphaned)
+}
+
+// isOrphan returns whether no AIChatWorkspace uses the workspace name the namespace is labelled with.
+func (s *OrphanSweeper) isOrphan(ctx context.Context, ns *corev1.Namespace) (bool, error) {
+	workspaces := &appsv1alpha1.AIChatWorkspaceList{}
+	if err := s.List(ctx, workspaces, client.MatchingFields{workspaceNameField: ns.Labels[constants.WorkspaceLabelName]}); err != nil {
+		return false, err
+	}
+	return len(workspaces.Items) == 0, nil
+}
+
+// setOrphanedSince sets the orphaned-since annotation of the namespace, or removes it when since is empty.
+func (s *OrphanSweeper) setOrphanedSince(ctx context.Context, ns *corev1.Namespace, since string) error {
+	patch := client.MergeFrom(ns.DeepCopy())
+	if since == "" {
+		delete(ns.Annotations, constants.OrphanedSinceAnnotation)
+	} else {
+		if ns.Annotations == nil {
+			ns.Annotations = map[string]string{}
+		}
+		ns.Annotations[constants.OrphanedSinceAnnotation] = since
+	}
+	return s.Patch(ctx, ns, patch)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// workspaceNamespace returns a namespace created by the operator for the AIChatWorkspace name.
+func workspaceNamespace(name string, annotations map[string]string) *corev1.Namespace {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if _, ok := annotations[constants.CreatedForAnnotation]; !ok {
+		annotations[constants.CreatedForAnnotation] = constants.AIChatWorkspaceNamespace + "/" + name
+	}
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Labels:      defaultLabels(name, name, constants.AIChatWorkspaceName),
+		Annotations: annotations,
+	}}
+}
+
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := appsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayv1.Install(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&appsv1alpha1.AIChatWorkspace{}, &appsv1alpha1.AIChatBackend{}, &appsv1alpha1.AIChatWorkspaceAPIKey{}).
+		WithIndex(&appsv1alpha1.AIChatWorkspace{}, workspaceNameField, func(obj client.Object) []string {
+			return []string{obj.(*appsv1alpha1.AIChatWorkspace).Spec.WorkspaceName}
+		}).
+		WithIndex(&appsv1alpha1.AIChatWorkspace{}, backendRefField, func(obj client.Object) []string {
+			workspace := obj.(*appsv1alpha1.AIChatWorkspace)
+			if backendMode(workspace) != appsv1alpha1.BackendModeShared {
+				return nil
+			}
+			return []string{backendRef(workspace).String()}
+		}).
+		WithIndex(&appsv1alpha1.AIChatWorkspaceAPIKey{}, workspaceRefField, func(obj client.Object) []string {
+			return []string{apiKeyWorkspaceRef(obj.(*appsv1alpha1.AIChatWorkspaceAPIKey)).String()}
+		}).
+		Build()
+}
+
+func TestOrphanSweeper(t *testing.T) {
+	longAgo := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	recently := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	workspace := &appsv1alpha1.AIChatWorkspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: constants.AIChatWorkspaceNamespace},
+		Spec:       appsv1alpha1.AIChatWorkspaceSpec{WorkspaceName: "team-a"},
+	}
+	adopted := workspaceNamespace("team-e", map[string]string{constants.OrphanedSinceAnnotation: longAgo})
+	delete(adopted.Annotations, constants.CreatedForAnnotation)
+	c := newFakeClient(t,
+		workspace,
+		adopted,
+		workspaceNamespace("team-a", map[string]string{constants.OrphanedSinceAnnotation: longAgo}),
+		workspaceNamespace("team-b", nil),
+		workspaceNamespace("team-c", map[string]string{constants.OrphanedSinceAnnotation: recently}),
+		workspaceNamespace("team-d", map[string]string{constants.OrphanedSinceAnnotation: longAgo}),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged"}},
+	)
+
+	sweeper := &OrphanSweeper{Client: c, GracePeriod: time.Hour, Delete: true}
+	sweeper.sweep(context.Background())
+
+	tests := []struct {
+		namespace string
+		deleted   bool
+		annotated bool
+	}{
+		{namespace: "team-a", annotated: false},
+		{namespace: "team-b", annotated: true},
+		{namespace: "team-c", annotated: true},
+		{namespace: "team-d", deleted: true},
+		{namespace: "team-e", annotated: true},
+		{namespace: "unmanaged", annotated: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			ns := &corev1.Namespace{}
+			err := c.Get(context.Background(), types.NamespacedName{Name: tt.namespace}, ns)
+			if tt.deleted {
+				if !apierrors.IsNotFound(err) {
+					t.Fatalf("expected the namespace to be deleted, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := ns.Annotations[constants.OrphanedSinceAnnotation]; ok != tt.annotated {
+				t.Errorf("orphaned-since annotation present = %v, want %v", ok, tt.annotated)
+			}
+		})
+	}
+}
+
+func TestOrphanSweeperReportOnly(t *testing.T) {
+	longAgo := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	c := newFakeClient(t, workspaceNamespace("team-d", map[string]string{constants.OrphanedSinceAnnotation: longAgo}))
+
+	sweeper := &OrphanSweeper{Client: c, GracePeriod: time.Hour}
+	sweeper.sweep(context.Background())
+
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "team-d"}, &corev1.Namespace{}); err != nil {
+		t.Fatalf("expected the namespace to be kept, got %v", err)
+	}
+}
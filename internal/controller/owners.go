@@ -0,0 +1,210 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=pods/portforward,verbs=create
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=get;list;watch
+
+/**
+ * Ensures the owners of spec.owners can debug the workspace and edit their AIChatWorkspace.
+ *
+ * The <workspaceName>-owner Role and RoleBinding of the workspace namespace let the owners read
+ * the pods, their logs, the events and the workloads, and port-forward to the pods. The
+ * <name>-owner Role and RoleBinding of the namespace of the AIChatWorkspace let them edit it,
+ * they are owned by the AIChatWorkspace. Without owners, the four objects are removed.
+ *
+ * The operator must hold the permissions it grants, see the rbac markers above.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose owners are granted access.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureOwners(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (*ctrl.Result, error) {
+	debugName := getName(instance.Spec.WorkspaceName, constants.OwnerName)
+	editorName := getName(instance.Name, constants.OwnerName)
+
+	owners := instance.Spec.Owners
+	if owners == nil || (len(owners.Users) == 0 && len(owners.Groups) == 0) {
+		for _, obj := range []struct{ namespace, name string }{
+			{instance.Spec.WorkspaceName, debugName},
+			{instance.Namespace, editorName},
+		} {
+			if err := r.deleteIfExists(ctx, &rbacv1.RoleBinding{}, obj.namespace, obj.name); err != nil {
+				return &ctrl.Result{}, err
+			}
+			if err := r.deleteIfExists(ctx, &rbacv1.Role{}, obj.namespace, obj.name); err != nil {
+				return &ctrl.Result{}, err
+			}
+		}
+		return nil, nil
+	}
+
+	roleLabels := defaultLabels(instance.Spec.WorkspaceName, debugName, constants.RoleLabelName)
+	result, err := r.ensureRole(ctx, instance, k8s.NewWorkspaceDebugRole(debugName, instance.Spec.WorkspaceName, roleLabels))
+	if result != nil {
+		return result, err
+	}
+	bindingLabels := defaultLabels(instance.Spec.WorkspaceName, debugName, constants.RoleBindingLabelName)
+	result, err = r.ensureRoleBinding(ctx, instance, k8s.NewRoleBinding(debugName, instance.Spec.WorkspaceName, debugName, owners.Users, owners.Groups, bindingLabels))
+	if result != nil {
+		return result, err
+	}
+
+	roleLabels = defaultLabels(instance.Spec.WorkspaceName, editorName, constants.RoleLabelName)
+	result, err = r.ensureRole(ctx, instance, k8s.NewWorkspaceEditorRole(editorName, instance.Namespace, instance.Name, roleLabels))
+	if result != nil {
+		return result, err
+	}
+	bindingLabels = defaultLabels(instance.Spec.WorkspaceName, editorName, constants.RoleBindingLabelName)
+	return r.ensureRoleBinding(ctx, instance, k8s.NewRoleBinding(editorName, instance.Namespace, editorName, owners.Users, owners.Groups, bindingLabels))
+}
+
+/**
+ * Ensures a Role exists with the desired rules.
+ *
+ * A Role of the workspace namespace is tracked by the workspace label, a Role of the namespace
+ * of the AIChatWorkspace is owned by it.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace the Role belongs to.
+ * @param role The desired Role.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureRole(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, role *rbacv1.Role) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	found := &rbacv1.Role{}
+	err := r.Get(ctx, types.NamespacedName{Name: role.Name, Namespace: role.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a Role", "Role.Namespace", role.Namespace, "Role.Name", role.Name)
+		if err := r.setRBACOwner(instance, role); err != nil {
+			return &ctrl.Result{}, err
+		}
+		if err := r.Create(ctx, role); err != nil {
+			logger.Error(err, "Failed to create Role", "Role.Namespace", role.Namespace, "Role.Name", role.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventCreated(instance, "Role", role)
+		return nil, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get Role")
+		return &ctrl.Result{}, err
+	}
+
+	if found.Namespace == instance.Spec.WorkspaceName {
+		if err := r.ensureTracked(ctx, instance, found); err != nil {
+			return &ctrl.Result{}, err
+		}
+	}
+
+	if !reflect.DeepEqual(found.Rules, role.Rules) {
+		logger.Info("Updating Role", "Role.Namespace", found.Namespace, "Role.Name", found.Name)
+		found.Rules = role.Rules
+		if err := r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to update Role", "Role.Namespace", found.Namespace, "Role.Name", found.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "Role", found)
+	}
+	return nil, nil
+}
+
+/**
+ * Ensures a RoleBinding exists with the desired subjects.
+ *
+ * A RoleBinding whose role changed is deleted and created again, its roleRef is immutable.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace the RoleBinding belongs to.
+ * @param binding The desired RoleBinding.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureRoleBinding(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, binding *rbacv1.RoleBinding) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	found := &rbacv1.RoleBinding{}
+	err := r.Get(ctx, types.NamespacedName{Name: binding.Name, Namespace: binding.Namespace}, found)
+	if err == nil && found.RoleRef != binding.RoleRef {
+		logger.Info("Deleting RoleBinding to change its role", "RoleBinding.Namespace", found.Namespace, "RoleBinding.Name", found.Name)
+		if err := r.Delete(ctx, found); err != nil && !errors.IsNotFound(err) {
+			return &ctrl.Result{}, err
+		}
+		err = errors.NewNotFound(rbacv1.Resource("rolebindings"), found.Name)
+	}
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a RoleBinding", "RoleBinding.Namespace", binding.Namespace, "RoleBinding.Name", binding.Name)
+		if err := r.setRBACOwner(instance, binding); err != nil {
+			return &ctrl.Result{}, err
+		}
+		if err := r.Create(ctx, binding); err != nil {
+			logger.Error(err, "Failed to create RoleBinding", "RoleBinding.Namespace", binding.Namespace, "RoleBinding.Name", binding.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventCreated(instance, "RoleBinding", binding)
+		return nil, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get RoleBinding")
+		return &ctrl.Result{}, err
+	}
+
+	if found.Namespace == instance.Spec.WorkspaceName {
+		if err := r.ensureTracked(ctx, instance, found); err != nil {
+			return &ctrl.Result{}, err
+		}
+	}
+
+	if !reflect.DeepEqual(found.Subjects, binding.Subjects) {
+		logger.Info("Updating RoleBinding", "RoleBinding.Namespace", found.Namespace, "RoleBinding.Name", found.Name)
+		found.Subjects = binding.Subjects
+		if err := r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to update RoleBinding", "RoleBinding.Namespace", found.Namespace, "RoleBinding.Name", found.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "RoleBinding", found)
+	}
+	return nil, nil
+}
+
+// setRBACOwner labels an object of the workspace namespace with the workspace, and makes an object
+// of the namespace of the AIChatWorkspace owned by it, so it is garbage collected with it.
+func (r *AIChatWorkspaceReconciler) setRBACOwner(instance *appsv1alpha1.AIChatWorkspace, obj client.Object) error {
+	if obj.GetNamespace() == instance.Spec.WorkspaceName {
+		setWorkspaceLabel(instance, obj)
+		return nil
+	}
+	return controllerutil.SetControllerReference(instance, obj, r.Scheme)
+}
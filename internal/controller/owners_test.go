@@ -0,0 +1,115 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func TestEnsureOwners(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Owners = &appsv1alpha1.OwnersSpec{Users: []string{"alice@example.com"}, Groups: []string{"team-a"}}
+	c := newFakeClient(t, workspace)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	if result, err := r.ensureOwners(ctx, workspace); result != nil {
+		t.Fatalf("ensureOwners() = %v, %v", result, err)
+	}
+
+	debug := types.NamespacedName{Name: "team-a-owner", Namespace: "team-a"}
+	editor := types.NamespacedName{Name: "team-a-owner", Namespace: constants.AIChatWorkspaceNamespace}
+
+	role := &rbacv1.Role{}
+	if err := c.Get(ctx, debug, role); err != nil {
+		t.Fatal(err)
+	}
+	if role.Labels[constants.WorkspaceLabelName] != "team-a" {
+		t.Errorf("labels of the debug Role = %v, want the workspace label", role.Labels)
+	}
+	if !hasRule(role.Rules, "pods/log", "get") || !hasRule(role.Rules, "pods/portforward", "create") || hasRule(role.Rules, "pods/exec", "create") {
+		t.Errorf("rules of the debug Role = %+v, want logs and port-forward but no exec", role.Rules)
+	}
+
+	if err := c.Get(ctx, editor, role); err != nil {
+		t.Fatal(err)
+	}
+	if len(role.Rules) == 0 || len(role.Rules[0].ResourceNames) != 1 || role.Rules[0].ResourceNames[0] != "team-a" {
+		t.Errorf("rules of the editor Role = %+v, want them limited to the team-a AIChatWorkspace", role.Rules)
+	}
+	if len(role.OwnerReferences) != 1 || role.OwnerReferences[0].Kind != "AIChatWorkspace" {
+		t.Errorf("owner references of the editor Role = %+v, want the AIChatWorkspace", role.OwnerReferences)
+	}
+
+	binding := &rbacv1.RoleBinding{}
+	for _, key := range []types.NamespacedName{debug, editor} {
+		if err := c.Get(ctx, key, binding); err != nil {
+			t.Fatal(err)
+		}
+		if binding.RoleRef.Name != "team-a-owner" || len(binding.Subjects) != 2 || binding.Subjects[0].Kind != rbacv1.UserKind || binding.Subjects[1].Kind != rbacv1.GroupKind {
+			t.Errorf("RoleBinding %s = %+v, want alice and the team-a group bound to team-a-owner", key, binding)
+		}
+	}
+
+	// a new owner is added to the bindings.
+	workspace.Spec.Owners.Users = append(workspace.Spec.Owners.Users, "bob@example.com")
+	if result, err := r.ensureOwners(ctx, workspace); result != nil {
+		t.Fatalf("ensureOwners() = %v, %v", result, err)
+	}
+	if err := c.Get(ctx, debug, binding); err != nil {
+		t.Fatal(err)
+	}
+	if len(binding.Subjects) != 3 {
+		t.Errorf("subjects = %+v, want bob added", binding.Subjects)
+	}
+
+	// removing the owners removes their access.
+	workspace.Spec.Owners = nil
+	if result, err := r.ensureOwners(ctx, workspace); result != nil {
+		t.Fatalf("ensureOwners() = %v, %v", result, err)
+	}
+	for _, key := range []types.NamespacedName{debug, editor} {
+		if err := c.Get(ctx, key, &rbacv1.RoleBinding{}); !apierrors.IsNotFound(err) {
+			t.Errorf("RoleBinding %s: %v, want it deleted", key, err)
+		}
+		if err := c.Get(ctx, key, &rbacv1.Role{}); !apierrors.IsNotFound(err) {
+			t.Errorf("Role %s: %v, want it deleted", key, err)
+		}
+	}
+}
+
+func hasRule(rules []rbacv1.PolicyRule, resource, verb string) bool {
+	for _, rule := range rules {
+		for _, r := range rule.Resources {
+			for _, v := range rule.Verbs {
+				if r == resource && v == verb {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
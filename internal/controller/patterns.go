@@ -0,0 +1,260 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ai/modelfiles"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/openwebui"
+)
+
+const (
+	// patternPromptTitlePrefix marks the Open WebUI prompts published by the operator.
+	patternPromptTitlePrefix = "fabric: "
+
+	// patternPresetIDPrefix marks the Open WebUI model presets published by the operator.
+	patternPresetIDPrefix = "fabric-"
+)
+
+// PatternPublishRetryInterval is how often the patterns are published again while publishing
+// failed. Open WebUI isn't watched, so nothing else reconciles the workspace once it recovers.
+const PatternPublishRetryInterval = time.Minute
+
+/**
+ * Ensures spec.patterns are published in Open WebUI as selected by spec.patternDelivery.
+ *
+ * With Prompts every pattern is a prompt used with /<pattern>, with ModelPresets every pattern is
+ * a model preset fabric-<pattern> built on the first model of spec.models, with the pattern as
+ * its system prompt. They are published with the admin of spec.bootstrap once Open WebUI is
+ * bootstrapped. The prompts and presets of the operator are recognised by their title and ID, the
+ * ones of a removed pattern or of the other delivery are deleted, the ones created in Open WebUI
+ * are left alone. With Modelfile the patterns are Ollama models, see createPersonas, and the
+ * prompts and presets published before are deleted.
+ *
+ * The outcome is recorded in the PatternsPublished condition. A failure to reach Open WebUI is
+ * reported there rather than failing or stopping the reconcile, the next steps still run and the
+ * patterns are published again after PatternPublishRetryInterval (see scheduledRequeue). Once
+ * published, they are published again when the generation changes.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose patterns are published.
+ * @param baseURL The URL of the Open WebUI Service.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensurePatterns(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, baseURL string) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	delivery := patternDelivery(instance)
+	current := apimeta.FindStatusCondition(instance.Status.Conditions, appsv1alpha1.ConditionTypePatternsPublished)
+	if delivery == appsv1alpha1.PatternDeliveryModelfile && current == nil {
+		return nil, nil
+	}
+	if current != nil && current.Status == metav1.ConditionTrue && current.ObservedGeneration == instance.GetGeneration() {
+		return nil, nil
+	}
+	// without an admin the prompts and presets can't be managed anymore, they are left as they are.
+	if instance.Spec.Bootstrap == nil {
+		if apimeta.RemoveStatusCondition(&instance.Status.Conditions, appsv1alpha1.ConditionTypePatternsPublished) {
+			return nil, r.patchStatus(ctx, instance)
+		}
+		return nil, nil
+	}
+	bootstrapped := apimeta.FindStatusCondition(instance.Status.Conditions, appsv1alpha1.ConditionTypeOpenWebUIBootstrapped)
+	if bootstrapped == nil || bootstrapped.Reason != appsv1alpha1.BootstrappedReason || bootstrapped.ObservedGeneration != instance.GetGeneration() {
+		return nil, r.setPatternsCondition(ctx, instance, metav1.ConditionFalse, appsv1alpha1.WaitingForOpenWebUIReason, "waiting for Open WebUI to be bootstrapped")
+	}
+
+	if err := r.publishPatterns(ctx, instance, baseURL, delivery); err != nil {
+		logger.Info("Unable to publish the patterns", "PatternDelivery", delivery, "error", err.Error())
+		if err := r.setPatternsCondition(ctx, instance, metav1.ConditionFalse, appsv1alpha1.PatternsPublishFailedReason, err.Error()); err != nil {
+			return &ctrl.Result{}, err
+		}
+		return nil, nil
+	}
+
+	if delivery == appsv1alpha1.PatternDeliveryModelfile {
+		apimeta.RemoveStatusCondition(&instance.Status.Conditions, appsv1alpha1.ConditionTypePatternsPublished)
+		return nil, r.patchStatus(ctx, instance)
+	}
+	logger.Info("Patterns published", "PatternDelivery", delivery, "Patterns", len(instance.Spec.Patterns))
+	return nil, r.setPatternsCondition(ctx, instance, metav1.ConditionTrue, appsv1alpha1.PatternsPublishedReason,
+		fmt.Sprintf("%d patterns are published as %s", len(instance.Spec.Patterns), delivery))
+}
+
+// publishPatterns publishes the patterns as prompts or presets and deletes the other managed ones.
+func (r *AIChatWorkspaceReconciler) publishPatterns(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, baseURL string, delivery appsv1alpha1.PatternDelivery) error {
+	_, email, password, err := r.adminCredentials(ctx, instance)
+	if err != nil {
+		return err
+	}
+	session, err := openwebui.SignIn(baseURL, email, password)
+	if err != nil {
+		return fmt.Errorf("unable to sign the admin in: %w", err)
+	}
+
+	var prompts, presets []string
+	switch delivery {
+	case appsv1alpha1.PatternDeliveryPrompts:
+		prompts = instance.Spec.Patterns
+	case appsv1alpha1.PatternDeliveryModelPresets:
+		presets = instance.Spec.Patterns
+	}
+	if err := syncPatternPrompts(baseURL, session.Token, prompts); err != nil {
+		return err
+	}
+	var baseModel string
+	if len(instance.Spec.Models) > 0 {
+		baseModel = instance.Spec.Models[0].ServedName()
+	}
+	return syncPatternPresets(baseURL, session.Token, baseModel, presets)
+}
+
+// syncPatternPrompts publishes a prompt for every pattern and deletes the other prompts of the operator.
+func syncPatternPrompts(baseURL, token string, patterns []string) error {
+	existing, err := openwebui.ListPrompts(baseURL, token)
+	if err != nil {
+		return fmt.Errorf("unable to list the prompts: %w", err)
+	}
+	published := map[string]openwebui.Prompt{}
+	for _, prompt := range existing {
+		published[prompt.Command] = prompt
+	}
+
+	var errs error
+	wanted := map[string]bool{}
+	for _, pattern := range patterns {
+		content, err := modelfiles.SystemPrompt(pattern)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		prompt := openwebui.Prompt{Command: "/" + pattern, Title: patternPromptTitlePrefix + pattern, Content: content}
+		wanted[prompt.Command] = true
+		previous, exists := published[prompt.Command]
+		if exists && previous == prompt {
+			continue
+		}
+		if exists && !strings.HasPrefix(previous.Title, patternPromptTitlePrefix) {
+			errs = errors.Join(errs, fmt.Errorf("the prompt %s already exists and isn't managed by the operator", prompt.Command))
+			continue
+		}
+		if err := openwebui.SavePrompt(baseURL, token, prompt, exists); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("unable to publish the prompt %s: %w", prompt.Command, err))
+		}
+	}
+
+	for _, prompt := range existing {
+		if wanted[prompt.Command] || !strings.HasPrefix(prompt.Title, patternPromptTitlePrefix) {
+			continue
+		}
+		if err := openwebui.DeletePrompt(baseURL, token, prompt.Command); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("unable to delete the prompt %s: %w", prompt.Command, err))
+		}
+	}
+	return errs
+}
+
+// syncPatternPresets publishes a model preset on baseModel for every pattern and deletes the other presets of the operator.
+func syncPatternPresets(baseURL, token, baseModel string, patterns []string) error {
+	existing, err := openwebui.ListModelPresets(baseURL, token)
+	if err != nil {
+		return fmt.Errorf("unable to list the model presets: %w", err)
+	}
+	published := map[string]openwebui.ModelPreset{}
+	for _, preset := range existing {
+		published[preset.ID] = preset
+	}
+
+	var errs error
+	if len(patterns) > 0 && baseModel == "" {
+		errs = errors.Join(errs, errors.New("the model presets need a model in spec.models"))
+		patterns = nil
+	}
+	wanted := map[string]bool{}
+	for _, pattern := range patterns {
+		system, err := modelfiles.SystemPrompt(pattern)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		preset := openwebui.ModelPreset{
+			ID:          patternPresetIDPrefix + pattern,
+			BaseModelID: baseModel,
+			Name:        pattern,
+			Description: "fabric pattern " + pattern + " on " + baseModel,
+			System:      system,
+		}
+		wanted[preset.ID] = true
+		previous, exists := published[preset.ID]
+		if exists && previous == preset {
+			continue
+		}
+		if err := openwebui.SaveModelPreset(baseURL, token, preset, exists); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("unable to publish the model preset %s: %w", preset.ID, err))
+		}
+	}
+
+	for _, preset := range existing {
+		if wanted[preset.ID] || !strings.HasPrefix(preset.ID, patternPresetIDPrefix) {
+			continue
+		}
+		if err := openwebui.DeleteModelPreset(baseURL, token, preset.ID); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("unable to delete the model preset %s: %w", preset.ID, err))
+		}
+	}
+	return errs
+}
+
+// patternDelivery returns spec.patternDelivery, Modelfile when it's not set.
+func patternDelivery(instance *appsv1alpha1.AIChatWorkspace) appsv1alpha1.PatternDelivery {
+	if instance.Spec.PatternDelivery == "" {
+		return appsv1alpha1.PatternDeliveryModelfile
+	}
+	return instance.Spec.PatternDelivery
+}
+
+// patternsPublishFailed reports whether the last publish of the patterns failed.
+func patternsPublishFailed(instance *appsv1alpha1.AIChatWorkspace) bool {
+	condition := apimeta.FindStatusCondition(instance.Status.Conditions, appsv1alpha1.ConditionTypePatternsPublished)
+	return condition != nil && condition.Status == metav1.ConditionFalse && condition.Reason == appsv1alpha1.PatternsPublishFailedReason
+}
+
+// setPatternsCondition sets the PatternsPublished condition, the status is only patched when it changes.
+func (r *AIChatWorkspaceReconciler) setPatternsCondition(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, status metav1.ConditionStatus, reason, message string) error {
+	changed := apimeta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypePatternsPublished,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: instance.GetGeneration(),
+	})
+	if !changed {
+		return nil
+	}
+	return r.patchStatus(ctx, instance)
+}
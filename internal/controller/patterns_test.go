@@ -0,0 +1,205 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/openwebui"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/inference"
+)
+
+func TestEnsurePatterns(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+	webui.passwords["admin@example.com"] = "s3cret"
+	webui.roles["admin@example.com"] = "admin"
+	webui.prompts["/standup"] = openwebui.Prompt{Command: "/standup", Title: "Standup", Content: "What did you do?"}
+	webui.prompts["/ai"] = openwebui.Prompt{Command: "/ai", Title: "fabric: ai", Content: "outdated"}
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Models = []appsv1alpha1.ModelSpec{{Name: "llama3.2:1b"}}
+	workspace.Spec.Patterns = []string{"summarize", "extract_wisdom"}
+	workspace.Spec.PatternDelivery = appsv1alpha1.PatternDeliveryPrompts
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin"}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	c := newFakeClient(t, workspace, admin)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	// the patterns wait for the bootstrap.
+	if result, err := r.ensurePatterns(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensurePatterns() = %v, %v", result, err)
+	}
+	assertPatternsCondition(t, workspace, metav1.ConditionFalse, appsv1alpha1.WaitingForOpenWebUIReason)
+
+	setBootstrapped(workspace, 1)
+	if result, err := r.ensurePatterns(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensurePatterns() = %v, %v", result, err)
+	}
+	assertPatternsCondition(t, workspace, metav1.ConditionTrue, appsv1alpha1.PatternsPublishedReason)
+	if got := slices.Sorted(maps.Keys(webui.prompts)); !slices.Equal(got, []string{"/extract_wisdom", "/standup", "/summarize"}) {
+		t.Errorf("prompts = %v, want /extract_wisdom, /standup and /summarize", got)
+	}
+	summarize := webui.prompts["/summarize"]
+	if summarize.Title != "fabric: summarize" || !strings.Contains(summarize.Content, "# IDENTITY") {
+		t.Errorf("prompt /summarize = %+v, want the fabric pattern", summarize)
+	}
+
+	// switching to model presets replaces the prompts with presets on the first model.
+	workspace.Spec.PatternDelivery = appsv1alpha1.PatternDeliveryModelPresets
+	workspace.Spec.Patterns = []string{"summarize"}
+	workspace.Generation = 2
+	if err := c.Update(ctx, workspace); err != nil {
+		t.Fatal(err)
+	}
+	setBootstrapped(workspace, 2)
+	if result, err := r.ensurePatterns(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensurePatterns() = %v, %v", result, err)
+	}
+	assertPatternsCondition(t, workspace, metav1.ConditionTrue, appsv1alpha1.PatternsPublishedReason)
+	if got := slices.Sorted(maps.Keys(webui.prompts)); !slices.Equal(got, []string{"/standup"}) {
+		t.Errorf("prompts = %v, want only /standup", got)
+	}
+	preset, ok := webui.presets["fabric-summarize"]
+	if !ok || len(webui.presets) != 1 || preset.BaseModelID != "llama3.2:1b" || preset.Params.System != summarize.Content {
+		t.Errorf("presets = %+v, want fabric-summarize on llama3.2:1b", webui.presets)
+	}
+
+	// back to modelfiles, the presets are deleted and the condition removed.
+	workspace.Spec.PatternDelivery = appsv1alpha1.PatternDeliveryModelfile
+	workspace.Generation = 3
+	if err := c.Update(ctx, workspace); err != nil {
+		t.Fatal(err)
+	}
+	setBootstrapped(workspace, 3)
+	if result, err := r.ensurePatterns(ctx, workspace, webui.URL); result != nil {
+		t.Fatalf("ensurePatterns() = %v, %v", result, err)
+	}
+	if len(webui.presets) != 0 {
+		t.Errorf("presets = %+v, want none", webui.presets)
+	}
+	if condition := apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypePatternsPublished); condition != nil {
+		t.Errorf("condition = %+v, want none", condition)
+	}
+}
+
+func TestEnsurePatternsUnknownPattern(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+	webui.passwords["admin@example.com"] = "s3cret"
+	webui.roles["admin@example.com"] = "admin"
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Patterns = []string{"summarize", "not_a_pattern"}
+	workspace.Spec.PatternDelivery = appsv1alpha1.PatternDeliveryPrompts
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin"}
+	setBootstrapped(workspace, 1)
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	c := newFakeClient(t, workspace, admin)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	// a failed publish is retried after a delay, Open WebUI isn't watched.
+	if result, err := r.ensurePatterns(context.Background(), workspace, webui.URL); result != nil {
+		t.Fatalf("ensurePatterns() = %v, %v", result, err)
+	}
+	if requeue := scheduledRequeue(workspace); requeue != PatternPublishRetryInterval {
+		t.Errorf("scheduledRequeue() = %s, want %s", requeue, PatternPublishRetryInterval)
+	}
+	assertPatternsCondition(t, workspace, metav1.ConditionFalse, appsv1alpha1.PatternsPublishFailedReason)
+	if _, ok := webui.prompts["/summarize"]; !ok {
+		t.Errorf("prompts = %v, want /summarize published", webui.prompts)
+	}
+
+	// the retry of a failed publish, here with Open WebUI unreachable, keeps requeueing.
+	webui.Close()
+	if result, err := r.ensurePatterns(context.Background(), workspace, webui.URL); result != nil {
+		t.Fatalf("ensurePatterns() = %v, %v", result, err)
+	}
+	if requeue := scheduledRequeue(workspace); requeue != PatternPublishRetryInterval {
+		t.Errorf("scheduledRequeue() = %s, want %s", requeue, PatternPublishRetryInterval)
+	}
+	assertPatternsCondition(t, workspace, metav1.ConditionFalse, appsv1alpha1.PatternsPublishFailedReason)
+}
+
+func TestEnsureWorkspaceAccessWithFailedPatterns(t *testing.T) {
+	webui := newFakeOpenWebUI(t)
+	webui.passwords["admin@example.com"] = "s3cret"
+	webui.roles["admin@example.com"] = "admin"
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Generation = 1
+	workspace.Spec.Patterns = []string{"not_a_pattern"}
+	workspace.Spec.PatternDelivery = appsv1alpha1.PatternDeliveryPrompts
+	workspace.Spec.Bootstrap = &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin"}
+	setBootstrapped(workspace, 1)
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-admin", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{"email": []byte("admin@example.com"), "password": []byte("s3cret")},
+	}
+	c := newFakeClient(t, workspace, admin)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+	ctx := context.Background()
+
+	if result, err := r.ensureWorkspaceAccess(ctx, workspace, inference.Ollama{}, testConfig(t), webui.URL); result != nil {
+		t.Fatalf("ensureWorkspaceAccess() = %v, %v", result, err)
+	}
+	assertPatternsCondition(t, workspace, metav1.ConditionFalse, appsv1alpha1.PatternsPublishFailedReason)
+	// the steps after the patterns still run.
+	if err := c.Get(ctx, types.NamespacedName{Name: "team-a-openwebui", Namespace: "team-a"}, &networkingv1.Ingress{}); err != nil {
+		t.Errorf("the Open WebUI Ingress should be reconciled while the patterns fail to publish: %v", err)
+	}
+	if requeue := scheduledRequeue(workspace); requeue != PatternPublishRetryInterval {
+		t.Errorf("scheduledRequeue() = %s, want %s", requeue, PatternPublishRetryInterval)
+	}
+}
+
+// setBootstrapped marks Open WebUI as bootstrapped for a generation.
+func setBootstrapped(workspace *appsv1alpha1.AIChatWorkspace, generation int64) {
+	apimeta.SetStatusCondition(&workspace.Status.Conditions, metav1.Condition{
+		Type:               appsv1alpha1.ConditionTypeOpenWebUIBootstrapped,
+		Status:             metav1.ConditionTrue,
+		Reason:             appsv1alpha1.BootstrappedReason,
+		ObservedGeneration: generation,
+	})
+}
+
+func assertPatternsCondition(t *testing.T, workspace *appsv1alpha1.AIChatWorkspace, status metav1.ConditionStatus, reason string) {
+	t.Helper()
+	condition := apimeta.FindStatusCondition(workspace.Status.Conditions, appsv1alpha1.ConditionTypePatternsPublished)
+	if condition == nil || condition.Status != status || condition.Reason != reason {
+		t.Fatalf("condition = %+v, want %s/%s", condition, status, reason)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/openai"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// ProviderCheckInterval is how often the models of a connected provider are listed again.
+const ProviderCheckInterval = 5 * time.Minute
+
+/**
+ * Ensures the external providers of spec.providers are offered in Open WebUI and reports their
+ * connectivity in status.providers.
+ *
+ * The API keys are copied from the namespace of the AIChatWorkspace into the <workspaceName>-providers
+ * Secret of the workspace namespace, read by Open WebUI as OPENAI_API_KEYS. The namespace of the
+ * AIChatWorkspace is shared by the workspaces, so only the Secrets labelled for the workspace with
+ * aichatworkspaces.io/provider-key=<workspaceName> are read. A provider whose key can't be read is
+ * still offered, without a key, and reported Failed. Connected providers are
+ * checked again every ProviderCheckInterval, the others on every reconcile.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace whose providers are configured.
+ * @param deployment The Open WebUI Deployment, updated with the providers before it is ensured.
+ * @return A ctrl.Result and an error, or nil if no further reconciliation is needed.
+ */
+func (r *AIChatWorkspaceReconciler) ensureProviders(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, deployment *appsv1.Deployment) (*ctrl.Result, error) {
+	secretName := getName(instance.Spec.WorkspaceName, constants.ProvidersName)
+	if len(instance.Spec.Providers) == 0 {
+		if err := r.deleteIfExists(ctx, &corev1.Secret{}, instance.Spec.WorkspaceName, secretName); err != nil {
+			return &ctrl.Result{}, err
+		}
+		if len(instance.Status.Providers) > 0 {
+			instance.Status.Providers = nil
+			if err := r.patchStatus(ctx, instance); err != nil {
+				return &ctrl.Result{}, err
+			}
+		}
+		return nil, nil
+	}
+
+	baseURLs := make([]string, 0, len(instance.Spec.Providers))
+	// the first key is the one of the inference server of the workspace, which has none.
+	keys := []string{""}
+	keyErrors := map[string]error{}
+	for _, provider := range instance.Spec.Providers {
+		key, err := r.providerKey(ctx, instance, provider)
+		if err != nil && !apierrors.IsNotFound(err) && !errors.Is(err, errProviderKeyMissing) {
+			return &ctrl.Result{}, err
+		}
+		keyErrors[provider.Name] = err
+		baseURLs = append(baseURLs, provider.BaseURL)
+		keys = append(keys, key)
+	}
+
+	joined := strings.Join(keys, ";")
+	data := map[string][]byte{constants.ProvidersKeysSecretKey: []byte(joined)}
+	secretLabels := defaultLabels(instance.Spec.WorkspaceName, secretName, constants.SecretLabelName)
+	result, err := r.ensureSecret(ctx, instance, k8s.NewSecret(secretName, instance.Spec.WorkspaceName, data, secretLabels))
+	if result != nil {
+		return result, err
+	}
+	sum := sha256.Sum256([]byte(joined))
+	k8s.AddOpenAIProviders(deployment, baseURLs, secretName, hex.EncodeToString(sum[:8]))
+
+	previous := map[string]appsv1alpha1.ProviderStatus{}
+	for _, status := range instance.Status.Providers {
+		previous[status.Name] = status
+	}
+	statuses := make([]appsv1alpha1.ProviderStatus, 0, len(instance.Spec.Providers))
+	for i, provider := range instance.Spec.Providers {
+		status := previous[provider.Name]
+		switch {
+		case keyErrors[provider.Name] != nil:
+			status = appsv1alpha1.ProviderStatus{
+				Name:    provider.Name,
+				State:   appsv1alpha1.ProviderStateFailed,
+				Message: keyErrors[provider.Name].Error(),
+			}
+		case status.State != appsv1alpha1.ProviderStateConnected || updateCheckDue(status.LastCheck, ProviderCheckInterval):
+			status = checkProvider(provider, keys[i+1])
+		}
+		r.eventProviderState(ctx, instance, previous[provider.Name], status)
+		statuses = append(statuses, status)
+	}
+
+	if !equality.Semantic.DeepEqual(instance.Status.Providers, statuses) {
+		instance.Status.Providers = statuses
+		if err := r.patchStatus(ctx, instance); err != nil {
+			return &ctrl.Result{}, fmt.Errorf("unable to patch status.providers: %w", err)
+		}
+	}
+	return nil, nil
+}
+
+// errProviderKeyMissing is returned by providerKey when the Secret has no key under SecretKey, or
+// isn't labelled for the workspace.
+var errProviderKeyMissing = errors.New("the provider Secret has no API key")
+
+// providerKey reads the API key of a provider from a Secret of the namespace of the AIChatWorkspace
+// labelled for the workspace. Other Secrets are refused, the key is sent to the provider URL.
+func (r *AIChatWorkspaceReconciler) providerKey(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, provider appsv1alpha1.ProviderSpec) (string, error) {
+	if provider.SecretName == "" {
+		return "", nil
+	}
+	secretKey := provider.SecretKey
+	if secretKey == "" {
+		secretKey = constants.APIKeySecretKey
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: provider.SecretName, Namespace: instance.Namespace}, secret); err != nil {
+		return "", fmt.Errorf("unable to read the API key of provider %s: %w", provider.Name, err)
+	}
+	if secret.Labels[constants.ProviderKeyLabel] != instance.Spec.WorkspaceName {
+		return "", fmt.Errorf("%w: %s/%s isn't labelled %s=%s", errProviderKeyMissing, instance.Namespace, provider.SecretName, constants.ProviderKeyLabel, instance.Spec.WorkspaceName)
+	}
+	key, ok := secret.Data[secretKey]
+	if !ok || len(key) == 0 {
+		return "", fmt.Errorf("%w: %s/%s has no %q key", errProviderKeyMissing, instance.Namespace, provider.SecretName, secretKey)
+	}
+	// the keys are joined with ;, a key holding one would shift the keys of the next providers.
+	if strings.ContainsAny(string(key), ";\n") {
+		return "", fmt.Errorf("%w: the key in %s/%s contains a ; or a newline", errProviderKeyMissing, instance.Namespace, provider.SecretName)
+	}
+	return string(key), nil
+}
+
+// checkProvider lists the models of a provider and compares them to its allow-list.
+func checkProvider(provider appsv1alpha1.ProviderSpec, key string) appsv1alpha1.ProviderStatus {
+	now := metav1.Now()
+	status := appsv1alpha1.ProviderStatus{Name: provider.Name, State: appsv1alpha1.ProviderStateConnected, LastCheck: &now}
+
+	served, err := openai.ListModels(provider.BaseURL, key)
+	if err != nil {
+		status.State, status.Message = appsv1alpha1.ProviderStateFailed, err.Error()
+		return status
+	}
+	status.ServedModels = int32(len(served))
+	for _, model := range provider.Models {
+		if !slices.Contains(served, model) {
+			status.MissingModels = append(status.MissingModels, model)
+		}
+	}
+	if len(status.MissingModels) > 0 {
+		status.State = appsv1alpha1.ProviderStateFailed
+		status.Message = fmt.Sprintf("the provider doesn't serve %s", strings.Join(status.MissingModels, ", "))
+	}
+	return status
+}
+
+// eventProviderState records the providers becoming connected or failing.
+func (r *AIChatWorkspaceReconciler) eventProviderState(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, previous, status appsv1alpha1.ProviderStatus) {
+	if previous.State == status.State && previous.Message == status.Message {
+		return
+	}
+	switch status.State {
+	case appsv1alpha1.ProviderStateConnected:
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, EventReasonProviderConnected, "Provider %s serves %d models", status.Name, status.ServedModels)
+	case appsv1alpha1.ProviderStateFailed:
+		log.FromContext(ctx).Info("Provider check failed", "Provider", status.Name, "Message", status.Message)
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonProviderFailed, "Provider %s: %s", status.Name, status.Message)
+	}
+}
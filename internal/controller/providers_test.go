@@ -0,0 +1,175 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func TestEnsureProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer sk-team-a" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o"},{"id":"gpt-4o-mini"}]}`))
+	}))
+	defer server.Close()
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Providers = []appsv1alpha1.ProviderSpec{
+		{Name: "openai", BaseURL: server.URL + "/v1", SecretName: "openai-key", Models: []string{"gpt-4o"}},
+		{Name: "azure", BaseURL: "https://azure.example.com/v1", SecretName: "azure-key"},
+	}
+	key := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "openai-key",
+			Namespace: workspace.Namespace,
+			Labels:    map[string]string{constants.ProviderKeyLabel: "team-a"},
+		},
+		Data: map[string][]byte{constants.APIKeySecretKey: []byte("sk-team-a")},
+	}
+	c := newFakeClient(t, workspace, key)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	deployment := k8s.NewDeployment("team-a", "team-a-openwebui", constants.OpenwebuiContainerPort, "open-webui:main", "cluster.local")
+	if result, err := r.ensureProviders(context.Background(), workspace, deployment); result != nil {
+		t.Fatalf("ensureProviders() = %v, %v", result, err)
+	}
+
+	env := map[string]corev1.EnvVar{}
+	for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e
+	}
+	if _, ok := env["OPENAI_API_BASE_URL"]; ok {
+		t.Error("OPENAI_API_BASE_URL is set, want OPENAI_API_BASE_URLS")
+	}
+	want := "http://team-a-ollama.team-a.svc.cluster.local:11434/v1;" + server.URL + "/v1;https://azure.example.com/v1"
+	if got := env["OPENAI_API_BASE_URLS"].Value; got != want {
+		t.Errorf("OPENAI_API_BASE_URLS = %q, want %q", got, want)
+	}
+	if ref := env["OPENAI_API_KEYS"].ValueFrom; ref == nil || ref.SecretKeyRef.Name != "team-a-providers" {
+		t.Errorf("OPENAI_API_KEYS = %+v, want a reference to the team-a-providers Secret", env["OPENAI_API_KEYS"])
+	}
+
+	keys := &corev1.Secret{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "team-a-providers", Namespace: "team-a"}, keys); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(keys.Data[constants.ProvidersKeysSecretKey]); got != ";sk-team-a;" {
+		t.Errorf("OPENAI_API_KEYS = %q, want the keys in the order of the URLs", got)
+	}
+
+	statuses := map[string]appsv1alpha1.ProviderStatus{}
+	for _, status := range workspace.Status.Providers {
+		statuses[status.Name] = status
+	}
+	if openai := statuses["openai"]; openai.State != appsv1alpha1.ProviderStateConnected || openai.ServedModels != 2 || openai.LastCheck == nil {
+		t.Errorf("status of openai = %+v, want Connected with 2 models", openai)
+	}
+	if azure := statuses["azure"]; azure.State != appsv1alpha1.ProviderStateFailed || azure.LastCheck != nil {
+		t.Errorf("status of azure = %+v, want Failed without a check, its Secret is missing", azure)
+	}
+
+	// a model of the allow-list the provider doesn't serve fails the check.
+	workspace.Spec.Providers = workspace.Spec.Providers[:1]
+	workspace.Spec.Providers[0].Models = []string{"gpt-4o", "o3"}
+	workspace.Status.Providers[0].LastCheck = nil
+	if result, err := r.ensureProviders(context.Background(), workspace, deployment); result != nil {
+		t.Fatalf("ensureProviders() = %v, %v", result, err)
+	}
+	if openai := workspace.Status.Providers[0]; openai.State != appsv1alpha1.ProviderStateFailed || len(openai.MissingModels) != 1 || openai.MissingModels[0] != "o3" {
+		t.Errorf("status of openai = %+v, want Failed with o3 missing", openai)
+	}
+
+	// removing the providers removes their keys.
+	workspace.Spec.Providers = nil
+	if result, err := r.ensureProviders(context.Background(), workspace, deployment); result != nil {
+		t.Fatalf("ensureProviders() = %v, %v", result, err)
+	}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "team-a-providers", Namespace: "team-a"}, keys); !apierrors.IsNotFound(err) {
+		t.Errorf("Secret team-a-providers: %v, want it deleted", err)
+	}
+	if len(workspace.Status.Providers) != 0 {
+		t.Errorf("status.providers = %+v, want it cleared", workspace.Status.Providers)
+	}
+}
+
+func TestEnsureProvidersRefusesUnlabelledSecrets(t *testing.T) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"object":"list","data":[]}`))
+	}))
+	defer server.Close()
+
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.Spec.Providers = []appsv1alpha1.ProviderSpec{
+		{Name: "operator", BaseURL: server.URL + "/v1", SecretName: "operator-credentials"},
+		{Name: "team-b", BaseURL: server.URL + "/v1", SecretName: "team-b-key"},
+	}
+	// a Secret of the operator namespace, and the key of another workspace.
+	operatorSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator-credentials", Namespace: workspace.Namespace},
+		Data:       map[string][]byte{constants.APIKeySecretKey: []byte("operator-token")},
+	}
+	otherKey := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "team-b-key",
+			Namespace: workspace.Namespace,
+			Labels:    map[string]string{constants.ProviderKeyLabel: "team-b"},
+		},
+		Data: map[string][]byte{constants.APIKeySecretKey: []byte("sk-team-b")},
+	}
+	c := newFakeClient(t, workspace, operatorSecret, otherKey)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(20)}
+
+	deployment := k8s.NewDeployment("team-a", "team-a-openwebui", constants.OpenwebuiContainerPort, "open-webui:main", "cluster.local")
+	if result, err := r.ensureProviders(context.Background(), workspace, deployment); result != nil {
+		t.Fatalf("ensureProviders() = %v, %v", result, err)
+	}
+
+	keys := &corev1.Secret{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "team-a-providers", Namespace: "team-a"}, keys); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(keys.Data[constants.ProvidersKeysSecretKey]); got != ";;" {
+		t.Errorf("OPENAI_API_KEYS = %q, want no key copied", got)
+	}
+	if len(authorization) != 0 {
+		t.Errorf("the providers were called with %v, want no call", authorization)
+	}
+	for _, status := range workspace.Status.Providers {
+		if status.State != appsv1alpha1.ProviderStateFailed || !strings.Contains(status.Message, constants.ProviderKeyLabel) {
+			t.Errorf("status of %s = %+v, want Failed on the missing label", status.Name, status)
+		}
+	}
+}
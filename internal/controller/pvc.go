@@ -23,7 +23,6 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
@@ -46,7 +45,7 @@ func (r *AIChatWorkspaceReconciler) ensurePVC(ctx context.Context, instance *app
 
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new PVC", "PVC.Namespace", instance.Spec.WorkspaceName, "PVC.Name", pvc.Name)
-		controllerutil.SetControllerReference(instance, pvc, r.Scheme)
+		setWorkspaceLabel(instance, pvc)
 		err = r.Create(context.TODO(), pvc)
 
 		if err != nil {
@@ -54,6 +53,7 @@ func (r *AIChatWorkspaceReconciler) ensurePVC(ctx context.Context, instance *app
 			return &ctrl.Result{}, err
 		}
 
+		r.eventCreated(instance, "PersistentVolumeClaim", pvc)
 		return nil, nil
 
 	} else if err != nil {
@@ -62,5 +62,9 @@ func (r *AIChatWorkspaceReconciler) ensurePVC(ctx context.Context, instance *app
 		return &ctrl.Result{}, err
 	}
 
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
 	return nil, nil
 }
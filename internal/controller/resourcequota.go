@@ -18,12 +18,15 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
@@ -32,8 +35,9 @@ import (
 /**
  * Ensures a resource quota exists for the given AIChatWorkspace instance.
  *
- * If the resource quota does not exist, it will be created. If it already exists,
- * this function will do nothing.
+ * If the resource quota does not exist, it will be created. If it already exists, its limits are
+ * updated to the desired ones, and a QuotaExceeded warning is recorded on the instance when one
+ * of them is used up.
  *
  * @param ctx The context in which to perform the operation.
  * @param instance The AIChatWorkspace instance for which to ensure a resource quota.
@@ -53,7 +57,7 @@ func (r *AIChatWorkspaceReconciler) ensureResourceQuota(ctx context.Context, ins
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a resource quota", "ResourceQuota.Namespace", instance.Spec.WorkspaceName, "ResourceQuota.Name", rq.Name)
 
-		controllerutil.SetControllerReference(instance, rq, r.Scheme)
+		setWorkspaceLabel(instance, rq)
 		err = r.Create(context.TODO(), rq)
 
 		if err != nil {
@@ -61,6 +65,7 @@ func (r *AIChatWorkspaceReconciler) ensureResourceQuota(ctx context.Context, ins
 			return &ctrl.Result{}, err
 		}
 
+		r.eventCreated(instance, "ResourceQuota", rq)
 		return nil, nil
 
 	} else if err != nil {
@@ -69,5 +74,36 @@ func (r *AIChatWorkspaceReconciler) ensureResourceQuota(ctx context.Context, ins
 		return &ctrl.Result{}, err
 	}
 
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if !equality.Semantic.DeepEqual(found.Spec.Hard, rq.Spec.Hard) {
+		found.Spec.Hard = rq.Spec.Hard
+		if err = r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to update resource quota", "ResourceQuota.Namespace", found.Namespace, "ResourceQuota.Name", found.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "ResourceQuota", found)
+	}
+
+	if exhausted := exhaustedResources(found); len(exhausted) > 0 {
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, EventReasonQuotaExceeded,
+			"ResourceQuota %s is used up: %s", objectName(found), strings.Join(exhausted, ", "))
+	}
+
 	return nil, nil
 }
+
+// exhaustedResources returns the resources of the quota whose usage reached the hard limit.
+func exhaustedResources(rq *corev1.ResourceQuota) []string {
+	var exhausted []string
+	for name, hard := range rq.Status.Hard {
+		used, ok := rq.Status.Used[name]
+		if ok && used.Cmp(hard) >= 0 {
+			exhausted = append(exhausted, fmt.Sprintf("%s %s/%s", name, used.String(), hard.String()))
+		}
+	}
+	sort.Strings(exhausted)
+	return exhausted
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+)
+
+// ensureSecret ensures that the specified Secret exists in the workspace namespace
+// and holds the desired data.
+//
+// If the Secret does not exist, it is created. If it exists with different data, the
+// data is replaced. If an error occurs during this process, it logs the error and returns it.
+func (r *AIChatWorkspaceReconciler) ensureSecret(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, secret *corev1.Secret) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	found := &corev1.Secret{}
+
+	err := r.Get(context.TODO(), types.NamespacedName{
+		Name:      secret.Name,
+		Namespace: instance.Spec.WorkspaceName,
+	}, found)
+
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a Secret", "Secret.Namespace", instance.Spec.WorkspaceName, "Secret.Name", secret.Name)
+
+		setWorkspaceLabel(instance, secret)
+		err = r.Create(context.TODO(), secret)
+		if err != nil {
+			logger.Error(err, "Failed to create Secret", "Secret.Namespace", instance.Spec.WorkspaceName, "Secret.Name", secret.Name)
+
+			return &ctrl.Result{}, err
+		}
+
+		r.eventCreated(instance, "Secret", secret)
+		return nil, nil
+
+	} else if err != nil {
+		logger.Error(err, "Failed to get Secret")
+
+		return &ctrl.Result{}, err
+	}
+
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if !reflect.DeepEqual(found.Data, secret.Data) {
+		logger.Info("Updating Secret", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+		found.Data = secret.Data
+		if err = r.Update(context.TODO(), found); err != nil {
+			logger.Error(err, "Failed to update Secret", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "Secret", found)
+	}
+
+	return nil, nil
+}
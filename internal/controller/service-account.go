@@ -23,7 +23,6 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
@@ -53,7 +52,7 @@ func (r *AIChatWorkspaceReconciler) ensureServiceAccount(ctx context.Context, in
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a ServiceAccount", "ServiceAccount.Namespace", instance.Spec.WorkspaceName, "ServiceAccount.Name", sa.Name)
 
-		controllerutil.SetControllerReference(instance, sa, r.Scheme)
+		setWorkspaceLabel(instance, sa)
 		err = r.Create(context.TODO(), sa)
 
 		if err != nil {
@@ -62,6 +61,7 @@ func (r *AIChatWorkspaceReconciler) ensureServiceAccount(ctx context.Context, in
 			return &ctrl.Result{}, err
 		}
 
+		r.eventCreated(instance, "ServiceAccount", sa)
 		return nil, nil
 
 	} else if err != nil {
@@ -70,5 +70,9 @@ func (r *AIChatWorkspaceReconciler) ensureServiceAccount(ctx context.Context, in
 		return &ctrl.Result{}, err
 	}
 
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
 	return nil, nil
 }
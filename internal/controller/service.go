@@ -18,20 +18,21 @@ package controller
 
 import (
 	"context"
+	"slices"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
 )
 
 // ensureService ensures that the specified Service exists in the cluster.
-// If it does not exist, it creates a new one. If an error occurs during this process,
-// it returns the error and logs it.
+// If it does not exist, it creates a new one. The ports of an existing Service are updated,
+// they change when the workspace switches its inference engine. If an error occurs during
+// this process, it returns the error and logs it.
 func (r *AIChatWorkspaceReconciler) ensureService(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, svc *corev1.Service) (*ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
@@ -45,7 +46,7 @@ func (r *AIChatWorkspaceReconciler) ensureService(ctx context.Context, instance
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a Service", "Service.Namespace", instance.Spec.WorkspaceName, "Service.Name", svc.Name)
 
-		controllerutil.SetControllerReference(instance, svc, r.Scheme)
+		setWorkspaceLabel(instance, svc)
 		err = r.Create(context.TODO(), svc)
 
 		if err != nil {
@@ -54,6 +55,7 @@ func (r *AIChatWorkspaceReconciler) ensureService(ctx context.Context, instance
 			return &ctrl.Result{}, err
 		}
 
+		r.eventCreated(instance, "Service", svc)
 		return nil, nil
 
 	} else if err != nil {
@@ -62,5 +64,27 @@ func (r *AIChatWorkspaceReconciler) ensureService(ctx context.Context, instance
 		return &ctrl.Result{}, err
 	}
 
+	if err = r.ensureTracked(ctx, instance, found); err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if !samePorts(found.Spec.Ports, svc.Spec.Ports) {
+		logger.Info("Updating Service ports", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+		found.Spec.Ports = svc.Spec.Ports
+		if err = r.Update(context.TODO(), found); err != nil {
+			logger.Error(err, "Failed to update Service", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+			return &ctrl.Result{}, err
+		}
+		r.eventUpdated(instance, "Service", found)
+	}
+
 	return nil, nil
 }
+
+// samePorts reports whether two lists of Service ports expose the same ports, ignoring the fields
+// defaulted by the API server.
+func samePorts(found, desired []corev1.ServicePort) bool {
+	return slices.EqualFunc(found, desired, func(a, b corev1.ServicePort) bool {
+		return a.Port == b.Port && a.TargetPort == b.TargetPort
+	})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package controller
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -25,6 +26,7 @@ type UpdateAIChatWorkspaceStep struct {
 }
 
 func (step *UpdateAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance) (ctrl.Result, error) {
+	instance.startStep("Update")
 	var err error
 	var result *ctrl.Result
 	isCreated := instance.aichatWorkspaceConfig.Status.IsCreated
@@ -35,7 +37,10 @@ func (step *UpdateAIChatWorkspaceStep) execute(instance *AIChatWorkspaceInstance
 
 		result, err = instance.r.handleReconcile(instance.ctx, result, instance.aichatWorkspaceConfig)
 		if result != nil {
-			return instance.r.finishReconcile(err, true)
+			if err != nil {
+				instance.r.Recorder.Event(instance.aichatWorkspaceConfig, corev1.EventTypeWarning, EventReasonReconcileFailed, err.Error())
+			}
+			return instance.r.finishReconcile(err, result)
 		}
 
 		return step.next.execute(instance)
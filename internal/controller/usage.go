@@ -0,0 +1,133 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/gateway"
+)
+
+// usageClient fetches the usage summaries from the API gateways.
+var usageClient = &http.Client{Timeout: 5 * time.Second}
+
+/**
+ * Copies the usage summary of the workspace API gateway into status.usage.
+ *
+ * The summary is read from the metrics port of the gateway sidecar. Failing to read it is
+ * logged and does not fail the reconciliation, the previous summary is kept.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace instance to update.
+ * @return An error if the status could not be patched, or nil otherwise.
+ */
+func (r *AIChatWorkspaceReconciler) ensureUsageStatus(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) error {
+	logger := log.FromContext(ctx)
+
+	if apiAuthMode(instance) != appsv1alpha1.APIAuthModeAPIKey {
+		if instance.Status.Usage == nil {
+			return nil
+		}
+		instance.Status.Usage = nil
+		return r.patchStatus(ctx, instance)
+	}
+
+	summary, err := r.fetchUsage(ctx, instance)
+	if err != nil {
+		logger.Info("unable to read the API gateway usage", "error", err.Error())
+		return nil
+	}
+	if summary == nil {
+		return nil
+	}
+
+	usage := &appsv1alpha1.UsageStatus{Window: summary.Window}
+	for _, model := range summary.Models {
+		usage.Requests += model.Requests
+		usage.PromptTokens += model.PromptTokens
+		usage.CompletionTokens += model.CompletionTokens
+		usage.Models = append(usage.Models, appsv1alpha1.ModelUsageStatus{
+			Model:            model.Model,
+			Requests:         model.Requests,
+			PromptTokens:     model.PromptTokens,
+			CompletionTokens: model.CompletionTokens,
+		})
+	}
+
+	if instance.Status.Usage != nil {
+		usage.LastUpdated = instance.Status.Usage.LastUpdated
+		if equality.Semantic.DeepEqual(instance.Status.Usage, usage) {
+			return nil
+		}
+	}
+	usage.LastUpdated = metav1.Now()
+	instance.Status.Usage = usage
+
+	return r.patchStatus(ctx, instance)
+}
+
+/**
+ * Reads the usage summary from the gateway sidecar of the Ollama pod.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace instance whose gateway is queried.
+ * @return The summary, nil when the pod has no IP yet, and an error if the request failed.
+ */
+func (r *AIChatWorkspaceReconciler) fetchUsage(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace) (*gateway.UsageSummary, error) {
+	pod := &corev1.Pod{}
+	podName := fmt.Sprintf("%s-0", getName(instance.Spec.WorkspaceName, constants.OllamaName))
+	if err := r.Get(ctx, types.NamespacedName{Name: podName, Namespace: instance.Spec.WorkspaceName}, pod); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if pod.Status.PodIP == "" {
+		return nil, nil
+	}
+
+	url := fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, constants.APIGatewayMetricsPort, gateway.UsagePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := usageClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+
+	summary := &gateway.UsageSummary{}
+	if err := json.NewDecoder(resp.Body).Decode(summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
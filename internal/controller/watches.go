@@ -0,0 +1,315 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// Field indexes registered with the manager cache.
+const (
+	// workspaceNameField indexes the AIChatWorkspaces by spec.workspaceName.
+	workspaceNameField = ".spec.workspaceName"
+
+	// workspaceRefField indexes the AIChatWorkspaceAPIKeys by the namespaced name of the referenced AIChatWorkspace.
+	workspaceRefField = ".spec.workspaceRef"
+
+	// backendRefField indexes the AIChatWorkspaces in shared backend mode by the namespaced name of the referenced AIChatBackend.
+	backendRefField = ".spec.backend.backendRef"
+)
+
+/**
+ * Registers the field indexes used to map watch events to the objects to reconcile.
+ *
+ * Must be called before the controllers are set up with the manager.
+ *
+ * @param ctx The context used to register the indexes.
+ * @param mgr The manager whose cache is indexed.
+ * @return An error if an index could not be registered, or nil otherwise.
+ */
+func SetupFieldIndexes(ctx context.Context, mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &appsv1alpha1.AIChatWorkspace{}, workspaceNameField, func(obj client.Object) []string {
+		return []string{obj.(*appsv1alpha1.AIChatWorkspace).Spec.WorkspaceName}
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &appsv1alpha1.AIChatWorkspace{}, backendRefField, func(obj client.Object) []string {
+		workspace := obj.(*appsv1alpha1.AIChatWorkspace)
+		if backendMode(workspace) != appsv1alpha1.BackendModeShared {
+			return nil
+		}
+		return []string{backendRef(workspace).String()}
+	}); err != nil {
+		return err
+	}
+
+	return mgr.GetFieldIndexer().IndexField(ctx, &appsv1alpha1.AIChatWorkspaceAPIKey{}, workspaceRefField, func(obj client.Object) []string {
+		return []string{apiKeyWorkspaceRef(obj.(*appsv1alpha1.AIChatWorkspaceAPIKey)).String()}
+	})
+}
+
+/**
+ * Sets the label tracking which workspace an object belongs to.
+ *
+ * The objects live in the workspace namespace, not in the namespace of the AIChatWorkspace, so
+ * owner references can't be used to find the AIChatWorkspace from a watch event. The label is
+ * mapped back with the spec.workspaceName index instead. The managed-by label is set as well,
+ * the manager cache selects the kinds shared with the AIChatBackend pools by it.
+ *
+ * @param instance The AIChatWorkspace the object belongs to.
+ * @param obj The object to label.
+ */
+func setWorkspaceLabel(instance *appsv1alpha1.AIChatWorkspace, obj client.Object) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[constants.WorkspaceLabelName] = instance.Spec.WorkspaceName
+	labels[constants.ManagedByLabelName] = constants.ManagedBy
+	obj.SetLabels(labels)
+}
+
+/**
+ * Makes an existing object of the workspace tracked by its label only.
+ *
+ * Objects created by earlier versions of the operator are not labelled, so their changes would
+ * not be mapped back to the AIChatWorkspace. They also carry an owner reference to the
+ * AIChatWorkspace, which lives in another namespace. The garbage collector treats such a
+ * reference as unresolvable (and may delete a namespaced dependent), so it is removed.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param instance The AIChatWorkspace the object belongs to.
+ * @param found The object read from the cluster.
+ * @return An error if the object could not be patched, or nil otherwise.
+ */
+func (r *AIChatWorkspaceReconciler) ensureTracked(ctx context.Context, instance *appsv1alpha1.AIChatWorkspace, found client.Object) error {
+	owned := slices.ContainsFunc(found.GetOwnerReferences(), func(ref metav1.OwnerReference) bool {
+		return ref.UID == instance.UID
+	})
+	labels := found.GetLabels()
+	if labels[constants.WorkspaceLabelName] == instance.Spec.WorkspaceName && labels[constants.ManagedByLabelName] == constants.ManagedBy && !owned {
+		return nil
+	}
+
+	patch := client.MergeFrom(found.DeepCopyObject().(client.Object))
+	setWorkspaceLabel(instance, found)
+	found.SetOwnerReferences(slices.DeleteFunc(found.GetOwnerReferences(), func(ref metav1.OwnerReference) bool {
+		return ref.UID == instance.UID
+	}))
+	log.FromContext(ctx).Info("Tracking object by its workspace label", "Object.Namespace", found.GetNamespace(), "Object.Name", found.GetName(), "Object.Kind", fmt.Sprintf("%T", found))
+	return r.Patch(ctx, found, patch)
+}
+
+// hasWorkspaceLabel filters the watch events to the objects managed for a workspace.
+var hasWorkspaceLabel = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	_, ok := obj.GetLabels()[constants.WorkspaceLabelName]
+	return ok
+})
+
+/**
+ * Maps an object labelled with setWorkspaceLabel to the AIChatWorkspace it belongs to.
+ *
+ * @param ctx The context of the watch event.
+ * @param obj The object that changed.
+ * @return The reconcile requests of the AIChatWorkspaces using the workspace name.
+ */
+func (r *AIChatWorkspaceReconciler) mapWorkspaceObject(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.workspaceRequests(ctx, client.MatchingFields{workspaceNameField: obj.GetLabels()[constants.WorkspaceLabelName]})
+}
+
+func (r *AIChatWorkspaceReconciler) workspaceRequests(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	workspaces := &appsv1alpha1.AIChatWorkspaceList{}
+	if err := r.List(ctx, workspaces, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list AIChatWorkspaces")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(workspaces.Items))
+	for _, workspace := range workspaces.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: workspace.Name, Namespace: workspace.Namespace},
+		})
+	}
+	return requests
+}
+
+/**
+ * Returns the kinds created in the workspace namespaces whose changes trigger a reconcile.
+ *
+ * HTTPRoutes are only watched when the Gateway API CRDs are installed, the controller would
+ * otherwise fail to start.
+ *
+ * @param mapper The REST mapper of the cluster.
+ * @return Empty objects of the watched kinds.
+ */
+func watchedWorkspaceObjects(mapper meta.RESTMapper) []client.Object {
+	objs := []client.Object{
+		&corev1.Namespace{},
+		&corev1.ResourceQuota{},
+		&corev1.ServiceAccount{},
+		&corev1.PersistentVolumeClaim{},
+		&corev1.Service{},
+		&corev1.Secret{},
+		&corev1.ConfigMap{},
+		&appsv1.Deployment{},
+		&appsv1.StatefulSet{},
+		&batchv1.Job{},
+		&networkingv1.NetworkPolicy{},
+		&networkingv1.Ingress{},
+		&rbacv1.Role{},
+		&rbacv1.RoleBinding{},
+	}
+
+	httpRoute := schema.GroupKind{Group: gatewayv1.GroupName, Kind: "HTTPRoute"}
+	if _, err := mapper.RESTMapping(httpRoute, gatewayv1.GroupVersion.Version); err == nil {
+		objs = append(objs, &gatewayv1.HTTPRoute{})
+	} else {
+		ctrl.Log.WithName(constants.ManagedBy).Info("not watching HTTPRoutes, the Gateway API CRDs are not installed")
+	}
+
+	return objs
+}
+
+/**
+ * Returns the manager cache settings of the kinds watched in the workspace namespaces.
+ *
+ * Only the objects of the operator are cached rather than every object of the cluster. The
+ * objects of the workspaces carry the workspace label; the StatefulSets, Services and
+ * ServiceAccounts are shared with the AIChatBackend pools, whose objects carry no workspace
+ * label, and are selected by the managed-by label. The Secrets and ConfigMaps of the operator
+ * namespace are all cached, the AIChatWorkspaces living there reference the Secrets of their
+ * users and the operator ConfigMap. Namespaces are cluster scoped and cached as a whole, an
+ * existing namespace named after a workspace has to be found.
+ *
+ * @param mapper The REST mapper of the cluster.
+ * @param operatorNamespace The namespace of the AIChatWorkspaces and of the operator ConfigMap.
+ * @return The ByObject settings of the manager cache, and an error if a selector is invalid.
+ */
+func CacheByObject(mapper meta.RESTMapper, operatorNamespace string) (map[client.Object]cache.ByObject, error) {
+	tracked, err := labels.NewRequirement(constants.WorkspaceLabelName, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	workspaceObjects := labels.NewSelector().Add(*tracked)
+	managedObjects := labels.SelectorFromSet(labels.Set{constants.ManagedByLabelName: constants.ManagedBy})
+
+	byObject := map[client.Object]cache.ByObject{}
+	for _, obj := range watchedWorkspaceObjects(mapper) {
+		switch obj.(type) {
+		case *corev1.Namespace:
+			continue
+		case *corev1.Secret, *corev1.ConfigMap:
+			byObject[obj] = cache.ByObject{Namespaces: map[string]cache.Config{
+				operatorNamespace:   {},
+				cache.AllNamespaces: {LabelSelector: workspaceObjects},
+			}}
+		case *appsv1.StatefulSet, *corev1.Service, *corev1.ServiceAccount:
+			byObject[obj] = cache.ByObject{Label: managedObjects}
+		default:
+			byObject[obj] = cache.ByObject{Label: workspaceObjects}
+		}
+	}
+	return byObject, nil
+}
+
+/**
+ * Labels the objects of the workspaces created before the manager cache was limited to labelled
+ * objects.
+ *
+ * The cache doesn't see an object without the labels, so the controller would fail to create it
+ * again instead of adopting it with ensureTracked. The objects of the workspace namespaces
+ * carrying the workspace label, or an owner reference to the AIChatWorkspace, are read without
+ * the cache and tracked. Failures are logged, the objects are then left to a later start.
+ *
+ * @param ctx The context in which the function is being executed.
+ * @param reader A reader bypassing the cache.
+ * @param objs Empty objects of the watched kinds.
+ */
+func (r *AIChatWorkspaceReconciler) trackExistingObjects(ctx context.Context, reader client.Reader, objs []client.Object) {
+	logger := log.FromContext(ctx)
+	workspaces := &appsv1alpha1.AIChatWorkspaceList{}
+	if err := reader.List(ctx, workspaces); err != nil {
+		logger.Error(err, "Failed to list the AIChatWorkspaces to track their objects")
+		return
+	}
+
+	for _, obj := range objs {
+		if _, ok := obj.(*corev1.Namespace); ok {
+			continue
+		}
+		gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+		if err != nil {
+			logger.Error(err, "Failed to resolve the kind of a watched object", "Object.Kind", fmt.Sprintf("%T", obj))
+			continue
+		}
+		for i := range workspaces.Items {
+			workspace := &workspaces.Items[i]
+			if err := r.trackExistingKind(ctx, reader, workspace, gvk); err != nil {
+				logger.Error(err, "Failed to track the existing objects", "Workspace", workspace.Spec.WorkspaceName, "Object.Kind", gvk.Kind)
+			}
+		}
+	}
+}
+
+// trackExistingKind tracks the objects of one kind in the namespace of a workspace.
+func (r *AIChatWorkspaceReconciler) trackExistingKind(ctx context.Context, reader client.Reader, workspace *appsv1alpha1.AIChatWorkspace, gvk schema.GroupVersionKind) error {
+	list := &metav1.PartialObjectMetadataList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := reader.List(ctx, list, client.InNamespace(workspace.Spec.WorkspaceName)); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		found := &list.Items[i]
+		found.SetGroupVersionKind(gvk)
+		owned := slices.ContainsFunc(found.GetOwnerReferences(), func(ref metav1.OwnerReference) bool {
+			return ref.UID == workspace.UID
+		})
+		if found.GetLabels()[constants.WorkspaceLabelName] != workspace.Spec.WorkspaceName && !owned {
+			continue
+		}
+		if err := r.ensureTracked(ctx, workspace, found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
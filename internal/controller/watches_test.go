@@ -0,0 +1,269 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+func TestMapWorkspaceObject(t *testing.T) {
+	c := newFakeClient(t, configuredWorkspace("team-a", "", nil), configuredWorkspace("team-b", "", nil))
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme()}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name: "team-a-openwebui", Namespace: "team-a", Labels: map[string]string{constants.WorkspaceLabelName: "team-a"},
+	}}
+	assertRequests(t, r.mapWorkspaceObject(context.Background(), service), "team-a")
+
+	unknown := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name: "team-z-openwebui", Namespace: "team-z", Labels: map[string]string{constants.WorkspaceLabelName: "team-z"},
+	}}
+	assertRequests(t, r.mapWorkspaceObject(context.Background(), unknown))
+}
+
+func TestMapAPIKeys(t *testing.T) {
+	c := newFakeClient(t,
+		configuredWorkspace("team-a", "", nil),
+		configuredWorkspace("team-b", "", nil),
+		newAPIKey(constants.AIChatWorkspaceNamespace, "ci", nil),
+		newAPIKey("team-b", "build", nil),
+		&appsv1alpha1.AIChatWorkspaceAPIKey{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: constants.AIChatWorkspaceNamespace},
+			Spec:       appsv1alpha1.AIChatWorkspaceAPIKeySpec{WorkspaceRef: appsv1alpha1.WorkspaceReference{Name: "team-b"}},
+		},
+	)
+	r := &AIChatWorkspaceAPIKeyReconciler{Client: c, Scheme: c.Scheme()}
+	ctx := context.Background()
+	want := []types.NamespacedName{{Namespace: constants.AIChatWorkspaceNamespace, Name: "ci"}, {Namespace: "team-b", Name: "build"}}
+
+	requests := r.mapWorkspace(ctx, configuredWorkspace("team-a", "", nil))
+	if len(requests) != len(want) || requests[0].NamespacedName != want[0] || requests[1].NamespacedName != want[1] {
+		t.Errorf("mapWorkspace() = %v, want %v", requests, want)
+	}
+
+	registry := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name: "team-a-api-keys", Namespace: "team-a", Labels: map[string]string{constants.WorkspaceLabelName: "team-a"},
+	}}
+	if !isKeyRegistry.Create(event.CreateEvent{Object: registry}) {
+		t.Error("isKeyRegistry() = false for the key registry")
+	}
+	requests = r.mapKeyRegistry(ctx, registry)
+	if len(requests) != len(want) || requests[0].NamespacedName != want[0] || requests[1].NamespacedName != want[1] {
+		t.Errorf("mapKeyRegistry() = %v, want %v", requests, want)
+	}
+
+	other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name: "team-a-openwebui", Namespace: "team-a", Labels: map[string]string{constants.WorkspaceLabelName: "team-a"},
+	}}
+	if isKeyRegistry.Create(event.CreateEvent{Object: other}) {
+		t.Error("isKeyRegistry() = true for another Secret of the workspace")
+	}
+}
+
+func TestEnsureTracked(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.UID = "team-a-uid"
+	legacy := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:      "team-a-openwebui",
+		Namespace: "team-a",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: appsv1alpha1.GroupVersion.String(), Kind: "AIChatWorkspace", Name: "team-a", UID: "team-a-uid", Controller: ptr.To(true)},
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other-uid"},
+		},
+	}}
+	c := newFakeClient(t, workspace, legacy)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme()}
+	ctx := context.Background()
+
+	if err := r.ensureTracked(ctx, workspace, legacy); err != nil {
+		t.Fatal(err)
+	}
+	found := &corev1.Service{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "team-a-openwebui", Namespace: "team-a"}, found); err != nil {
+		t.Fatal(err)
+	}
+	if found.Labels[constants.WorkspaceLabelName] != "team-a" {
+		t.Errorf("labels = %v, want the workspace label", found.Labels)
+	}
+	if len(found.OwnerReferences) != 1 || found.OwnerReferences[0].UID != "other-uid" {
+		t.Errorf("ownerReferences = %+v, want only the reference to another owner", found.OwnerReferences)
+	}
+
+	// a tracked object isn't patched again.
+	version := found.ResourceVersion
+	if err := r.ensureTracked(ctx, workspace, found); err != nil {
+		t.Fatal(err)
+	}
+	if found.ResourceVersion != version {
+		t.Errorf("resourceVersion = %s, want the tracked object unchanged (%s)", found.ResourceVersion, version)
+	}
+}
+
+func TestCacheByObject(t *testing.T) {
+	byObject, err := CacheByObject(meta.NewDefaultRESTMapper(nil), "operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := map[string]cache.ByObject{}
+	for obj, setting := range byObject {
+		settings[fmt.Sprintf("%T", obj)] = setting
+	}
+	if _, ok := settings["*v1.Namespace"]; ok {
+		t.Error("Namespaces are restricted, want them cached as a whole")
+	}
+	if _, ok := settings["*v1.HTTPRoute"]; ok {
+		t.Error("HTTPRoutes are cached without the Gateway API CRDs")
+	}
+
+	workspace := labels.Set{constants.WorkspaceLabelName: "team-a", constants.ManagedByLabelName: constants.ManagedBy}
+	pool := labels.Set{constants.BackendLabelName: "shared", constants.ManagedByLabelName: constants.ManagedBy}
+	other := labels.Set{"app": "other"}
+	for kind, want := range map[string][]labels.Set{
+		"*v1.Deployment":     {workspace},
+		"*v1.Role":           {workspace},
+		"*v1.StatefulSet":    {workspace, pool},
+		"*v1.Service":        {workspace, pool},
+		"*v1.ServiceAccount": {workspace, pool},
+	} {
+		setting, ok := settings[kind]
+		if !ok || setting.Label == nil {
+			t.Errorf("%s: settings = %+v, want a label selector", kind, setting)
+			continue
+		}
+		for _, set := range want {
+			if !setting.Label.Matches(set) {
+				t.Errorf("%s: %s doesn't select %v", kind, setting.Label, set)
+			}
+		}
+		if setting.Label.Matches(other) {
+			t.Errorf("%s: %s selects the objects of others", kind, setting.Label)
+		}
+	}
+
+	// the Secrets of the operator namespace are read for the workspaces, the others only when labelled.
+	secrets := settings["*v1.Secret"]
+	if operator, ok := secrets.Namespaces["operator"]; !ok || operator.LabelSelector != nil {
+		t.Errorf("Secrets of the operator namespace = %+v, want all of them", secrets.Namespaces)
+	}
+	if all := secrets.Namespaces[cache.AllNamespaces]; all.LabelSelector == nil || !all.LabelSelector.Matches(workspace) || all.LabelSelector.Matches(other) {
+		t.Errorf("Secrets of the other namespaces = %+v, want the workspace objects", all)
+	}
+}
+
+func TestTrackExistingObjects(t *testing.T) {
+	workspace := configuredWorkspace("team-a", "", nil)
+	workspace.UID = "team-a-uid"
+	legacy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:            "team-a-openwebui",
+		Namespace:       "team-a",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: appsv1alpha1.GroupVersion.String(), Kind: "AIChatWorkspace", Name: "team-a", UID: "team-a-uid"}},
+	}}
+	labelled := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name:      "team-a-ollama",
+		Namespace: "team-a",
+		Labels:    map[string]string{constants.WorkspaceLabelName: "team-a"},
+	}}
+	foreign := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "team-a"}}
+	c := newFakeClient(t, workspace, legacy, labelled, foreign)
+	r := &AIChatWorkspaceReconciler{Client: c, Scheme: c.Scheme()}
+	ctx := context.Background()
+
+	r.trackExistingObjects(ctx, c, []client.Object{&corev1.Namespace{}, &appsv1.Deployment{}, &appsv1.StatefulSet{}, &corev1.ConfigMap{}})
+
+	for _, obj := range []client.Object{&appsv1.Deployment{}, &appsv1.StatefulSet{}, &corev1.ConfigMap{}} {
+		key := client.ObjectKeyFromObject(legacy)
+		switch obj.(type) {
+		case *appsv1.StatefulSet:
+			key = client.ObjectKeyFromObject(labelled)
+		case *corev1.ConfigMap:
+			key = client.ObjectKeyFromObject(foreign)
+		}
+		if err := c.Get(ctx, key, obj); err != nil {
+			t.Fatal(err)
+		}
+		_, isForeign := obj.(*corev1.ConfigMap)
+		tracked := obj.GetLabels()[constants.WorkspaceLabelName] == "team-a" && obj.GetLabels()[constants.ManagedByLabelName] == constants.ManagedBy
+		if tracked == isForeign {
+			t.Errorf("%T %s labels = %v, want tracked %t", obj, key.Name, obj.GetLabels(), !isForeign)
+		}
+		if len(obj.GetOwnerReferences()) != 0 {
+			t.Errorf("%T %s ownerReferences = %+v, want none", obj, key.Name, obj.GetOwnerReferences())
+		}
+	}
+}
+
+func TestScheduledRequeue(t *testing.T) {
+	apiKey := configuredWorkspace("team-a", "", nil)
+	apiKey.Spec.API = &appsv1alpha1.APISpec{Auth: &appsv1alpha1.APIAuthSpec{Mode: appsv1alpha1.APIAuthModeAPIKey}}
+
+	updates := configuredWorkspace("team-a", "", nil)
+	updates.Spec.ModelUpdatePolicy = &appsv1alpha1.ModelUpdatePolicy{
+		Type:          appsv1alpha1.ModelUpdatePolicyOnTagChange,
+		CheckInterval: &metav1.Duration{Duration: time.Minute},
+	}
+
+	providers := apiKey.DeepCopy()
+	providers.Spec.Providers = []appsv1alpha1.ProviderSpec{{Name: "openai", BaseURL: "https://api.openai.com/v1"}}
+	providers.Spec.ModelUpdatePolicy = &appsv1alpha1.ModelUpdatePolicy{Type: appsv1alpha1.ModelUpdatePolicyOnTagChange}
+
+	failedMember := providers.DeepCopy()
+	failedMember.Status.Members = []appsv1alpha1.MemberStatus{{Email: "alice@example.com", State: appsv1alpha1.MemberStateFailed}}
+
+	failedPatterns := configuredWorkspace("team-a", "", nil)
+	meta.SetStatusCondition(&failedPatterns.Status.Conditions, metav1.Condition{
+		Type:   appsv1alpha1.ConditionTypePatternsPublished,
+		Status: metav1.ConditionFalse,
+		Reason: appsv1alpha1.PatternsPublishFailedReason,
+	})
+
+	deleting := apiKey.DeepCopy()
+	deleting.DeletionTimestamp = ptr.To(metav1.Now())
+
+	for name, tc := range map[string]struct {
+		workspace *appsv1alpha1.AIChatWorkspace
+		want      time.Duration
+	}{
+		"event driven only":            {configuredWorkspace("team-a", "", nil), 0},
+		"usage refresh":                {apiKey, UsageRefreshInterval},
+		"model update check, clamped":  {updates, MinModelCheckInterval},
+		"shortest of usage, providers": {providers, min(UsageRefreshInterval, ProviderCheckInterval)},
+		"failed member":                {failedMember, min(UsageRefreshInterval, MemberSyncRetryInterval)},
+		"failed patterns":              {failedPatterns, PatternPublishRetryInterval},
+		"deleting":                     {deleting, 0},
+	} {
+		if got := scheduledRequeue(tc.workspace); got != tc.want {
+			t.Errorf("%s: scheduledRequeue() = %s, want %s", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events provides the event recorder used by the reconcilers.
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// DefaultInterval is how long an identical event is suppressed for.
+const DefaultInterval = 15 * time.Minute
+
+// pruneThreshold is the number of remembered events above which expired ones are dropped.
+const pruneThreshold = 512
+
+// RateLimitedRecorder is a record.EventRecorder that drops an event when the same
+// object already received an event with the same type, reason and message within
+// the interval. The reconcilers requeue periodically and would otherwise emit the
+// same warning on every pass.
+type RateLimitedRecorder struct {
+	recorder record.EventRecorder
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+var _ record.EventRecorder = &RateLimitedRecorder{}
+
+// NewRateLimitedRecorder wraps recorder, suppressing identical events for interval.
+func NewRateLimitedRecorder(recorder record.EventRecorder, interval time.Duration) *RateLimitedRecorder {
+	return &RateLimitedRecorder{
+		recorder: recorder,
+		interval: interval,
+		now:      time.Now,
+		seen:     map[string]time.Time{},
+	}
+}
+
+// Event implements record.EventRecorder.
+func (r *RateLimitedRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.allow(object, eventtype, reason, message) {
+		r.recorder.Event(object, eventtype, reason, message)
+	}
+}
+
+// Eventf implements record.EventRecorder.
+func (r *RateLimitedRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf implements record.EventRecorder.
+func (r *RateLimitedRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if r.allow(object, eventtype, reason, message) {
+		r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
+
+func (r *RateLimitedRecorder) allow(object runtime.Object, eventtype, reason, message string) bool {
+	var uid string
+	if accessor, err := meta.Accessor(object); err == nil {
+		uid = string(accessor.GetUID())
+	}
+	key := uid + "\x00" + eventtype + "\x00" + reason + "\x00" + message
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.seen[key]; ok && now.Sub(last) < r.interval {
+		return false
+	}
+	r.seen[key] = now
+
+	if len(r.seen) > pruneThreshold {
+		for k, last := range r.seen {
+			if now.Sub(last) >= r.interval {
+				delete(r.seen, k)
+			}
+		}
+	}
+
+	return true
+}
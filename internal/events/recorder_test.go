@@ -0,0 +1,65 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRateLimitedRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	recorder := NewRateLimitedRecorder(fake, time.Minute)
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return now }
+
+	first := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{UID: "first"}}
+	second := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{UID: "second"}}
+
+	recorder.Eventf(first, corev1.EventTypeWarning, "QuotaExceeded", "quota %s exhausted", "cpu")
+	recorder.Eventf(first, corev1.EventTypeWarning, "QuotaExceeded", "quota %s exhausted", "cpu")
+	recorder.Eventf(first, corev1.EventTypeWarning, "QuotaExceeded", "quota %s exhausted", "memory")
+	recorder.Eventf(second, corev1.EventTypeWarning, "QuotaExceeded", "quota %s exhausted", "cpu")
+	now = now.Add(time.Minute)
+	recorder.Eventf(first, corev1.EventTypeWarning, "QuotaExceeded", "quota %s exhausted", "cpu")
+
+	expected := []string{
+		"Warning QuotaExceeded quota cpu exhausted",
+		"Warning QuotaExceeded quota memory exhausted",
+		"Warning QuotaExceeded quota cpu exhausted",
+		"Warning QuotaExceeded quota cpu exhausted",
+	}
+	for _, want := range expected {
+		select {
+		case got := <-fake.Events:
+			if got != want {
+				t.Fatalf("expected event %q, got %q", want, got)
+			}
+		default:
+			t.Fatalf("expected event %q, got none", want)
+		}
+	}
+	select {
+	case got := <-fake.Events:
+		t.Fatalf("expected the duplicate to be dropped, got %q", got)
+	default:
+	}
+}
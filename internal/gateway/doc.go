@@ -0,0 +1,3 @@
+// Package gateway provides the authenticating proxy that runs next to Ollama and
+// guards the workspace API with bearer API keys.
+package gateway
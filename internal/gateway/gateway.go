@@ -0,0 +1,175 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// HealthPath is served by the gateway itself without authentication.
+const HealthPath = "/healthz"
+
+// DefaultAllowedPaths are the Ollama endpoints reachable through the gateway.
+// Model management endpoints (pull, push, create, copy, delete, blobs) are not listed
+// and are rejected.
+var DefaultAllowedPaths = []string{
+	"/api/chat",
+	"/api/generate",
+	"/api/embed",
+	"/api/embeddings",
+	"/api/tags",
+	"/api/show",
+	"/api/ps",
+	"/api/version",
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/models",
+}
+
+// Options configures a Gateway.
+type Options struct {
+	// Upstream is the Ollama API the requests are forwarded to.
+	Upstream *url.URL
+
+	// Keys holds the API keys accepted by the gateway.
+	Keys *KeyStore
+
+	// AllowedPaths are the request paths forwarded upstream. A path also allows
+	// its sub paths, e.g. /v1/models allows /v1/models/llama3.2:1b.
+	AllowedPaths []string
+
+	// Meter records the token usage of the forwarded requests. Optional.
+	Meter *Meter
+
+	Logger logr.Logger
+}
+
+// Gateway is an http.Handler that authenticates requests with bearer API keys and
+// forwards the allowed ones to Ollama.
+type Gateway struct {
+	proxy        *httputil.ReverseProxy
+	keys         *KeyStore
+	allowedPaths []string
+	logger       logr.Logger
+}
+
+// New returns a Gateway for the given options.
+func New(opts Options) *Gateway {
+	allowedPaths := opts.AllowedPaths
+	if len(allowedPaths) == 0 {
+		allowedPaths = DefaultAllowedPaths
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(opts.Upstream)
+	if opts.Meter != nil {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			keyID, _ := resp.Request.Context().Value(keyIDContextKey{}).(string)
+			opts.Meter.meter(resp, keyID)
+			return nil
+		}
+	}
+
+	return &Gateway{
+		proxy:        proxy,
+		keys:         opts.Keys,
+		allowedPaths: allowedPaths,
+		logger:       opts.Logger,
+	}
+}
+
+// keyIDContextKey carries the ID of the authenticated key to the response hook.
+type keyIDContextKey struct{}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Normalise the path before matching it so /api/chat/../pull can't slip through.
+	req.URL.Path = path.Clean("/" + req.URL.Path)
+	req.URL.RawPath = ""
+
+	if req.URL.Path == HealthPath {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !g.isAllowed(req.URL.Path) {
+		writeError(w, http.StatusForbidden, "endpoint not allowed")
+		return
+	}
+
+	token, ok := bearerToken(req)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="aichatworkspace"`)
+		writeError(w, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+
+	key, ok := g.keys.Lookup(token)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="aichatworkspace", error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+		return
+	}
+
+	if !key.Allows(req.URL.Path) {
+		writeError(w, http.StatusForbidden, "api key is not allowed to call this endpoint")
+		return
+	}
+
+	g.logger.V(1).Info("forwarding request", "key", key.ID, "method", req.Method, "path", req.URL.Path)
+
+	// Ollama has no notion of the workspace keys, don't leak them upstream.
+	req.Header.Del("Authorization")
+	g.proxy.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), keyIDContextKey{}, key.ID)))
+}
+
+func (g *Gateway) isAllowed(p string) bool {
+	return matchPath(g.allowedPaths, p)
+}
+
+// matchPath reports whether p is one of the paths, or a sub path of one of them.
+func matchPath(paths []string, p string) bool {
+	for _, allowed := range paths {
+		if p == allowed || strings.HasPrefix(p, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// writeError replies with the {"error": "..."} body Ollama uses for its own errors.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestGateway(t *testing.T) {
+	rawKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var forwarded *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "default"), []byte(HashKey(rawKey)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	scopedKey, expiredKey := "acw_scoped", "acw_expired"
+	scopedEntry := FormatKey(HashKey(scopedKey), []string{ScopeEmbeddings, ScopeModels}, time.Now().Add(time.Hour))
+	if err := os.WriteFile(filepath.Join(dir, "ci.scoped"), []byte(scopedEntry), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expiredEntry := FormatKey(HashKey(expiredKey), nil, time.Now().Add(-time.Minute))
+	if err := os.WriteFile(filepath.Join(dir, "ci.expired"), []byte(expiredEntry), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Kubelet bookkeeping entries must be skipped.
+	if err := os.WriteFile(filepath.Join(dir, "..data"), []byte("ignored"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeyStore(dir, logr.Discard())
+	if err := keys.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if keys.Len() != 3 {
+		t.Fatalf("expected 3 keys, got %d", keys.Len())
+	}
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	gw := New(Options{Upstream: upstreamURL, Keys: keys, Logger: logr.Discard()})
+
+	tests := []struct {
+		name   string
+		path   string
+		auth   string
+		status int
+	}{
+		{name: "health check needs no key", path: HealthPath, status: http.StatusOK},
+		{name: "missing key", path: "/api/chat", status: http.StatusUnauthorized},
+		{name: "wrong key", path: "/api/chat", auth: "Bearer acw_wrong", status: http.StatusUnauthorized},
+		{name: "basic auth is not a key", path: "/api/chat", auth: "Basic " + rawKey, status: http.StatusUnauthorized},
+		{name: "valid key", path: "/api/chat", auth: "Bearer " + rawKey, status: http.StatusOK},
+		{name: "sub path of an allowed path", path: "/v1/models/llama3.2:1b", auth: "Bearer " + rawKey, status: http.StatusOK},
+		{name: "model management is blocked", path: "/api/pull", auth: "Bearer " + rawKey, status: http.StatusForbidden},
+		{name: "path traversal is blocked", path: "/api/chat/../delete", auth: "Bearer " + rawKey, status: http.StatusForbidden},
+		{name: "prefix without separator is blocked", path: "/api/chatter", auth: "Bearer " + rawKey, status: http.StatusForbidden},
+		{name: "scoped key within its scopes", path: "/v1/embeddings", auth: "Bearer " + scopedKey, status: http.StatusOK},
+		{name: "scoped key outside its scopes", path: "/v1/chat/completions", auth: "Bearer " + scopedKey, status: http.StatusForbidden},
+		{name: "expired key", path: "/api/chat", auth: "Bearer " + expiredKey, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded = nil
+			req := httptest.NewRequest(http.MethodPost, "http://gateway"+tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			gw.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status == http.StatusOK && tt.path != HealthPath {
+				if forwarded == nil {
+					t.Fatal("request was not forwarded upstream")
+				}
+				if forwarded.Header.Get("Authorization") != "" {
+					t.Fatal("the API key was forwarded upstream")
+				}
+			} else if forwarded != nil {
+				t.Fatal("rejected request was forwarded upstream")
+			}
+		})
+	}
+}
+
+func TestKeyStoreSkipsMalformedEntries(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "default"), []byte(HashKey("acw_valid")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ci.broken"), []byte("md5:abc"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := NewKeyStore(dir, logr.Discard())
+	if err := keys.Load(); err != nil {
+		t.Fatalf("Load() = %v, want the malformed entry skipped", err)
+	}
+	if keys.Len() != 1 {
+		t.Fatalf("expected 1 key, got %d", keys.Len())
+	}
+	if _, ok := keys.Lookup("acw_valid"); !ok {
+		t.Error("the valid key was dropped")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey("default", HashKey("acw_test")+"\n"); err != nil {
+		t.Fatalf("expected a valid key, got %v", err)
+	}
+	key, err := ParseKey("ci", FormatKey(HashKey("acw_test"), []string{ScopeChat}, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatalf("expected a valid key, got %v", err)
+	}
+	if len(key.Scopes) != 1 || key.Scopes[0] != ScopeChat || key.ExpiresAt.Year() != 2030 {
+		t.Fatalf("unexpected key attributes: %+v", key)
+	}
+	for _, value := range []string{"acw_test", "sha256:zz", "sha256:abcd", HashKey("acw_test") + ";scopes=admin", HashKey("acw_test") + ";expires=tomorrow"} {
+		if _, err := ParseKey("default", value); err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// KeyPrefix is prepended to every generated API key so they are easy to recognise in logs and scanners.
+	KeyPrefix = "acw_"
+
+	hashPrefix = "sha256:"
+
+	scopesAttribute  = "scopes"
+	expiresAttribute = "expires"
+)
+
+// Scopes an API key can be restricted to.
+const (
+	ScopeChat       = "chat"
+	ScopeEmbeddings = "embeddings"
+	ScopeModels     = "models"
+)
+
+// ScopePaths maps each scope to the Ollama and OpenAI compatible paths it grants.
+var ScopePaths = map[string][]string{
+	ScopeChat: {
+		"/api/chat",
+		"/api/generate",
+		"/v1/chat/completions",
+		"/v1/completions",
+	},
+	ScopeEmbeddings: {
+		"/api/embed",
+		"/api/embeddings",
+		"/v1/embeddings",
+	},
+	ScopeModels: {
+		"/api/tags",
+		"/api/show",
+		"/api/ps",
+		"/api/version",
+		"/v1/models",
+	},
+}
+
+// Key is an API key registered with the gateway. Only the hash of the key is known.
+type Key struct {
+	// ID is the name the key is registered under, i.e. the Secret data key.
+	ID string
+
+	// Scopes limits the endpoints the key can call, see ScopePaths. A key without
+	// scopes can call every allowed path.
+	Scopes []string
+
+	// ExpiresAt is the time after which the key is rejected. Zero means never.
+	ExpiresAt time.Time
+
+	hash []byte
+}
+
+// Expired reports whether the key is expired at the given time.
+func (k Key) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// Allows reports whether the key scopes permit calling the given path.
+func (k Key) Allows(p string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, scope := range k.Scopes {
+		if matchPath(ScopePaths[scope], p) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore holds the API keys the gateway accepts. Keys are read from a directory
+// where each file is named after the key ID and contains the key hash, which is
+// how Kubernetes projects a Secret into a volume.
+type KeyStore struct {
+	dir    string
+	logger logr.Logger
+
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// NewKeyStore returns a KeyStore reading keys from dir. Call Load before use.
+// Malformed entries are reported to logger.
+func NewKeyStore(dir string, logger logr.Logger) *KeyStore {
+	return &KeyStore{dir: dir, logger: logger}
+}
+
+// Load re-reads every key from the directory, replacing the keys in the store.
+// Entries starting with a dot (the ..data links maintained by the kubelet) are skipped,
+// and so are malformed entries, which are logged so one bad key doesn't drop the others.
+func (s *KeyStore) Load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]Key, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		value, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		key, err := ParseKey(entry.Name(), string(value))
+		if err != nil {
+			s.logger.Error(err, "skipping malformed api key", "id", entry.Name())
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Lookup returns the key matching the raw bearer token. Expired keys are never returned.
+func (s *KeyStore) Lookup(token string) (Key, bool) {
+	sum := sha256.Sum256([]byte(token))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if subtle.ConstantTimeCompare(key.hash, sum[:]) == 1 {
+			if key.Expired(time.Now()) {
+				return Key{}, false
+			}
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
+
+// Len returns the number of keys in the store.
+func (s *KeyStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.keys)
+}
+
+// ParseKey parses a registered key entry of the form "sha256:<hex>", optionally followed
+// by ";scopes=<scope>,<scope>" and ";expires=<RFC 3339 time>" attributes, see FormatKey.
+func ParseKey(id, value string) (Key, error) {
+	value, attributes, _ := strings.Cut(strings.TrimSpace(value), ";")
+	if !strings.HasPrefix(value, hashPrefix) {
+		return Key{}, fmt.Errorf("key %q: expected a %s hash", id, strings.TrimSuffix(hashPrefix, ":"))
+	}
+
+	hash, err := hex.DecodeString(strings.TrimPrefix(value, hashPrefix))
+	if err != nil || len(hash) != sha256.Size {
+		return Key{}, fmt.Errorf("key %q: malformed hash", id)
+	}
+
+	key := Key{ID: id, hash: hash}
+	for _, attribute := range strings.Split(attributes, ";") {
+		if attribute == "" {
+			continue
+		}
+		name, attrValue, _ := strings.Cut(attribute, "=")
+		switch name {
+		case scopesAttribute:
+			for _, scope := range strings.Split(attrValue, ",") {
+				if _, ok := ScopePaths[scope]; !ok {
+					return Key{}, fmt.Errorf("key %q: unknown scope %q", id, scope)
+				}
+				key.Scopes = append(key.Scopes, scope)
+			}
+		case expiresAttribute:
+			expiresAt, err := time.Parse(time.RFC3339, attrValue)
+			if err != nil {
+				return Key{}, fmt.Errorf("key %q: malformed expiry: %w", id, err)
+			}
+			key.ExpiresAt = expiresAt
+		default:
+			return Key{}, fmt.Errorf("key %q: unknown attribute %q", id, name)
+		}
+	}
+
+	return key, nil
+}
+
+// FormatKey returns the entry registered with the gateway for a key hash (see HashKey)
+// restricted to the given scopes and expiry. Empty scopes and a zero expiry are omitted.
+func FormatKey(hash string, scopes []string, expiresAt time.Time) string {
+	entry := hash
+	if len(scopes) > 0 {
+		entry += ";" + scopesAttribute + "=" + strings.Join(scopes, ",")
+	}
+	if !expiresAt.IsZero() {
+		entry += ";" + expiresAttribute + "=" + expiresAt.UTC().Format(time.RFC3339)
+	}
+	return entry
+}
+
+// HashKey returns the value registered with the gateway for a raw API key.
+func HashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// GenerateKey returns a new random API key.
+func GenerateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ReloadEvery reloads the keys every interval until ctx is done, so keys added,
+// rotated or revoked in the Secret take effect without restarting the gateway.
+func (s *KeyStore) ReloadEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Load(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
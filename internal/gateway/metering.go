@@ -0,0 +1,307 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UsagePath serves the usage summary of the last UsageWindow on the metrics listener.
+const UsagePath = "/usage"
+
+// UsageWindow is the period summarised by the usage endpoint.
+const UsageWindow = 24 * time.Hour
+
+// usageWindowName is UsageWindow as reported in the summary.
+const usageWindowName = "24h"
+
+// maxMeteredLine bounds the memory used to parse a single response line. Lines
+// longer than this (e.g. large embeddings) are not parsed.
+const maxMeteredLine = 1 << 20
+
+// Usage is the token usage reported by Ollama for one request.
+type Usage struct {
+	Model            string
+	PromptTokens     int64
+	CompletionTokens int64
+	PromptEval       time.Duration
+	Eval             time.Duration
+	Total            time.Duration
+}
+
+// ModelUsage is the usage of a model over the usage window.
+type ModelUsage struct {
+	Model            string `json:"model"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"promptTokens"`
+	CompletionTokens int64  `json:"completionTokens"`
+}
+
+// UsageSummary is the body served on UsagePath.
+type UsageSummary struct {
+	Window string       `json:"window"`
+	Models []ModelUsage `json:"models"`
+}
+
+// Meter records the usage of the workspace API as Prometheus metrics and keeps
+// hourly totals for the usage summary.
+type Meter struct {
+	workspace string
+
+	requests         *prometheus.CounterVec
+	promptTokens     *prometheus.CounterVec
+	completionTokens *prometheus.CounterVec
+	promptEval       *prometheus.CounterVec
+	eval             *prometheus.CounterVec
+	total            *prometheus.CounterVec
+
+	mu      sync.Mutex
+	now     func() time.Time
+	buckets [24]usageBucket
+}
+
+// usageBucket holds the per model totals of one hour.
+type usageBucket struct {
+	hour   time.Time
+	models map[string]ModelUsage
+}
+
+// NewMeter returns a Meter for the workspace, registering its metrics with reg.
+func NewMeter(workspace string, reg prometheus.Registerer) *Meter {
+	labels := []string{"workspace", "model", "api_key"}
+	m := &Meter{
+		workspace: workspace,
+		now:       time.Now,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aichat_gateway_requests_total",
+			Help: "Requests forwarded to Ollama by the workspace API gateway, by response code.",
+		}, []string{"workspace", "api_key", "code"}),
+		promptTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aichat_gateway_prompt_tokens_total",
+			Help: "Prompt tokens evaluated by Ollama (prompt_eval_count).",
+		}, labels),
+		completionTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aichat_gateway_completion_tokens_total",
+			Help: "Tokens generated by Ollama (eval_count).",
+		}, labels),
+		promptEval: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aichat_gateway_prompt_eval_seconds_total",
+			Help: "Time spent evaluating prompts (prompt_eval_duration).",
+		}, labels),
+		eval: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aichat_gateway_eval_seconds_total",
+			Help: "Time spent generating tokens (eval_duration).",
+		}, labels),
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aichat_gateway_inference_seconds_total",
+			Help: "Total time spent by Ollama on requests (total_duration).",
+		}, labels),
+	}
+	reg.MustRegister(m.requests, m.promptTokens, m.completionTokens, m.promptEval, m.eval, m.total)
+	return m
+}
+
+// Record adds the usage of one request made with the given key.
+func (m *Meter) Record(keyID string, usage Usage) {
+	m.promptTokens.WithLabelValues(m.workspace, usage.Model, keyID).Add(float64(usage.PromptTokens))
+	m.completionTokens.WithLabelValues(m.workspace, usage.Model, keyID).Add(float64(usage.CompletionTokens))
+	m.promptEval.WithLabelValues(m.workspace, usage.Model, keyID).Add(usage.PromptEval.Seconds())
+	m.eval.WithLabelValues(m.workspace, usage.Model, keyID).Add(usage.Eval.Seconds())
+	m.total.WithLabelValues(m.workspace, usage.Model, keyID).Add(usage.Total.Seconds())
+
+	hour := m.now().Truncate(time.Hour)
+	bucket := &m.buckets[hour.Unix()/3600%int64(len(m.buckets))]
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !bucket.hour.Equal(hour) {
+		*bucket = usageBucket{hour: hour, models: map[string]ModelUsage{}}
+	}
+	total := bucket.models[usage.Model]
+	total.Model = usage.Model
+	total.Requests++
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	bucket.models[usage.Model] = total
+}
+
+// Summary returns the per model usage over the last UsageWindow, sorted by model.
+func (m *Meter) Summary() UsageSummary {
+	since := m.now().Add(-UsageWindow)
+
+	m.mu.Lock()
+	totals := map[string]ModelUsage{}
+	for _, bucket := range m.buckets {
+		if !bucket.hour.After(since.Truncate(time.Hour)) {
+			continue
+		}
+		for model, usage := range bucket.models {
+			total := totals[model]
+			total.Model = model
+			total.Requests += usage.Requests
+			total.PromptTokens += usage.PromptTokens
+			total.CompletionTokens += usage.CompletionTokens
+			totals[model] = total
+		}
+	}
+	m.mu.Unlock()
+
+	summary := UsageSummary{Window: usageWindowName, Models: make([]ModelUsage, 0, len(totals))}
+	for _, usage := range totals {
+		summary.Models = append(summary.Models, usage)
+	}
+	sort.Slice(summary.Models, func(i, j int) bool { return summary.Models[i].Model < summary.Models[j].Model })
+	return summary
+}
+
+// ServeUsage serves the usage summary as JSON.
+func (m *Meter) ServeUsage(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m.Summary())
+}
+
+// meter wraps an upstream response so its usage is recorded once the body has been read.
+func (m *Meter) meter(resp *http.Response, keyID string) {
+	m.requests.WithLabelValues(m.workspace, keyID, strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	resp.Body = &usageReader{ReadCloser: resp.Body, record: func(u Usage) { m.Record(keyID, u) }}
+}
+
+// usageReader parses the response body as it is streamed to the client. Ollama
+// answers with a single JSON object or, when streaming, one JSON object per line
+// where the last one (done: true) carries the counts. The OpenAI compatible
+// endpoints answer with a JSON object or server-sent events with a usage object.
+type usageReader struct {
+	io.ReadCloser
+	record func(Usage)
+
+	line     []byte
+	skipping bool
+	recorded bool
+}
+
+func (u *usageReader) Read(p []byte) (int, error) {
+	n, err := u.ReadCloser.Read(p)
+	u.scan(p[:n])
+	if err == io.EOF {
+		u.flush()
+	}
+	return n, err
+}
+
+func (u *usageReader) Close() error {
+	u.flush()
+	return u.ReadCloser.Close()
+}
+
+func (u *usageReader) scan(b []byte) {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			u.appendLine(b)
+			return
+		}
+		u.appendLine(b[:i])
+		u.flush()
+		b = b[i+1:]
+	}
+}
+
+func (u *usageReader) appendLine(b []byte) {
+	if u.skipping {
+		return
+	}
+	if len(u.line)+len(b) > maxMeteredLine {
+		u.line, u.skipping = u.line[:0], true
+		return
+	}
+	u.line = append(u.line, b...)
+}
+
+// flush parses the buffered line and records it when it carries usage.
+func (u *usageReader) flush() {
+	line := bytes.TrimSpace(u.line)
+	u.line, u.skipping = u.line[:0], false
+	if u.recorded || len(line) == 0 {
+		return
+	}
+
+	line = bytes.TrimPrefix(line, []byte("data:"))
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return
+	}
+
+	if usage, ok := parseUsage(line); ok {
+		u.recorded = true
+		u.record(usage)
+	}
+}
+
+// usageResponse holds the usage fields of the Ollama and OpenAI compatible responses.
+type usageResponse struct {
+	Model              string `json:"model"`
+	Done               bool   `json:"done"`
+	PromptEvalCount    int64  `json:"prompt_eval_count"`
+	EvalCount          int64  `json:"eval_count"`
+	TotalDuration      int64  `json:"total_duration"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration"`
+	EvalDuration       int64  `json:"eval_duration"`
+	Usage              *struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func parseUsage(line []byte) (Usage, bool) {
+	var resp usageResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return Usage{}, false
+	}
+
+	switch {
+	case resp.Usage != nil:
+		return Usage{
+			Model:            resp.Model,
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+		}, true
+	case resp.Done || resp.PromptEvalCount > 0 || resp.EvalCount > 0:
+		return Usage{
+			Model:            resp.Model,
+			PromptTokens:     resp.PromptEvalCount,
+			CompletionTokens: resp.EvalCount,
+			PromptEval:       time.Duration(resp.PromptEvalDuration),
+			Eval:             time.Duration(resp.EvalDuration),
+			Total:            time.Duration(resp.TotalDuration),
+		}, true
+	}
+
+	return Usage{}, false
+}
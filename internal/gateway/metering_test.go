@@ -0,0 +1,119 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMeterResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		model      string
+		prompt     int64
+		completion int64
+	}{
+		{
+			name:       "ollama response",
+			body:       `{"model":"llama3.2:1b","done":true,"prompt_eval_count":12,"eval_count":30,"total_duration":2000000000}`,
+			model:      "llama3.2:1b",
+			prompt:     12,
+			completion: 30,
+		},
+		{
+			name: "ollama stream",
+			body: `{"model":"gemma2:2b","message":{"content":"Hel"},"done":false}` + "\n" +
+				`{"model":"gemma2:2b","message":{"content":"lo"},"done":false}` + "\n" +
+				`{"model":"gemma2:2b","done":true,"prompt_eval_count":5,"eval_count":2,"eval_duration":1000}` + "\n",
+			model:      "gemma2:2b",
+			prompt:     5,
+			completion: 2,
+		},
+		{
+			name:       "openai response",
+			body:       `{"model":"smollm2","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":9,"total_tokens":16}}`,
+			model:      "smollm2",
+			prompt:     7,
+			completion: 9,
+		},
+		{
+			name: "openai stream",
+			body: "data: {\"model\":\"smollm2\",\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+				"data: {\"model\":\"smollm2\",\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1}}\n\n" +
+				"data: [DONE]\n\n",
+			model:      "smollm2",
+			prompt:     3,
+			completion: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := NewMeter("team-a", prometheus.NewRegistry())
+			resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(tt.body))}
+			meter.meter(resp, "default")
+
+			// Read in small chunks so lines are split across reads.
+			buf := make([]byte, 7)
+			for {
+				if _, err := resp.Body.Read(buf); err != nil {
+					break
+				}
+			}
+			_ = resp.Body.Close()
+
+			if got := testutil.ToFloat64(meter.promptTokens.WithLabelValues("team-a", tt.model, "default")); got != float64(tt.prompt) {
+				t.Fatalf("expected %d prompt tokens, got %v", tt.prompt, got)
+			}
+			if got := testutil.ToFloat64(meter.completionTokens.WithLabelValues("team-a", tt.model, "default")); got != float64(tt.completion) {
+				t.Fatalf("expected %d completion tokens, got %v", tt.completion, got)
+			}
+			summary := meter.Summary()
+			if len(summary.Models) != 1 || summary.Models[0].Requests != 1 {
+				t.Fatalf("expected a single metered request, got %+v", summary)
+			}
+		})
+	}
+}
+
+func TestMeterSummaryWindow(t *testing.T) {
+	now := time.Date(2024, 11, 1, 12, 30, 0, 0, time.UTC)
+	meter := NewMeter("team-a", prometheus.NewRegistry())
+
+	meter.now = func() time.Time { return now.Add(-25 * time.Hour) }
+	meter.Record("default", Usage{Model: "llama3.2:1b", PromptTokens: 100})
+	meter.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	meter.Record("default", Usage{Model: "llama3.2:1b", PromptTokens: 10, CompletionTokens: 1})
+	meter.now = func() time.Time { return now }
+	meter.Record("ci.build", Usage{Model: "llama3.2:1b", PromptTokens: 5, CompletionTokens: 2})
+
+	summary := meter.Summary()
+	if summary.Window != "24h" || len(summary.Models) != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if got := summary.Models[0]; got.Requests != 2 || got.PromptTokens != 15 || got.CompletionTokens != 3 {
+		t.Fatalf("usage older than the window was counted: %+v", got)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inference abstracts the inference servers a workspace can run: how they are deployed,
+// checked and wired into Open WebUI, and how their models are listed, installed and removed.
+package inference
+
+import (
+	"errors"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+)
+
+// ErrLoadedAtStartup is returned by the backends loading their models when the server starts, from
+// the arguments of their StatefulSet, when asked to install or remove a model through their API.
+var ErrLoadedAtStartup = errors.New("the models are loaded when the server starts")
+
+// Backend is an inference server serving the models of a workspace.
+type Backend interface {
+	// Engine is the value of spec.backend.engine selecting the backend.
+	Engine() appsv1alpha1.BackendEngine
+
+	// Port is the port of the inference API, on the container and on its Service.
+	Port() int32
+
+	// InstallsModels reports whether the models are installed at runtime through InstallModel.
+	// When false, they are loaded at startup and only listed.
+	InstallsModels() bool
+
+	// ValidateModels returns the spec.models entries the backend can't serve.
+	ValidateModels(models []appsv1alpha1.ModelSpec) error
+
+	// StatefulSet returns the workload running the server with the models of the workspace.
+	StatefulSet(namespace, name string, models []appsv1alpha1.ModelSpec, cfg *config.Config) *appsv1.StatefulSet
+
+	// Healthy returns an error when the API at baseURL doesn't serve requests.
+	Healthy(baseURL string) error
+
+	// ListModels returns the names of the served models, with their digest when the backend knows it.
+	ListModels(baseURL string) (map[string]string, error)
+
+	// InstallModel installs a model from its source and returns the number of bytes downloaded.
+	InstallModel(model appsv1alpha1.ModelSpec, cfg *config.Config, baseURL string) (int64, error)
+
+	// DeleteModel removes a served model.
+	DeleteModel(name, baseURL string) error
+
+	// ConfigureOpenWebUI points the Open WebUI Deployment at the API at baseURL.
+	ConfigureOpenWebUI(deployment *appsv1.Deployment, baseURL string)
+}
+
+/**
+ * Returns the backend of an engine.
+ *
+ * @param engine The engine of spec.backend.engine, Ollama when empty.
+ * @return The backend, or an error if the engine is unknown.
+ */
+func For(engine appsv1alpha1.BackendEngine) (Backend, error) {
+	switch engine {
+	case "", appsv1alpha1.BackendEngineOllama:
+		return Ollama{}, nil
+	case appsv1alpha1.BackendEngineLlamaCpp:
+		return LlamaCpp{}, nil
+	default:
+		return nil, fmt.Errorf("unknown inference engine %q", engine)
+	}
+}
+
+/**
+ * Returns the name a model is pulled from a registry under, and whether it comes from a registry.
+ *
+ * Models without a source come from the Ollama library, Hugging Face models from the hf.co
+ * registry. Both are rewritten with the modelNameRewrites of the configuration.
+ *
+ * @param model The model of spec.models.
+ * @param cfg The configuration of the workspace.
+ * @return The registry name, and false for the models imported from a URL or a PVC.
+ */
+func RegistryName(model appsv1alpha1.ModelSpec, cfg *config.Config) (string, bool) {
+	switch {
+	case model.Source == nil:
+		return cfg.RewriteModelName(model.Name), true
+	case model.Source.HuggingFace != "":
+		return cfg.RewriteModelName("hf.co/" + model.Source.HuggingFace), true
+	default:
+		return "", false
+	}
+}
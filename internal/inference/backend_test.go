@@ -0,0 +1,139 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inference
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Parse(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "system"},
+		Data: map[string]string{
+			"defaultDomain":     "localtest.me",
+			"openwebUIImageTag": "main",
+			"ollamaImageTag":    "0.4.1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestFor(t *testing.T) {
+	for engine, want := range map[appsv1alpha1.BackendEngine]appsv1alpha1.BackendEngine{
+		"":                                 appsv1alpha1.BackendEngineOllama,
+		appsv1alpha1.BackendEngineOllama:   appsv1alpha1.BackendEngineOllama,
+		appsv1alpha1.BackendEngineLlamaCpp: appsv1alpha1.BackendEngineLlamaCpp,
+	} {
+		backend, err := For(engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backend.Engine() != want {
+			t.Errorf("For(%q) = %s, want %s", engine, backend.Engine(), want)
+		}
+	}
+	if _, err := For("vllm"); err == nil {
+		t.Error("For(vllm) succeeded, want an error")
+	}
+}
+
+func TestLlamaCppValidateModels(t *testing.T) {
+	hf := &appsv1alpha1.ModelSource{HuggingFace: "ggml-org/gemma-3-1b-it-GGUF"}
+	for name, tc := range map[string]struct {
+		models []appsv1alpha1.ModelSpec
+		valid  bool
+	}{
+		"huggingFace": {models: []appsv1alpha1.ModelSpec{{Name: "gemma3", Source: hf}}, valid: true},
+		"no model":    {models: nil},
+		"two models":  {models: []appsv1alpha1.ModelSpec{{Name: "a", Source: hf}, {Name: "b", Source: hf}}},
+		"library":     {models: []appsv1alpha1.ModelSpec{{Name: "llama3.2:1b"}}},
+		"alias":       {models: []appsv1alpha1.ModelSpec{{Name: "gemma3", Source: hf, Alias: "chat"}}},
+		"preload":     {models: []appsv1alpha1.ModelSpec{{Name: "gemma3", Source: hf, Preload: true}}},
+	} {
+		err := LlamaCpp{}.ValidateModels(tc.models)
+		if tc.valid != (err == nil) {
+			t.Errorf("%s: ValidateModels() = %v, want valid %t", name, err, tc.valid)
+		}
+	}
+}
+
+func TestLlamaCppStatefulSet(t *testing.T) {
+	cfg := testConfig(t)
+
+	sts := LlamaCpp{}.StatefulSet("team-a", "team-a-ollama", []appsv1alpha1.ModelSpec{{
+		Name:   "gemma3",
+		Source: &appsv1alpha1.ModelSource{HuggingFace: "ggml-org/gemma-3-1b-it-GGUF"},
+	}}, cfg)
+	container := sts.Spec.Template.Spec.Containers[0]
+	if container.Image != cfg.LlamaCppImage() {
+		t.Errorf("image = %s, want %s", container.Image, cfg.LlamaCppImage())
+	}
+	for _, args := range [][]string{{"--alias", "gemma3"}, {"--hf-repo", "ggml-org/gemma-3-1b-it-GGUF"}, {"--port", "8080"}} {
+		if i := slices.Index(container.Args, args[0]); i < 0 || container.Args[i+1] != args[1] {
+			t.Errorf("args = %v, want %s %s", container.Args, args[0], args[1])
+		}
+	}
+	if len(sts.Spec.Template.Spec.InitContainers) != 0 {
+		t.Errorf("init containers = %v, want none", sts.Spec.Template.Spec.InitContainers)
+	}
+
+	sts = LlamaCpp{}.StatefulSet("team-a", "team-a-ollama", []appsv1alpha1.ModelSpec{{
+		Name: "gemma3",
+		Source: &appsv1alpha1.ModelSource{URL: &appsv1alpha1.URLModelSource{
+			URL:    "https://models.example.com/gemma3.gguf",
+			SHA256: "sha256:0123",
+		}},
+	}}, cfg)
+	container = sts.Spec.Template.Spec.Containers[0]
+	if i := slices.Index(container.Args, "--model"); i < 0 || container.Args[i+1] != "/cache/0123.gguf" {
+		t.Errorf("args = %v, want --model /cache/0123.gguf", container.Args)
+	}
+	if init := sts.Spec.Template.Spec.InitContainers; len(init) != 1 || init[0].Image != cfg.ImporterImage() {
+		t.Errorf("init containers = %v, want the download container", init)
+	}
+}
+
+func TestLlamaCppConfigureOpenWebUI(t *testing.T) {
+	deployment := k8s.NewDeployment("team-a", "team-a-openwebui", 8080, "open-webui:main", "cluster.local")
+	LlamaCpp{}.ConfigureOpenWebUI(deployment, "http://team-a-ollama.team-a.svc.cluster.local:8080")
+
+	env := map[string]string{}
+	for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if _, ok := env["OLLAMA_BASE_URL"]; ok {
+		t.Error("OLLAMA_BASE_URL is set, want it removed")
+	}
+	if got, want := env["OPENAI_API_BASE_URL"], "http://team-a-ollama.team-a.svc.cluster.local:8080/v1"; got != want {
+		t.Errorf("OPENAI_API_BASE_URL = %q, want %q", got, want)
+	}
+	if env["ENABLE_OLLAMA_API"] != "false" {
+		t.Errorf("ENABLE_OLLAMA_API = %q, want false", env["ENABLE_OLLAMA_API"])
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inference
+
+import (
+	"errors"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/llamacpp"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ollama"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// LlamaCpp runs the CPU llama.cpp server. It loads a single GGUF model at startup and serves it
+// through its OpenAI-compatible API; changing the model restarts the server.
+type LlamaCpp struct{}
+
+var _ Backend = LlamaCpp{}
+
+func (LlamaCpp) Engine() appsv1alpha1.BackendEngine { return appsv1alpha1.BackendEngineLlamaCpp }
+
+func (LlamaCpp) Port() int32 { return constants.LlamaCppPort }
+
+func (LlamaCpp) InstallsModels() bool { return false }
+
+/**
+ * Checks the models can be served by llama.cpp.
+ *
+ * The server serves exactly one model, from a GGUF source. The features implemented with the
+ * Ollama API, the digests, aliases, parameters and preloading, are not available.
+ */
+func (LlamaCpp) ValidateModels(models []appsv1alpha1.ModelSpec) error {
+	if len(models) != 1 {
+		return fmt.Errorf("the llamacpp engine serves exactly one model, spec.models has %d", len(models))
+	}
+
+	var errs []error
+	model := models[0]
+	if model.Source == nil {
+		errs = append(errs, errors.New("spec.models[0].source is required by the llamacpp engine, the Ollama library is not available"))
+	}
+	if model.Digest != "" || model.Alias != "" || len(model.Parameters) > 0 || model.Preload || model.KeepAlive != nil {
+		errs = append(errs, errors.New("spec.models[0] can't set digest, alias, parameters, preload or keepAlive with the llamacpp engine"))
+	}
+	return errors.Join(errs...)
+}
+
+func (LlamaCpp) StatefulSet(namespace, name string, models []appsv1alpha1.ModelSpec, cfg *config.Config) *appsv1.StatefulSet {
+	var model k8s.LlamaCppModel
+	if len(models) > 0 {
+		model.Name = models[0].Name
+		if source := models[0].Source; source != nil {
+			switch {
+			case source.HuggingFace != "":
+				model.HuggingFace = source.HuggingFace
+			case source.URL != nil:
+				model.URL, model.SHA256, model.DownloadImage = source.URL.URL, source.URL.SHA256, cfg.ImporterImage()
+			case source.PVC != nil:
+				model.ClaimName, model.Path = source.PVC.ClaimName, source.PVC.Path
+			}
+		}
+	}
+	return k8s.NewLlamaCppStatefulSet(namespace, name, constants.LlamaCppPort, constants.OllamaDefaultVolumeSize, cfg.LlamaCppImage(), model)
+}
+
+func (LlamaCpp) Healthy(baseURL string) error {
+	return llamacpp.Healthy(baseURL)
+}
+
+// ListModels lists the served models under their name:tag, like Ollama lists them. llama.cpp
+// doesn't report digests.
+func (LlamaCpp) ListModels(baseURL string) (map[string]string, error) {
+	names, err := llamacpp.ListModels(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make(map[string]string, len(names))
+	for _, name := range names {
+		models[ollama.FullName(name)] = ""
+	}
+	return models, nil
+}
+
+func (LlamaCpp) InstallModel(appsv1alpha1.ModelSpec, *config.Config, string) (int64, error) {
+	return 0, ErrLoadedAtStartup
+}
+
+func (LlamaCpp) DeleteModel(string, string) error {
+	return ErrLoadedAtStartup
+}
+
+func (LlamaCpp) ConfigureOpenWebUI(deployment *appsv1.Deployment, baseURL string) {
+	k8s.SetOpenAIURL(deployment, baseURL)
+}
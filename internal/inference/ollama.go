@@ -0,0 +1,80 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inference
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/k8s"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/adapters/ollama"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// Ollama runs Ollama, which pulls and imports the models at runtime through its API.
+type Ollama struct{}
+
+var _ Backend = Ollama{}
+
+func (Ollama) Engine() appsv1alpha1.BackendEngine { return appsv1alpha1.BackendEngineOllama }
+
+func (Ollama) Port() int32 { return constants.OllamaPort }
+
+func (Ollama) InstallsModels() bool { return true }
+
+// ValidateModels accepts every model, ValidateModels of the API checked them already.
+func (Ollama) ValidateModels([]appsv1alpha1.ModelSpec) error { return nil }
+
+func (Ollama) StatefulSet(namespace, name string, _ []appsv1alpha1.ModelSpec, cfg *config.Config) *appsv1.StatefulSet {
+	return k8s.NewStatefulSet(namespace, name, constants.OllamaPort, constants.OllamaDefaultVolumeSize, cfg.OllamaImage())
+}
+
+func (Ollama) Healthy(baseURL string) error {
+	_, err := ollama.ListModels(baseURL)
+	return err
+}
+
+func (Ollama) ListModels(baseURL string) (map[string]string, error) {
+	return ollama.ListModelDigests(baseURL)
+}
+
+/**
+ * Installs a model on Ollama.
+ *
+ * Models are pulled from their registry, through the model cache when one is configured, and
+ * copied to their name when they were pulled under another one. Models from a URL or a PVC are
+ * imported by a Job of the workspace namespace instead.
+ */
+func (Ollama) InstallModel(model appsv1alpha1.ModelSpec, cfg *config.Config, baseURL string) (int64, error) {
+	// the tag is checked for updates against the registry, only the download goes through the cache.
+	source, _ := RegistryName(model, cfg)
+	pullName, insecure := cfg.CachedModelName(source)
+	pulledBytes, err := ollama.PullModel(pullName, insecure, baseURL)
+	if err == nil && ollama.FullName(pullName) != ollama.FullName(model.Name) {
+		err = ollama.CopyModel(pullName, model.Name, baseURL)
+	}
+	return pulledBytes, err
+}
+
+func (Ollama) DeleteModel(name, baseURL string) error {
+	return ollama.DeleteModel(name, baseURL)
+}
+
+func (Ollama) ConfigureOpenWebUI(deployment *appsv1.Deployment, baseURL string) {
+	k8s.SetOllamaURL(deployment, baseURL)
+}
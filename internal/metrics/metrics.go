@@ -0,0 +1,158 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the operator Prometheus metrics. They are registered with the
+// controller-runtime registry and served by the manager metrics endpoint.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Outcomes of an ensure* call.
+const (
+	OutcomeOK      = "ok"
+	OutcomeRequeue = "requeue"
+	OutcomeError   = "error"
+)
+
+var (
+	// ReconcileStepDuration is the time spent in each step of the AIChatWorkspace reconcile chain.
+	ReconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aichatworkspace_reconcile_step_duration_seconds",
+		Help:    "Time spent in each step (Init, Finalizer, Create, Update, Delete) of the AIChatWorkspace reconcile.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"step"})
+
+	// EnsureTotal counts the outcome of every ensure* call.
+	EnsureTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aichatworkspace_ensure_total",
+		Help: "Outcomes (ok, requeue, error) of the ensure functions reconciling the workspace resources.",
+	}, []string{"resource", "outcome"})
+
+	// ModelPullDuration is the time taken to pull a model into a workspace.
+	ModelPullDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aichatworkspace_model_pull_duration_seconds",
+		Help:    "Time taken to pull a model into a workspace.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+	}, []string{"workspace", "model"})
+
+	// ModelPullBytes counts the bytes downloaded by model pulls.
+	ModelPullBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aichatworkspace_model_pull_bytes_total",
+		Help: "Bytes downloaded while pulling models.",
+	}, []string{"workspace", "model"})
+
+	// ModelPullFailures counts the failed model pulls.
+	ModelPullFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aichatworkspace_model_pull_failures_total",
+		Help: "Model pulls that failed.",
+	}, []string{"workspace", "model"})
+
+	// WorkspaceModels is the number of models present in a workspace.
+	WorkspaceModels = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aichatworkspace_models",
+		Help: "Number of models present in the workspace Ollama.",
+	}, []string{"workspace"})
+
+	// WorkspaceModelBytes is the disk space used by the models of a workspace.
+	WorkspaceModelBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aichatworkspace_model_bytes",
+		Help: "Bytes on disk used by the models of the workspace Ollama.",
+	}, []string{"workspace"})
+
+	// OllamaRequests counts the requests sent by the operator to the workspace Ollama APIs.
+	OllamaRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aichatworkspace_ollama_requests_total",
+		Help: "Requests sent by the operator to the workspace Ollama APIs, by endpoint.",
+	}, []string{"endpoint"})
+
+	// OrphanedNamespaces is the number of workspace namespaces whose AIChatWorkspace no longer exists.
+	OrphanedNamespaces = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "aichatworkspace_orphaned_namespaces",
+		Help: "Workspace namespaces whose AIChatWorkspace no longer exists, as of the last orphan sweep.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		ReconcileStepDuration,
+		EnsureTotal,
+		ModelPullDuration,
+		ModelPullBytes,
+		ModelPullFailures,
+		WorkspaceModels,
+		WorkspaceModelBytes,
+		OllamaRequests,
+		OrphanedNamespaces,
+	)
+}
+
+// ObserveStep records the time spent in a reconcile step started at start.
+func ObserveStep(step string, start time.Time) {
+	ReconcileStepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+}
+
+// ObserveEnsure records the outcome of an ensure* call. A nil result means the
+// reconcile moves on, a non nil result stops it with or without an error.
+func ObserveEnsure(resource string, requeue bool, err error) {
+	outcome := OutcomeOK
+	switch {
+	case err != nil:
+		outcome = OutcomeError
+	case requeue:
+		outcome = OutcomeRequeue
+	}
+	EnsureTotal.WithLabelValues(resource, outcome).Inc()
+}
+
+// ObserveModelPull records a model pull that took duration and downloaded bytes.
+func ObserveModelPull(workspace, model string, duration time.Duration, bytes int64, err error) {
+	if err != nil {
+		ModelPullFailures.WithLabelValues(workspace, model).Inc()
+		return
+	}
+	ModelPullDuration.WithLabelValues(workspace, model).Observe(duration.Seconds())
+	ModelPullBytes.WithLabelValues(workspace, model).Add(float64(bytes))
+}
+
+// SetWorkspaceModels records the models present in a workspace.
+func SetWorkspaceModels(workspace string, count int, bytes int64) {
+	WorkspaceModels.WithLabelValues(workspace).Set(float64(count))
+	WorkspaceModelBytes.WithLabelValues(workspace).Set(float64(bytes))
+}
+
+// ObserveOllamaRequest records a request sent to an Ollama API endpoint, e.g. /api/tags.
+func ObserveOllamaRequest(endpoint string) {
+	OllamaRequests.WithLabelValues(endpoint).Inc()
+}
+
+// SetOrphanedNamespaces records the number of orphaned workspace namespaces found by a sweep.
+func SetOrphanedNamespaces(count int) {
+	OrphanedNamespaces.Set(float64(count))
+}
+
+// DeleteWorkspace removes the series of a deleted workspace.
+func DeleteWorkspace(workspace string) {
+	WorkspaceModels.DeleteLabelValues(workspace)
+	WorkspaceModelBytes.DeleteLabelValues(workspace)
+	ModelPullDuration.DeletePartialMatch(prometheus.Labels{"workspace": workspace})
+	ModelPullBytes.DeletePartialMatch(prometheus.Labels{"workspace": workspace})
+	ModelPullFailures.DeletePartialMatch(prometheus.Labels{"workspace": workspace})
+}
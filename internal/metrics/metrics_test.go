@@ -0,0 +1,50 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveEnsure(t *testing.T) {
+	EnsureTotal.Reset()
+
+	ObserveEnsure("Deployment", false, nil)
+	ObserveEnsure("Deployment", false, nil)
+	ObserveEnsure("Deployment", true, nil)
+	ObserveEnsure("Deployment", true, errors.New("conflict"))
+	// an error without a result is still an error, not a requeue.
+	ObserveEnsure("IngressCondition", false, errors.New("conflict"))
+
+	for _, tc := range []struct {
+		resource, outcome string
+		want              float64
+	}{
+		{"Deployment", OutcomeOK, 2},
+		{"Deployment", OutcomeRequeue, 1},
+		{"Deployment", OutcomeError, 1},
+		{"IngressCondition", OutcomeError, 1},
+		{"IngressCondition", OutcomeRequeue, 0},
+	} {
+		if got := testutil.ToFloat64(EnsureTotal.WithLabelValues(tc.resource, tc.outcome)); got != tc.want {
+			t.Errorf("aichatworkspace_ensure_total{resource=%q,outcome=%q} = %v, want %v", tc.resource, tc.outcome, got, tc.want)
+		}
+	}
+}
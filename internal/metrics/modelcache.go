@@ -0,0 +1,114 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/chaunceyt/aichat-workspace-operator/internal/config"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/modelcache"
+)
+
+var (
+	modelCacheUpDesc = prometheus.NewDesc("aichatworkspace_model_cache_up",
+		"Whether the model cache set by modelCacheURL answered the last scrape.", nil, nil)
+	modelCacheHitRatioDesc = prometheus.NewDesc("aichatworkspace_model_cache_hit_ratio",
+		"Share of the model blob requests served from the model cache since it started.", nil, nil)
+	modelCacheRequestsDesc = prometheus.NewDesc("aichatworkspace_model_cache_requests_total",
+		"Model blob requests served by the model cache, by result (hit or miss).", []string{"result"}, nil)
+	modelCacheBytesSavedDesc = prometheus.NewDesc("aichatworkspace_model_cache_bytes_saved_total",
+		"Bytes of model blobs served from the model cache instead of the registry.", nil, nil)
+	modelCacheCachedBytesDesc = prometheus.NewDesc("aichatworkspace_model_cache_cached_bytes",
+		"Bytes of model blobs stored in the model cache.", nil, nil)
+)
+
+// ModelCacheCollector reports the statistics of the model cache at scrape time. Nothing is
+// reported when no cache is configured.
+type ModelCacheCollector struct {
+	loader *config.Loader
+	client *http.Client
+}
+
+// NewModelCacheCollector returns a collector reading the model cache URL with loader.
+func NewModelCacheCollector(loader *config.Loader) *ModelCacheCollector {
+	return &ModelCacheCollector{loader: loader, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ModelCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- modelCacheUpDesc
+	ch <- modelCacheHitRatioDesc
+	ch <- modelCacheRequestsDesc
+	ch <- modelCacheBytesSavedDesc
+	ch <- modelCacheCachedBytesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ModelCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg, err := c.loader.Load(ctx)
+	if err != nil || cfg.ModelCacheURL == "" {
+		return
+	}
+
+	report, err := c.report(ctx, cfg.ModelCacheURL)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(modelCacheUpDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(modelCacheUpDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(modelCacheHitRatioDesc, prometheus.GaugeValue, report.HitRatio())
+	ch <- prometheus.MustNewConstMetric(modelCacheRequestsDesc, prometheus.CounterValue, float64(report.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(modelCacheRequestsDesc, prometheus.CounterValue, float64(report.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(modelCacheBytesSavedDesc, prometheus.CounterValue, float64(report.BytesSaved))
+	ch <- prometheus.MustNewConstMetric(modelCacheCachedBytesDesc, prometheus.GaugeValue, float64(report.CachedBytes))
+}
+
+// report reads the statistics served by the model cache.
+func (c *ModelCacheCollector) report(ctx context.Context, cacheURL string) (*modelcache.Report, error) {
+	statsURL, err := url.JoinPath(cacheURL, modelcache.StatsPath)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, statsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reading %s: %s", statsURL, resp.Status)
+	}
+
+	report := &modelcache.Report{}
+	if err := json.NewDecoder(resp.Body).Decode(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
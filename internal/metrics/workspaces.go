@@ -0,0 +1,101 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// Workspace states reported by the workspaces collector.
+const (
+	StateReady       = "Ready"
+	StateNotReady    = "NotReady"
+	StateSuspended   = "Suspended"
+	StateTerminating = "Terminating"
+)
+
+var workspacesDesc = prometheus.NewDesc(
+	"aichatworkspace_workspaces",
+	"Number of AIChatWorkspaces by state. Suspended workspaces have their Open WebUI scaled to zero.",
+	[]string{"state"}, nil,
+)
+
+// WorkspacesCollector counts the AIChatWorkspaces by state at scrape time.
+type WorkspacesCollector struct {
+	reader client.Reader
+}
+
+// NewWorkspacesCollector returns a collector reading the workspaces with reader,
+// usually the manager cache.
+func NewWorkspacesCollector(reader client.Reader) *WorkspacesCollector {
+	return &WorkspacesCollector{reader: reader}
+}
+
+// Describe implements prometheus.Collector.
+func (c *WorkspacesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- workspacesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *WorkspacesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	workspaces := &appsv1alpha1.AIChatWorkspaceList{}
+	if err := c.reader.List(ctx, workspaces); err != nil {
+		ch <- prometheus.NewInvalidMetric(workspacesDesc, err)
+		return
+	}
+
+	counts := map[string]int{StateReady: 0, StateNotReady: 0, StateSuspended: 0, StateTerminating: 0}
+	for i := range workspaces.Items {
+		counts[c.state(ctx, &workspaces.Items[i])]++
+	}
+
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(workspacesDesc, prometheus.GaugeValue, float64(count), state)
+	}
+}
+
+func (c *WorkspacesCollector) state(ctx context.Context, workspace *appsv1alpha1.AIChatWorkspace) string {
+	if !workspace.DeletionTimestamp.IsZero() {
+		return StateTerminating
+	}
+
+	openwebui := &appsv1.Deployment{}
+	name := fmt.Sprintf("%s-%s", workspace.Spec.WorkspaceName, constants.OpenwebuiName)
+	err := c.reader.Get(ctx, types.NamespacedName{Name: name, Namespace: workspace.Spec.WorkspaceName}, openwebui)
+	if err == nil && openwebui.Spec.Replicas != nil && *openwebui.Spec.Replicas == 0 {
+		return StateSuspended
+	}
+
+	if apimeta.IsStatusConditionTrue(workspace.Status.Conditions, appsv1alpha1.ConditionTypeReady) {
+		return StateReady
+	}
+	return StateNotReady
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+)
+
+func workspace(name string, ready bool) *appsv1alpha1.AIChatWorkspace {
+	ws := &appsv1alpha1.AIChatWorkspace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "aichat-workspace-operator-system"},
+		Spec:       appsv1alpha1.AIChatWorkspaceSpec{WorkspaceName: name},
+	}
+	if ready {
+		ws.Status.Conditions = []metav1.Condition{{Type: appsv1alpha1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: "Ready"}}
+	}
+	return ws
+}
+
+func TestWorkspacesCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := appsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	terminating := workspace("team-d", true)
+	terminating.Finalizers = []string{"core.aichatworkspace.io/finalizer"}
+	terminating.DeletionTimestamp = ptr.To(metav1.Now())
+	suspended := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-c-openwebui", Namespace: "team-c"},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To[int32](0)},
+	}
+	objs := []client.Object{workspace("team-a", true), workspace("team-b", false), workspace("team-c", true), terminating, suspended}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+	expected := `
+# HELP aichatworkspace_workspaces Number of AIChatWorkspaces by state. Suspended workspaces have their Open WebUI scaled to zero.
+# TYPE aichatworkspace_workspaces gauge
+aichatworkspace_workspaces{state="NotReady"} 1
+aichatworkspace_workspaces{state="Ready"} 1
+aichatworkspace_workspaces{state="Suspended"} 1
+aichatworkspace_workspaces{state="Terminating"} 1
+`
+	if err := testutil.CollectAndCompare(NewWorkspacesCollector(reader), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
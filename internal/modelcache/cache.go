@@ -0,0 +1,440 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// HealthPath is served by the cache itself, it doesn't reach the upstream registry.
+const HealthPath = "/healthz"
+
+var (
+	// manifestPath and blobPath match the registry API paths Ollama pulls models with,
+	// /v2/<namespace>/<model>/manifests/<tag> and /v2/<namespace>/<model>/blobs/<digest>.
+	manifestPath = regexp.MustCompile(`^/v2/([a-zA-Z0-9][a-zA-Z0-9._-]*)/([a-zA-Z0-9][a-zA-Z0-9._-]*)/manifests/([a-zA-Z0-9_][a-zA-Z0-9._-]{0,127})$`)
+	blobPath     = regexp.MustCompile(`^/v2/([a-zA-Z0-9][a-zA-Z0-9._-]*)/([a-zA-Z0-9][a-zA-Z0-9._-]*)/blobs/sha256:([a-f0-9]{64})$`)
+)
+
+// Options configures a Cache.
+type Options struct {
+	// Upstream is the registry the models are pulled from, e.g. https://registry.ollama.ai.
+	Upstream *url.URL
+
+	// Dir stores the cached manifests and blobs.
+	Dir string
+
+	// MaxBytes bounds the size of the cached blobs, the least recently used ones are evicted
+	// beyond it. Zero disables the eviction.
+	MaxBytes int64
+
+	// Client is used to reach the upstream registry. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	Logger logr.Logger
+}
+
+// Cache is an http.Handler serving the registry API of Ollama from a local copy of the
+// upstream registry.
+//
+// Blobs are content addressed, they are served from the cache once downloaded. A blob missing
+// from the cache is streamed from upstream and stored on the way; range requests, used by Ollama
+// to download large blobs in parallel, are passed through and the blob is downloaded in the
+// background. Manifests map tags to blobs, they are always read from upstream and the cached copy
+// is only served when upstream can't be reached.
+type Cache struct {
+	opts  Options
+	stats *Stats
+
+	mu       sync.Mutex
+	fetching map[string]bool
+}
+
+// New returns a Cache for the given options.
+func New(opts Options) (*Cache, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	for _, dir := range []string{"blobs", "manifests", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(opts.Dir, dir), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	c := &Cache{opts: opts, stats: &Stats{}, fetching: map[string]bool{}}
+	c.evict()
+	return c, nil
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() *Stats {
+	return c.stats
+}
+
+// ServeHTTP implements http.Handler.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "the cache is read only")
+		return
+	}
+
+	switch p := req.URL.Path; {
+	case p == HealthPath:
+		w.WriteHeader(http.StatusOK)
+	case p == "/v2" || p == "/v2/":
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	case p == StatsPath:
+		c.stats.ServeStats(w, req)
+	case manifestPath.MatchString(p):
+		m := manifestPath.FindStringSubmatch(p)
+		c.serveManifest(w, req, m[1], m[2], m[3])
+	case blobPath.MatchString(p):
+		m := blobPath.FindStringSubmatch(p)
+		c.serveBlob(w, req, m[1]+"/"+m[2], m[3])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// serveManifest serves the manifest of a model tag from upstream, or from the cache when upstream
+// can't be reached.
+func (c *Cache) serveManifest(w http.ResponseWriter, req *http.Request, namespace, model, tag string) {
+	cached := filepath.Join(c.opts.Dir, "manifests", namespace, model, tag)
+
+	resp, err := c.upstream(req.Context(), http.MethodGet, req.URL.Path, req.Header)
+	if err == nil && resp.StatusCode == http.StatusOK {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		if err := writeFile(cached, body); err != nil {
+			c.opts.Logger.Error(err, "unable to cache manifest", "model", namespace+"/"+model, "tag", tag)
+		}
+		serveManifest(w, req, resp.Header.Get("Content-Type"), body)
+		return
+	}
+
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode < http.StatusInternalServerError {
+			// the registry answered, e.g. the tag doesn't exist: don't hide it with a stale copy.
+			copyResponse(w, resp)
+			return
+		}
+		err = fmt.Errorf("upstream replied %s", resp.Status)
+	}
+
+	body, readErr := os.ReadFile(cached)
+	if readErr != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	c.opts.Logger.Info("serving cached manifest, upstream is unavailable", "model", namespace+"/"+model, "tag", tag, "error", err.Error())
+	serveManifest(w, req, "application/vnd.docker.distribution.manifest.v2+json", body)
+}
+
+// serveBlob serves a blob from the cache, or from upstream while it is stored in the cache.
+func (c *Cache) serveBlob(w http.ResponseWriter, req *http.Request, repository, hexDigest string) {
+	path := c.blobFile(hexDigest)
+
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		counter := &countingWriter{ResponseWriter: w}
+		w.Header().Set("Docker-Content-Digest", "sha256:"+hexDigest)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(counter, req, "", time.Time{}, f)
+		c.stats.hit(counter.n)
+		return
+	}
+
+	if req.Method == http.MethodHead || req.Header.Get("Range") != "" {
+		c.stats.miss(0)
+		resp, err := c.upstream(req.Context(), req.Method, req.URL.Path, req.Header)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		defer resp.Body.Close()
+		n := copyResponse(w, resp)
+		c.stats.upstream(n)
+		if resp.StatusCode < http.StatusMultipleChoices {
+			go c.fetchBlob(repository, hexDigest)
+		}
+		return
+	}
+
+	c.stats.miss(0)
+	if !c.startFetch(hexDigest) {
+		// another request is storing the blob, stream it from upstream without storing it.
+		resp, err := c.upstream(req.Context(), req.Method, req.URL.Path, req.Header)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		defer resp.Body.Close()
+		c.stats.upstream(copyResponse(w, resp))
+		return
+	}
+	defer c.endFetch(hexDigest)
+
+	resp, err := c.upstream(req.Context(), http.MethodGet, req.URL.Path, req.Header)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		copyResponse(w, resp)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(c.opts.Dir, "tmp"), hexDigest+"-*")
+	if err != nil {
+		c.opts.Logger.Error(err, "unable to cache blob", "digest", hexDigest)
+		c.stats.upstream(copyResponse(w, resp))
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	header := w.Header()
+	for _, key := range []string{"Content-Length", "Content-Type", "Docker-Content-Digest"} {
+		if value := resp.Header.Get(key); value != "" {
+			header.Set(key, value)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, tmp, hash), resp.Body)
+	c.stats.upstream(n)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.opts.Logger.Error(err, "unable to stream blob", "digest", hexDigest)
+		return
+	}
+	c.store(tmp.Name(), hexDigest, hash.Sum(nil))
+}
+
+// fetchBlob downloads a blob into the cache, unless it is cached or being downloaded already.
+func (c *Cache) fetchBlob(repository, hexDigest string) {
+	if _, err := os.Stat(c.blobFile(hexDigest)); err == nil || !c.startFetch(hexDigest) {
+		return
+	}
+	defer c.endFetch(hexDigest)
+
+	logger := c.opts.Logger.WithValues("digest", hexDigest)
+	logger.Info("downloading blob into the cache")
+
+	resp, err := c.upstream(context.Background(), http.MethodGet, fmt.Sprintf("/v2/%s/blobs/sha256:%s", repository, hexDigest), nil)
+	if err != nil {
+		logger.Error(err, "unable to download blob")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Info("unable to download blob", "status", resp.Status)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(c.opts.Dir, "tmp"), hexDigest+"-*")
+	if err != nil {
+		logger.Error(err, "unable to cache blob")
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	c.stats.upstream(n)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Error(err, "unable to download blob")
+		return
+	}
+	c.store(tmp.Name(), hexDigest, hash.Sum(nil))
+}
+
+// store moves a downloaded blob into the cache when it has the expected digest.
+func (c *Cache) store(tmp, hexDigest string, sum []byte) {
+	if got := hex.EncodeToString(sum); got != hexDigest {
+		c.opts.Logger.Info("not caching blob, its digest doesn't match", "digest", hexDigest, "got", got)
+		return
+	}
+	if err := os.Rename(tmp, c.blobFile(hexDigest)); err != nil {
+		c.opts.Logger.Error(err, "unable to cache blob", "digest", hexDigest)
+		return
+	}
+	c.evict()
+}
+
+// evict removes the least recently used blobs until the cache fits in MaxBytes, and records the
+// size of the cache.
+func (c *Cache) evict() {
+	dir := filepath.Join(c.opts.Dir, "blobs")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		c.opts.Logger.Error(err, "unable to list cached blobs")
+		return
+	}
+
+	var total int64
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+		infos = append(infos, info)
+	}
+	c.stats.setSize(total)
+	if c.opts.MaxBytes <= 0 {
+		return
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	for _, info := range infos {
+		if total <= c.opts.MaxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+			c.opts.Logger.Error(err, "unable to evict blob", "blob", info.Name())
+			continue
+		}
+		c.opts.Logger.Info("evicted blob", "blob", info.Name(), "size", info.Size())
+		total -= info.Size()
+	}
+	c.stats.setSize(total)
+}
+
+func (c *Cache) startFetch(hexDigest string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fetching[hexDigest] {
+		return false
+	}
+	c.fetching[hexDigest] = true
+	return true
+}
+
+func (c *Cache) endFetch(hexDigest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.fetching, hexDigest)
+}
+
+func (c *Cache) blobFile(hexDigest string) string {
+	return filepath.Join(c.opts.Dir, "blobs", "sha256-"+hexDigest)
+}
+
+// upstream sends a request to the upstream registry, forwarding the headers the registry API
+// depends on. Redirects to the blob storage of the registry are followed.
+func (c *Cache) upstream(ctx context.Context, method, path string, header http.Header) (*http.Response, error) {
+	target := c.opts.Upstream.JoinPath(path)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"Accept", "Range", "User-Agent"} {
+		if value := header.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	return c.opts.Client.Do(req)
+}
+
+// maxManifestSize bounds the manifests read from upstream, they are a few KB.
+const maxManifestSize = 4 << 20
+
+func serveManifest(w http.ResponseWriter, req *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Docker-Content-Digest", "sha256:"+hex.EncodeToString(sum[:]))
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// copyResponse copies an upstream response and returns the number of body bytes copied.
+func copyResponse(w http.ResponseWriter, resp *http.Response) int64 {
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	n, _ := io.Copy(w, resp.Body)
+	return n
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// countingWriter counts the body bytes written to a response.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// writeError replies with the error body of the registry API.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_")), "message": message}},
+	})
+}
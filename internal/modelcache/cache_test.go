@@ -0,0 +1,178 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestCache(t *testing.T) {
+	blob := []byte(strings.Repeat("gguf", 1024))
+	sum := sha256.Sum256(blob)
+	digest := hex.EncodeToString(sum[:])
+	manifest := `{"layers":[{"digest":"sha256:` + digest + `"}]}`
+
+	var blobRequests atomic.Int32
+	var down atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/library/llama3/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			_, _ = w.Write([]byte(manifest))
+		case "/v2/library/llama3/blobs/sha256:" + digest:
+			blobRequests.Add(1)
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(blob)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	dir := t.TempDir()
+	cache, err := New(Options{Upstream: upstreamURL, Dir: dir, Logger: logr.Discard()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(cache)
+	defer server.Close()
+
+	get := func(path string, header map[string]string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/v2/library/llama3/manifests/latest", nil); code != http.StatusOK || body != manifest {
+		t.Fatalf("manifest: got %d %q", code, body)
+	}
+	if code, _ := get("/v2/library/llama3/manifests/missing", nil); code != http.StatusNotFound {
+		t.Errorf("missing tag: got %d, want 404", code)
+	}
+
+	blobPath := "/v2/library/llama3/blobs/sha256:" + digest
+	if code, body := get(blobPath, nil); code != http.StatusOK || body != string(blob) {
+		t.Fatalf("blob miss: got %d, %d bytes", code, len(body))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "sha256-"+digest)); err != nil {
+		t.Fatalf("blob was not cached: %v", err)
+	}
+
+	if code, body := get(blobPath, nil); code != http.StatusOK || body != string(blob) {
+		t.Fatalf("blob hit: got %d, %d bytes", code, len(body))
+	}
+	if code, body := get(blobPath, map[string]string{"Range": "bytes=0-3"}); code != http.StatusPartialContent || body != "gguf" {
+		t.Fatalf("blob range hit: got %d %q", code, body)
+	}
+	if n := blobRequests.Load(); n != 1 {
+		t.Errorf("upstream blob requests: got %d, want 1", n)
+	}
+
+	// A stale manifest is better than a failed pull while the registry is down.
+	down.Store(true)
+	if code, body := get("/v2/library/llama3/manifests/latest", nil); code != http.StatusOK || body != manifest {
+		t.Errorf("manifest with upstream down: got %d %q", code, body)
+	}
+
+	report := cache.Stats().Report()
+	want := Report{Hits: 2, Misses: 1, BytesSaved: int64(len(blob)) + 4, BytesUpstream: int64(len(blob)), CachedBytes: int64(len(blob))}
+	if report != want {
+		t.Errorf("report: got %+v, want %+v", report, want)
+	}
+	if ratio := report.HitRatio(); ratio < 0.66 || ratio > 0.67 {
+		t.Errorf("hit ratio: got %f", ratio)
+	}
+}
+
+func TestCacheRejectsCorruptedBlob(t *testing.T) {
+	digest := strings.Repeat("0", 64)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not the blob"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	dir := t.TempDir()
+	cache, err := New(Options{Upstream: upstreamURL, Dir: dir, Logger: logr.Discard()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/library/llama3/blobs/sha256:"+digest, nil)
+	cache.ServeHTTP(httptest.NewRecorder(), req)
+
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "sha256-"+digest)); !os.IsNotExist(err) {
+		t.Errorf("corrupted blob was cached: %v", err)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := New(Options{Upstream: &url.URL{}, Dir: dir, MaxBytes: 10, Logger: logr.Discard()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, recent := cache.blobFile("old"), cache.blobFile("recent")
+	for i, path := range []string{old, recent} {
+		if err := os.WriteFile(path, []byte("123456"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(time.Duration(i-2) * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache.evict()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("oldest blob was not evicted: %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("recent blob was evicted: %v", err)
+	}
+	if size := cache.Stats().Report().CachedBytes; size != 6 {
+		t.Errorf("cached bytes: got %d, want 6", size)
+	}
+}
@@ -0,0 +1,3 @@
+// Package modelcache provides the pull-through cache of a model registry shared by the
+// workspace Ollama instances, so a model is downloaded once per cluster.
+package modelcache
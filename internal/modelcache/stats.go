@@ -0,0 +1,126 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatsPath serves the Report of the cache, read by the operator.
+const StatsPath = "/stats"
+
+// Report is the body served on StatsPath.
+type Report struct {
+	// Hits and Misses count the blob requests served from the cache and from upstream.
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+
+	// BytesSaved is the size of the blobs served from the cache, the bytes not downloaded again
+	// from upstream.
+	BytesSaved int64 `json:"bytesSaved"`
+
+	// BytesUpstream is the size of the blobs downloaded from upstream.
+	BytesUpstream int64 `json:"bytesUpstream"`
+
+	// CachedBytes is the size of the cached blobs, as of the last blob stored.
+	CachedBytes int64 `json:"cachedBytes"`
+}
+
+// HitRatio returns the share of the blob requests served from the cache.
+func (r Report) HitRatio() float64 {
+	if r.Hits+r.Misses == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Hits+r.Misses)
+}
+
+// Stats counts the requests served by the cache. It is a prometheus.Collector.
+type Stats struct {
+	hits          atomic.Int64
+	misses        atomic.Int64
+	bytesSaved    atomic.Int64
+	bytesUpstream atomic.Int64
+	cachedBytes   atomic.Int64
+}
+
+var (
+	requestsDesc = prometheus.NewDesc("modelcache_blob_requests_total",
+		"Blob requests by result, hit when served from the cache.", []string{"result"}, nil)
+	bytesSavedDesc = prometheus.NewDesc("modelcache_bytes_saved_total",
+		"Bytes of blobs served from the cache instead of upstream.", nil, nil)
+	bytesUpstreamDesc = prometheus.NewDesc("modelcache_bytes_upstream_total",
+		"Bytes of blobs downloaded from upstream.", nil, nil)
+	cachedBytesDesc = prometheus.NewDesc("modelcache_cached_bytes",
+		"Bytes of the cached blobs.", nil, nil)
+)
+
+func (s *Stats) hit(n int64) {
+	s.hits.Add(1)
+	s.bytesSaved.Add(n)
+}
+
+func (s *Stats) miss(n int64) {
+	s.misses.Add(1)
+	s.bytesUpstream.Add(n)
+}
+
+func (s *Stats) upstream(n int64) {
+	s.bytesUpstream.Add(n)
+}
+
+func (s *Stats) setSize(n int64) {
+	s.cachedBytes.Store(n)
+}
+
+// Report returns the current counters.
+func (s *Stats) Report() Report {
+	return Report{
+		Hits:          s.hits.Load(),
+		Misses:        s.misses.Load(),
+		BytesSaved:    s.bytesSaved.Load(),
+		BytesUpstream: s.bytesUpstream.Load(),
+		CachedBytes:   s.cachedBytes.Load(),
+	}
+}
+
+// ServeStats writes the Report as JSON.
+func (s *Stats) ServeStats(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Report())
+}
+
+// Describe implements prometheus.Collector.
+func (s *Stats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- requestsDesc
+	ch <- bytesSavedDesc
+	ch <- bytesUpstreamDesc
+	ch <- cachedBytesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *Stats) Collect(ch chan<- prometheus.Metric) {
+	r := s.Report()
+	ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, float64(r.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, float64(r.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(bytesSavedDesc, prometheus.CounterValue, float64(r.BytesSaved))
+	ch <- prometheus.MustNewConstMetric(bytesUpstreamDesc, prometheus.CounterValue, float64(r.BytesUpstream))
+	ch <- prometheus.MustNewConstMetric(cachedBytesDesc, prometheus.GaugeValue, float64(r.CachedBytes))
+}
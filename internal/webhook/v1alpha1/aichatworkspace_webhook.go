@@ -0,0 +1,216 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+	"github.com/chaunceyt/aichat-workspace-operator/internal/constants"
+)
+
+// log is for logging in this package.
+var aichatworkspacelog = logf.Log.WithName("aichatworkspace-resource")
+
+// SetupAIChatWorkspaceWebhookWithManager registers the webhook for AIChatWorkspace in the manager.
+func SetupAIChatWorkspaceWebhookWithManager(mgr ctrl.Manager, managerServiceAccount string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&appsv1alpha1.AIChatWorkspace{}).
+		WithValidator(&AIChatWorkspaceCustomValidator{ManagerServiceAccount: managerServiceAccount}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-apps-aichatworkspaces-io-v1alpha1-aichatworkspace,mutating=false,failurePolicy=fail,sideEffects=None,groups=apps.aichatworkspaces.io,resources=aichatworkspaces,verbs=create;update;delete,versions=v1alpha1,name=vaichatworkspace-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// AIChatWorkspaceCustomValidator stops the users who are not owners of an AIChatWorkspace from
+// changing or deleting it, once spec.owners is set. The owners can't change the fields reading
+// Secrets of the operator namespace, where those Secrets are sent, or the routes and the egress
+// of the workspace either, see protectedFieldChanges.
+//
+// The cluster admins (system:masters), the service accounts of kube-system, e.g. the namespace
+// controller deleting the namespace of an AIChatWorkspace, and the service account of the
+// operator, which removes the finalizer, are always allowed.
+type AIChatWorkspaceCustomValidator struct {
+	// ManagerServiceAccount is the username of the service account the operator runs as,
+	// system:serviceaccount:<namespace>:<name>.
+	ManagerServiceAccount string
+}
+
+var _ webhook.CustomValidator = &AIChatWorkspaceCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type AIChatWorkspace.
+func (v *AIChatWorkspaceCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	aichatworkspace, ok := obj.(*appsv1alpha1.AIChatWorkspace)
+	if !ok {
+		return nil, fmt.Errorf("expected an AIChatWorkspace object but got %T", obj)
+	}
+	if aichatworkspace.Spec.Owners == nil {
+		return nil, nil
+	}
+
+	// the creator may not be an owner, e.g. a platform team creating the workspaces of the teams.
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !aichatworkspace.Spec.Owners.Includes(req.UserInfo.Username, req.UserInfo.Groups) && !v.isPrivileged(req) {
+		return admission.Warnings{fmt.Sprintf("%s is not an owner of %s and won't be able to change it", req.UserInfo.Username, aichatworkspace.GetName())}, nil
+	}
+	return nil, nil
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type AIChatWorkspace.
+func (v *AIChatWorkspaceCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	aichatworkspace, ok := oldObj.(*appsv1alpha1.AIChatWorkspace)
+	if !ok {
+		return nil, fmt.Errorf("expected an AIChatWorkspace object for the oldObj but got %T", oldObj)
+	}
+	updated, ok := newObj.(*appsv1alpha1.AIChatWorkspace)
+	if !ok {
+		return nil, fmt.Errorf("expected an AIChatWorkspace object for the newObj but got %T", newObj)
+	}
+	if err := v.validateOwner(ctx, aichatworkspace, "change"); err != nil {
+		return nil, err
+	}
+	return nil, v.validateProtectedFields(ctx, aichatworkspace, updated)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type AIChatWorkspace.
+func (v *AIChatWorkspaceCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	aichatworkspace, ok := obj.(*appsv1alpha1.AIChatWorkspace)
+	if !ok {
+		return nil, fmt.Errorf("expected an AIChatWorkspace object but got %T", obj)
+	}
+	return nil, v.validateOwner(ctx, aichatworkspace, "delete")
+}
+
+// validateOwner returns an error when the user of the request is not an owner of the workspace.
+// The owners are read from the stored object, an update can't make its own user an owner.
+func (v *AIChatWorkspaceCustomValidator) validateOwner(ctx context.Context, aichatworkspace *appsv1alpha1.AIChatWorkspace, verb string) error {
+	if aichatworkspace.Spec.Owners == nil {
+		return nil
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if aichatworkspace.Spec.Owners.Includes(req.UserInfo.Username, req.UserInfo.Groups) || v.isPrivileged(req) {
+		return nil
+	}
+
+	aichatworkspacelog.Info("Denied a change by a non-owner", "name", aichatworkspace.GetName(), "namespace", aichatworkspace.GetNamespace(), "user", req.UserInfo.Username)
+	return fmt.Errorf("%s is not an owner of the AIChatWorkspace %s and can't %s it", req.UserInfo.Username, aichatworkspace.GetName(), verb)
+}
+
+// validateProtectedFields returns an error when a user who isn't privileged changes a protected
+// field of a workspace with owners. Without owners, only the users allowed by the RBAC of the
+// operator namespace edit the workspace.
+func (v *AIChatWorkspaceCustomValidator) validateProtectedFields(ctx context.Context, old, updated *appsv1alpha1.AIChatWorkspace) error {
+	if old.Spec.Owners == nil {
+		return nil
+	}
+	changed := protectedFieldChanges(old, updated)
+	if len(changed) == 0 {
+		return nil
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if v.isPrivileged(req) {
+		return nil
+	}
+
+	aichatworkspacelog.Info("Denied a change of protected fields", "name", old.GetName(), "namespace", old.GetNamespace(), "user", req.UserInfo.Username, "fields", changed)
+	return fmt.Errorf("%s can't change %s of the AIChatWorkspace %s, only a cluster admin can", req.UserInfo.Username, strings.Join(changed, ", "), old.GetName())
+}
+
+// protectedFieldChanges returns the paths of the protected fields an update changes: the Secrets
+// read from the namespace of the AIChatWorkspace, shared with the operator, with the URLs their
+// content is sent to, and the overrides of the domain, the Ingress annotations and the egress.
+func protectedFieldChanges(old, updated *appsv1alpha1.AIChatWorkspace) []string {
+	var changed []string
+
+	previous := map[string]appsv1alpha1.ProviderSpec{}
+	for _, provider := range old.Spec.Providers {
+		previous[provider.Name] = provider
+	}
+	for i, provider := range updated.Spec.Providers {
+		// the API key is sent to the base URL, a new key or a new URL for a key is protected.
+		before, ok := previous[provider.Name]
+		if provider.SecretName != "" && (!ok || before.SecretName != provider.SecretName || before.BaseURL != provider.BaseURL) {
+			changed = append(changed, fmt.Sprintf("spec.providers[%d].secretName", i))
+		}
+	}
+
+	for _, key := range []string{constants.DefaultDomain, constants.IngressAnnotations, constants.HTTPSProxy, constants.CABundle} {
+		if old.Spec.Overrides[key] != updated.Spec.Overrides[key] {
+			changed = append(changed, "spec.overrides."+key)
+		}
+	}
+	if apiAuthSecretName(old) != apiAuthSecretName(updated) {
+		changed = append(changed, "spec.api.auth.secretName")
+	}
+	if adminSecretName(old) != adminSecretName(updated) {
+		changed = append(changed, "spec.bootstrap.adminSecretName")
+	}
+	// the client secret is sent to the issuer.
+	if oldOIDC, newOIDC := oidcSpec(old), oidcSpec(updated); newOIDC.ClientSecretName != "" &&
+		(oldOIDC.ClientSecretName != newOIDC.ClientSecretName || oldOIDC.Issuer != newOIDC.Issuer) {
+		changed = append(changed, "spec.auth.oidc.clientSecretName")
+	}
+	return changed
+}
+
+func apiAuthSecretName(aichatworkspace *appsv1alpha1.AIChatWorkspace) string {
+	if aichatworkspace.Spec.API == nil || aichatworkspace.Spec.API.Auth == nil {
+		return ""
+	}
+	return aichatworkspace.Spec.API.Auth.SecretName
+}
+
+func adminSecretName(aichatworkspace *appsv1alpha1.AIChatWorkspace) string {
+	if aichatworkspace.Spec.Bootstrap == nil {
+		return ""
+	}
+	return aichatworkspace.Spec.Bootstrap.AdminSecretName
+}
+
+func oidcSpec(aichatworkspace *appsv1alpha1.AIChatWorkspace) appsv1alpha1.OIDCSpec {
+	if aichatworkspace.Spec.Auth == nil || aichatworkspace.Spec.Auth.OIDC == nil {
+		return appsv1alpha1.OIDCSpec{}
+	}
+	return *aichatworkspace.Spec.Auth.OIDC
+}
+
+// isPrivileged returns whether the user of the request is always allowed, see AIChatWorkspaceCustomValidator.
+func (v *AIChatWorkspaceCustomValidator) isPrivileged(req admission.Request) bool {
+	if v.ManagerServiceAccount != "" && req.UserInfo.Username == v.ManagerServiceAccount {
+		return true
+	}
+	return slices.ContainsFunc(req.UserInfo.Groups, func(group string) bool {
+		return group == "system:masters" || group == "system:serviceaccounts:kube-system"
+	})
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2024 AIChatWorkspace Contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appsv1alpha1 "github.com/chaunceyt/aichat-workspace-operator/api/v1alpha1"
+)
+
+func requestContext(username string, groups ...string) context.Context {
+	return admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UserInfo: authenticationv1.UserInfo{Username: username, Groups: groups},
+		},
+	})
+}
+
+func TestValidateOwners(t *testing.T) {
+	validator := &AIChatWorkspaceCustomValidator{ManagerServiceAccount: "system:serviceaccount:aichat-workspace-operator-system:controller-manager"}
+	owned := &appsv1alpha1.AIChatWorkspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "aichat-workspace-operator-system"},
+		Spec: appsv1alpha1.AIChatWorkspaceSpec{
+			WorkspaceName: "team-a",
+			Owners:        &appsv1alpha1.OwnersSpec{Users: []string{"alice"}, Groups: []string{"team-a"}},
+		},
+	}
+	unowned := owned.DeepCopy()
+	unowned.Spec.Owners = nil
+
+	for name, tc := range map[string]struct {
+		ctx     context.Context
+		old     *appsv1alpha1.AIChatWorkspace
+		allowed bool
+	}{
+		"owner user":         {ctx: requestContext("alice", "system:authenticated"), old: owned, allowed: true},
+		"owner group":        {ctx: requestContext("bob", "system:authenticated", "team-a"), old: owned, allowed: true},
+		"non-owner":          {ctx: requestContext("mallory", "system:authenticated", "team-b"), old: owned},
+		"no owners":          {ctx: requestContext("mallory", "system:authenticated"), old: unowned, allowed: true},
+		"cluster admin":      {ctx: requestContext("admin", "system:masters"), old: owned, allowed: true},
+		"operator":           {ctx: requestContext("system:serviceaccount:aichat-workspace-operator-system:controller-manager", "system:serviceaccounts:aichat-workspace-operator-system"), old: owned, allowed: true},
+		"namespace cleanup":  {ctx: requestContext("system:serviceaccount:kube-system:namespace-controller", "system:serviceaccounts:kube-system"), old: owned, allowed: true},
+		"other operator":     {ctx: requestContext("system:serviceaccount:team-b:default", "system:serviceaccounts:team-b"), old: owned},
+		"operator namespace": {ctx: requestContext("system:serviceaccount:aichat-workspace-operator-system:default", "system:serviceaccounts:aichat-workspace-operator-system"), old: owned},
+	} {
+		updated := tc.old.DeepCopy()
+		updated.Spec.Owners = &appsv1alpha1.OwnersSpec{Users: []string{"mallory"}}
+
+		if _, err := validator.ValidateUpdate(tc.ctx, tc.old, updated); tc.allowed != (err == nil) {
+			t.Errorf("%s: ValidateUpdate() = %v, want allowed %t", name, err, tc.allowed)
+		}
+		if _, err := validator.ValidateDelete(tc.ctx, tc.old); tc.allowed != (err == nil) {
+			t.Errorf("%s: ValidateDelete() = %v, want allowed %t", name, err, tc.allowed)
+		}
+	}
+
+	// a workspace can be created for other owners, with a warning.
+	warnings, err := validator.ValidateCreate(requestContext("platform", "system:authenticated"), owned)
+	if err != nil || len(warnings) != 1 {
+		t.Errorf("ValidateCreate() = %v, %v, want a warning", warnings, err)
+	}
+	if warnings, err := validator.ValidateCreate(requestContext("alice"), owned); err != nil || len(warnings) != 0 {
+		t.Errorf("ValidateCreate() by an owner = %v, %v, want no warning", warnings, err)
+	}
+}
+
+func TestValidateProtectedFields(t *testing.T) {
+	validator := &AIChatWorkspaceCustomValidator{ManagerServiceAccount: "system:serviceaccount:aichat-workspace-operator-system:controller-manager"}
+	owned := &appsv1alpha1.AIChatWorkspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "aichat-workspace-operator-system"},
+		Spec: appsv1alpha1.AIChatWorkspaceSpec{
+			WorkspaceName: "team-a",
+			Owners:        &appsv1alpha1.OwnersSpec{Users: []string{"alice"}},
+			Providers:     []appsv1alpha1.ProviderSpec{{Name: "openai", BaseURL: "https://api.openai.com/v1", SecretName: "team-a-openai"}},
+			Overrides:     map[string]string{"defaultDomain": "team-a.example.com"},
+			API:           &appsv1alpha1.APISpec{Auth: &appsv1alpha1.APIAuthSpec{SecretName: "team-a-api"}},
+			Bootstrap:     &appsv1alpha1.BootstrapSpec{AdminSecretName: "team-a-admin"},
+		},
+	}
+	unowned := owned.DeepCopy()
+	unowned.Spec.Owners = nil
+
+	for name, tc := range map[string]struct {
+		old    *appsv1alpha1.AIChatWorkspace
+		update func(*appsv1alpha1.AIChatWorkspace)
+		field  string
+	}{
+		"provider secret": {old: owned, field: "spec.providers[0].secretName", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Providers[0].SecretName = "aichat-workspace-operator-webhook-server-cert"
+		}},
+		"provider URL of a secret": {old: owned, field: "spec.providers[0].secretName", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Providers[0].BaseURL = "https://attacker.example.com/v1"
+		}},
+		"new provider with a secret": {old: owned, field: "spec.providers[1].secretName", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Providers = append(ws.Spec.Providers, appsv1alpha1.ProviderSpec{Name: "azure", BaseURL: "https://azure.example.com/v1", SecretName: "team-a-openai"})
+		}},
+		"default domain": {old: owned, field: "spec.overrides.defaultDomain", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Overrides["defaultDomain"] = "team-b.example.com"
+		}},
+		"ingress annotations": {old: owned, field: "spec.overrides.ingressAnnotations", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Overrides["ingressAnnotations"] = `{"nginx.ingress.kubernetes.io/server-snippet":"return 200;"}`
+		}},
+		"https proxy": {old: owned, field: "spec.overrides.httpsProxy", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Overrides["httpsProxy"] = "http://proxy.attacker.example.com:3128"
+		}},
+		"ca bundle": {old: owned, field: "spec.overrides.caBundle", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Overrides["caBundle"] = "-----BEGIN CERTIFICATE-----"
+		}},
+		"api auth secret": {old: owned, field: "spec.api.auth.secretName", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.API.Auth.SecretName = "team-b-api"
+		}},
+		"admin secret": {old: owned, field: "spec.bootstrap.adminSecretName", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Bootstrap.AdminSecretName = "team-b-admin"
+		}},
+		"oidc client secret": {old: owned, field: "spec.auth.oidc.clientSecretName", update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Auth = &appsv1alpha1.AuthSpec{OIDC: &appsv1alpha1.OIDCSpec{Issuer: "https://idp.example.com", ClientID: "webui", ClientSecretName: "team-a-oidc"}}
+		}},
+		"other fields": {old: owned, update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Models = []appsv1alpha1.ModelSpec{{Name: "llama3.2"}}
+			ws.Spec.Providers[0].Models = []string{"gpt-4o"}
+			ws.Spec.Providers = append(ws.Spec.Providers, appsv1alpha1.ProviderSpec{Name: "local", BaseURL: "http://vllm.team-a.svc/v1"})
+			ws.Spec.Overrides["openwebUIImageTag"] = "v0.6.0"
+		}},
+		"removed provider secret": {old: owned, update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Providers[0].SecretName = ""
+		}},
+		"without owners": {old: unowned, update: func(ws *appsv1alpha1.AIChatWorkspace) {
+			ws.Spec.Bootstrap.AdminSecretName = "team-b-admin"
+		}},
+	} {
+		updated := tc.old.DeepCopy()
+		tc.update(updated)
+
+		_, err := validator.ValidateUpdate(requestContext("alice", "system:authenticated"), tc.old, updated)
+		if tc.field == "" && err != nil {
+			t.Errorf("%s: ValidateUpdate() by an owner = %v, want allowed", name, err)
+		}
+		if tc.field != "" && (err == nil || !strings.Contains(err.Error(), tc.field)) {
+			t.Errorf("%s: ValidateUpdate() by an owner = %v, want %s denied", name, err, tc.field)
+		}
+
+		for user, groups := range map[string][]string{
+			"admin": {"system:masters"},
+			"system:serviceaccount:aichat-workspace-operator-system:controller-manager": {"system:serviceaccounts:aichat-workspace-operator-system"},
+		} {
+			if _, err := validator.ValidateUpdate(requestContext(user, groups...), tc.old, updated); err != nil {
+				t.Errorf("%s: ValidateUpdate() by %s = %v, want allowed", name, user, err)
+			}
+		}
+	}
+}